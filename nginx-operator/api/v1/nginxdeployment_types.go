@@ -1,32 +1,439 @@
 package v1
 
 import (
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Defaults applied by the defaulting webhook
+const (
+	DefaultImage    = "nginx:stable"
+	DefaultPort     = 80
+	DefaultReplicas = 1
+)
+
+// CanaryActionAnnotation requests an action on the running canary rollout, the operator removes it once handled
+const CanaryActionAnnotation = "web.example.com/canary-action"
+
+// Values of CanaryActionAnnotation
+const (
+	// CanaryActionPromote rolls the canary out to all replicas skipping the remaining steps
+	CanaryActionPromote = "promote"
+	// CanaryActionAbort removes the canary and keeps the stable version until the pod template changes again
+	CanaryActionAbort = "abort"
 )
 
 // NginxDeploymentSpec defines the desired state of NginxDeployment
 type NginxDeploymentSpec struct {
-	// Number of nginx replicas
-	Replicas int32 `json:"replicas"`
+	// Number of nginx replicas, initial number of replicas when autoscaling is enabled.
+	// Defaults to 1 or to minReplicas of autoscaling.
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Port for nginx container, ignored when ports are set, defaults to 80
+	Port int32 `json:"port,omitempty"`
+
+	// Named ports of nginx container, the first one is used by probes and Ingress.
+	// The https name is reserved when TLS is enabled.
+	// +listType=map
+	// +listMapKey=name
+	Ports []NginxPort `json:"ports,omitempty"`
+
+	// Docker image for nginx, defaults to nginx:stable
+	Image string `json:"image,omitempty"`
+
+	// Labels added to the Deployment, its pods and the Service
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Labels added to nginx pods
+	PodLabels map[string]string `json:"podLabels,omitempty"`
+
+	// Annotations added to nginx pods
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+
+	// Annotations added to the Service
+	ServiceAnnotations map[string]string `json:"serviceAnnotations,omitempty"`
+
+	// Type and options of the Service, ClusterIP by default
+	Service *NginxServiceSpec `json:"service,omitempty"`
+
+	// Resource requests and limits for nginx container
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Node labels nginx pods must be scheduled onto
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Scheduling constraints of nginx pods
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// Tolerations of nginx pods
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Init containers run before nginx starts, e.g. to fetch content into a shared volume
+	InitContainers []corev1.Container `json:"initContainers,omitempty"`
+
+	// Additional volumes of nginx pods shared with init containers, config, tls and content names are reserved
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+
+	// Additional volume mounts of nginx container, e.g. an emptyDir filled by init containers at the web root
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+
+	// Liveness probe of nginx container, GET / on the first port by default
+	LivenessProbe *NginxProbeSpec `json:"livenessProbe,omitempty"`
+
+	// Readiness probe of nginx container, GET / on the first port by default
+	ReadinessProbe *NginxProbeSpec `json:"readinessProbe,omitempty"`
+
+	// Ingress exposing the nginx Service, no Ingress is created when empty
+	Ingress *NginxIngressSpec `json:"ingress,omitempty"`
+
+	// HTTPS served by nginx with a certificate issued by cert-manager
+	TLS *NginxTLSSpec `json:"tls,omitempty"`
+
+	// Custom nginx configuration, changes roll out the Deployment
+	Config *NginxConfigSpec `json:"config,omitempty"`
+
+	// Static content served from a ConfigMap mounted at the web root
+	Content *NginxContentSpec `json:"content,omitempty"`
+
+	// NetworkPolicy allowing ingress traffic to nginx only on the declared ports
+	NetworkPolicy *NginxNetworkPolicySpec `json:"networkPolicy,omitempty"`
+
+	// PodDisruptionBudget of nginx pods, no budget is created when empty
+	PDB *NginxPDBSpec `json:"pdb,omitempty"`
+
+	// Prometheus metrics exported by nginx-prometheus-exporter sidecar
+	Metrics *NginxMetricsSpec `json:"metrics,omitempty"`
+
+	// Horizontal autoscaling of nginx, replicas are managed by HorizontalPodAutoscaler when set
+	Autoscaling *NginxAutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// Rollout strategy of pod template changes, the Deployment rolling update is used when empty
+	Strategy *NginxStrategySpec `json:"strategy,omitempty"`
+}
+
+// NginxIngressSpec defines the Ingress created for NginxDeployment
+type NginxIngressSpec struct {
+	// Host name routed to nginx
+	Host string `json:"host"`
+
+	// Path routed to nginx, defaults to /
+	Path string `json:"path,omitempty"`
+
+	// Name of the IngressClass, the cluster default is used when empty
+	ClassName string `json:"className,omitempty"`
+
+	// Name of the Secret with TLS certificate for the host, TLS is disabled when empty
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+}
+
+// NginxPort defines a port of nginx container and the matching Service port
+type NginxPort struct {
+	// Name of the port
+	Name string `json:"name"`
+
+	// Port of nginx container
+	ContainerPort int32 `json:"containerPort"`
+
+	// Port of the Service, defaults to containerPort
+	ServicePort int32 `json:"servicePort,omitempty"`
+
+	// Protocol of the port, defaults to TCP
+	// +kubebuilder:validation:Enum=TCP;UDP;SCTP
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+}
+
+// NginxProbeSpec defines an HTTP probe of nginx container
+type NginxProbeSpec struct {
+	// Disable the probe
+	Disabled bool `json:"disabled,omitempty"`
+
+	// HTTP path, defaults to /
+	Path string `json:"path,omitempty"`
+
+	// Name or number of the port, defaults to the first port
+	Port *intstr.IntOrString `json:"port,omitempty"`
+
+	// Seconds after the container started before the probe is initiated
+	// +kubebuilder:validation:Minimum=0
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+
+	// How often to perform the probe, defaults to 10 seconds
+	// +kubebuilder:validation:Minimum=1
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+
+	// Seconds after which the probe times out, defaults to 5 seconds
+	// +kubebuilder:validation:Minimum=1
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+	// Consecutive successes for the probe to be considered successful, defaults to 1.
+	// Must be 1 for liveness probe.
+	// +kubebuilder:validation:Minimum=1
+	SuccessThreshold int32 `json:"successThreshold,omitempty"`
+
+	// Consecutive failures for the probe to be considered failed, defaults to 3
+	// +kubebuilder:validation:Minimum=1
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// NginxServiceSpec defines the Service exposing nginx
+type NginxServiceSpec struct {
+	// Type of the Service, defaults to ClusterIP
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// Node port for the first port with NodePort and LoadBalancer types, allocated by the cluster when empty
+	NodePort int32 `json:"nodePort,omitempty"`
+
+	// IP address requested from the load balancer
+	LoadBalancerIP string `json:"loadBalancerIP,omitempty"`
+
+	// Class of the load balancer implementation, cannot be changed after the Service is created
+	LoadBalancerClass *string `json:"loadBalancerClass,omitempty"`
+
+	// Annotations added to the Service, e.g. cloud load balancer options; override serviceAnnotations
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// NginxConfigSpec defines nginx configuration files
+type NginxConfigSpec struct {
+	// Complete nginx.conf replacing the one from the image
+	NginxConf string `json:"nginxConf,omitempty"`
 
-	// Port for nginx container
+	// Files included from /etc/nginx/conf.d keyed by file name, e.g. default.conf replaces
+	// the default server. nginx.conf, tls.conf with TLS and metrics.conf with metrics enabled are reserved.
+	Snippets map[string]string `json:"snippets,omitempty"`
+}
+
+// NginxContentSpec defines static content served by nginx. Files are mounted under /usr/share/nginx/html
+// replacing the default page, changes of the ConfigMap are picked up without a rollout.
+type NginxContentSpec struct {
+	// ConfigMap with the files in the namespace of NginxDeployment
+	ConfigMapRef corev1.LocalObjectReference `json:"configMapRef"`
+
+	// Directory under the web root the files are mounted to, e.g. static
+	SubPath string `json:"subPath,omitempty"`
+
+	// Keys of the ConfigMap mapped to relative file paths, e.g. css/site.css, every key is mounted by its name when empty
+	Items []corev1.KeyToPath `json:"items,omitempty"`
+}
+
+// NginxTLSSpec defines the cert-manager Certificate used by nginx
+type NginxTLSSpec struct {
+	// cert-manager Issuer or ClusterIssuer signing the certificate
+	IssuerRef NginxIssuerRef `json:"issuerRef"`
+
+	// DNS names of the certificate, defaults to the Ingress host or the Service name
+	DNSNames []string `json:"dnsNames,omitempty"`
+
+	// Port for HTTPS, defaults to 443
 	Port int32 `json:"port,omitempty"`
+}
+
+// NginxIssuerRef references a cert-manager issuer
+type NginxIssuerRef struct {
+	// Name of the issuer
+	Name string `json:"name"`
+
+	// Kind of the issuer, defaults to Issuer
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	Kind string `json:"kind,omitempty"`
+}
+
+// NginxNetworkPolicySpec defines the NetworkPolicy created for NginxDeployment
+type NginxNetworkPolicySpec struct {
+	// Create the NetworkPolicy
+	Enabled bool `json:"enabled"`
+
+	// Namespaces, pods and IP blocks allowed to connect, traffic from anywhere is allowed when empty
+	From []networkingv1.NetworkPolicyPeer `json:"from,omitempty"`
+}
 
-	// Docker image for nginx
+// NginxPDBSpec defines the PodDisruptionBudget created for NginxDeployment
+// +kubebuilder:validation:XValidation:rule="has(self.minAvailable) != has(self.maxUnavailable)",message="exactly one of minAvailable and maxUnavailable must be set"
+type NginxPDBSpec struct {
+	// Number or percentage of pods that must stay available during evictions
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// Number or percentage of pods that can be unavailable during evictions
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// NginxMetricsSpec defines the metrics exporter and its ServiceMonitor or PodMonitor
+type NginxMetricsSpec struct {
+	// Inject the exporter sidecar and create the monitor
+	Enabled bool `json:"enabled"`
+
+	// Image of nginx-prometheus-exporter
 	Image string `json:"image,omitempty"`
+
+	// Port of the exporter, defaults to 9113. The metrics name is reserved in ports.
+	Port int32 `json:"port,omitempty"`
+
+	// Scrape interval of the monitor, e.g. 30s, Prometheus default is used when empty
+	Interval string `json:"interval,omitempty"`
+}
+
+// NginxAutoscalingSpec defines the HorizontalPodAutoscaler created for NginxDeployment
+type NginxAutoscalingSpec struct {
+	// Lower limit for the number of replicas, defaults to 1
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// Upper limit for the number of replicas
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// Target average CPU utilization in percent of requests, defaults to 80 when no metrics are set
+	TargetCPUUtilization *int32 `json:"targetCPUUtilization,omitempty"`
+
+	// Additional metrics used for scaling
+	Metrics []autoscalingv2.MetricSpec `json:"metrics,omitempty"`
+}
+
+// NginxStrategySpec defines how changes of the pod template are rolled out
+// +kubebuilder:validation:XValidation:rule="!(has(self.canary) && has(self.blueGreen))",message="canary and blueGreen are mutually exclusive"
+type NginxStrategySpec struct {
+	// Canary rollout through a second Deployment receiving a share of the Service traffic
+	Canary *NginxCanarySpec `json:"canary,omitempty"`
+
+	// Blue-green rollout switching the Service to a second Deployment once it is available
+	BlueGreen *NginxBlueGreenSpec `json:"blueGreen,omitempty"`
 }
 
+// NginxCanarySpec defines the steps of canary rollout. While the canary runs, the Service of
+// NginxDeployment has no selector and the operator lists ready pods of both Deployments in its
+// EndpointSlices, the share of canary endpoints follows the weight. Requests through the Service,
+// directly or from any Ingress controller, are balanced across the endpoints. The canary pods are
+// also reachable through their own Service.
+type NginxCanarySpec struct {
+	// Steps run in order, the canary is promoted after the last one
+	// +kubebuilder:validation:MinItems=1
+	Steps []NginxCanaryStep `json:"steps"`
+}
+
+// NginxCanaryStep defines the share of traffic sent to the canary and how long it is kept
+type NginxCanaryStep struct {
+	// Percent of Service requests routed to the canary, its replicas are scaled to the same share
+	// of the stable ones rounded up. The weight is approximated by the share of endpoints,
+	// so its precision depends on the number of ready pods.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+
+	// Time to wait after the Service routes the weight to the canary, the rollout waits for promotion when empty
+	Pause *metav1.Duration `json:"pause,omitempty"`
+}
+
+// NginxBlueGreenSpec defines blue-green rollout. Changes are rolled out to the idle Deployment
+// and the Service selector is switched to it once all its replicas are available.
+type NginxBlueGreenSpec struct {
+	// How long the previous Deployment keeps running after the switch, defaults to 10m.
+	// Reverting the pod template within the window switches the Service back without a rollout.
+	RollbackWindow *metav1.Duration `json:"rollbackWindow,omitempty"`
+}
+
+// Condition types of NginxDeployment
+const (
+	// ConditionAvailable is True when all desired nginx replicas are available
+	ConditionAvailable = "Available"
+	// ConditionProgressing is True while changes are rolled out to nginx pods
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded is True when resources cannot be reconciled or the rollout is stuck
+	ConditionDegraded = "Degraded"
+	// ConditionConfigValid is False when nginx configuration is rejected and not rolled out
+	ConditionConfigValid = "ConfigValid"
+)
+
 // NginxDeploymentStatus defines the observed state of NginxDeployment
 type NginxDeploymentStatus struct {
 	// Number of available replicas
 	AvailableReplicas int32 `json:"availableReplicas"`
 
-	// Status message
-	Status string `json:"status,omitempty"`
+	// Generation of the spec reported by the status, it lags behind metadata.generation until the spec is reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions of NginxDeployment: Available, Progressing, Degraded and ConfigValid
+	//+listType=map
+	//+listMapKey=type
+	//+optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Status of the TLS certificate
+	Certificate string `json:"certificate,omitempty"`
+
+	// Canary rollout in progress or the aborted one
+	Canary *NginxCanaryStatus `json:"canary,omitempty"`
+
+	// Blue-green rollout state, the Service selects pods of the active color
+	BlueGreen *NginxBlueGreenStatus `json:"blueGreen,omitempty"`
+}
+
+// Colors of blue-green Deployments
+const (
+	// BlueGreenColorBlue is the color of the NAME-deployment Deployment
+	BlueGreenColorBlue = "blue"
+	// BlueGreenColorGreen is the color of the NAME-green Deployment
+	BlueGreenColorGreen = "green"
+)
+
+// NginxBlueGreenStatus defines the observed state of blue-green rollout
+type NginxBlueGreenStatus struct {
+	// Color of the Deployment selected by the Service: blue or green
+	ActiveColor string `json:"activeColor"`
+
+	// Hash of the pod template run by the active Deployment
+	ActiveRevision string `json:"activeRevision"`
+
+	// Hash of the pod template rolled out to the idle Deployment before the switch
+	PreviewRevision string `json:"previewRevision,omitempty"`
+
+	// Time the Service was switched, the previous Deployment runs until the rollback window ends
+	SwitchTime *metav1.Time `json:"switchTime,omitempty"`
+}
+
+// Phases of canary rollout
+const (
+	// CanaryPhaseProgressing is set while the canary waits for its replicas, its endpoints or the step pause
+	CanaryPhaseProgressing = "Progressing"
+	// CanaryPhasePaused is set when the step has no pause and the rollout waits for promotion
+	CanaryPhasePaused = "Paused"
+	// CanaryPhaseAborted is set when the canary is aborted and the stable version is kept
+	CanaryPhaseAborted = "Aborted"
+)
+
+// NginxCanaryStatus defines the observed state of canary rollout
+type NginxCanaryStatus struct {
+	// Phase of the rollout: Progressing, Paused or Aborted
+	Phase string `json:"phase"`
+
+	// Hash of the pod template run by the stable Deployment
+	StableRevision string `json:"stableRevision,omitempty"`
+
+	// Hash of the pod template run by the canary Deployment
+	CanaryRevision string `json:"canaryRevision"`
+
+	// Index of the current step
+	Step int32 `json:"step"`
+
+	// Percent of Service requests to be routed to the canary, it follows the step once the canary replicas are available
+	Weight int32 `json:"weight"`
+
+	// Percent of the Service endpoints serving the canary, it approximates weight as closely
+	// as the number of ready pods allows
+	EffectiveWeight int32 `json:"effectiveWeight,omitempty"`
+
+	// Time the Service started routing the weight of the current step to the canary
+	StepStartTime *metav1.Time `json:"stepStartTime,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Available",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].status`
+//+kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.status.availableReplicas`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // NginxDeployment is the Schema for the nginxdeployments API
 type NginxDeployment struct {
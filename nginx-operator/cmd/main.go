@@ -39,6 +39,7 @@ import (
 
 	webv1 "github.com/redbeardster/nginx-operator/api/v1"
 	"github.com/redbeardster/nginx-operator/internal/controller"
+	webhookwebv1 "github.com/redbeardster/nginx-operator/internal/webhook/v1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -203,12 +204,20 @@ func main() {
 	}
 
 	if err := (&controller.NginxDeploymentReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("nginxdeployment-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "NginxDeployment")
 		os.Exit(1)
 	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err := webhookwebv1.SetupNginxDeploymentWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "NginxDeployment")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if metricsCertWatcher != nil {
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webv1 "github.com/redbeardster/nginx-operator/api/v1"
+)
+
+// fieldManager owns the fields the operator sets with server-side apply
+const fieldManager = "nginx-operator"
+
+// apply creates or updates the resource of NginxDeployment with server-side apply.
+// The operator owns only fields set in obj, fields set by other controllers are kept
+// and conflicting fields are always taken over. obj is updated from the response,
+// creations and changes are recorded as events of NginxDeployment.
+func (r *NginxDeploymentReconciler) apply(ctx context.Context, nginxDeploy *webv1.NginxDeployment, obj client.Object) error {
+	log := log.FromContext(ctx)
+
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+
+	// Set controller reference
+	if err := ctrl.SetControllerReference(nginxDeploy, obj, r.Scheme); err != nil {
+		return err
+	}
+
+	// Compare resource versions to report what the apply changed
+	current := obj.DeepCopyObject().(client.Object)
+	err = r.Get(ctx, client.ObjectKeyFromObject(obj), current)
+	if err != nil && !errors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+		return err
+	}
+	exists := err == nil
+
+	if err := r.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		return err
+	}
+	switch {
+	case !exists:
+		log.Info("Created "+gvk.Kind, "name", obj.GetName())
+		r.Recorder.Eventf(nginxDeploy, corev1.EventTypeNormal, "Created", "Created %s %s", gvk.Kind, obj.GetName())
+	case obj.GetResourceVersion() != current.GetResourceVersion():
+		log.Info("Updated "+gvk.Kind, "name", obj.GetName())
+		r.Recorder.Eventf(nginxDeploy, corev1.EventTypeNormal, "Updated", "Updated %s %s", gvk.Kind, obj.GetName())
+	}
+	return nil
+}
+
+// deleteOwned deletes the named resource if it is controlled by NginxDeployment
+func (r *NginxDeploymentReconciler) deleteOwned(ctx context.Context, nginxDeploy *webv1.NginxDeployment, kind string, obj client.Object, name string) error {
+	log := log.FromContext(ctx)
+
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: nginxDeploy.Namespace}, obj)
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(obj, nginxDeploy) || !obj.GetDeletionTimestamp().IsZero() {
+		return nil
+	}
+	log.Info("Deleting "+kind, "name", name)
+	if err := r.Delete(ctx, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.Recorder.Eventf(nginxDeploy, corev1.EventTypeNormal, "Deleted", "Deleted %s %s", kind, name)
+	return nil
+}
@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webv1 "github.com/redbeardster/nginx-operator/api/v1"
+)
+
+const (
+	// Pod label of blue-green Deployments, the Service selects pods of the active color
+	colorLabel = "web.example.com/color"
+
+	defaultRollbackWindow = 10 * time.Minute
+)
+
+func blueGreenEnabled(nginxDeploy *webv1.NginxDeployment) bool {
+	return nginxDeploy.Spec.Strategy != nil && nginxDeploy.Spec.Strategy.BlueGreen != nil
+}
+
+func rollbackWindow(nginxDeploy *webv1.NginxDeployment) time.Duration {
+	if blueGreenEnabled(nginxDeploy) && nginxDeploy.Spec.Strategy.BlueGreen.RollbackWindow != nil {
+		return nginxDeploy.Spec.Strategy.BlueGreen.RollbackWindow.Duration
+	}
+	return defaultRollbackWindow
+}
+
+// colorDeploymentName returns the Deployment of the color, blue one is the Deployment of rolling update
+func colorDeploymentName(nginxDeploy *webv1.NginxDeployment, color string) string {
+	if color == webv1.BlueGreenColorGreen {
+		return nginxDeploy.Name + "-green"
+	}
+	return nginxDeploy.Name + "-deployment"
+}
+
+func otherColor(color string) string {
+	if color == webv1.BlueGreenColorGreen {
+		return webv1.BlueGreenColorBlue
+	}
+	return webv1.BlueGreenColorGreen
+}
+
+// activeDeploymentName returns the Deployment serving traffic of the Service
+func activeDeploymentName(nginxDeploy *webv1.NginxDeployment) string {
+	if blueGreen := nginxDeploy.Status.BlueGreen; blueGreen != nil {
+		return colorDeploymentName(nginxDeploy, blueGreen.ActiveColor)
+	}
+	return nginxDeploy.Name + "-deployment"
+}
+
+// serviceSelector returns labels of pods receiving traffic of the Service,
+// during canary rollout the operator lists its endpoints instead
+func serviceSelector(nginxDeploy *webv1.NginxDeployment) map[string]string {
+	if canaryActive(nginxDeploy) {
+		return nil
+	}
+	if blueGreen := nginxDeploy.Status.BlueGreen; blueGreen != nil {
+		return mergeMaps(selectorLabels(nginxDeploy), map[string]string{colorLabel: blueGreen.ActiveColor})
+	}
+	return selectorLabels(nginxDeploy)
+}
+
+// deploymentReady reports whether all replicas of the Deployment run its current template and are available
+func deploymentReady(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.Replicas == replicas &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.AvailableReplicas >= replicas
+}
+
+// colorDeployment returns the desired Deployment of the color
+func colorDeployment(nginxDeploy *webv1.NginxDeployment, deployment *appsv1.Deployment, color string) *appsv1.Deployment {
+	colored := deployment.DeepCopy()
+	colored.Name = colorDeploymentName(nginxDeploy, color)
+	// Selector of the blue Deployment is immutable and kept from rolling update
+	if color == webv1.BlueGreenColorGreen {
+		colored.Spec.Selector = &metav1.LabelSelector{
+			MatchLabels: mergeMaps(selectorLabels(nginxDeploy), map[string]string{colorLabel: color}),
+		}
+	}
+	colored.Spec.Template.Labels = mergeMaps(colored.Spec.Template.Labels, map[string]string{colorLabel: color})
+	return colored
+}
+
+// reconcileBlueGreen rolls out pod template changes to the idle Deployment and switches
+// the Service to it once all its replicas are available. The previous Deployment keeps
+// running during the rollback window, so reverting the change switches traffic back at once.
+func (r *NginxDeploymentReconciler) reconcileBlueGreen(ctx context.Context, nginxDeploy *webv1.NginxDeployment, deployment *appsv1.Deployment) error {
+	log := log.FromContext(ctx)
+
+	// Canary is removed when the strategy is changed
+	nginxDeploy.Status.Canary = nil
+	if err := r.deleteCanary(ctx, nginxDeploy); err != nil {
+		return err
+	}
+
+	// Pods of the existing Deployment are labelled blue before the Service selects the color
+	revision := deployment.Annotations[revisionAnnotation]
+	status := nginxDeploy.Status.BlueGreen
+	if status == nil {
+		blue := colorDeployment(nginxDeploy, deployment, webv1.BlueGreenColorBlue)
+		if err := r.apply(ctx, nginxDeploy, blue); err != nil {
+			return err
+		}
+		if deploymentReady(blue) {
+			nginxDeploy.Status.BlueGreen = &webv1.NginxBlueGreenStatus{
+				ActiveColor:    webv1.BlueGreenColorBlue,
+				ActiveRevision: revision,
+			}
+		}
+		return nil
+	}
+
+	active, idle := status.ActiveColor, otherColor(status.ActiveColor)
+	if revision == status.ActiveRevision {
+		status.PreviewRevision = ""
+		if err := r.apply(ctx, nginxDeploy, colorDeployment(nginxDeploy, deployment, active)); err != nil {
+			return err
+		}
+		return r.retireDeployment(ctx, nginxDeploy, idle)
+	}
+
+	// The idle Deployment is started with replicas of the active one, they are chosen by HorizontalPodAutoscaler
+	preview := colorDeployment(nginxDeploy, deployment, idle)
+	if nginxDeploy.Spec.Autoscaling != nil {
+		activeDeployment := &appsv1.Deployment{}
+		err := r.Get(ctx, types.NamespacedName{
+			Name:      colorDeploymentName(nginxDeploy, active),
+			Namespace: nginxDeploy.Namespace,
+		}, activeDeployment)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		preview.Spec.Replicas = activeDeployment.Spec.Replicas
+	}
+	if status.PreviewRevision != revision {
+		log.Info("Rolling out preview", "deployment", preview.Name, "revision", revision)
+		r.Recorder.Eventf(nginxDeploy, corev1.EventTypeNormal, "PreviewStarted", "Rolling out revision %s to %s Deployment %s",
+			revision, idle, preview.Name)
+		status.PreviewRevision = revision
+	}
+	if err := r.apply(ctx, nginxDeploy, preview); err != nil {
+		return err
+	}
+	if !deploymentReady(preview) {
+		return nil
+	}
+
+	// Service is reconciled after the Deployment and selects the new color in the same pass
+	log.Info("Switching Service", "from", active, "to", idle, "revision", revision)
+	r.Recorder.Eventf(nginxDeploy, corev1.EventTypeNormal, "Switched", "Switched Service from %s to %s Deployment %s",
+		active, idle, preview.Name)
+	now := metav1.Now()
+	nginxDeploy.Status.BlueGreen = &webv1.NginxBlueGreenStatus{
+		ActiveColor:    idle,
+		ActiveRevision: revision,
+		SwitchTime:     &now,
+	}
+	return nil
+}
+
+// retireDeployment scales the previous Deployment down once the rollback window ends
+func (r *NginxDeploymentReconciler) retireDeployment(ctx context.Context, nginxDeploy *webv1.NginxDeployment, color string) error {
+	status := nginxDeploy.Status.BlueGreen
+	if status.SwitchTime != nil && time.Since(status.SwitchTime.Time) < rollbackWindow(nginxDeploy) {
+		return nil
+	}
+	status.SwitchTime = nil
+
+	previous := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      colorDeploymentName(nginxDeploy, color),
+		Namespace: nginxDeploy.Namespace,
+	}, previous)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(previous, nginxDeploy) || (previous.Spec.Replicas != nil && *previous.Spec.Replicas == 0) {
+		return nil
+	}
+	r.Recorder.Eventf(nginxDeploy, corev1.EventTypeNormal, "ScalingDown", "Scaling down previous Deployment %s after the rollback window", previous.Name)
+	return r.scaleDeployment(ctx, previous, 0)
+}
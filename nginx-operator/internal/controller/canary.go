@@ -0,0 +1,444 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	webv1 "github.com/redbeardster/nginx-operator/api/v1"
+)
+
+const (
+	// Deployment annotation with hash of its pod template, canary rollout compares revisions by it
+	revisionAnnotation = "web.example.com/revision"
+
+	// Managers of EndpointSlices, the operator lists endpoints of the Service during canary rollout
+	endpointSliceManager           = "nginx-operator.web.example.com"
+	endpointSliceControllerManager = "endpointslice-controller.k8s.io"
+)
+
+// canaryName names the canary Deployment and Service, it is also the app label of canary pods,
+// so the Service of the stable version does not select them
+func canaryName(nginxDeploy *webv1.NginxDeployment) string {
+	return nginxDeploy.Name + "-canary"
+}
+
+func canarySelectorLabels(nginxDeploy *webv1.NginxDeployment) map[string]string {
+	return map[string]string{"app": canaryName(nginxDeploy)}
+}
+
+func canaryEnabled(nginxDeploy *webv1.NginxDeployment) bool {
+	return nginxDeploy.Spec.Strategy != nil && nginxDeploy.Spec.Strategy.Canary != nil
+}
+
+// canaryActive reports whether the canary Deployment serves traffic
+func canaryActive(nginxDeploy *webv1.NginxDeployment) bool {
+	return nginxDeploy.Status.Canary != nil && nginxDeploy.Status.Canary.Phase != webv1.CanaryPhaseAborted
+}
+
+// templateHash returns short hash of the pod template like pod-template-hash of ReplicaSets
+func templateHash(template *corev1.PodTemplateSpec) string {
+	// Typed pod templates always marshal
+	data, _ := json.Marshal(template)
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])[:10]
+}
+
+// canaryReplicas returns the number of canary replicas sized for the weight percent of total traffic,
+// any non-zero weight gets at least one replica
+func canaryReplicas(total, weight int32) int32 {
+	replicas := (total*weight + 99) / 100
+	if weight > 0 && replicas == 0 {
+		replicas = 1
+	}
+	return replicas
+}
+
+// applyStable rolls the pod template out to the stable Deployment and removes the canary
+// and green ones, the Service selects the stable pods again
+func (r *NginxDeploymentReconciler) applyStable(ctx context.Context, nginxDeploy *webv1.NginxDeployment, deployment *appsv1.Deployment) error {
+	nginxDeploy.Status.Canary = nil
+	nginxDeploy.Status.BlueGreen = nil
+	if err := r.apply(ctx, nginxDeploy, deployment); err != nil {
+		return err
+	}
+	if err := r.deleteCanary(ctx, nginxDeploy); err != nil {
+		return err
+	}
+	return r.deleteOwned(ctx, nginxDeploy, "Deployment", &appsv1.Deployment{},
+		colorDeploymentName(nginxDeploy, webv1.BlueGreenColorGreen))
+}
+
+// deleteCanary removes the canary Service and Deployment, the Service of NginxDeployment
+// stops listing canary pods as soon as it is reconciled without the canary
+func (r *NginxDeploymentReconciler) deleteCanary(ctx context.Context, nginxDeploy *webv1.NginxDeployment) error {
+	if err := r.deleteOwned(ctx, nginxDeploy, "Service", &corev1.Service{}, canaryName(nginxDeploy)); err != nil {
+		return err
+	}
+	return r.deleteOwned(ctx, nginxDeploy, "Deployment", &appsv1.Deployment{}, canaryName(nginxDeploy))
+}
+
+// reconcileCanary rolls out pod template changes through the canary Deployment.
+// The stable Deployment keeps the previous template and all its replicas until the canary
+// is promoted, the weight of the current step is routed by reconcileCanaryTraffic. The step
+// starts once the Service sends requests to the canary pods.
+func (r *NginxDeploymentReconciler) reconcileCanary(ctx context.Context, nginxDeploy *webv1.NginxDeployment, deployment *appsv1.Deployment) error {
+	log := log.FromContext(ctx)
+
+	stable := &appsv1.Deployment{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(deployment), stable)
+	if errors.IsNotFound(err) {
+		// The first version has nothing to be compared with
+		return r.applyStable(ctx, nginxDeploy, deployment)
+	} else if err != nil {
+		return err
+	}
+
+	// Deployments without revision were created by rolling update and are updated in place
+	revision, stableRevision := deployment.Annotations[revisionAnnotation], stable.Annotations[revisionAnnotation]
+	if stableRevision == "" || stableRevision == revision {
+		return r.applyStable(ctx, nginxDeploy, deployment)
+	}
+
+	action := nginxDeploy.Annotations[webv1.CanaryActionAnnotation]
+	if action != "" {
+		if err := r.clearCanaryAction(ctx, nginxDeploy); err != nil {
+			return err
+		}
+	}
+
+	status := nginxDeploy.Status.Canary
+	if status == nil || status.CanaryRevision != revision {
+		log.Info("Starting canary", "revision", revision, "stableRevision", stableRevision)
+		r.Recorder.Eventf(nginxDeploy, corev1.EventTypeNormal, "CanaryStarted", "Started canary of revision %s", revision)
+		status = &webv1.NginxCanaryStatus{
+			Phase:          webv1.CanaryPhaseProgressing,
+			StableRevision: stableRevision,
+			CanaryRevision: revision,
+		}
+		nginxDeploy.Status.Canary = status
+	}
+
+	steps := nginxDeploy.Spec.Strategy.Canary.Steps
+	switch action {
+	case "":
+	case webv1.CanaryActionPromote:
+		status.Step = int32(len(steps))
+	case webv1.CanaryActionAbort:
+		if status.Phase != webv1.CanaryPhaseAborted {
+			log.Info("Aborting canary", "revision", revision)
+			r.Recorder.Eventf(nginxDeploy, corev1.EventTypeWarning, "CanaryAborted", "Aborted canary of revision %s", revision)
+			status.Phase = webv1.CanaryPhaseAborted
+		}
+	default:
+		log.Info("Ignoring unknown canary action", "action", action)
+	}
+
+	// HorizontalPodAutoscaler scales the stable Deployment, the canary one is sized by its replicas
+	total := desiredReplicas(nginxDeploy)
+	if nginxDeploy.Spec.Autoscaling != nil && stable.Spec.Replicas != nil {
+		total = *stable.Spec.Replicas
+	}
+
+	// Aborted canary stays removed until the pod template changes again
+	if status.Phase == webv1.CanaryPhaseAborted {
+		status.Weight = 0
+		status.EffectiveWeight = 0
+		return r.deleteCanary(ctx, nginxDeploy)
+	}
+
+	if int(status.Step) >= len(steps) {
+		log.Info("Promoting canary", "revision", revision)
+		r.Recorder.Eventf(nginxDeploy, corev1.EventTypeNormal, "CanaryPromoted", "Promoted canary of revision %s", revision)
+		return r.applyStable(ctx, nginxDeploy, deployment)
+	}
+
+	step := steps[status.Step]
+	replicas := canaryReplicas(total, step.Weight)
+
+	canary := deployment.DeepCopy()
+	canary.Name = canaryName(nginxDeploy)
+	canary.Spec.Replicas = &replicas
+	canary.Spec.Selector = &metav1.LabelSelector{MatchLabels: canarySelectorLabels(nginxDeploy)}
+	canary.Spec.Template.Labels = mergeMaps(canary.Spec.Template.Labels, canarySelectorLabels(nginxDeploy))
+	if err := r.apply(ctx, nginxDeploy, canary); err != nil {
+		return err
+	}
+
+	// Weight of the step is routed once the canary replicas are available, until then the previous one is kept
+	if canary.Status.ObservedGeneration < canary.Generation || canary.Status.AvailableReplicas < replicas {
+		status.Phase = webv1.CanaryPhaseProgressing
+		status.StepStartTime = nil
+		return nil
+	}
+	status.Weight = step.Weight
+	if step.Weight > 0 && status.EffectiveWeight == 0 {
+		status.Phase = webv1.CanaryPhaseProgressing
+		status.StepStartTime = nil
+		return nil
+	}
+	if status.StepStartTime == nil {
+		now := metav1.Now()
+		status.StepStartTime = &now
+	}
+	if step.Pause == nil {
+		status.Phase = webv1.CanaryPhasePaused
+		return nil
+	}
+	status.Phase = webv1.CanaryPhaseProgressing
+	if time.Since(status.StepStartTime.Time) < step.Pause.Duration {
+		return nil
+	}
+
+	log.Info("Completed canary step", "step", status.Step, "weight", step.Weight)
+	r.Recorder.Eventf(nginxDeploy, corev1.EventTypeNormal, "CanaryStep", "Completed canary step %d of %d with weight %d%%",
+		status.Step+1, len(steps), step.Weight)
+	status.Step++
+	status.StepStartTime = nil
+	return nil
+}
+
+// scaleDeployment sets replicas of the Deployment without taking over its template
+func (r *NginxDeploymentReconciler) scaleDeployment(ctx context.Context, deployment *appsv1.Deployment, replicas int32) error {
+	log.FromContext(ctx).Info("Scaling Deployment", "name", deployment.Name, "replicas", replicas)
+	patch := client.MergeFrom(deployment.DeepCopy())
+	deployment.Spec.Replicas = &replicas
+	return r.Patch(ctx, deployment, patch, client.FieldOwner(fieldManager))
+}
+
+// clearCanaryAction removes the handled action, so it is not applied to the next canary
+func (r *NginxDeploymentReconciler) clearCanaryAction(ctx context.Context, nginxDeploy *webv1.NginxDeployment) error {
+	handled := nginxDeploy.DeepCopy()
+	patch := client.MergeFrom(handled.DeepCopy())
+	delete(handled.Annotations, webv1.CanaryActionAnnotation)
+	if err := r.Patch(ctx, handled, patch); err != nil {
+		return fmt.Errorf("failed to clear canary action: %w", err)
+	}
+	// Only metadata is taken from the response, the status reconciled so far is kept
+	nginxDeploy.Annotations = handled.Annotations
+	nginxDeploy.ResourceVersion = handled.ResourceVersion
+	return nil
+}
+
+// reconcileCanaryTraffic shifts requests of the Service of NginxDeployment to the canary. While the
+// canary is active the Service has no selector and the operator lists ready stable and canary pods
+// in its EndpointSlices, the share of canary endpoints is the closest one to the weight of the step.
+// Once the canary is gone the Service selects the stable pods again and EndpointSlices of the operator
+// are kept with all stable pods until the endpointslice controller lists them.
+func (r *NginxDeploymentReconciler) reconcileCanaryTraffic(ctx context.Context, nginxDeploy *webv1.NginxDeployment, tlsReady bool) error {
+	active := canaryActive(nginxDeploy)
+	if active {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      canaryName(nginxDeploy),
+				Namespace: nginxDeploy.Namespace,
+				Labels:    mergeMaps(nginxDeploy.Spec.Labels, selectorLabels(nginxDeploy)),
+			},
+			Spec: corev1.ServiceSpec{
+				Selector: canarySelectorLabels(nginxDeploy),
+				Ports:    nginxServicePorts(nginxDeploy, tlsReady),
+				Type:     corev1.ServiceTypeClusterIP,
+			},
+		}
+		if err := r.apply(ctx, nginxDeploy, service); err != nil {
+			return err
+		}
+	} else {
+		slices, err := r.listEndpointSlices(ctx, nginxDeploy, endpointSliceManager)
+		if err != nil || len(slices) == 0 {
+			return err
+		}
+		managed, err := r.listEndpointSlices(ctx, nginxDeploy, endpointSliceControllerManager)
+		if err != nil {
+			return err
+		}
+		if len(managed) > 0 {
+			for _, slice := range slices {
+				if err := r.deleteOwned(ctx, nginxDeploy, "EndpointSlice", &discoveryv1.EndpointSlice{}, slice.Name); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	stablePods, err := r.readyPods(ctx, nginxDeploy, selectorLabels(nginxDeploy))
+	if err != nil {
+		return err
+	}
+	var canaryPods []corev1.Pod
+	weight := int32(0)
+	if active {
+		if canaryPods, err = r.readyPods(ctx, nginxDeploy, canarySelectorLabels(nginxDeploy)); err != nil {
+			return err
+		}
+		weight = nginxDeploy.Status.Canary.Weight
+	}
+	canaryCount, stableCount := weightedEndpoints(len(canaryPods), len(stablePods), weight)
+	ports := nginxServicePorts(nginxDeploy, tlsReady)
+	if err := r.apply(ctx, nginxDeploy, endpointSlice(nginxDeploy, "stable", stablePods[:stableCount], ports)); err != nil {
+		return err
+	}
+	if err := r.apply(ctx, nginxDeploy, endpointSlice(nginxDeploy, "canary", canaryPods[:canaryCount], ports)); err != nil {
+		return err
+	}
+	if !active {
+		return nil
+	}
+	if canaryCount > 0 {
+		nginxDeploy.Status.Canary.EffectiveWeight = int32((100*canaryCount + (canaryCount+stableCount)/2) / (canaryCount + stableCount))
+	} else {
+		nginxDeploy.Status.Canary.EffectiveWeight = 0
+	}
+
+	// The endpointslice controller does not manage Services without selector, its EndpointSlices are stale
+	managed, err := r.listEndpointSlices(ctx, nginxDeploy, endpointSliceControllerManager)
+	if err != nil {
+		return err
+	}
+	for i := range managed {
+		log.FromContext(ctx).Info("Deleting EndpointSlice of the Service selector", "name", managed[i].Name)
+		if err := r.Delete(ctx, &managed[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// weightedEndpoints returns the numbers of canary and stable endpoints, out of the ready pods,
+// whose canary share is the closest to the weight. Ties are resolved to more endpoints.
+func weightedEndpoints(canary, stable int, weight int32) (int, int) {
+	switch {
+	case weight <= 0 || canary == 0:
+		return 0, stable
+	case weight >= 100 || stable == 0:
+		return canary, 0
+	}
+	bestCanary, bestStable, bestError := 0, stable, math.Inf(1)
+	for c := 1; c <= canary; c++ {
+		s := (c*int(100-weight) + int(weight)/2) / int(weight)
+		s = max(1, min(s, stable))
+		if e := math.Abs(float64(100*c)/float64(c+s) - float64(weight)); e <= bestError {
+			bestCanary, bestStable, bestError = c, s, e
+		}
+	}
+	return bestCanary, bestStable
+}
+
+// readyPods returns ready pods with the labels sorted by name, so the chosen endpoints are kept between passes
+func (r *NginxDeploymentReconciler) readyPods(ctx context.Context, nginxDeploy *webv1.NginxDeployment, labels map[string]string) ([]corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(nginxDeploy.Namespace), client.MatchingLabels(labels)); err != nil {
+		return nil, err
+	}
+	var ready []corev1.Pod
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil || pod.Status.PodIP == "" {
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+				ready = append(ready, pod)
+			}
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool { return ready[i].Name < ready[j].Name })
+	return ready, nil
+}
+
+// listEndpointSlices returns EndpointSlices of the Service of NginxDeployment with the manager
+func (r *NginxDeploymentReconciler) listEndpointSlices(ctx context.Context, nginxDeploy *webv1.NginxDeployment, manager string) ([]discoveryv1.EndpointSlice, error) {
+	slices := &discoveryv1.EndpointSliceList{}
+	if err := r.List(ctx, slices, client.InNamespace(nginxDeploy.Namespace), client.MatchingLabels{
+		discoveryv1.LabelServiceName: nginxDeploy.Name + "-service",
+		discoveryv1.LabelManagedBy:   manager,
+	}); err != nil {
+		return nil, err
+	}
+	return slices.Items, nil
+}
+
+// endpointSlice lists the pods of the track as endpoints of the Service of NginxDeployment.
+// Named target ports are resolved with the first pod, pods of one Deployment share the template.
+func endpointSlice(nginxDeploy *webv1.NginxDeployment, track string, pods []corev1.Pod, servicePorts []corev1.ServicePort) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginxDeploy.Name + "-service-" + track,
+			Namespace: nginxDeploy.Namespace,
+			Labels: mergeMaps(nginxDeploy.Spec.Labels, map[string]string{
+				discoveryv1.LabelServiceName: nginxDeploy.Name + "-service",
+				discoveryv1.LabelManagedBy:   endpointSliceManager,
+			}),
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   []discoveryv1.Endpoint{},
+	}
+	if len(pods) == 0 {
+		return slice
+	}
+	if net.ParseIP(pods[0].Status.PodIP).To4() == nil {
+		slice.AddressType = discoveryv1.AddressTypeIPv6
+	}
+	for _, servicePort := range servicePorts {
+		for _, container := range pods[0].Spec.Containers {
+			for _, containerPort := range container.Ports {
+				if containerPort.Name == servicePort.TargetPort.String() {
+					slice.Ports = append(slice.Ports, discoveryv1.EndpointPort{
+						Name:     ptr.To(servicePort.Name),
+						Port:     ptr.To(containerPort.ContainerPort),
+						Protocol: ptr.To(servicePort.Protocol),
+					})
+				}
+			}
+		}
+	}
+	for _, pod := range pods {
+		endpoint := discoveryv1.Endpoint{
+			Addresses:  []string{pod.Status.PodIP},
+			Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)},
+			TargetRef: &corev1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+				UID:       pod.UID,
+			},
+		}
+		if pod.Spec.NodeName != "" {
+			endpoint.NodeName = ptr.To(pod.Spec.NodeName)
+		}
+		slice.Endpoints = append(slice.Endpoints, endpoint)
+	}
+	return slice
+}
+
+// canaryPodRequests reconciles NginxDeployment with canary strategy when its pods change,
+// ready pods are the endpoints of its Service
+func (r *NginxDeploymentReconciler) canaryPodRequests(ctx context.Context, pod client.Object) []reconcile.Request {
+	name := pod.GetLabels()[instanceLabel]
+	if name == "" {
+		return nil
+	}
+	nginxDeploy := &webv1.NginxDeployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: pod.GetNamespace()}, nginxDeploy); err != nil ||
+		!canaryEnabled(nginxDeploy) {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(nginxDeploy)}}
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	webv1 "github.com/redbeardster/nginx-operator/api/v1"
+)
+
+const (
+	nginxConfigFile = "nginx.conf"
+
+	// Pod template annotation with hash of the generated ConfigMap,
+	// configuration changes roll out the Deployment through it
+	configHashAnnotation = "web.example.com/config-hash"
+)
+
+// configMapData renders the nginx configuration files stored in the ConfigMap
+func configMapData(nginxDeploy *webv1.NginxDeployment, tlsReady bool) map[string]string {
+	data := map[string]string{}
+	if config := nginxDeploy.Spec.Config; config != nil {
+		for name, snippet := range config.Snippets {
+			data[name] = snippet
+		}
+		if config.NginxConf != "" {
+			data[nginxConfigFile] = config.NginxConf
+		}
+	}
+	if tlsReady {
+		data[tlsConfigFile] = tlsServerConfig(nginxDeploy)
+	}
+	if metricsEnabled(nginxDeploy) {
+		data[metricsConfigFile] = stubStatusConfig()
+	}
+	return data
+}
+
+// validateConfig rejects configuration that cannot be mounted or is broken before nginx parses it
+func validateConfig(nginxDeploy *webv1.NginxDeployment) error {
+	config := nginxDeploy.Spec.Config
+	if config == nil {
+		return nil
+	}
+	reserved := map[string]bool{nginxConfigFile: true}
+	if nginxDeploy.Spec.TLS != nil {
+		reserved[tlsConfigFile] = true
+	}
+	if metricsEnabled(nginxDeploy) {
+		reserved[metricsConfigFile] = true
+	}
+	for _, name := range sortedKeys(config.Snippets) {
+		if reserved[name] {
+			return fmt.Errorf("snippet %s is reserved", name)
+		}
+		if errs := validation.IsConfigMapKey(name); len(errs) > 0 {
+			return fmt.Errorf("invalid snippet name %s: %s", name, strings.Join(errs, ", "))
+		}
+		if err := checkBraces(config.Snippets[name]); err != nil {
+			return fmt.Errorf("snippet %s: %w", name, err)
+		}
+	}
+	if err := checkBraces(config.NginxConf); err != nil {
+		return fmt.Errorf("%s: %w", nginxConfigFile, err)
+	}
+	return nil
+}
+
+// checkBraces finds unbalanced blocks, braces in comments and quoted strings are skipped
+func checkBraces(config string) error {
+	depth, line := 0, 1
+	var quote rune
+	comment, escaped := false, false
+	for _, c := range config {
+		switch {
+		case c == '\n':
+			line++
+			comment = false
+		case comment:
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			comment = true
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth == 0 {
+				return fmt.Errorf("unexpected \"}\" on line %d", line)
+			}
+			depth--
+		}
+	}
+	if depth > 0 {
+		return fmt.Errorf("unexpected end of file, expecting \"}\"")
+	}
+	return nil
+}
+
+func sortedKeys(data map[string]string) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configHash returns hash of the configuration files, it changes with any of them
+func configHash(data map[string]string) string {
+	hash := sha256.New()
+	for _, key := range sortedKeys(data) {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write([]byte(data[key]))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// configVolumeMounts mounts nginx.conf over the default one and other files into conf.d.
+// Files are mounted with subPath, so they are updated only by the rollout.
+func configVolumeMounts(data map[string]string) []corev1.VolumeMount {
+	var mounts []corev1.VolumeMount
+	for _, key := range sortedKeys(data) {
+		mountPath := "/etc/nginx/conf.d/" + key
+		if key == nginxConfigFile {
+			mountPath = "/etc/nginx/" + nginxConfigFile
+		}
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      "config",
+			MountPath: mountPath,
+			SubPath:   key,
+			ReadOnly:  true,
+		})
+	}
+	return mounts
+}
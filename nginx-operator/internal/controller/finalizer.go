@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webv1 "github.com/redbeardster/nginx-operator/api/v1"
+)
+
+// nginxFinalizer keeps NginxDeployment until its resources are cleaned up in order,
+// the garbage collector removes owned resources all at once and skips non-owned ones
+const nginxFinalizer = "web.example.com/finalizer"
+
+// certificateNameAnnotation is set by cert-manager on Secrets it issues
+const certificateNameAnnotation = "cert-manager.io/certificate-name"
+
+// finalize stops traffic to nginx, waits for pods to drain connections and
+// removes the TLS Secret issued by cert-manager before releasing the finalizer
+func (r *NginxDeploymentReconciler) finalize(ctx context.Context, nginxDeploy *webv1.NginxDeployment) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(nginxDeploy, nginxFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	// Deregister nginx from Ingress controllers and Service endpoints, the canary goes first
+	if err := r.deleteCanary(ctx, nginxDeploy); err != nil {
+		log.Error(err, "Failed to delete canary")
+		return ctrl.Result{}, err
+	}
+	if err := r.deleteOwned(ctx, nginxDeploy, "Ingress", &networkingv1.Ingress{}, nginxDeploy.Name+"-ingress"); err != nil {
+		log.Error(err, "Failed to delete Ingress")
+		return ctrl.Result{}, err
+	}
+	if err := r.deleteOwned(ctx, nginxDeploy, "Service", &corev1.Service{}, nginxDeploy.Name+"-service"); err != nil {
+		log.Error(err, "Failed to delete Service")
+		return ctrl.Result{}, err
+	}
+
+	// Stop autoscaling, otherwise HorizontalPodAutoscaler scales the Deployment back up
+	if err := r.deleteOwned(ctx, nginxDeploy, "HorizontalPodAutoscaler", &autoscalingv2.HorizontalPodAutoscaler{}, nginxDeploy.Name+"-hpa"); err != nil {
+		log.Error(err, "Failed to delete HorizontalPodAutoscaler")
+		return ctrl.Result{}, err
+	}
+
+	// The idle blue-green Deployment is removed at once, only the one serving traffic is drained
+	active := activeDeploymentName(nginxDeploy)
+	for _, color := range []string{webv1.BlueGreenColorBlue, webv1.BlueGreenColorGreen} {
+		if name := colorDeploymentName(nginxDeploy, color); name != active {
+			if err := r.deleteOwned(ctx, nginxDeploy, "Deployment", &appsv1.Deployment{}, name); err != nil {
+				log.Error(err, "Failed to delete idle Deployment")
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	// Scale nginx down so pods finish in-flight requests during graceful shutdown
+	drained, err := r.drainDeployment(ctx, nginxDeploy, active)
+	if err != nil {
+		log.Error(err, "Failed to scale down Deployment")
+		return ctrl.Result{}, err
+	}
+	if !drained {
+		log.Info("Waiting for nginx pods to terminate", "deployment", active)
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+
+	// Remove Certificate and the Secret cert-manager created for it
+	if err := r.deleteCertificate(ctx, nginxDeploy); err != nil {
+		log.Error(err, "Failed to delete Certificate")
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Removing finalizer", "finalizer", nginxFinalizer)
+	controllerutil.RemoveFinalizer(nginxDeploy, nginxFinalizer)
+	return ctrl.Result{}, r.Update(ctx, nginxDeploy)
+}
+
+// drainDeployment scales the named Deployment to zero and reports whether all its pods are gone
+func (r *NginxDeploymentReconciler) drainDeployment(ctx context.Context, nginxDeploy *webv1.NginxDeployment, name string) (bool, error) {
+	log := log.FromContext(ctx)
+
+	foundDeployment := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      name,
+		Namespace: nginxDeploy.Namespace,
+	}, foundDeployment)
+	if errors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !metav1.IsControlledBy(foundDeployment, nginxDeploy) {
+		return true, nil
+	}
+
+	if foundDeployment.Spec.Replicas == nil || *foundDeployment.Spec.Replicas != 0 {
+		log.Info("Scaling down Deployment", "name", foundDeployment.Name)
+		r.Recorder.Eventf(nginxDeploy, corev1.EventTypeNormal, "ScalingDown", "Scaling down Deployment %s before deletion", foundDeployment.Name)
+		patch := client.MergeFrom(foundDeployment.DeepCopy())
+		replicas := int32(0)
+		foundDeployment.Spec.Replicas = &replicas
+		if err := r.Patch(ctx, foundDeployment, patch, client.FieldOwner(fieldManager)); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	return foundDeployment.Status.Replicas == 0, nil
+}
+
+// deleteCertificate removes the Certificate and its Secret, cert-manager keeps Secrets of deleted Certificates by default
+func (r *NginxDeploymentReconciler) deleteCertificate(ctx context.Context, nginxDeploy *webv1.NginxDeployment) error {
+	log := log.FromContext(ctx)
+
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(certificateGVK)
+	if err := r.deleteOwned(ctx, nginxDeploy, "Certificate", certificate, tlsName(nginxDeploy)); err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      tlsName(nginxDeploy),
+		Namespace: nginxDeploy.Namespace,
+	}, secret)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// Secrets created by hand under the same name are kept
+	if secret.Annotations[certificateNameAnnotation] != tlsName(nginxDeploy) {
+		return nil
+	}
+	log.Info("Deleting Secret", "name", secret.Name)
+	if err := r.Delete(ctx, secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.Recorder.Eventf(nginxDeploy, corev1.EventTypeNormal, "Deleted", "Deleted Secret %s", secret.Name)
+	return nil
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webv1 "github.com/redbeardster/nginx-operator/api/v1"
+)
+
+// Prometheus Operator monitors are handled as unstructured objects
+// like cert-manager Certificates, the operator works without their CRDs
+var (
+	serviceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+	podMonitorGVK     = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PodMonitor"}
+)
+
+const (
+	defaultExporterImage = "nginx/nginx-prometheus-exporter:1.1.0"
+	metricsConfigFile    = "metrics.conf"
+	// stub_status is served on a separate port reachable from the exporter only
+	stubStatusPort = 8081
+)
+
+func metricsEnabled(nginxDeploy *webv1.NginxDeployment) bool {
+	return nginxDeploy.Spec.Metrics != nil && nginxDeploy.Spec.Metrics.Enabled
+}
+
+func metricsPort(nginxDeploy *webv1.NginxDeployment) int32 {
+	if nginxDeploy.Spec.Metrics.Port == 0 {
+		return 9113
+	}
+	return nginxDeploy.Spec.Metrics.Port
+}
+
+// stubStatusConfig renders nginx server block with stub_status scraped by the exporter
+func stubStatusConfig() string {
+	return fmt.Sprintf(`server {
+    listen 127.0.0.1:%d;
+
+    location /stub_status {
+        stub_status;
+    }
+}
+`, stubStatusPort)
+}
+
+// exporterContainer returns nginx-prometheus-exporter sidecar
+func exporterContainer(nginxDeploy *webv1.NginxDeployment) corev1.Container {
+	image := nginxDeploy.Spec.Metrics.Image
+	if image == "" {
+		image = defaultExporterImage
+	}
+	return corev1.Container{
+		Name:  "exporter",
+		Image: image,
+		Args: []string{
+			fmt.Sprintf("--nginx.scrape-uri=http://127.0.0.1:%d/stub_status", stubStatusPort),
+			fmt.Sprintf("--web.listen-address=:%d", metricsPort(nginxDeploy)),
+		},
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          "metrics",
+				ContainerPort: metricsPort(nginxDeploy),
+				Protocol:      corev1.ProtocolTCP,
+			},
+		},
+	}
+}
+
+// reconcileMonitor creates ServiceMonitor, or PodMonitor when the cluster has only its CRD
+func (r *NginxDeploymentReconciler) reconcileMonitor(ctx context.Context, nginxDeploy *webv1.NginxDeployment) error {
+	log := log.FromContext(ctx)
+
+	endpoint := map[string]interface{}{"port": "metrics"}
+	if metricsEnabled(nginxDeploy) && nginxDeploy.Spec.Metrics.Interval != "" {
+		endpoint["interval"] = nginxDeploy.Spec.Metrics.Interval
+	}
+	// ServiceMonitor selects the Services, PodMonitor selects pods of all tracks
+	serviceMonitorSelector := map[string]interface{}{"matchLabels": map[string]interface{}{"app": nginxDeploy.Name}}
+	podMonitorSelector := map[string]interface{}{"matchLabels": map[string]interface{}{instanceLabel: nginxDeploy.Name}}
+	monitors := []struct {
+		gvk  schema.GroupVersionKind
+		spec map[string]interface{}
+	}{
+		{gvk: serviceMonitorGVK, spec: map[string]interface{}{
+			"selector":  serviceMonitorSelector,
+			"endpoints": []interface{}{endpoint},
+		}},
+		{gvk: podMonitorGVK, spec: map[string]interface{}{
+			"selector":            podMonitorSelector,
+			"podMetricsEndpoints": []interface{}{endpoint},
+		}},
+	}
+
+	enabled, created := metricsEnabled(nginxDeploy), false
+	for _, monitor := range monitors {
+		exists, err := r.reconcileMonitorKind(ctx, nginxDeploy, monitor.gvk, monitor.spec, enabled)
+		if meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		// Only one kind of monitor is created, the other one is removed
+		if exists {
+			enabled, created = false, true
+		}
+	}
+	if metricsEnabled(nginxDeploy) && !created {
+		log.Info("Prometheus Operator CRDs are not installed, monitor is not created")
+	}
+	return nil
+}
+
+// reconcileMonitorKind applies or removes a monitor of the kind and reports whether it exists now
+func (r *NginxDeploymentReconciler) reconcileMonitorKind(ctx context.Context, nginxDeploy *webv1.NginxDeployment,
+	gvk schema.GroupVersionKind, spec map[string]interface{}, enabled bool) (bool, error) {
+	// Remove monitor if metrics are disabled
+	if !enabled {
+		foundMonitor := &unstructured.Unstructured{}
+		foundMonitor.SetGroupVersionKind(gvk)
+		return false, r.deleteOwned(ctx, nginxDeploy, gvk.Kind, foundMonitor, nginxDeploy.Name+"-metrics")
+	}
+
+	monitor := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	monitor.SetGroupVersionKind(gvk)
+	monitor.SetName(nginxDeploy.Name + "-metrics")
+	monitor.SetNamespace(nginxDeploy.Namespace)
+	monitor.SetLabels(mergeMaps(nginxDeploy.Spec.Labels, selectorLabels(nginxDeploy)))
+
+	return true, r.apply(ctx, nginxDeploy, monitor)
+}
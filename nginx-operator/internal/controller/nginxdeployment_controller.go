@@ -3,16 +3,26 @@ package controller
 import (
 	"context"
 	"fmt"
+	"path"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	webv1 "github.com/redbeardster/nginx-operator/api/v1"
@@ -21,7 +31,8 @@ import (
 // NginxDeploymentReconciler reconciles a NginxDeployment object
 type NginxDeploymentReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=web.example.com,resources=nginxdeployments,verbs=get;list;watch;create;update;patch;delete
@@ -29,6 +40,17 @@ type NginxDeploymentReconciler struct {
 //+kubebuilder:rbac:groups=web.example.com,resources=nginxdeployments/finalizers,verbs=update
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors;podmonitors,verbs=get;list;watch;create;update;patch;delete
 
 func (r *NginxDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
@@ -44,85 +66,195 @@ func (r *NginxDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, err
 	}
 
-	// Set defaults
-	if nginxDeploy.Spec.Image == "" {
-		nginxDeploy.Spec.Image = "nginx:latest"
+	// Clean up before NginxDeployment is removed
+	if !nginxDeploy.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, &nginxDeploy)
 	}
-	if nginxDeploy.Spec.Port == 0 {
-		nginxDeploy.Spec.Port = 80
+
+	// Add finalizer
+	if controllerutil.AddFinalizer(&nginxDeploy, nginxFinalizer) {
+		log.Info("Adding finalizer", "finalizer", nginxFinalizer)
+		if err := r.Update(ctx, &nginxDeploy); err != nil {
+			log.Error(err, "Failed to add finalizer")
+			return ctrl.Result{}, err
+		}
 	}
 
-	// Reconcile Deployment
-	if err := r.reconcileDeployment(ctx, &nginxDeploy); err != nil {
-		log.Error(err, "Failed to reconcile Deployment")
-		return ctrl.Result{}, err
+	// Validate nginx configuration, invalid configuration is not rolled out
+	if err := validateConfig(&nginxDeploy); err != nil {
+		log.Info("Rejecting nginx configuration", "reason", err.Error())
+		r.Recorder.Event(&nginxDeploy, corev1.EventTypeWarning, "InvalidConfig", err.Error())
+		setCondition(&nginxDeploy, webv1.ConditionConfigValid, metav1.ConditionFalse, "InvalidConfig", err.Error())
+		setCondition(&nginxDeploy, webv1.ConditionDegraded, metav1.ConditionTrue, "InvalidConfig", err.Error())
+		return ctrl.Result{}, r.Status().Update(ctx, &nginxDeploy)
 	}
+	setCondition(&nginxDeploy, webv1.ConditionConfigValid, metav1.ConditionTrue, "ConfigAccepted", "nginx configuration is valid")
 
-	// Reconcile Service
-	if err := r.reconcileService(ctx, &nginxDeploy); err != nil {
-		log.Error(err, "Failed to reconcile Service")
+	tlsReady, err := r.reconcileResources(ctx, &nginxDeploy)
+	if err != nil {
+		r.Recorder.Event(&nginxDeploy, corev1.EventTypeWarning, "ReconcileFailed", err.Error())
+		setCondition(&nginxDeploy, webv1.ConditionDegraded, metav1.ConditionTrue, "ReconcileFailed", err.Error())
+		if statusErr := r.Status().Update(ctx, &nginxDeploy); statusErr != nil {
+			log.Error(statusErr, "Failed to update status")
+		}
 		return ctrl.Result{}, err
 	}
 
 	// Update status
-	if err := r.updateStatus(ctx, &nginxDeploy); err != nil {
+	if err := r.updateStatus(ctx, &nginxDeploy, tlsReady); err != nil {
 		log.Error(err, "Failed to update status")
 		return ctrl.Result{}, err
 	}
 
+	// Wait for cert-manager to issue the certificate, the Secret is not watched
+	if nginxDeploy.Spec.TLS != nil && !tlsReady {
+		log.Info("Waiting for TLS certificate", "certificate", tlsName(&nginxDeploy))
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	// Requeue until the rollout converges, so the status does not wait for unrelated events.
+	// Paused canary waits for the promote action, the annotation change triggers reconcile.
+	if progressing := meta.FindStatusCondition(nginxDeploy.Status.Conditions, webv1.ConditionProgressing); progressing != nil &&
+		progressing.Status == metav1.ConditionTrue && progressing.Reason != "CanaryPaused" {
+		log.Info("Waiting for rollout", "reason", progressing.Reason, "message", progressing.Message)
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+
+	// Scale down the previous blue-green Deployment when the rollback window ends
+	if blueGreen := nginxDeploy.Status.BlueGreen; blueGreen != nil && blueGreen.SwitchTime != nil {
+		return ctrl.Result{RequeueAfter: time.Until(blueGreen.SwitchTime.Add(rollbackWindow(&nginxDeploy)))}, nil
+	}
+
 	log.Info("Successfully reconciled NginxDeployment")
 	return ctrl.Result{}, nil
 }
 
-func (r *NginxDeploymentReconciler) reconcileDeployment(ctx context.Context, nginxDeploy *webv1.NginxDeployment) error {
+// reconcileResources creates or updates resources of NginxDeployment and reports whether TLS is served
+func (r *NginxDeploymentReconciler) reconcileResources(ctx context.Context, nginxDeploy *webv1.NginxDeployment) (bool, error) {
 	log := log.FromContext(ctx)
 
-	targetPort := intstr.FromInt(int(nginxDeploy.Spec.Port))
+	// Reconcile Certificate
+	tlsReady, err := r.reconcileCertificate(ctx, nginxDeploy)
+	if err != nil {
+		log.Error(err, "Failed to reconcile Certificate")
+		return false, fmt.Errorf("failed to reconcile Certificate: %w", err)
+	}
+
+	// Reconcile ConfigMap
+	if err := r.reconcileConfigMap(ctx, nginxDeploy, tlsReady); err != nil {
+		log.Error(err, "Failed to reconcile ConfigMap")
+		return false, fmt.Errorf("failed to reconcile ConfigMap: %w", err)
+	}
+
+	// Reconcile Deployment
+	if err := r.reconcileDeployment(ctx, nginxDeploy, tlsReady); err != nil {
+		log.Error(err, "Failed to reconcile Deployment")
+		return false, fmt.Errorf("failed to reconcile Deployment: %w", err)
+	}
+
+	// Reconcile Service
+	if err := r.reconcileService(ctx, nginxDeploy, tlsReady); err != nil {
+		log.Error(err, "Failed to reconcile Service")
+		return false, fmt.Errorf("failed to reconcile Service: %w", err)
+	}
 
+	// Reconcile ServiceMonitor or PodMonitor
+	if err := r.reconcileMonitor(ctx, nginxDeploy); err != nil {
+		log.Error(err, "Failed to reconcile monitor")
+		return false, fmt.Errorf("failed to reconcile monitor: %w", err)
+	}
+
+	// Reconcile NetworkPolicy
+	if err := r.reconcileNetworkPolicy(ctx, nginxDeploy); err != nil {
+		log.Error(err, "Failed to reconcile NetworkPolicy")
+		return false, fmt.Errorf("failed to reconcile NetworkPolicy: %w", err)
+	}
+
+	// Reconcile PodDisruptionBudget
+	if err := r.reconcilePodDisruptionBudget(ctx, nginxDeploy); err != nil {
+		log.Error(err, "Failed to reconcile PodDisruptionBudget")
+		return false, fmt.Errorf("failed to reconcile PodDisruptionBudget: %w", err)
+	}
+
+	// Reconcile HorizontalPodAutoscaler
+	if err := r.reconcileHorizontalPodAutoscaler(ctx, nginxDeploy); err != nil {
+		log.Error(err, "Failed to reconcile HorizontalPodAutoscaler")
+		return false, fmt.Errorf("failed to reconcile HorizontalPodAutoscaler: %w", err)
+	}
+
+	// Reconcile Ingress
+	if err := r.reconcileIngress(ctx, nginxDeploy); err != nil {
+		log.Error(err, "Failed to reconcile Ingress")
+		return false, fmt.Errorf("failed to reconcile Ingress: %w", err)
+	}
+
+	// Reconcile canary Service and Ingress
+	if err := r.reconcileCanaryTraffic(ctx, nginxDeploy, tlsReady); err != nil {
+		log.Error(err, "Failed to reconcile canary traffic")
+		return false, fmt.Errorf("failed to reconcile canary traffic: %w", err)
+	}
+
+	return tlsReady, nil
+}
+
+func (r *NginxDeploymentReconciler) reconcileConfigMap(ctx context.Context, nginxDeploy *webv1.NginxDeployment, tlsReady bool) error {
+	// Remove ConfigMap if there is no generated configuration
+	data := configMapData(nginxDeploy, tlsReady)
+	if len(data) == 0 {
+		return r.deleteOwned(ctx, nginxDeploy, "ConfigMap", &corev1.ConfigMap{}, nginxDeploy.Name+"-config")
+	}
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginxDeploy.Name + "-config",
+			Namespace: nginxDeploy.Namespace,
+		},
+		Data: data,
+	}
+
+	return r.apply(ctx, nginxDeploy, configMap)
+}
+
+// webRoot is the document root of the nginx image
+const webRoot = "/usr/share/nginx/html"
+
+func (r *NginxDeploymentReconciler) reconcileDeployment(ctx context.Context, nginxDeploy *webv1.NginxDeployment, tlsReady bool) error {
+	ports := nginxPorts(nginxDeploy)
+	targetPort := intstr.FromInt(int(ports[0].ContainerPort))
+
+	replicas := desiredReplicas(nginxDeploy)
+	image := nginxDeploy.Spec.Image
+	if image == "" {
+		image = webv1.DefaultImage
+	}
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      nginxDeploy.Name + "-deployment",
 			Namespace: nginxDeploy.Namespace,
+			Labels:    mergeMaps(nginxDeploy.Spec.Labels, selectorLabels(nginxDeploy)),
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: &nginxDeploy.Spec.Replicas,
+			Replicas: &replicas,
 			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{"app": nginxDeploy.Name},
+				MatchLabels: selectorLabels(nginxDeploy),
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{"app": nginxDeploy.Name},
+					Labels:      mergeMaps(nginxDeploy.Spec.Labels, nginxDeploy.Spec.PodLabels, selectorLabels(nginxDeploy), instanceLabels(nginxDeploy)),
+					Annotations: mergeMaps(nginxDeploy.Spec.PodAnnotations),
 				},
 				Spec: corev1.PodSpec{
+					NodeSelector: nginxDeploy.Spec.NodeSelector,
+					Affinity:     nginxDeploy.Spec.Affinity,
+					Tolerations:  nginxDeploy.Spec.Tolerations,
 					Containers: []corev1.Container{
 						{
-							Name:  "nginx",
-							Image: nginxDeploy.Spec.Image,
-							Ports: []corev1.ContainerPort{
-								{
-									ContainerPort: nginxDeploy.Spec.Port,
-								},
-							},
-							LivenessProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									HTTPGet: &corev1.HTTPGetAction{
-										Path: "/",
-										Port: targetPort,
-									},
-								},
-								InitialDelaySeconds: 15,
-								TimeoutSeconds:      5,
-							},
-							ReadinessProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									HTTPGet: &corev1.HTTPGetAction{
-										Path: "/",
-										Port: targetPort,
-									},
-								},
-								InitialDelaySeconds: 5,
-								TimeoutSeconds:      5,
-							},
+							Name:           "nginx",
+							Image:          image,
+							Resources:      nginxDeploy.Spec.Resources,
+							Ports:          containerPorts(ports),
+							LivenessProbe:  httpProbe(nginxDeploy.Spec.LivenessProbe, targetPort, 15),
+							ReadinessProbe: httpProbe(nginxDeploy.Spec.ReadinessProbe, targetPort, 5),
 						},
 					},
 				},
@@ -130,84 +262,487 @@ func (r *NginxDeploymentReconciler) reconcileDeployment(ctx context.Context, ngi
 		},
 	}
 
-	// Set controller reference
-	if err := ctrl.SetControllerReference(nginxDeploy, deployment, r.Scheme); err != nil {
-		return err
+	podSpec := &deployment.Spec.Template.Spec
+
+	// Mount configuration files, the hash rolls out pods when they change
+	if data := configMapData(nginxDeploy, tlsReady); len(data) > 0 {
+		deployment.Spec.Template.Annotations[configHashAnnotation] = configHash(data)
+		podSpec.Containers[0].VolumeMounts = configVolumeMounts(data)
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "config",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: nginxDeploy.Name + "-config"},
+				},
+			},
+		})
 	}
 
-	// Check if deployment exists
-	foundDeploy := &appsv1.Deployment{}
-	err := r.Get(ctx, types.NamespacedName{
-		Name:      deployment.Name,
-		Namespace: deployment.Namespace,
-	}, foundDeploy)
-
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating Deployment", "name", deployment.Name)
-		return r.Create(ctx, deployment)
-	} else if err != nil {
-		return err
+	// Serve static content of the ConfigMap, it is mounted as directory and updated in place
+	if content := nginxDeploy.Spec.Content; content != nil {
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "content",
+			MountPath: path.Join(webRoot, content.SubPath),
+			ReadOnly:  true,
+		})
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "content",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: content.ConfigMapRef,
+					Items:                content.Items,
+				},
+			},
+		})
 	}
 
-	// Update if needed
-	if *foundDeploy.Spec.Replicas != *deployment.Spec.Replicas ||
-		foundDeploy.Spec.Template.Spec.Containers[0].Image != deployment.Spec.Template.Spec.Containers[0].Image {
+	// Mount the certificate
+	if tlsReady {
+		container := &podSpec.Containers[0]
+		container.Ports = append(container.Ports, corev1.ContainerPort{
+			Name:          "https",
+			ContainerPort: tlsPort(nginxDeploy),
+			Protocol:      corev1.ProtocolTCP,
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "tls",
+			MountPath: tlsMountPath,
+			ReadOnly:  true,
+		})
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "tls",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: tlsName(nginxDeploy)},
+			},
+		})
+	}
 
-		log.Info("Updating Deployment", "name", deployment.Name)
-		foundDeploy.Spec = deployment.Spec
-		return r.Update(ctx, foundDeploy)
+	// Export metrics with the sidecar
+	if metricsEnabled(nginxDeploy) {
+		podSpec.Containers = append(podSpec.Containers, exporterContainer(nginxDeploy))
 	}
 
-	return nil
+	// Init containers prepare additional volumes before nginx starts
+	podSpec.InitContainers = nginxDeploy.Spec.InitContainers
+	podSpec.Volumes = append(podSpec.Volumes, nginxDeploy.Spec.Volumes...)
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, nginxDeploy.Spec.VolumeMounts...)
+
+	deployment.Annotations = map[string]string{revisionAnnotation: templateHash(&deployment.Spec.Template)}
+
+	// HorizontalPodAutoscaler owns replicas once the Deployment is created
+	if nginxDeploy.Spec.Autoscaling != nil {
+		err := r.Get(ctx, types.NamespacedName{
+			Name:      deployment.Name,
+			Namespace: deployment.Namespace,
+		}, &appsv1.Deployment{})
+		if err == nil {
+			deployment.Spec.Replicas = nil
+		} else if !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	// Roll out pod template changes through the canary or the idle blue-green Deployment
+	switch {
+	case canaryEnabled(nginxDeploy):
+		return r.reconcileCanary(ctx, nginxDeploy, deployment)
+	case blueGreenEnabled(nginxDeploy):
+		return r.reconcileBlueGreen(ctx, nginxDeploy, deployment)
+	}
+	return r.applyStable(ctx, nginxDeploy, deployment)
 }
 
-func (r *NginxDeploymentReconciler) reconcileService(ctx context.Context, nginxDeploy *webv1.NginxDeployment) error {
-	log := log.FromContext(ctx)
+// httpProbe builds HTTP probe of nginx container, nil when the probe is disabled
+func httpProbe(spec *webv1.NginxProbeSpec, defaultPort intstr.IntOrString, defaultDelay int32) *corev1.Probe {
+	if spec == nil {
+		spec = &webv1.NginxProbeSpec{}
+	}
+	if spec.Disabled {
+		return nil
+	}
+
+	probe := &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path:   "/",
+				Port:   defaultPort,
+				Scheme: corev1.URISchemeHTTP,
+			},
+		},
+		InitialDelaySeconds: defaultDelay,
+		TimeoutSeconds:      5,
+		PeriodSeconds:       10,
+		SuccessThreshold:    1,
+		FailureThreshold:    3,
+	}
+	if spec.Path != "" {
+		probe.HTTPGet.Path = spec.Path
+	}
+	if spec.Port != nil {
+		probe.HTTPGet.Port = *spec.Port
+	}
+	if spec.InitialDelaySeconds != nil {
+		probe.InitialDelaySeconds = *spec.InitialDelaySeconds
+	}
+	if spec.TimeoutSeconds != 0 {
+		probe.TimeoutSeconds = spec.TimeoutSeconds
+	}
+	if spec.PeriodSeconds != 0 {
+		probe.PeriodSeconds = spec.PeriodSeconds
+	}
+	if spec.SuccessThreshold != 0 {
+		probe.SuccessThreshold = spec.SuccessThreshold
+	}
+	if spec.FailureThreshold != 0 {
+		probe.FailureThreshold = spec.FailureThreshold
+	}
+	return probe
+}
+
+// desiredReplicas returns the number of replicas, resources stored without
+// the defaulting webhook fall back to the default
+func desiredReplicas(nginxDeploy *webv1.NginxDeployment) int32 {
+	if nginxDeploy.Spec.Replicas == nil {
+		return webv1.DefaultReplicas
+	}
+	return *nginxDeploy.Spec.Replicas
+}
+
+// nginxPorts returns ports with defaults applied, the single port field is used when ports are not set
+func nginxPorts(nginxDeploy *webv1.NginxDeployment) []webv1.NginxPort {
+	if len(nginxDeploy.Spec.Ports) == 0 {
+		port := nginxDeploy.Spec.Port
+		if port == 0 {
+			port = webv1.DefaultPort
+		}
+		return []webv1.NginxPort{{
+			Name:          "http",
+			ContainerPort: port,
+			ServicePort:   port,
+			Protocol:      corev1.ProtocolTCP,
+		}}
+	}
+	ports := make([]webv1.NginxPort, 0, len(nginxDeploy.Spec.Ports))
+	for _, port := range nginxDeploy.Spec.Ports {
+		if port.ServicePort == 0 {
+			port.ServicePort = port.ContainerPort
+		}
+		if port.Protocol == "" {
+			port.Protocol = corev1.ProtocolTCP
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+func containerPorts(ports []webv1.NginxPort) []corev1.ContainerPort {
+	containerPorts := make([]corev1.ContainerPort, 0, len(ports))
+	for _, port := range ports {
+		containerPorts = append(containerPorts, corev1.ContainerPort{
+			Name:          port.Name,
+			ContainerPort: port.ContainerPort,
+			Protocol:      port.Protocol,
+		})
+	}
+	return containerPorts
+}
+
+func servicePorts(ports []webv1.NginxPort) []corev1.ServicePort {
+	servicePorts := make([]corev1.ServicePort, 0, len(ports))
+	for _, port := range ports {
+		servicePorts = append(servicePorts, corev1.ServicePort{
+			Name:       port.Name,
+			Port:       port.ServicePort,
+			TargetPort: intstr.FromString(port.Name),
+			Protocol:   port.Protocol,
+		})
+	}
+	return servicePorts
+}
+
+// Pod label with the name of NginxDeployment set on pods of all its Deployments
+const instanceLabel = "web.example.com/nginx-deployment"
+
+// selectorLabels returns labels selecting nginx pods, they cannot be overridden by user labels
+func selectorLabels(nginxDeploy *webv1.NginxDeployment) map[string]string {
+	return map[string]string{"app": nginxDeploy.Name}
+}
+
+// instanceLabels returns labels of nginx pods of all tracks, stable, canary and both blue-green colors.
+// The app label of canary pods differs, so PodDisruptionBudget, NetworkPolicy and PodMonitor select by these.
+func instanceLabels(nginxDeploy *webv1.NginxDeployment) map[string]string {
+	return map[string]string{instanceLabel: nginxDeploy.Name}
+}
+
+// mergeMaps merges maps into a new one, later maps take precedence
+func mergeMaps(maps ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, m := range maps {
+		for key, value := range m {
+			merged[key] = value
+		}
+	}
+	return merged
+}
 
-	targetPort := intstr.FromInt(int(nginxDeploy.Spec.Port))
+// nginxServicePorts returns Service ports of nginx pods with HTTPS and metrics ones
+func nginxServicePorts(nginxDeploy *webv1.NginxDeployment, tlsReady bool) []corev1.ServicePort {
+	ports := servicePorts(nginxPorts(nginxDeploy))
+	if tlsReady {
+		ports = append(ports, corev1.ServicePort{
+			Name:       "https",
+			Port:       tlsPort(nginxDeploy),
+			TargetPort: intstr.FromString("https"),
+			Protocol:   corev1.ProtocolTCP,
+		})
+	}
+	if metricsEnabled(nginxDeploy) {
+		ports = append(ports, corev1.ServicePort{
+			Name:       "metrics",
+			Port:       metricsPort(nginxDeploy),
+			TargetPort: intstr.FromString("metrics"),
+			Protocol:   corev1.ProtocolTCP,
+		})
+	}
+	return ports
+}
 
+func (r *NginxDeploymentReconciler) reconcileService(ctx context.Context, nginxDeploy *webv1.NginxDeployment, tlsReady bool) error {
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      nginxDeploy.Name + "-service",
-			Namespace: nginxDeploy.Namespace,
+			Name:        nginxDeploy.Name + "-service",
+			Namespace:   nginxDeploy.Namespace,
+			Labels:      mergeMaps(nginxDeploy.Spec.Labels, selectorLabels(nginxDeploy)),
+			Annotations: mergeMaps(nginxDeploy.Spec.ServiceAnnotations),
 		},
 		Spec: corev1.ServiceSpec{
-			Selector: map[string]string{"app": nginxDeploy.Name},
-			Ports: []corev1.ServicePort{
+			Selector: serviceSelector(nginxDeploy),
+			Ports:    nginxServicePorts(nginxDeploy, tlsReady),
+			Type:     corev1.ServiceTypeClusterIP,
+		},
+	}
+	if spec := nginxDeploy.Spec.Service; spec != nil {
+		if spec.Type != "" {
+			service.Spec.Type = spec.Type
+		}
+		if service.Spec.Type != corev1.ServiceTypeClusterIP {
+			service.Spec.Ports[0].NodePort = spec.NodePort
+		}
+		if service.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			service.Spec.LoadBalancerIP = spec.LoadBalancerIP
+			service.Spec.LoadBalancerClass = spec.LoadBalancerClass
+		}
+		service.Annotations = mergeMaps(service.Annotations, spec.Annotations)
+	}
+
+	// Node ports and load balancer class left unset are assigned by the cluster and kept
+	return r.apply(ctx, nginxDeploy, service)
+}
+
+func (r *NginxDeploymentReconciler) reconcileIngress(ctx context.Context, nginxDeploy *webv1.NginxDeployment) error {
+	// Remove Ingress if it is no longer requested
+	if nginxDeploy.Spec.Ingress == nil {
+		return r.deleteOwned(ctx, nginxDeploy, "Ingress", &networkingv1.Ingress{}, nginxDeploy.Name+"-ingress")
+	}
+
+	return r.apply(ctx, nginxDeploy, nginxIngress(nginxDeploy, nginxDeploy.Name+"-ingress", nginxDeploy.Name+"-service"))
+}
+
+// nginxIngress returns the Ingress routing the host and path of NginxDeployment to the Service
+func nginxIngress(nginxDeploy *webv1.NginxDeployment, name, serviceName string) *networkingv1.Ingress {
+	spec := nginxDeploy.Spec.Ingress
+	path := spec.Path
+	if path == "" {
+		path = "/"
+	}
+	pathType := networkingv1.PathTypePrefix
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: nginxDeploy.Namespace,
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{
 				{
-					Port:       nginxDeploy.Spec.Port,
-					TargetPort: targetPort,
+					Host: spec.Host,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     path,
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: serviceName,
+											Port: networkingv1.ServiceBackendPort{
+												Number: nginxPorts(nginxDeploy)[0].ServicePort,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
 				},
 			},
-			Type: corev1.ServiceTypeClusterIP,
 		},
 	}
+	if spec.ClassName != "" {
+		ingress.Spec.IngressClassName = &spec.ClassName
+	}
+	if spec.TLSSecretName != "" {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{
+			{
+				Hosts:      []string{spec.Host},
+				SecretName: spec.TLSSecretName,
+			},
+		}
+	}
+	return ingress
+}
 
-	// Set controller reference
-	if err := ctrl.SetControllerReference(nginxDeploy, service, r.Scheme); err != nil {
-		return err
+func (r *NginxDeploymentReconciler) reconcileNetworkPolicy(ctx context.Context, nginxDeploy *webv1.NginxDeployment) error {
+	// Remove NetworkPolicy if it is no longer requested
+	if nginxDeploy.Spec.NetworkPolicy == nil || !nginxDeploy.Spec.NetworkPolicy.Enabled {
+		return r.deleteOwned(ctx, nginxDeploy, "NetworkPolicy", &networkingv1.NetworkPolicy{}, nginxDeploy.Name+"-networkpolicy")
 	}
 
-	foundService := &corev1.Service{}
-	err := r.Get(ctx, types.NamespacedName{
-		Name:      service.Name,
-		Namespace: service.Namespace,
-	}, foundService)
-
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating Service", "name", service.Name)
-		return r.Create(ctx, service)
-	} else if err != nil {
-		return err
+	// Allow all ports of nginx pods, TLS port is allowed before the certificate is issued
+	containerPorts := containerPorts(nginxPorts(nginxDeploy))
+	if nginxDeploy.Spec.TLS != nil {
+		containerPorts = append(containerPorts, corev1.ContainerPort{ContainerPort: tlsPort(nginxDeploy), Protocol: corev1.ProtocolTCP})
+	}
+	if metricsEnabled(nginxDeploy) {
+		containerPorts = append(containerPorts, corev1.ContainerPort{ContainerPort: metricsPort(nginxDeploy), Protocol: corev1.ProtocolTCP})
+	}
+	var ports []networkingv1.NetworkPolicyPort
+	for _, containerPort := range containerPorts {
+		protocol := containerPort.Protocol
+		port := intstr.FromInt(int(containerPort.ContainerPort))
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+	}
+
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginxDeploy.Name + "-networkpolicy",
+			Namespace: nginxDeploy.Namespace,
+			Labels:    mergeMaps(nginxDeploy.Spec.Labels, selectorLabels(nginxDeploy)),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: instanceLabels(nginxDeploy)},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: ports,
+					From:  nginxDeploy.Spec.NetworkPolicy.From,
+				},
+			},
+		},
+	}
+
+	return r.apply(ctx, nginxDeploy, policy)
+}
+
+func (r *NginxDeploymentReconciler) reconcilePodDisruptionBudget(ctx context.Context, nginxDeploy *webv1.NginxDeployment) error {
+	// Remove PodDisruptionBudget if it is no longer requested
+	if nginxDeploy.Spec.PDB == nil {
+		return r.deleteOwned(ctx, nginxDeploy, "PodDisruptionBudget", &policyv1.PodDisruptionBudget{}, nginxDeploy.Name+"-pdb")
 	}
 
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginxDeploy.Name + "-pdb",
+			Namespace: nginxDeploy.Namespace,
+			Labels:    mergeMaps(nginxDeploy.Spec.Labels, selectorLabels(nginxDeploy)),
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: instanceLabels(nginxDeploy),
+			},
+			MinAvailable:   nginxDeploy.Spec.PDB.MinAvailable,
+			MaxUnavailable: nginxDeploy.Spec.PDB.MaxUnavailable,
+		},
+	}
+
+	return r.apply(ctx, nginxDeploy, pdb)
+}
+
+func (r *NginxDeploymentReconciler) reconcileHorizontalPodAutoscaler(ctx context.Context, nginxDeploy *webv1.NginxDeployment) error {
+	// Remove HorizontalPodAutoscaler if autoscaling is disabled
+	if nginxDeploy.Spec.Autoscaling == nil {
+		return r.deleteOwned(ctx, nginxDeploy, "HorizontalPodAutoscaler", &autoscalingv2.HorizontalPodAutoscaler{}, nginxDeploy.Name+"-hpa")
+	}
+
+	spec := nginxDeploy.Spec.Autoscaling
+	metrics := append([]autoscalingv2.MetricSpec{}, spec.Metrics...)
+	targetCPU := spec.TargetCPUUtilization
+	if targetCPU == nil && len(metrics) == 0 {
+		defaultCPU := int32(80)
+		targetCPU = &defaultCPU
+	}
+	if targetCPU != nil {
+		metrics = append(metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: corev1.ResourceCPU,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: targetCPU,
+				},
+			},
+		})
+	}
+	minReplicas := int32(1)
+	if spec.MinReplicas != nil {
+		minReplicas = *spec.MinReplicas
+	}
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginxDeploy.Name + "-hpa",
+			Namespace: nginxDeploy.Namespace,
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       activeDeploymentName(nginxDeploy),
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: spec.MaxReplicas,
+			Metrics:     metrics,
+		},
+	}
+
+	return r.apply(ctx, nginxDeploy, hpa)
+}
+
+// setCondition records a condition of NginxDeployment observed at its current generation
+func setCondition(nginxDeploy *webv1.NginxDeployment, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&nginxDeploy.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: nginxDeploy.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// deploymentCondition returns the condition of the Deployment if it is reported
+func deploymentCondition(deployment *appsv1.Deployment, conditionType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range deployment.Status.Conditions {
+		if deployment.Status.Conditions[i].Type == conditionType {
+			return &deployment.Status.Conditions[i]
+		}
+	}
 	return nil
 }
 
-func (r *NginxDeploymentReconciler) updateStatus(ctx context.Context, nginxDeploy *webv1.NginxDeployment) error {
+func (r *NginxDeploymentReconciler) updateStatus(ctx context.Context, nginxDeploy *webv1.NginxDeployment, tlsReady bool) error {
 	deployment := &appsv1.Deployment{}
 	err := r.Get(ctx, types.NamespacedName{
-		Name:      nginxDeploy.Name + "-deployment",
+		Name:      activeDeploymentName(nginxDeploy),
 		Namespace: nginxDeploy.Namespace,
 	}, deployment)
 
@@ -215,15 +750,92 @@ func (r *NginxDeploymentReconciler) updateStatus(ctx context.Context, nginxDeplo
 		return err
 	}
 
-	nginxDeploy.Status.AvailableReplicas = deployment.Status.AvailableReplicas
+	// Canary pods serve traffic next to the stable ones
+	availableReplicas := deployment.Status.AvailableReplicas
+	if canaryActive(nginxDeploy) {
+		canary := &appsv1.Deployment{}
+		err := r.Get(ctx, types.NamespacedName{Name: canaryName(nginxDeploy), Namespace: nginxDeploy.Namespace}, canary)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		availableReplicas += canary.Status.AvailableReplicas
+	}
+
+	nginxDeploy.Status.AvailableReplicas = availableReplicas
+	wasAvailable := meta.IsStatusConditionTrue(nginxDeploy.Status.Conditions, webv1.ConditionAvailable)
+	wasDegraded := meta.IsStatusConditionTrue(nginxDeploy.Status.Conditions, webv1.ConditionDegraded)
+
+	// With autoscaling the desired number of replicas is chosen by HorizontalPodAutoscaler
+	desired := desiredReplicas(nginxDeploy)
+	if nginxDeploy.Spec.Autoscaling != nil && deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
 
-	if deployment.Status.AvailableReplicas == nginxDeploy.Spec.Replicas {
-		nginxDeploy.Status.Status = "Ready"
+	available := fmt.Sprintf("%d/%d replicas available", availableReplicas, desired)
+	if availableReplicas >= desired {
+		setCondition(nginxDeploy, webv1.ConditionAvailable, metav1.ConditionTrue, "ReplicasAvailable", available)
 	} else {
-		nginxDeploy.Status.Status = fmt.Sprintf("Available: %d/%d",
-			deployment.Status.AvailableReplicas, nginxDeploy.Spec.Replicas)
+		setCondition(nginxDeploy, webv1.ConditionAvailable, metav1.ConditionFalse, "ReplicasUnavailable", available)
+	}
+
+	// Deployment controller reports stuck rollouts with Progressing False and failed pod creation with ReplicaFailure
+	progressing := deploymentCondition(deployment, appsv1.DeploymentProgressing)
+	replicaFailure := deploymentCondition(deployment, appsv1.DeploymentReplicaFailure)
+	stuck := progressing != nil && progressing.Status == corev1.ConditionFalse
+	rollingOut := deployment.Status.ObservedGeneration < deployment.Generation ||
+		deployment.Status.UpdatedReplicas < desired ||
+		deployment.Status.Replicas > deployment.Status.UpdatedReplicas ||
+		deployment.Status.AvailableReplicas < desired
+	switch {
+	case stuck:
+		setCondition(nginxDeploy, webv1.ConditionProgressing, metav1.ConditionFalse, progressing.Reason, progressing.Message)
+	case canaryActive(nginxDeploy):
+		canary := nginxDeploy.Status.Canary
+		reason := "CanaryProgressing"
+		switch {
+		case canary.Phase == webv1.CanaryPhasePaused:
+			reason = "CanaryPaused"
+		case canary.Weight > 0 && canary.EffectiveWeight == 0:
+			reason = "CanaryWaitingForEndpoints"
+		}
+		setCondition(nginxDeploy, webv1.ConditionProgressing, metav1.ConditionTrue, reason,
+			fmt.Sprintf("Canary step %d/%d with weight %d%%, %d%% of Service endpoints", canary.Step+1,
+				len(nginxDeploy.Spec.Strategy.Canary.Steps), canary.Weight, canary.EffectiveWeight))
+	case nginxDeploy.Status.BlueGreen != nil && nginxDeploy.Status.BlueGreen.PreviewRevision != "":
+		blueGreen := nginxDeploy.Status.BlueGreen
+		setCondition(nginxDeploy, webv1.ConditionProgressing, metav1.ConditionTrue, "PreviewRollingOut",
+			fmt.Sprintf("Rolling out revision %s to %s Deployment", blueGreen.PreviewRevision, otherColor(blueGreen.ActiveColor)))
+	case rollingOut:
+		setCondition(nginxDeploy, webv1.ConditionProgressing, metav1.ConditionTrue, "RollingOut",
+			fmt.Sprintf("%d/%d replicas updated", deployment.Status.UpdatedReplicas, desired))
+	case nginxDeploy.Spec.TLS != nil && !tlsReady:
+		setCondition(nginxDeploy, webv1.ConditionProgressing, metav1.ConditionTrue, "WaitingForCertificate",
+			fmt.Sprintf("Waiting for Certificate %s to be issued", tlsName(nginxDeploy)))
+	default:
+		setCondition(nginxDeploy, webv1.ConditionProgressing, metav1.ConditionFalse, "RolloutComplete", available)
 	}
 
+	switch {
+	case stuck:
+		setCondition(nginxDeploy, webv1.ConditionDegraded, metav1.ConditionTrue, progressing.Reason, progressing.Message)
+	case replicaFailure != nil && replicaFailure.Status == corev1.ConditionTrue:
+		setCondition(nginxDeploy, webv1.ConditionDegraded, metav1.ConditionTrue, replicaFailure.Reason, replicaFailure.Message)
+	default:
+		setCondition(nginxDeploy, webv1.ConditionDegraded, metav1.ConditionFalse, "AsExpected", "All resources are reconciled")
+	}
+
+	// Report transitions of the rollout
+	if !wasAvailable && meta.IsStatusConditionTrue(nginxDeploy.Status.Conditions, webv1.ConditionAvailable) {
+		r.Recorder.Event(nginxDeploy, corev1.EventTypeNormal, "Available", available)
+	}
+	if degraded := meta.FindStatusCondition(nginxDeploy.Status.Conditions, webv1.ConditionDegraded); !wasDegraded &&
+		degraded.Status == metav1.ConditionTrue {
+		r.Recorder.Event(nginxDeploy, corev1.EventTypeWarning, degraded.Reason, degraded.Message)
+	}
+
+	// Status is updated here only after all resources are reconciled
+	nginxDeploy.Status.ObservedGeneration = nginxDeploy.Generation
+
 	return r.Status().Update(ctx, nginxDeploy)
 }
 
@@ -232,5 +844,12 @@ func (r *NginxDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&webv1.NginxDeployment{}).
 		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.Service{}).
+		Owns(&networkingv1.Ingress{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&discoveryv1.EndpointSlice{}).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.canaryPodRequests)).
 		Complete(r)
 }
@@ -18,14 +18,27 @@ package controller
 
 import (
 	"context"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	webv1 "github.com/redbeardster/nginx-operator/api/v1"
 )
@@ -51,7 +64,50 @@ var _ = Describe("NginxDeployment Controller", func() {
 						Name:      resourceName,
 						Namespace: "default",
 					},
-					// TODO(user): Specify other spec details if needed.
+					Spec: webv1.NginxDeploymentSpec{
+						Labels:             map[string]string{"team": "web"},
+						PodLabels:          map[string]string{"app": "overridden", "tier": "frontend"},
+						ServiceAnnotations: map[string]string{"prometheus.io/scrape": "true"},
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse("100m"),
+								corev1.ResourceMemory: resource.MustParse("64Mi"),
+							},
+						},
+						LivenessProbe:  &webv1.NginxProbeSpec{Disabled: true},
+						ReadinessProbe: &webv1.NginxProbeSpec{Path: "/healthz"},
+						Ingress: &webv1.NginxIngressSpec{
+							Host: "nginx.example.com",
+						},
+						Config: &webv1.NginxConfigSpec{
+							Snippets: map[string]string{
+								"default.conf": "server { listen 80; location / { return 200; } }",
+							},
+						},
+						InitContainers: []corev1.Container{{
+							Name:         "fetch",
+							Image:        "alpine/git",
+							Args:         []string{"clone", "https://example.com/docs.git", "/docs"},
+							VolumeMounts: []corev1.VolumeMount{{Name: "docs", MountPath: "/docs"}},
+						}},
+						Volumes: []corev1.Volume{{
+							Name:         "docs",
+							VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+						}},
+						VolumeMounts: []corev1.VolumeMount{{Name: "docs", MountPath: "/usr/share/nginx/html/docs"}},
+						Content: &webv1.NginxContentSpec{
+							ConfigMapRef: corev1.LocalObjectReference{Name: "site"},
+							SubPath:      "static",
+						},
+						NetworkPolicy: &webv1.NginxNetworkPolicySpec{
+							Enabled: true,
+							From: []networkingv1.NetworkPolicyPeer{{
+								NamespaceSelector: &metav1.LabelSelector{
+									MatchLabels: map[string]string{"kubernetes.io/metadata.name": "ingress-nginx"},
+								},
+							}},
+						},
+					},
 				}
 				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
 			}
@@ -65,20 +121,883 @@ var _ = Describe("NginxDeployment Controller", func() {
 
 			By("Cleanup the specific resource instance NginxDeployment")
 			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			By("Running the finalizer cleanup")
+			controllerReconciler := &NginxDeploymentReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+			}
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			// The Deployment serving traffic is drained, the idle blue-green one is removed at once
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      activeDeploymentName(resource),
+				Namespace: "default",
+			}, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(BeZero())
+			if blueGreen := resource.Status.BlueGreen; blueGreen != nil {
+				err = k8sClient.Get(ctx, types.NamespacedName{
+					Name:      colorDeploymentName(resource, otherColor(blueGreen.ActiveColor)),
+					Namespace: "default",
+				}, deployment)
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+			}
+
+			// Without pods the scaled down Deployment is drained on the next pass
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
 		})
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &NginxDeploymentReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
 			}
 
-			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
 				NamespacedName: typeNamespacedName,
 			})
 			Expect(err).NotTo(HaveOccurred())
+			// Pods are not started by envtest, so the rollout never completes
+			Expect(result.RequeueAfter).NotTo(BeZero())
+
+			By("Recording events for created resources")
+			var events []string
+			recorder := controllerReconciler.Recorder.(*record.FakeRecorder)
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			Expect(events).To(ContainElement("Normal Created Created Deployment " + resourceName + "-deployment"))
 			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
+
+			By("Checking the finalizer")
+			reconciled := &webv1.NginxDeployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, reconciled)).To(Succeed())
+			Expect(reconciled.Finalizers).To(ContainElement(nginxFinalizer))
+
+			By("Checking the status conditions")
+			Expect(meta.IsStatusConditionTrue(reconciled.Status.Conditions, webv1.ConditionConfigValid)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(reconciled.Status.Conditions, webv1.ConditionAvailable)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(reconciled.Status.Conditions, webv1.ConditionProgressing)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(reconciled.Status.Conditions, webv1.ConditionDegraded)).To(BeTrue())
+			Expect(reconciled.Status.ObservedGeneration).To(Equal(reconciled.Generation))
+
+			By("Checking the nginx container resources")
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-deployment",
+				Namespace: "default",
+			}, deployment)).To(Succeed())
+			requests := deployment.Spec.Template.Spec.Containers[0].Resources.Requests
+			Expect(requests.Cpu().String()).To(Equal("100m"))
+			Expect(requests.Memory().String()).To(Equal("64Mi"))
+
+			By("Checking the nginx container probes")
+			Expect(deployment.Spec.Template.Spec.Containers[0].LivenessProbe).To(BeNil())
+			Expect(deployment.Spec.Template.Spec.Containers[0].ReadinessProbe.HTTPGet.Path).To(Equal("/healthz"))
+
+			By("Checking the mounted nginx configuration")
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-config",
+				Namespace: "default",
+			}, configMap)).To(Succeed())
+			Expect(configMap.Data).To(HaveKey("default.conf"))
+			Expect(deployment.Spec.Template.Annotations).To(HaveKeyWithValue(configHashAnnotation, configHash(configMap.Data)))
+			Expect(deployment.Spec.Template.Spec.Containers[0].VolumeMounts).To(HaveLen(3))
+
+			By("Checking the static content mounted under the web root")
+			Expect(deployment.Spec.Template.Spec.Containers[0].VolumeMounts).To(ContainElement(And(
+				HaveField("Name", "content"),
+				HaveField("MountPath", "/usr/share/nginx/html/static"),
+			)))
+			Expect(deployment.Spec.Template.Spec.Volumes).To(ContainElement(
+				HaveField("VolumeSource.ConfigMap.LocalObjectReference.Name", "site")))
+
+			By("Checking init containers share the volume with nginx")
+			Expect(deployment.Spec.Template.Spec.InitContainers).To(HaveLen(1))
+			Expect(deployment.Spec.Template.Spec.InitContainers[0].Name).To(Equal("fetch"))
+			Expect(deployment.Spec.Template.Spec.Volumes).To(ContainElement(HaveField("Name", "docs")))
+			Expect(deployment.Spec.Template.Spec.Containers[0].VolumeMounts).To(ContainElement(
+				HaveField("MountPath", "/usr/share/nginx/html/docs")))
+
+			By("Checking labels and annotations of child resources")
+			Expect(deployment.Labels).To(HaveKeyWithValue("team", "web"))
+			Expect(deployment.Spec.Template.Labels).To(Equal(map[string]string{
+				"app": resourceName, "team": "web", "tier": "frontend", instanceLabel: resourceName,
+			}))
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-service",
+				Namespace: "default",
+			}, service)).To(Succeed())
+			Expect(service.Labels).To(HaveKeyWithValue("team", "web"))
+			Expect(service.Annotations).To(HaveKeyWithValue("prometheus.io/scrape", "true"))
+
+			By("Updating the Service when the port changes")
+			reconciled.Spec.Port = 8080
+			Expect(k8sClient.Update(ctx, reconciled)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-service",
+				Namespace: "default",
+			}, service)).To(Succeed())
+			Expect(service.Spec.Ports[0].Port).To(Equal(int32(8080)))
+			Expect(service.Spec.Ports[0].TargetPort.String()).To(Equal("http"))
+
+			By("Checking the Ingress pointing at the Service")
+			ingress := &networkingv1.Ingress{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-ingress",
+				Namespace: "default",
+			}, ingress)).To(Succeed())
+			Expect(ingress.Spec.Rules).To(HaveLen(1))
+			Expect(ingress.Spec.Rules[0].Host).To(Equal("nginx.example.com"))
+			Expect(ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name).To(Equal(resourceName + "-service"))
+
+			By("Checking the NetworkPolicy allowing the nginx port")
+			policy := &networkingv1.NetworkPolicy{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-networkpolicy",
+				Namespace: "default",
+			}, policy)).To(Succeed())
+			Expect(policy.Spec.PodSelector.MatchLabels).To(Equal(map[string]string{instanceLabel: resourceName}))
+			Expect(policy.Spec.Ingress).To(HaveLen(1))
+			Expect(policy.Spec.Ingress[0].Ports).To(HaveLen(1))
+			Expect(policy.Spec.Ingress[0].Ports[0].Port.IntValue()).To(Equal(8080))
+			Expect(policy.Spec.Ingress[0].From[0].NamespaceSelector.MatchLabels).To(HaveKey("kubernetes.io/metadata.name"))
+
+			By("Keeping containers injected by other controllers")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-deployment",
+				Namespace: "default",
+			}, deployment)).To(Succeed())
+			Expect(deployment.ManagedFields).To(ContainElement(And(
+				HaveField("Manager", fieldManager),
+				HaveField("Operation", metav1.ManagedFieldsOperationApply),
+			)))
+			deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers,
+				corev1.Container{Name: "injected", Image: "busybox"})
+			Expect(k8sClient.Update(ctx, deployment, client.FieldOwner("sidecar-injector"))).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-deployment",
+				Namespace: "default",
+			}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers).To(ContainElement(HaveField("Name", "injected")))
+
+			By("Exposing nginx through the LoadBalancer Service")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, reconciled)).To(Succeed())
+			loadBalancerClass := "example.com/internal"
+			reconciled.Spec.Service = &webv1.NginxServiceSpec{
+				Type:              corev1.ServiceTypeLoadBalancer,
+				NodePort:          30080,
+				LoadBalancerClass: &loadBalancerClass,
+				Annotations: map[string]string{
+					"service.beta.kubernetes.io/aws-load-balancer-internal": "true",
+					"prometheus.io/scrape": "false",
+				},
+			}
+			Expect(k8sClient.Update(ctx, reconciled)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-service",
+				Namespace: "default",
+			}, service)).To(Succeed())
+			Expect(service.Spec.Type).To(Equal(corev1.ServiceTypeLoadBalancer))
+			Expect(service.Spec.LoadBalancerClass).To(HaveValue(Equal(loadBalancerClass)))
+			Expect(service.Spec.Ports[0].NodePort).To(Equal(int32(30080)))
+			// Service annotations override serviceAnnotations
+			Expect(service.Annotations).To(HaveKeyWithValue("prometheus.io/scrape", "false"))
+			Expect(service.Annotations).To(HaveKeyWithValue("service.beta.kubernetes.io/aws-load-balancer-internal", "true"))
+
+			By("Serving multiple named ports")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, reconciled)).To(Succeed())
+			reconciled.Spec.Ports = []webv1.NginxPort{
+				{Name: "http", ContainerPort: 8080, ServicePort: 80},
+				{Name: "syslog", ContainerPort: 5140, Protocol: corev1.ProtocolUDP},
+			}
+			Expect(k8sClient.Update(ctx, reconciled)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-service",
+				Namespace: "default",
+			}, service)).To(Succeed())
+			Expect(service.Spec.Ports).To(HaveLen(2))
+			Expect(service.Spec.Ports[0]).To(And(
+				HaveField("Name", "http"),
+				HaveField("Port", int32(80)),
+				HaveField("TargetPort", intstr.FromString("http")),
+				HaveField("Protocol", corev1.ProtocolTCP),
+				HaveField("NodePort", int32(30080)),
+			))
+			Expect(service.Spec.Ports[1]).To(And(
+				HaveField("Name", "syslog"),
+				HaveField("Port", int32(5140)),
+				HaveField("TargetPort", intstr.FromString("syslog")),
+				HaveField("Protocol", corev1.ProtocolUDP),
+			))
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-deployment",
+				Namespace: "default",
+			}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Ports).To(Equal([]corev1.ContainerPort{
+				{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP},
+				{Name: "syslog", ContainerPort: 5140, Protocol: corev1.ProtocolUDP},
+			}))
+
+			By("Propagating scheduling controls to the pod template")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, reconciled)).To(Succeed())
+			reconciled.Spec.NodeSelector = map[string]string{"node-pool": "edge"}
+			reconciled.Spec.Affinity = &corev1.Affinity{
+				PodAntiAffinity: &corev1.PodAntiAffinity{
+					PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+						Weight: 100,
+						PodAffinityTerm: corev1.PodAffinityTerm{
+							LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": resourceName}},
+							TopologyKey:   "kubernetes.io/hostname",
+						},
+					}},
+				},
+			}
+			reconciled.Spec.Tolerations = []corev1.Toleration{{
+				Key:      "edge",
+				Operator: corev1.TolerationOpExists,
+				Effect:   corev1.TaintEffectNoSchedule,
+			}}
+			Expect(k8sClient.Update(ctx, reconciled)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-deployment",
+				Namespace: "default",
+			}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.NodeSelector).To(Equal(map[string]string{"node-pool": "edge"}))
+			Expect(deployment.Spec.Template.Spec.Affinity).To(Equal(reconciled.Spec.Affinity))
+			Expect(deployment.Spec.Template.Spec.Tolerations).To(Equal(reconciled.Spec.Tolerations))
+		})
+
+		It("should scale the Deployment with the HorizontalPodAutoscaler", func() {
+			controllerReconciler := &NginxDeploymentReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Enabling autoscaling")
+			reconciled := &webv1.NginxDeployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, reconciled)).To(Succeed())
+			minReplicas, targetCPU := int32(2), int32(60)
+			reconciled.Spec.Autoscaling = &webv1.NginxAutoscalingSpec{
+				MinReplicas:          &minReplicas,
+				MaxReplicas:          5,
+				TargetCPUUtilization: &targetCPU,
+			}
+			Expect(k8sClient.Update(ctx, reconciled)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking the HorizontalPodAutoscaler targeting the Deployment")
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+			hpaName := types.NamespacedName{Name: resourceName + "-hpa", Namespace: "default"}
+			Expect(k8sClient.Get(ctx, hpaName, hpa)).To(Succeed())
+			Expect(hpa.Spec.ScaleTargetRef).To(Equal(autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       resourceName + "-deployment",
+			}))
+			Expect(*hpa.Spec.MinReplicas).To(Equal(int32(2)))
+			Expect(hpa.Spec.MaxReplicas).To(Equal(int32(5)))
+			Expect(hpa.Spec.Metrics).To(HaveLen(1))
+			Expect(hpa.Spec.Metrics[0].Resource.Name).To(Equal(corev1.ResourceCPU))
+			Expect(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization).To(Equal(int32(60)))
+
+			By("Leaving replicas of the Deployment to the HorizontalPodAutoscaler")
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-deployment",
+				Namespace: "default",
+			}, deployment)).To(Succeed())
+			Expect(deployment.ManagedFields).To(ContainElement(And(
+				HaveField("Manager", fieldManager),
+				HaveField("Operation", metav1.ManagedFieldsOperationApply),
+			)))
+			for _, entry := range deployment.ManagedFields {
+				if entry.Manager == fieldManager && entry.Operation == metav1.ManagedFieldsOperationApply {
+					Expect(string(entry.FieldsV1.Raw)).NotTo(ContainSubstring(`"f:replicas"`))
+				}
+			}
+
+			By("Removing the HorizontalPodAutoscaler when autoscaling is disabled")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, reconciled)).To(Succeed())
+			reconciled.Spec.Autoscaling = nil
+			Expect(k8sClient.Update(ctx, reconciled)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Get(ctx, hpaName, hpa)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should protect nginx pods with the PodDisruptionBudget", func() {
+			controllerReconciler := &NginxDeploymentReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			pdb := &policyv1.PodDisruptionBudget{}
+			pdbName := types.NamespacedName{Name: resourceName + "-pdb", Namespace: "default"}
+			err = k8sClient.Get(ctx, pdbName, pdb)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+
+			By("Requesting the PodDisruptionBudget")
+			reconciled := &webv1.NginxDeployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, reconciled)).To(Succeed())
+			minAvailable := intstr.FromString("50%")
+			reconciled.Spec.PDB = &webv1.NginxPDBSpec{MinAvailable: &minAvailable}
+			Expect(k8sClient.Update(ctx, reconciled)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking the PodDisruptionBudget selecting nginx pods")
+			Expect(k8sClient.Get(ctx, pdbName, pdb)).To(Succeed())
+			Expect(pdb.Spec.Selector.MatchLabels).To(Equal(map[string]string{instanceLabel: resourceName}))
+			Expect(pdb.Spec.MinAvailable.String()).To(Equal("50%"))
+			Expect(pdb.Spec.MaxUnavailable).To(BeNil())
+			Expect(pdb.Labels).To(HaveKeyWithValue("team", "web"))
+			Expect(metav1.IsControlledBy(pdb, reconciled)).To(BeTrue())
+
+			By("Removing the PodDisruptionBudget when it is no longer requested")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, reconciled)).To(Succeed())
+			reconciled.Spec.PDB = nil
+			Expect(k8sClient.Update(ctx, reconciled)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Get(ctx, pdbName, pdb)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should export metrics through the sidecar and the ServiceMonitor", func() {
+			controllerReconciler := &NginxDeploymentReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Enabling metrics")
+			reconciled := &webv1.NginxDeployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, reconciled)).To(Succeed())
+			reconciled.Spec.Metrics = &webv1.NginxMetricsSpec{Enabled: true, Interval: "30s"}
+			Expect(k8sClient.Update(ctx, reconciled)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking the exporter sidecar")
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-deployment",
+				Namespace: "default",
+			}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers).To(ContainElement(And(
+				HaveField("Name", "exporter"),
+				HaveField("Image", defaultExporterImage),
+				HaveField("Ports", ContainElement(And(
+					HaveField("Name", "metrics"),
+					HaveField("ContainerPort", int32(9113)),
+				))),
+			)))
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-config",
+				Namespace: "default",
+			}, configMap)).To(Succeed())
+			Expect(configMap.Data).To(HaveKeyWithValue("metrics.conf", ContainSubstring("stub_status;")))
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-service",
+				Namespace: "default",
+			}, service)).To(Succeed())
+			Expect(service.Spec.Ports).To(ContainElement(And(
+				HaveField("Name", "metrics"),
+				HaveField("Port", int32(9113)),
+				HaveField("TargetPort", intstr.FromString("metrics")),
+			)))
+
+			By("Checking the ServiceMonitor scraping the metrics port")
+			monitor := &unstructured.Unstructured{}
+			monitor.SetGroupVersionKind(serviceMonitorGVK)
+			monitorName := types.NamespacedName{Name: resourceName + "-metrics", Namespace: "default"}
+			Expect(k8sClient.Get(ctx, monitorName, monitor)).To(Succeed())
+			Expect(monitor.GetLabels()).To(HaveKeyWithValue("team", "web"))
+			Expect(monitor.Object["spec"]).To(Equal(map[string]interface{}{
+				"selector": map[string]interface{}{
+					"matchLabels": map[string]interface{}{"app": resourceName},
+				},
+				"endpoints": []interface{}{
+					map[string]interface{}{"port": "metrics", "interval": "30s"},
+				},
+			}))
+
+			By("Removing the sidecar and the ServiceMonitor when metrics are disabled")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, reconciled)).To(Succeed())
+			reconciled.Spec.Metrics = nil
+			Expect(k8sClient.Update(ctx, reconciled)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Get(ctx, monitorName, monitor)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-deployment",
+				Namespace: "default",
+			}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers).NotTo(ContainElement(HaveField("Name", "exporter")))
+		})
+
+		It("should serve HTTPS once cert-manager issues the certificate", func() {
+			controllerReconciler := &NginxDeploymentReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Requesting the certificate")
+			reconciled := &webv1.NginxDeployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, reconciled)).To(Succeed())
+			reconciled.Spec.TLS = &webv1.NginxTLSSpec{
+				IssuerRef: webv1.NginxIssuerRef{Name: "letsencrypt", Kind: "ClusterIssuer"},
+			}
+			Expect(k8sClient.Update(ctx, reconciled)).To(Succeed())
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking the Certificate for the Ingress host")
+			certificate := &unstructured.Unstructured{}
+			certificate.SetGroupVersionKind(certificateGVK)
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-tls",
+				Namespace: "default",
+			}, certificate)).To(Succeed())
+			Expect(certificate.Object["spec"]).To(Equal(map[string]interface{}{
+				"secretName": resourceName + "-tls",
+				"dnsNames":   []interface{}{"nginx.example.com"},
+				"issuerRef": map[string]interface{}{
+					"name":  "letsencrypt",
+					"kind":  "ClusterIssuer",
+					"group": "cert-manager.io",
+				},
+			}))
+
+			By("Waiting for the Secret without serving HTTPS")
+			Expect(result.RequeueAfter).To(Equal(10 * time.Second))
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-config",
+				Namespace: "default",
+			}, configMap)).To(Succeed())
+			Expect(configMap.Data).NotTo(HaveKey("tls.conf"))
+
+			By("Issuing the certificate like cert-manager does")
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        resourceName + "-tls",
+					Namespace:   "default",
+					Annotations: map[string]string{certificateNameAnnotation: resourceName + "-tls"},
+				},
+				Type: corev1.SecretTypeTLS,
+				Data: map[string][]byte{
+					corev1.TLSCertKey:       []byte("certificate"),
+					corev1.TLSPrivateKeyKey: []byte("key"),
+				},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(Equal(10 * time.Second))
+
+			By("Checking the HTTPS server block")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-config",
+				Namespace: "default",
+			}, configMap)).To(Succeed())
+			Expect(configMap.Data).To(HaveKeyWithValue("tls.conf", ContainSubstring("listen 443 ssl;")))
+			Expect(configMap.Data["tls.conf"]).To(ContainSubstring("ssl_certificate /etc/nginx/tls/tls.crt;"))
+
+			By("Checking the certificate mounted into nginx")
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-deployment",
+				Namespace: "default",
+			}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Volumes).To(ContainElement(And(
+				HaveField("Name", "tls"),
+				HaveField("VolumeSource.Secret.SecretName", resourceName+"-tls"),
+			)))
+			container := deployment.Spec.Template.Spec.Containers[0]
+			Expect(container.VolumeMounts).To(ContainElement(And(
+				HaveField("Name", "tls"),
+				HaveField("MountPath", "/etc/nginx/tls"),
+			)))
+			Expect(container.Ports).To(ContainElement(And(
+				HaveField("Name", "https"),
+				HaveField("ContainerPort", int32(443)),
+			)))
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-service",
+				Namespace: "default",
+			}, service)).To(Succeed())
+			Expect(service.Spec.Ports).To(ContainElement(HaveField("Name", "https")))
+		})
+
+		It("should roll out pod template changes through the canary Deployment", func() {
+			controllerReconciler := &NginxDeploymentReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Changing the image with the canary strategy")
+			resource := &webv1.NginxDeployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			replicas := int32(2)
+			resource.Spec.Replicas = &replicas
+			resource.Spec.Image = "nginx:mainline"
+			resource.Spec.Strategy = &webv1.NginxStrategySpec{
+				Canary: &webv1.NginxCanarySpec{Steps: []webv1.NginxCanaryStep{{Weight: 50}}},
+			}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking the canary Deployment runs the new image next to the stable one")
+			stable := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-deployment",
+				Namespace: "default",
+			}, stable)).To(Succeed())
+			Expect(stable.Spec.Template.Spec.Containers[0].Image).To(Equal(webv1.DefaultImage))
+			canary := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-canary",
+				Namespace: "default",
+			}, canary)).To(Succeed())
+			Expect(canary.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:mainline"))
+			Expect(canary.Spec.Template.Labels).To(HaveKeyWithValue("app", resourceName+"-canary"))
+			Expect(canary.Spec.Template.Labels).To(HaveKeyWithValue(instanceLabel, resourceName))
+			Expect(*canary.Spec.Replicas).To(Equal(int32(1)))
+			Expect(*stable.Spec.Replicas).To(Equal(int32(2)))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Canary).NotTo(BeNil())
+			Expect(resource.Status.Canary.Phase).To(Equal(webv1.CanaryPhaseProgressing))
+			Expect(resource.Status.Canary.Weight).To(BeZero())
+			Expect(resource.Status.Canary.CanaryRevision).To(Equal(canary.Annotations[revisionAnnotation]))
+
+			By("Routing the step weight through the Service once the canary pods are ready")
+			// There are no kubelet and endpointslice controller in envtest, pods and EndpointSlices are created by hand
+			createReadyPod := func(name, app, ip string) {
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      name,
+						Namespace: "default",
+						Labels:    map[string]string{"app": app, instanceLabel: resourceName},
+					},
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{
+						Name:  "nginx",
+						Image: webv1.DefaultImage,
+						Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 80}},
+					}}},
+				}
+				Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+				DeferCleanup(func() { Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, pod))).To(Succeed()) })
+				pod.Status.PodIP = ip
+				pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+				Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+			}
+			createReadyPod("stable-a", resourceName, "10.0.0.1")
+			createReadyPod("stable-b", resourceName, "10.0.0.2")
+			createReadyPod("canary-a", resourceName+"-canary", "10.0.0.3")
+			createSelectorEndpointSlice := func() {
+				slice := &discoveryv1.EndpointSlice{
+					ObjectMeta: metav1.ObjectMeta{
+						GenerateName: resourceName + "-service-",
+						Namespace:    "default",
+						Labels: map[string]string{
+							discoveryv1.LabelServiceName: resourceName + "-service",
+							discoveryv1.LabelManagedBy:   endpointSliceControllerManager,
+						},
+					},
+					AddressType: discoveryv1.AddressTypeIPv4,
+				}
+				Expect(k8sClient.Create(ctx, slice)).To(Succeed())
+				DeferCleanup(func() { Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, slice))).To(Succeed()) })
+			}
+			createSelectorEndpointSlice()
+
+			canary.Status.ObservedGeneration = canary.Generation
+			canary.Status.Replicas = 1
+			canary.Status.UpdatedReplicas = 1
+			canary.Status.AvailableReplicas = 1
+			Expect(k8sClient.Status().Update(ctx, canary)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Canary.Phase).To(Equal(webv1.CanaryPhaseProgressing))
+			Expect(resource.Status.Canary.Weight).To(Equal(int32(50)))
+			Expect(resource.Status.Canary.EffectiveWeight).To(Equal(int32(50)))
+
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-service",
+				Namespace: "default",
+			}, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(BeEmpty())
+			endpointAddresses := func(track string) []string {
+				slice := &discoveryv1.EndpointSlice{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{
+					Name:      resourceName + "-service-" + track,
+					Namespace: "default",
+				}, slice)).To(Succeed())
+				Expect(slice.Labels).To(HaveKeyWithValue(discoveryv1.LabelServiceName, resourceName+"-service"))
+				var addresses []string
+				for _, endpoint := range slice.Endpoints {
+					addresses = append(addresses, endpoint.Addresses...)
+				}
+				if len(addresses) > 0 {
+					Expect(slice.Ports).To(HaveLen(1))
+					Expect(*slice.Ports[0].Name).To(Equal("http"))
+					Expect(*slice.Ports[0].Port).To(Equal(int32(80)))
+				}
+				return addresses
+			}
+			Expect(endpointAddresses("stable")).To(Equal([]string{"10.0.0.1"}))
+			Expect(endpointAddresses("canary")).To(Equal([]string{"10.0.0.3"}))
+			slices := &discoveryv1.EndpointSliceList{}
+			Expect(k8sClient.List(ctx, slices, client.InNamespace("default"), client.MatchingLabels{
+				discoveryv1.LabelManagedBy: endpointSliceControllerManager,
+			})).To(Succeed())
+			Expect(slices.Items).To(BeEmpty())
+			canaryService := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-canary",
+				Namespace: "default",
+			}, canaryService)).To(Succeed())
+			Expect(canaryService.Spec.Selector).To(Equal(map[string]string{"app": resourceName + "-canary"}))
+
+			By("Pausing the step once the Service routes its weight")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Canary.Phase).To(Equal(webv1.CanaryPhasePaused))
+
+			By("Promoting the canary")
+			resource.Annotations = map[string]string{webv1.CanaryActionAnnotation: webv1.CanaryActionPromote}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-deployment",
+				Namespace: "default",
+			}, stable)).To(Succeed())
+			Expect(stable.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:mainline"))
+			err = k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-canary",
+				Namespace: "default",
+			}, canary)
+			Expect(errors.IsNotFound(err) || !canary.DeletionTimestamp.IsZero()).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Canary).To(BeNil())
+			Expect(resource.Annotations).NotTo(HaveKey(webv1.CanaryActionAnnotation))
+
+			By("Keeping all stable pods as endpoints until the Service selector is listed again")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-service",
+				Namespace: "default",
+			}, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(Equal(map[string]string{"app": resourceName}))
+			Expect(endpointAddresses("stable")).To(Equal([]string{"10.0.0.1", "10.0.0.2"}))
+			Expect(endpointAddresses("canary")).To(BeEmpty())
+
+			createSelectorEndpointSlice()
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.List(ctx, slices, client.InNamespace("default"), client.MatchingLabels{
+				discoveryv1.LabelManagedBy: endpointSliceManager,
+			})).To(Succeed())
+			Expect(slices.Items).To(BeEmpty())
+		})
+
+		It("should switch the Service to the green Deployment once it is available", func() {
+			controllerReconciler := &NginxDeploymentReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+			}
+			resource := &webv1.NginxDeployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Strategy = &webv1.NginxStrategySpec{BlueGreen: &webv1.NginxBlueGreenSpec{}}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			// There is no Deployment controller in envtest, rollouts are completed by hand
+			completeRollout := func(name string) {
+				deployment := &appsv1.Deployment{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, deployment)).To(Succeed())
+				deployment.Status.ObservedGeneration = deployment.Generation
+				deployment.Status.Replicas = *deployment.Spec.Replicas
+				deployment.Status.UpdatedReplicas = *deployment.Spec.Replicas
+				deployment.Status.ReadyReplicas = *deployment.Spec.Replicas
+				deployment.Status.AvailableReplicas = *deployment.Spec.Replicas
+				Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			serviceSelector := func() map[string]string {
+				service := &corev1.Service{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{
+					Name:      resourceName + "-service",
+					Namespace: "default",
+				}, service)).To(Succeed())
+				return service.Spec.Selector
+			}
+
+			By("Labelling the existing Deployment blue")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(serviceSelector()).NotTo(HaveKey(colorLabel))
+			completeRollout(resourceName + "-deployment")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.BlueGreen).NotTo(BeNil())
+			Expect(resource.Status.BlueGreen.ActiveColor).To(Equal(webv1.BlueGreenColorBlue))
+			Expect(serviceSelector()).To(HaveKeyWithValue(colorLabel, webv1.BlueGreenColorBlue))
+
+			By("Rolling out the new image to the green Deployment")
+			resource.Spec.Image = "nginx:mainline"
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			green := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-green",
+				Namespace: "default",
+			}, green)).To(Succeed())
+			Expect(green.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:mainline"))
+			Expect(green.Spec.Selector.MatchLabels).To(HaveKeyWithValue(colorLabel, webv1.BlueGreenColorGreen))
+			Expect(serviceSelector()).To(HaveKeyWithValue(colorLabel, webv1.BlueGreenColorBlue))
+
+			By("Switching the Service once green is available")
+			completeRollout(resourceName + "-green")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.BlueGreen.ActiveColor).To(Equal(webv1.BlueGreenColorGreen))
+			Expect(resource.Status.BlueGreen.SwitchTime).NotTo(BeNil())
+			Expect(serviceSelector()).To(HaveKeyWithValue(colorLabel, webv1.BlueGreenColorGreen))
+
+			By("Keeping the blue Deployment for rollback")
+			blue := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-deployment",
+				Namespace: "default",
+			}, blue)).To(Succeed())
+			Expect(blue.Spec.Template.Spec.Containers[0].Image).To(Equal(webv1.DefaultImage))
+			Expect(*blue.Spec.Replicas).To(Equal(int32(1)))
+
+			// Pods of green reported by hand would never terminate and block the finalizer draining it
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + "-green",
+				Namespace: "default",
+			}, green)).To(Succeed())
+			green.Status = appsv1.DeploymentStatus{}
+			Expect(k8sClient.Status().Update(ctx, green)).To(Succeed())
 		})
 	})
 })
+
+var _ = Describe("Canary endpoints", func() {
+	DescribeTable("should approximate the weight with the ready pods",
+		func(canary, stable int, weight int32, wantCanary, wantStable int) {
+			canaryCount, stableCount := weightedEndpoints(canary, stable, weight)
+			Expect(canaryCount).To(Equal(wantCanary))
+			Expect(stableCount).To(Equal(wantStable))
+		},
+		Entry("no weight", 1, 3, int32(0), 0, 3),
+		Entry("no ready canary pods", 0, 3, int32(20), 0, 3),
+		Entry("exact share", 2, 10, int32(20), 2, 8),
+		Entry("half of the pods", 5, 10, int32(50), 5, 5),
+		Entry("too few pods for the weight", 1, 2, int32(5), 1, 2),
+		Entry("full weight", 2, 3, int32(100), 2, 0),
+		Entry("no ready stable pods", 1, 0, int32(10), 1, 0),
+	)
+})
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	webv1 "github.com/redbeardster/nginx-operator/api/v1"
+)
+
+// Certificate is handled as unstructured object, so the operator
+// does not depend on cert-manager and works in clusters without it
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+const (
+	tlsMountPath  = "/etc/nginx/tls"
+	tlsConfigFile = "tls.conf"
+)
+
+func tlsName(nginxDeploy *webv1.NginxDeployment) string {
+	return nginxDeploy.Name + "-tls"
+}
+
+func tlsPort(nginxDeploy *webv1.NginxDeployment) int32 {
+	if nginxDeploy.Spec.TLS.Port == 0 {
+		return 443
+	}
+	return nginxDeploy.Spec.TLS.Port
+}
+
+func certificateDNSNames(nginxDeploy *webv1.NginxDeployment) []interface{} {
+	names := nginxDeploy.Spec.TLS.DNSNames
+	if len(names) == 0 && nginxDeploy.Spec.Ingress != nil {
+		names = []string{nginxDeploy.Spec.Ingress.Host}
+	}
+	if len(names) == 0 {
+		service := nginxDeploy.Name + "-service"
+		names = []string{service + "." + nginxDeploy.Namespace + ".svc", service + "." + nginxDeploy.Namespace + ".svc.cluster.local"}
+	}
+	dnsNames := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		dnsNames = append(dnsNames, name)
+	}
+	return dnsNames
+}
+
+// tlsServerConfig renders nginx server block serving HTTPS with the mounted certificate
+func tlsServerConfig(nginxDeploy *webv1.NginxDeployment) string {
+	return fmt.Sprintf(`server {
+    listen %d ssl;
+    ssl_certificate %s/tls.crt;
+    ssl_certificate_key %s/tls.key;
+
+    location / {
+        root /usr/share/nginx/html;
+        index index.html index.htm;
+    }
+}
+`, tlsPort(nginxDeploy), tlsMountPath, tlsMountPath)
+}
+
+// reconcileCertificate applies the Certificate and reports whether its Secret can be mounted into nginx
+func (r *NginxDeploymentReconciler) reconcileCertificate(ctx context.Context, nginxDeploy *webv1.NginxDeployment) (bool, error) {
+	// Remove Certificate if TLS is no longer requested
+	if nginxDeploy.Spec.TLS == nil {
+		nginxDeploy.Status.Certificate = ""
+		foundCertificate := &unstructured.Unstructured{}
+		foundCertificate.SetGroupVersionKind(certificateGVK)
+		return false, r.deleteOwned(ctx, nginxDeploy, "Certificate", foundCertificate, tlsName(nginxDeploy))
+	}
+
+	issuerKind := nginxDeploy.Spec.TLS.IssuerRef.Kind
+	if issuerKind == "" {
+		issuerKind = "Issuer"
+	}
+	certificate := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"secretName": tlsName(nginxDeploy),
+			"dnsNames":   certificateDNSNames(nginxDeploy),
+			"issuerRef": map[string]interface{}{
+				"name":  nginxDeploy.Spec.TLS.IssuerRef.Name,
+				"kind":  issuerKind,
+				"group": certificateGVK.Group,
+			},
+		},
+	}}
+	certificate.SetGroupVersionKind(certificateGVK)
+	certificate.SetName(tlsName(nginxDeploy))
+	certificate.SetNamespace(nginxDeploy.Namespace)
+
+	if err := r.apply(ctx, nginxDeploy, certificate); err != nil {
+		return false, err
+	}
+	nginxDeploy.Status.Certificate = certificateStatus(certificate)
+
+	// Wait for cert-manager to store the certificate
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      tlsName(nginxDeploy),
+		Namespace: nginxDeploy.Namespace,
+	}, secret)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return len(secret.Data[corev1.TLSCertKey]) > 0 && len(secret.Data[corev1.TLSPrivateKeyKey]) > 0, nil
+}
+
+// certificateStatus reports the Ready condition of the Certificate
+func certificateStatus(certificate *unstructured.Unstructured) string {
+	conditions, _, _ := unstructured.NestedSlice(certificate.Object, "status", "conditions")
+	for _, item := range conditions {
+		condition, ok := item.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+		if condition["status"] == "True" {
+			return "Ready"
+		}
+		if message, ok := condition["message"].(string); ok && message != "" {
+			return "Not ready: " + message
+		}
+	}
+	return "Issuing"
+}
@@ -0,0 +1,303 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	webv1 "github.com/redbeardster/nginx-operator/api/v1"
+)
+
+// log is for logging in this package.
+var nginxdeploymentlog = logf.Log.WithName("nginxdeployment-resource")
+
+// imageReference matches image references of the distribution grammar: [domain[:port]/]path[:tag][@digest]
+var imageReference = regexp.MustCompile(`^` +
+	`(?:(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?/)?` +
+	`[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*` +
+	`(?::[\w][\w.-]{0,127})?` +
+	`(?:@[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9A-Fa-f]{32,})?` +
+	`$`)
+
+// SetupNginxDeploymentWebhookWithManager registers the webhook for NginxDeployment in the manager.
+func SetupNginxDeploymentWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&webv1.NginxDeployment{}).
+		WithValidator(&NginxDeploymentCustomValidator{}).
+		WithDefaulter(&NginxDeploymentCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-web-example-com-v1-nginxdeployment,mutating=true,failurePolicy=fail,sideEffects=None,groups=web.example.com,resources=nginxdeployments,verbs=create;update,versions=v1,name=mnginxdeployment-v1.kb.io,admissionReviewVersions=v1
+
+// NginxDeploymentCustomDefaulter struct is responsible for setting default values on the custom resource of the
+// Kind NginxDeployment when those are created or updated, so the stored spec matches the deployed one.
+type NginxDeploymentCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &NginxDeploymentCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the Kind NginxDeployment.
+func (d *NginxDeploymentCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	nginxdeployment, ok := obj.(*webv1.NginxDeployment)
+	if !ok {
+		return fmt.Errorf("expected an NginxDeployment object but got %T", obj)
+	}
+	nginxdeploymentlog.Info("Defaulting for NginxDeployment", "name", nginxdeployment.GetName())
+
+	spec := &nginxdeployment.Spec
+	if spec.Image == "" {
+		spec.Image = webv1.DefaultImage
+	}
+	if spec.Port == 0 {
+		spec.Port = webv1.DefaultPort
+	}
+	// Start autoscaled nginx at the lower limit, so the default passes validation
+	if spec.Replicas == nil {
+		replicas := int32(webv1.DefaultReplicas)
+		if spec.Autoscaling != nil && spec.Autoscaling.MinReplicas != nil {
+			replicas = *spec.Autoscaling.MinReplicas
+		}
+		spec.Replicas = &replicas
+	}
+
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-web-example-com-v1-nginxdeployment,mutating=false,failurePolicy=fail,sideEffects=None,groups=web.example.com,resources=nginxdeployments,verbs=create;update,versions=v1,name=vnginxdeployment-v1.kb.io,admissionReviewVersions=v1
+
+// NginxDeploymentCustomValidator struct is responsible for validating the NginxDeployment resource
+// when it is created, updated, or deleted.
+type NginxDeploymentCustomValidator struct{}
+
+var _ webhook.CustomValidator = &NginxDeploymentCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type NginxDeployment.
+func (v *NginxDeploymentCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	nginxdeployment, ok := obj.(*webv1.NginxDeployment)
+	if !ok {
+		return nil, fmt.Errorf("expected a NginxDeployment object but got %T", obj)
+	}
+	nginxdeploymentlog.Info("Validation for NginxDeployment upon creation", "name", nginxdeployment.GetName())
+
+	return nil, validateNginxDeployment(nginxdeployment)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type NginxDeployment.
+func (v *NginxDeploymentCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	nginxdeployment, ok := newObj.(*webv1.NginxDeployment)
+	if !ok {
+		return nil, fmt.Errorf("expected a NginxDeployment object for the newObj but got %T", newObj)
+	}
+	nginxdeploymentlog.Info("Validation for NginxDeployment upon update", "name", nginxdeployment.GetName())
+
+	return nil, validateNginxDeployment(nginxdeployment)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type NginxDeployment.
+func (v *NginxDeploymentCustomValidator) ValidateDelete(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateNginxDeployment returns Invalid error listing every rejected field of the spec
+func validateNginxDeployment(nginxdeployment *webv1.NginxDeployment) error {
+	allErrs := validateNginxDeploymentSpec(&nginxdeployment.Spec, field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(webv1.GroupVersion.WithKind("NginxDeployment").GroupKind(), nginxdeployment.Name, allErrs)
+}
+
+func validateNginxDeploymentSpec(spec *webv1.NginxDeploymentSpec, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	replicas := int32(webv1.DefaultReplicas)
+	if spec.Replicas != nil {
+		replicas = *spec.Replicas
+	}
+	if replicas < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("replicas"), replicas, "must be greater than or equal to 0"))
+	}
+	if spec.Image != "" && !imageReference.MatchString(spec.Image) {
+		allErrs = append(allErrs, field.Invalid(path.Child("image"), spec.Image, "must be a valid image reference"))
+	}
+
+	// Port 0 selects the default one
+	if spec.Port != 0 {
+		allErrs = append(allErrs, validatePort(path.Child("port"), spec.Port)...)
+	}
+	containerPorts := map[int32]*field.Path{}
+	checkContainerPort := func(portPath *field.Path, port int32) {
+		if other, ok := containerPorts[port]; ok {
+			allErrs = append(allErrs, field.Duplicate(portPath, fmt.Sprintf("%d is already used by %s", port, other)))
+			return
+		}
+		containerPorts[port] = portPath
+	}
+	for i, port := range spec.Ports {
+		portPath := path.Child("ports").Index(i)
+		if errs := validatePort(portPath.Child("containerPort"), port.ContainerPort); len(errs) > 0 {
+			allErrs = append(allErrs, errs...)
+		} else {
+			checkContainerPort(portPath.Child("containerPort"), port.ContainerPort)
+		}
+		if port.ServicePort != 0 {
+			allErrs = append(allErrs, validatePort(portPath.Child("servicePort"), port.ServicePort)...)
+		}
+	}
+	if len(spec.Ports) == 0 && spec.Port != 0 {
+		checkContainerPort(path.Child("port"), spec.Port)
+	}
+	if spec.TLS != nil && spec.TLS.Port != 0 {
+		if errs := validatePort(path.Child("tls", "port"), spec.TLS.Port); len(errs) > 0 {
+			allErrs = append(allErrs, errs...)
+		} else {
+			checkContainerPort(path.Child("tls", "port"), spec.TLS.Port)
+		}
+	}
+	if spec.Metrics != nil && spec.Metrics.Enabled && spec.Metrics.Port != 0 {
+		if errs := validatePort(path.Child("metrics", "port"), spec.Metrics.Port); len(errs) > 0 {
+			allErrs = append(allErrs, errs...)
+		} else {
+			checkContainerPort(path.Child("metrics", "port"), spec.Metrics.Port)
+		}
+	}
+	if spec.Metrics != nil && spec.Metrics.Image != "" && !imageReference.MatchString(spec.Metrics.Image) {
+		allErrs = append(allErrs, field.Invalid(path.Child("metrics", "image"), spec.Metrics.Image, "must be a valid image reference"))
+	}
+
+	if content := spec.Content; content != nil {
+		if content.ConfigMapRef.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("content", "configMapRef", "name"), "name of the ConfigMap is required"))
+		}
+		if content.SubPath != "" && !validRelativePath(content.SubPath) {
+			allErrs = append(allErrs, field.Invalid(path.Child("content", "subPath"), content.SubPath,
+				"must be a relative path without '..'"))
+		}
+		for i, item := range content.Items {
+			if !validRelativePath(item.Path) {
+				allErrs = append(allErrs, field.Invalid(path.Child("content", "items").Index(i).Child("path"), item.Path,
+					"must be a relative path without '..'"))
+			}
+		}
+	}
+
+	// Volumes and containers of the pod template are named by the operator
+	volumes := map[string]bool{"config": true, "tls": true, "content": true}
+	userVolumes := map[string]bool{}
+	for i, volume := range spec.Volumes {
+		if volumes[volume.Name] {
+			allErrs = append(allErrs, field.Duplicate(path.Child("volumes").Index(i).Child("name"), volume.Name))
+		}
+		volumes[volume.Name] = true
+		userVolumes[volume.Name] = true
+	}
+
+	// Mounts of nginx container use the declared volumes and keep the paths mounted by the operator
+	mountPaths := operatorMountPaths(spec)
+	for i, mount := range spec.VolumeMounts {
+		mountPath := path.Child("volumeMounts").Index(i)
+		if !userVolumes[mount.Name] {
+			allErrs = append(allErrs, field.NotFound(mountPath.Child("name"), mount.Name))
+		}
+		cleaned := filepath.Clean(mount.MountPath)
+		if other, ok := mountPaths[cleaned]; ok {
+			allErrs = append(allErrs, field.Duplicate(mountPath.Child("mountPath"),
+				fmt.Sprintf("%s is already mounted by %s", mount.MountPath, other)))
+			continue
+		}
+		mountPaths[cleaned] = mountPath.Child("mountPath").String()
+	}
+	containers := map[string]bool{"nginx": true, "exporter": true}
+	for i, container := range spec.InitContainers {
+		if containers[container.Name] {
+			allErrs = append(allErrs, field.Duplicate(path.Child("initContainers").Index(i).Child("name"), container.Name))
+		}
+		containers[container.Name] = true
+	}
+
+	// Replicas are the initial number of replicas, HorizontalPodAutoscaler keeps them within its limits
+	if autoscaling := spec.Autoscaling; autoscaling != nil {
+		minReplicas := int32(1)
+		if autoscaling.MinReplicas != nil {
+			minReplicas = *autoscaling.MinReplicas
+		}
+		if minReplicas > autoscaling.MaxReplicas {
+			allErrs = append(allErrs, field.Invalid(path.Child("autoscaling", "minReplicas"), minReplicas,
+				fmt.Sprintf("must be less than or equal to maxReplicas %d", autoscaling.MaxReplicas)))
+		} else if replicas < minReplicas || replicas > autoscaling.MaxReplicas {
+			allErrs = append(allErrs, field.Invalid(path.Child("replicas"), replicas,
+				fmt.Sprintf("must be between autoscaling minReplicas %d and maxReplicas %d", minReplicas, autoscaling.MaxReplicas)))
+		}
+	}
+
+	return allErrs
+}
+
+// validRelativePath reports whether the path stays within the directory it is mounted to
+// operatorMountPaths returns paths mounted into nginx container by the operator with the fields requesting them
+func operatorMountPaths(spec *webv1.NginxDeploymentSpec) map[string]string {
+	paths := map[string]string{}
+	if config := spec.Config; config != nil {
+		if config.NginxConf != "" {
+			paths["/etc/nginx/nginx.conf"] = "spec.config.nginxConf"
+		}
+		for name := range config.Snippets {
+			paths[filepath.Join("/etc/nginx/conf.d", name)] = "spec.config.snippets"
+		}
+	}
+	if spec.TLS != nil {
+		paths["/etc/nginx/conf.d/tls.conf"] = "spec.tls"
+		paths["/etc/nginx/tls"] = "spec.tls"
+	}
+	if spec.Metrics != nil && spec.Metrics.Enabled {
+		paths["/etc/nginx/conf.d/metrics.conf"] = "spec.metrics"
+	}
+	if spec.Content != nil {
+		paths[filepath.Join("/usr/share/nginx/html", spec.Content.SubPath)] = "spec.content"
+	}
+	return paths
+}
+
+func validRelativePath(p string) bool {
+	if p == "" || strings.HasPrefix(p, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func validatePort(path *field.Path, port int32) field.ErrorList {
+	if port < 1 || port > 65535 {
+		return field.ErrorList{field.Invalid(path, port, "must be between 1 and 65535, inclusive")}
+	}
+	return nil
+}
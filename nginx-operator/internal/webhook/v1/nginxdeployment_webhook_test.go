@@ -0,0 +1,178 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	webv1 "github.com/redbeardster/nginx-operator/api/v1"
+)
+
+var _ = Describe("NginxDeployment Webhook", func() {
+	var (
+		obj       *webv1.NginxDeployment
+		oldObj    *webv1.NginxDeployment
+		validator NginxDeploymentCustomValidator
+		defaulter NginxDeploymentCustomDefaulter
+	)
+
+	BeforeEach(func() {
+		obj = &webv1.NginxDeployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-resource", Namespace: "default"},
+			Spec: webv1.NginxDeploymentSpec{
+				Replicas: ptr.To(int32(2)),
+				Image:    "nginx:1.27",
+			},
+		}
+		oldObj = obj.DeepCopy()
+		validator = NginxDeploymentCustomValidator{}
+		defaulter = NginxDeploymentCustomDefaulter{}
+	})
+
+	Context("When creating NginxDeployment under Defaulting Webhook", func() {
+		It("Should apply defaults when fields are not set", func() {
+			obj.Spec = webv1.NginxDeploymentSpec{}
+			Expect(defaulter.Default(context.Background(), obj)).To(Succeed())
+			Expect(obj.Spec.Image).To(Equal("nginx:stable"))
+			Expect(obj.Spec.Port).To(Equal(int32(80)))
+			Expect(obj.Spec.Replicas).To(Equal(ptr.To(int32(1))))
+		})
+
+		It("Should keep values which are set", func() {
+			obj.Spec.Replicas = ptr.To(int32(0))
+			Expect(defaulter.Default(context.Background(), obj)).To(Succeed())
+			Expect(obj.Spec.Image).To(Equal("nginx:1.27"))
+			Expect(obj.Spec.Replicas).To(Equal(ptr.To(int32(0))))
+		})
+
+		It("Should start autoscaled nginx at minReplicas", func() {
+			obj.Spec.Replicas = nil
+			obj.Spec.Autoscaling = &webv1.NginxAutoscalingSpec{MinReplicas: ptr.To(int32(3)), MaxReplicas: 5}
+			Expect(defaulter.Default(context.Background(), obj)).To(Succeed())
+			Expect(obj.Spec.Replicas).To(Equal(ptr.To(int32(3))))
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When creating or updating NginxDeployment under Validating Webhook", func() {
+		It("Should admit a valid spec", func() {
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().NotTo(HaveOccurred())
+			Expect(validator.ValidateUpdate(context.Background(), oldObj, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should accept image references with registry, tag and digest", func() {
+			for _, image := range []string{
+				"nginx",
+				"library/nginx:stable-alpine",
+				"registry.example.com:5000/web/nginx:1.27",
+				"nginx@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			} {
+				obj.Spec.Image = image
+				Expect(validator.ValidateCreate(context.Background(), obj)).Error().NotTo(HaveOccurred(), image)
+			}
+		})
+
+		It("Should deny negative replicas", func() {
+			obj.Spec.Replicas = ptr.To(int32(-1))
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().To(
+				MatchError(ContainSubstring("spec.replicas")))
+		})
+
+		It("Should deny ports out of range", func() {
+			obj.Spec.Ports = []webv1.NginxPort{{Name: "http", ContainerPort: 70000}}
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().To(
+				MatchError(ContainSubstring("spec.ports[0].containerPort")))
+		})
+
+		It("Should deny a port already used by another listener", func() {
+			obj.Spec.Port = 8443
+			obj.Spec.TLS = &webv1.NginxTLSSpec{IssuerRef: webv1.NginxIssuerRef{Name: "ca"}, Port: 8443}
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().To(
+				MatchError(ContainSubstring("spec.tls.port")))
+		})
+
+		It("Should deny a malformed image reference", func() {
+			obj.Spec.Image = "Nginx:latest tag"
+			Expect(validator.ValidateUpdate(context.Background(), oldObj, obj)).Error().To(
+				MatchError(ContainSubstring("spec.image")))
+		})
+
+		It("Should deny content paths leaving the web root", func() {
+			obj.Spec.Content = &webv1.NginxContentSpec{
+				ConfigMapRef: corev1.LocalObjectReference{Name: "site"},
+				SubPath:      "static",
+				Items:        []corev1.KeyToPath{{Key: "site.css", Path: "css/site.css"}},
+			}
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().NotTo(HaveOccurred())
+
+			obj.Spec.Content.SubPath = "../conf.d"
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().To(
+				MatchError(ContainSubstring("spec.content.subPath")))
+		})
+
+		It("Should deny volumes and init containers named like the operator ones", func() {
+			obj.Spec.InitContainers = []corev1.Container{{Name: "fetch", Image: "alpine/git"}}
+			obj.Spec.Volumes = []corev1.Volume{{Name: "html", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().NotTo(HaveOccurred())
+
+			obj.Spec.InitContainers[0].Name = "nginx"
+			obj.Spec.Volumes[0].Name = "config"
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().To(And(
+				MatchError(ContainSubstring("spec.initContainers[0].name")),
+				MatchError(ContainSubstring("spec.volumes[0].name")),
+			))
+		})
+
+		It("Should deny volume mounts of undeclared volumes and operator paths", func() {
+			obj.Spec.TLS = &webv1.NginxTLSSpec{IssuerRef: webv1.NginxIssuerRef{Name: "letsencrypt"}}
+			obj.Spec.Volumes = []corev1.Volume{{Name: "docs", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+			obj.Spec.VolumeMounts = []corev1.VolumeMount{{Name: "docs", MountPath: "/usr/share/nginx/html/docs"}}
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().NotTo(HaveOccurred())
+
+			obj.Spec.VolumeMounts = []corev1.VolumeMount{
+				{Name: "html", MountPath: "/usr/share/nginx/html/html"},
+				{Name: "docs", MountPath: "/etc/nginx/tls/"},
+				{Name: "docs", MountPath: "/docs"},
+				{Name: "docs", MountPath: "/docs"},
+			}
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().To(And(
+				MatchError(ContainSubstring("spec.volumeMounts[0].name")),
+				MatchError(ContainSubstring("spec.volumeMounts[1].mountPath")),
+				MatchError(ContainSubstring("already mounted by spec.tls")),
+				MatchError(ContainSubstring("already mounted by spec.volumeMounts[2].mountPath")),
+			))
+		})
+
+		It("Should deny replicas outside of autoscaling limits", func() {
+			obj.Spec.Replicas = ptr.To(int32(5))
+			obj.Spec.Autoscaling = &webv1.NginxAutoscalingSpec{MaxReplicas: 3}
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().To(
+				MatchError(ContainSubstring("spec.replicas")))
+
+			minReplicas := int32(4)
+			obj.Spec.Autoscaling.MinReplicas = &minReplicas
+			Expect(validator.ValidateCreate(context.Background(), obj)).Error().To(
+				MatchError(ContainSubstring("spec.autoscaling.minReplicas")))
+		})
+	})
+})
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// alertmanagerPayload - тело запроса webhook receiver'а Alertmanager
+type alertmanagerPayload struct {
+	Version  string              `json:"version"`
+	Status   string              `json:"status"`
+	Receiver string              `json:"receiver"`
+	Alerts   []alertmanagerAlert `json:"alerts"`
+}
+
+type alertmanagerAlert struct {
+	Status      string            `json:"status"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	Fingerprint string            `json:"fingerprint"`
+}
+
+// AlertHealResult - что healer сделал с Pod'ом по алерту
+type AlertHealResult struct {
+	Alert     string        `json:"alert"`
+	Cluster   string        `json:"cluster"`
+	Namespace string        `json:"namespace"`
+	Pod       string        `json:"pod,omitempty"`
+	Action    HealingAction `json:"action,omitempty"`
+	Message   string        `json:"message,omitempty"`
+}
+
+// alertReceiver принимает алерты Alertmanager и лечит Pod'ы, на которые они указывают.
+// Pod определяется по labels алерта: namespace и pod, deployment или statefulset;
+// label cluster выбирает кластер, без нее используется первый.
+// Пустой token принимает алерты без авторизации (--alert-receiver-insecure).
+type alertReceiver struct {
+	healers []*PodHealer
+	token   string
+}
+
+func newAlertReceiver(healers []*PodHealer, token string) http.Handler {
+	return &alertReceiver{healers: healers, token: token}
+}
+
+func (a *alertReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.token != "" {
+		expected := "Bearer " + a.token
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	payload := &alertmanagerPayload{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(payload); err != nil {
+		http.Error(w, fmt.Sprintf("invalid alertmanager payload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Трейс продолжает контекст, переданный отправителем алерта
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "HandleAlerts", trace.WithAttributes(attribute.Int("alerts", len(payload.Alerts))))
+	defer span.End()
+
+	results := []AlertHealResult{}
+	for _, alert := range payload.Alerts {
+		if alert.Status != "firing" {
+			continue
+		}
+		results = append(results, a.handleAlert(ctx, alert)...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		klog.ErrorS(err, "Failed to write alert receiver response")
+	}
+}
+
+func (a *alertReceiver) healerFor(cluster string) *PodHealer {
+	return findHealer(a.healers, cluster)
+}
+
+// findHealer возвращает healer кластера, без имени кластера - первый
+func findHealer(healers []*PodHealer, cluster string) *PodHealer {
+	if cluster == "" {
+		return healers[0]
+	}
+	for _, healer := range healers {
+		if healer.cluster == cluster {
+			return healer
+		}
+	}
+	return nil
+}
+
+func (a *alertReceiver) handleAlert(ctx context.Context, alert alertmanagerAlert) []AlertHealResult {
+	name := alert.Labels["alertname"]
+	namespace := alert.Labels["namespace"]
+	result := AlertHealResult{Alert: name, Cluster: alert.Labels["cluster"], Namespace: namespace}
+
+	healer := a.healerFor(alert.Labels["cluster"])
+	if healer == nil {
+		result.Message = "unknown cluster"
+		return []AlertHealResult{result}
+	}
+	result.Cluster = healer.cluster
+	alertRequestsTotal.WithLabelValues(healer.cluster, name).Inc()
+
+	pods, err := healer.alertTargetPods(ctx, alert)
+	if err != nil {
+		klog.ErrorS(err, "Failed to resolve alert target", "cluster", healer.cluster, "alert", name, "namespace", namespace)
+		result.Message = err.Error()
+		return []AlertHealResult{result}
+	}
+
+	var results []AlertHealResult
+	for i := range pods {
+		podResult := result
+		podResult.Pod = pods[i].Name
+		decision := healer.healFromAlert(ctx, &pods[i], alert)
+		if decision == nil {
+			podResult.Message = "pod is excluded from healing"
+		} else {
+			podResult.Action, podResult.Message = decision.Action, decision.Message
+		}
+		results = append(results, podResult)
+	}
+	return results
+}
+
+// alertTargetPods находит Pod'ы, на которые указывают labels алерта
+func (h *PodHealer) alertTargetPods(ctx context.Context, alert alertmanagerAlert) ([]corev1.Pod, error) {
+	namespace := alert.Labels["namespace"]
+	if namespace == "" {
+		return nil, fmt.Errorf("alert has no namespace label")
+	}
+
+	if name := alert.Labels["pod"]; name != "" {
+		pod, err := h.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return []corev1.Pod{*pod}, nil
+	}
+
+	var selector *metav1.LabelSelector
+	switch {
+	case alert.Labels["deployment"] != "":
+		deployment, err := h.clientset.AppsV1().Deployments(namespace).Get(ctx, alert.Labels["deployment"], metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector = deployment.Spec.Selector
+	case alert.Labels["statefulset"] != "":
+		statefulSet, err := h.clientset.AppsV1().StatefulSets(namespace).Get(ctx, alert.Labels["statefulset"], metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector = statefulSet.Spec.Selector
+	default:
+		return nil, fmt.Errorf("alert has no pod, deployment or statefulset label")
+	}
+
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	list, err := h.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector.String()})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// healFromAlert считает Pod зависшим по алерту и проводит его через те же
+// политики, rate limit и журнал решений, что и обнаруженные healer'ом Pod'ы
+func (h *PodHealer) healFromAlert(ctx context.Context, pod *corev1.Pod, alert alertmanagerAlert) *healingDecision {
+	mode, eligible := h.podMode(pod)
+	if !eligible {
+		return nil
+	}
+
+	detail := "alert " + alert.Labels["alertname"]
+	if summary := alert.Annotations["summary"]; summary != "" {
+		detail += ": " + summary
+	}
+	stuck := &stuckCondition{Reason: ReasonAlert, Detail: detail, Since: alert.StartsAt}
+	thresholds := thresholdsForPod(pod, thresholdsForMode(mode, h.thresholdsAt(h.clock.Now())))
+
+	decision := h.decide(ctx, pod, stuck, mode, thresholds, h.clock.Now())
+	klog.InfoS("Healing requested by alert", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name,
+		"alert", alert.Labels["alertname"], "action", decision.Action)
+	h.executeDecision(ctx, decision)
+	return decision
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAlertReceiver(t *testing.T) {
+	withLabels := func(pod *corev1.Pod) { pod.Labels = map[string]string{"app": "web"} }
+	web1 := testPod("web-1", time.Hour, withOwner("ReplicaSet", "web-5d4f8"), withLabels)
+	web2 := testPod("web-2", time.Hour, withOwner("ReplicaSet", "web-5d4f8"), withLabels)
+	objects := testDeployment("web")
+	objects[0].(*appsv1.Deployment).Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+
+	send := func(t *testing.T, handler http.Handler, method, token, body string) (int, []AlertHealResult) {
+		t.Helper()
+		request := httptest.NewRequest(method, "/alertmanager/webhook", bytes.NewReader([]byte(body)))
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		var results []AlertHealResult
+		if recorder.Code == http.StatusOK {
+			if err := json.NewDecoder(recorder.Body).Decode(&results); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return recorder.Code, results
+	}
+	payload := func(alerts ...alertmanagerAlert) string {
+		body, err := json.Marshal(alertmanagerPayload{Version: "4", Status: "firing", Receiver: "pod-healer", Alerts: alerts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+	alert := func(status string, labels ...string) alertmanagerAlert {
+		alert := alertmanagerAlert{Status: status, Labels: map[string]string{"alertname": "HighErrorRate"},
+			Annotations: map[string]string{"summary": "5xx above 5%"}, StartsAt: testNow.Add(-10 * time.Minute)}
+		for i := 0; i+1 < len(labels); i += 2 {
+			alert.Labels[labels[i]] = labels[i+1]
+		}
+		return alert
+	}
+
+	t.Run("request validation", func(t *testing.T) {
+		healer, _, _ := newTestHealer(t, Config{}, append(objects, web1.DeepCopy())...)
+		handler := newAlertReceiver([]*PodHealer{healer}, "secret")
+		body := payload(alert("firing", "namespace", "default", "pod", "web-1"))
+		if code, _ := send(t, handler, http.MethodGet, "secret", body); code != http.StatusMethodNotAllowed {
+			t.Errorf("GET answered %d, want %d", code, http.StatusMethodNotAllowed)
+		}
+		if code, _ := send(t, handler, http.MethodPost, "wrong", body); code != http.StatusUnauthorized {
+			t.Errorf("wrong token answered %d, want %d", code, http.StatusUnauthorized)
+		}
+		if code, _ := send(t, handler, http.MethodPost, "", body); code != http.StatusUnauthorized {
+			t.Errorf("missing token answered %d, want %d", code, http.StatusUnauthorized)
+		}
+		if code, _ := send(t, handler, http.MethodPost, "secret", `{"alerts": [`); code != http.StatusBadRequest {
+			t.Errorf("invalid payload answered %d, want %d", code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("resolved alerts are skipped", func(t *testing.T) {
+		healer, clientset, _ := newTestHealer(t, Config{}, append(objects, web1.DeepCopy())...)
+		handler := newAlertReceiver([]*PodHealer{healer}, "secret")
+		code, results := send(t, handler, http.MethodPost, "secret", payload(alert("resolved", "namespace", "default", "pod", "web-1")))
+		if code != http.StatusOK || len(results) != 0 || !podExists(t, clientset, web1) {
+			t.Fatalf("resolved alert must not heal, got %d %+v", code, results)
+		}
+	})
+
+	t.Run("pod label", func(t *testing.T) {
+		healer, clientset, _ := newTestHealer(t, Config{}, append(objects, web1.DeepCopy(), web2.DeepCopy())...)
+		handler := newAlertReceiver([]*PodHealer{healer}, "secret")
+		code, results := send(t, handler, http.MethodPost, "secret", payload(alert("firing", "namespace", "default", "pod", "web-1")))
+		if code != http.StatusOK || len(results) != 1 {
+			t.Fatalf("unexpected response %d %+v", code, results)
+		}
+		want := AlertHealResult{Alert: "HighErrorRate", Cluster: "test", Namespace: "default", Pod: "web-1", Action: ActionDelete}
+		if results[0] != want {
+			t.Errorf("result %+v, want %+v", results[0], want)
+		}
+		if podExists(t, clientset, web1) || !podExists(t, clientset, web2) {
+			t.Errorf("only the alerted pod must be healed")
+		}
+		decision := healer.state.recentDecisions()[0]
+		if decision.Code != CodeAlert || decision.Detail != "alert HighErrorRate: 5xx above 5%" {
+			t.Errorf("unexpected decision record %+v", decision)
+		}
+	})
+
+	t.Run("deployment label", func(t *testing.T) {
+		healer, _, _ := newTestHealer(t, Config{}, append(objects, web1.DeepCopy(), web2.DeepCopy())...)
+		handler := newAlertReceiver([]*PodHealer{healer}, "secret")
+		_, results := send(t, handler, http.MethodPost, "secret", payload(alert("firing", "namespace", "default", "deployment", "web")))
+		if len(results) != 2 || results[0].Pod != "web-1" || results[1].Pod != "web-2" {
+			t.Fatalf("alert must target the pods selected by the deployment, got %+v", results)
+		}
+	})
+
+	t.Run("unresolved targets", func(t *testing.T) {
+		healer, _, _ := newTestHealer(t, Config{}, objects...)
+		handler := newAlertReceiver([]*PodHealer{healer}, "")
+		_, results := send(t, handler, http.MethodPost, "", payload(
+			alert("firing", "pod", "web-1"),
+			alert("firing", "namespace", "default"),
+			alert("firing", "namespace", "default", "pod", "web-1"),
+			alert("firing", "cluster", "staging", "namespace", "default", "pod", "web-1"),
+		))
+		messages := []string{
+			"alert has no namespace label",
+			"alert has no pod, deployment or statefulset label",
+			`pods "web-1" not found`,
+			"unknown cluster",
+		}
+		if len(results) != len(messages) {
+			t.Fatalf("expected a result per alert, got %+v", results)
+		}
+		for i, message := range messages {
+			if results[i].Pod != "" || results[i].Action != "" || results[i].Message != message {
+				t.Errorf("alert %d: result %+v, want message %q", i, results[i], message)
+			}
+		}
+	})
+}
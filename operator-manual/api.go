@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// Сколько последних решений хранится для /api/v1/decisions
+const decisionHistorySize = 200
+
+// DecisionRecord - решение по зависшему Pod'у и результат его выполнения
+type DecisionRecord struct {
+	Time time.Time `json:"time"`
+	StuckPodReport
+	// Result - healed, failed, rate-limited, escalated, observed, skipped, awaiting-approval, denied, selected, vetoed
+	// или claimed (heal выполняет другая реплика в active-active режиме)
+	Result string `json:"result"`
+	// TraceID - трейс решения, если трейсинг включен
+	TraceID string `json:"traceID,omitempty"`
+}
+
+// healerState - то, что healer сейчас считает зависшим, и история решений
+type healerState struct {
+	mu        sync.Mutex
+	stuck     map[types.UID]StuckPodReport
+	decisions []DecisionRecord
+}
+
+func newHealerState() *healerState {
+	return &healerState{stuck: make(map[types.UID]StuckPodReport)}
+}
+
+func (s *healerState) setStuck(uid types.UID, entry StuckPodReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stuck[uid] = entry
+}
+
+func (s *healerState) forget(uid types.UID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.stuck, uid)
+}
+
+func (s *healerState) recordDecision(record DecisionRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.decisions = append(s.decisions, record)
+	if len(s.decisions) > decisionHistorySize {
+		s.decisions = s.decisions[len(s.decisions)-decisionHistorySize:]
+	}
+}
+
+func (s *healerState) stuckPods() []StuckPodReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pods := make([]StuckPodReport, 0, len(s.stuck))
+	for _, entry := range s.stuck {
+		pods = append(pods, entry)
+	}
+	return pods
+}
+
+func (s *healerState) recentDecisions() []DecisionRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DecisionRecord(nil), s.decisions...)
+}
+
+// PolicyView - действующая конфигурация healer'а в читаемом виде
+type PolicyView struct {
+	Clusters           []string            `json:"clusters"`
+	Namespaces         []string            `json:"namespaces,omitempty"`
+	NamespaceSelector  string              `json:"namespaceSelector,omitempty"`
+	NamespaceOptIn     bool                `json:"namespaceOptIn,omitempty"`
+	NodeSelector       string              `json:"nodeSelector,omitempty"`
+	Shard              string              `json:"shard,omitempty"`
+	Thresholds         map[string]string   `json:"thresholds"`
+	MaintenanceWindows []string            `json:"maintenanceWindows"`
+	HealCooldown       string              `json:"healCooldown"`
+	ReplacementTimeout string              `json:"replacementTimeout"`
+	MinAvailable       string              `json:"minAvailable"`
+	DefaultAction      HealingAction       `json:"defaultAction"`
+	Escalation         map[string]string   `json:"escalation"`
+	Flapping           map[string]string   `json:"flapping"`
+	NamespaceBudget    map[string]string   `json:"namespaceBudget"`
+	UnownedPods        UnownedPodPolicy    `json:"unownedPods"`
+	DaemonSetPods      DaemonSetPodPolicy  `json:"daemonSetPods"`
+	SidecarPods        SidecarPodPolicy    `json:"sidecarPods"`
+	ReadinessGatePods  ReadinessGatePolicy `json:"readinessGatePods"`
+	ExitCodePolicies   []string            `json:"exitCodePolicies,omitempty"`
+	ReasonActions      string              `json:"reasonActions,omitempty"`
+	StuckRolloutAction StuckRolloutAction  `json:"stuckRolloutAction"`
+	MaxHealsPerMinute  int                 `json:"maxHealsPerMinute"`
+	HealWorkers        int                 `json:"healWorkers"`
+	CanaryPercent      int                 `json:"canaryPercent,omitempty"`
+	PromQLDetectors    []string            `json:"promqlDetectors,omitempty"`
+	ThresholdSchedules []string            `json:"thresholdSchedules,omitempty"`
+	NodePressure       map[string]string   `json:"nodePressure,omitempty"`
+	NodePreemption     []string            `json:"nodePreemption,omitempty"`
+	ServiceEndpoints   string              `json:"serviceEndpointsTimeout,omitempty"`
+	ProtectedPriority  string              `json:"protectedPriorityClass,omitempty"`
+	WebhookEnabled     bool                `json:"webhookEnabled"`
+	FinalizerAllowlist []string            `json:"finalizerAllowlist,omitempty"`
+	ForceDeleteLost    bool                `json:"forceDeleteLostPods,omitempty"`
+	OrphanedPodGrace   string              `json:"orphanedPodGracePeriod,omitempty"`
+	Rollback           map[string]string   `json:"rollback,omitempty"`
+	ResourceSaturation string              `json:"resourceSaturation,omitempty"`
+	EphemeralStorage   map[string]string   `json:"ephemeralStorage,omitempty"`
+	OOMBump            map[string]string   `json:"oomBump,omitempty"`
+	MemoryLeak         map[string]string   `json:"memoryLeak,omitempty"`
+	BlackboxProbe      string              `json:"blackboxProbeTimeout,omitempty"`
+	HealingCondition   string              `json:"healingConditionDelay,omitempty"`
+	SummaryPeriod      string              `json:"summaryPeriod,omitempty"`
+	DeleteOptions      map[string]string   `json:"deleteOptions,omitempty"`
+}
+
+func policyView(config Config, clusters []string) PolicyView {
+	t := config.Thresholds
+	view := PolicyView{
+		Clusters:   clusters,
+		Namespaces: config.Namespaces,
+		Thresholds: map[string]string{
+			"pendingTimeout":           t.PendingTimeout.String(),
+			"maxRestarts":              strconv.Itoa(int(t.MaxRestarts)),
+			"notReadyTimeout":          t.NotReadyTimeout.String(),
+			"scaleUpPendingTimeout":    t.ScaleUpPendingTimeout.String(),
+			"livenessFailures":         strconv.Itoa(int(t.LivenessFailures)),
+			"livenessWindow":           t.LivenessWindow.String(),
+			"containerCreatingTimeout": t.ContainerCreatingTimeout.String(),
+			"terminatingTimeout":       t.TerminatingTimeout.String(),
+			"nodeLostTimeout":          t.NodeLostTimeout.String(),
+		},
+		MaintenanceWindows: []string{},
+		HealCooldown:       config.HealCooldown.String(),
+		ReplacementTimeout: config.ReplacementTimeout.String(),
+		MinAvailable:       config.MinAvailable.String(),
+		DefaultAction:      config.DefaultAction,
+		Escalation: map[string]string{
+			"threshold": strconv.Itoa(config.Escalation.Threshold),
+			"window":    config.Escalation.Window.String(),
+			"action":    string(config.Escalation.Action),
+		},
+		NamespaceBudget: map[string]string{
+			"heals":  strconv.Itoa(config.NamespaceBudget.Heals),
+			"window": config.NamespaceBudget.Window.String(),
+		},
+		Flapping: map[string]string{
+			"threshold": strconv.Itoa(config.Flapping.Threshold),
+			"window":    config.Flapping.Window.String(),
+		},
+		UnownedPods:        config.UnownedPods,
+		DaemonSetPods:      config.DaemonSetPods,
+		SidecarPods:        config.Sidecars.Policy,
+		ReadinessGatePods:  config.ReadinessGatePods,
+		StuckRolloutAction: config.StuckRolloutAction,
+		MaxHealsPerMinute:  config.MaxHealsPerMinute,
+		HealWorkers:        config.healWorkers(),
+		CanaryPercent:      config.CanaryPercent,
+		ProtectedPriority:  config.ProtectedPriorityClass,
+		WebhookEnabled:     config.Webhook.BindAddress != "",
+		ForceDeleteLost:    config.ForceDeleteLostPods,
+		NamespaceOptIn:     config.NamespaceOptIn,
+	}
+	if config.NodePressure.Enabled {
+		view.NodePressure = map[string]string{
+			"maxEvictionsPerNode": strconv.Itoa(config.NodePressure.MaxEvictionsPerNode),
+			"interval":            config.NodePressure.Interval.String(),
+		}
+	}
+	if config.NodePreemption.Enabled {
+		view.NodePreemption = append(view.NodePreemption, config.NodePreemption.Taints...)
+		for _, condition := range config.NodePreemption.Conditions {
+			view.NodePreemption = append(view.NodePreemption, string(condition))
+		}
+	}
+	for _, detector := range config.Prometheus.Detectors {
+		view.PromQLDetectors = append(view.PromQLDetectors, detector.Name)
+	}
+	if config.Finalizers.Enabled {
+		view.FinalizerAllowlist = config.Finalizers.Allowlist
+	}
+	if config.OOMBump.Percent > 0 {
+		view.OOMBump = map[string]string{
+			"percent":   strconv.Itoa(config.OOMBump.Percent),
+			"maxMemory": config.OOMBump.MaxMemory.String(),
+			"threshold": strconv.Itoa(config.OOMBump.Threshold),
+			"window":    config.OOMBump.Window.String(),
+		}
+	}
+	if config.EphemeralStorage.Threshold > 0 {
+		view.EphemeralStorage = map[string]string{
+			"threshold":  strconv.Itoa(config.EphemeralStorage.Threshold),
+			"window":     config.EphemeralStorage.Window.String(),
+			"maxRequest": config.EphemeralStorage.MaxRequest.String(),
+		}
+	}
+	if config.Delete.GracePeriod >= 0 || config.Delete.Propagation != "" {
+		view.DeleteOptions = map[string]string{"propagationPolicy": string(config.Delete.Propagation)}
+		if config.Delete.GracePeriod >= 0 {
+			view.DeleteOptions["gracePeriod"] = config.Delete.GracePeriod.String()
+		}
+	}
+	if config.Summary.enabled() {
+		view.SummaryPeriod = config.Summary.Period.String()
+	}
+	if config.BlackboxProbe.Enabled {
+		view.BlackboxProbe = config.BlackboxProbe.Timeout.String()
+	}
+	if config.ResourceSignals.Enabled {
+		view.ResourceSaturation = strconv.FormatFloat(config.ResourceSignals.Saturation, 'f', -1, 64)
+	}
+	if config.MemoryLeak.Enabled {
+		view.MemoryLeak = map[string]string{
+			"interval": config.MemoryLeak.Interval.String(),
+			"samples":  strconv.Itoa(config.MemoryLeak.Samples),
+			"horizon":  config.MemoryLeak.Horizon.String(),
+		}
+	}
+	if config.HealingCondition.Enabled {
+		view.HealingCondition = config.HealingCondition.Delay.String()
+	}
+	if config.ServiceEndpoints.enabled() {
+		view.ServiceEndpoints = config.ServiceEndpoints.Timeout.String()
+	}
+	if config.OrphanedPodGracePeriod > 0 {
+		view.OrphanedPodGrace = config.OrphanedPodGracePeriod.String()
+	}
+	if config.Rollback.Enabled {
+		view.Rollback = map[string]string{"window": config.Rollback.Window.String()}
+	}
+	if config.Shard.enabled() {
+		view.Shard = strconv.Itoa(config.Shard.Index) + "/" + strconv.Itoa(config.Shard.Total)
+	}
+	if config.NamespaceSelector != nil {
+		view.NamespaceSelector = config.NamespaceSelector.String()
+	}
+	if config.NodeSelector != nil {
+		view.NodeSelector = config.NodeSelector.String()
+	}
+	view.ThresholdSchedules = thresholdScheduleNames(config.ThresholdSchedules)
+	for _, policy := range config.ExitCodePolicies {
+		view.ExitCodePolicies = append(view.ExitCodePolicies, policy.String())
+	}
+	view.ReasonActions = config.ReasonActions.String()
+	for _, window := range config.MaintenanceWindows {
+		view.MaintenanceWindows = append(view.MaintenanceWindows, window.String())
+	}
+	return view
+}
+
+// apiHandler обслуживает read-only API состояния всех healer'ов процесса
+type apiHandler struct {
+	healers []*PodHealer
+}
+
+func newAPIHandler(healers []*PodHealer) http.Handler {
+	handler := &apiHandler{healers: healers}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/stuck-pods", handler.stuckPods)
+	mux.HandleFunc("/api/v1/decisions", handler.decisions)
+	mux.HandleFunc("/api/v1/policy", handler.policy)
+	return mux
+}
+
+func (a *apiHandler) stuckPods(w http.ResponseWriter, r *http.Request) {
+	pods := []StuckPodReport{}
+	for _, healer := range a.healers {
+		pods = append(pods, healer.state.stuckPods()...)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Cluster != pods[j].Cluster {
+			return pods[i].Cluster < pods[j].Cluster
+		}
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Pod < pods[j].Pod
+	})
+	writeJSON(w, r, pods)
+}
+
+func (a *apiHandler) decisions(w http.ResponseWriter, r *http.Request) {
+	decisions := []DecisionRecord{}
+	for _, healer := range a.healers {
+		decisions = append(decisions, healer.state.recentDecisions()...)
+	}
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return decisions[i].Time.After(decisions[j].Time)
+	})
+	writeJSON(w, r, decisions)
+}
+
+func (a *apiHandler) policy(w http.ResponseWriter, r *http.Request) {
+	var clusters []string
+	var config Config
+	for _, healer := range a.healers {
+		clusters = append(clusters, healer.cluster)
+		config = healer.config
+	}
+	writeJSON(w, r, policyView(config, clusters))
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, value interface{}) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		klog.ErrorS(err, "Failed to write API response", "path", r.URL.Path)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAPIHandler(t *testing.T) {
+	crashLooping := func(name string) *corev1.Pod {
+		return testPod(name, time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Hour),
+			withOwner("ReplicaSet", "web-5d4f8"))
+	}
+	config := Config{Thresholds: defaultThresholds, HealCooldown: time.Minute}
+	first, _, clock := newTestHealer(t, config, append(testDeployment("web"), crashLooping("web-1"))...)
+	second, err := newPodHealer("prod", fake.NewSimpleClientset(append(testDeployment("web"), crashLooping("web-2"))...), clock, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.handlePod(crashLooping("web-1"))
+	// Решения второго кластера новее и идут в /api/v1/decisions первыми
+	clock.Step(time.Minute)
+	second.handlePod(crashLooping("web-2"))
+
+	handler := newAPIHandler([]*PodHealer{first, second})
+	get := func(t *testing.T, path string, into interface{}) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("GET %s answered %d", path, recorder.Code)
+		}
+		if err := json.NewDecoder(recorder.Body).Decode(into); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var pods []StuckPodReport
+	get(t, "/api/v1/stuck-pods", &pods)
+	if len(pods) != 2 || pods[0].Cluster != "prod" || pods[0].Pod != "web-2" || pods[1].Cluster != "test" || pods[1].Pod != "web-1" {
+		t.Fatalf("stuck pods of all clusters must be sorted by cluster, got %+v", pods)
+	}
+	if pods[1].Code != CodeCrashLoop || pods[1].Action != ActionDelete || pods[1].Owner != "Deployment default/web" {
+		t.Errorf("unexpected stuck pod %+v", pods[1])
+	}
+
+	var decisions []DecisionRecord
+	get(t, "/api/v1/decisions", &decisions)
+	if len(decisions) != 2 || decisions[0].Pod != "web-2" || decisions[1].Pod != "web-1" || decisions[0].Result != "healed" {
+		t.Fatalf("decisions must be sorted newest first, got %+v", decisions)
+	}
+
+	var policy PolicyView
+	get(t, "/api/v1/policy", &policy)
+	if len(policy.Clusters) != 2 || policy.Clusters[0] != "test" || policy.Clusters[1] != "prod" ||
+		policy.HealCooldown != "1m0s" || policy.Thresholds["maxRestarts"] == "" {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/decisions", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST answered %d, want %d", recorder.Code, http.StatusMethodNotAllowed)
+	}
+}
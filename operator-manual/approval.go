@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// Аннотация, которой оператор одобряет или отклоняет healing Pod'а в режиме annotation
+const (
+	annotationApproval          = "healing.kubernetes.io/approval"
+	annotationApprovalRequested = "healing.kubernetes.io/approval-requested"
+)
+
+// ApprovalMode - откуда healer получает одобрение решений
+type ApprovalMode string
+
+const (
+	ApprovalNone       ApprovalMode = "none"
+	ApprovalWebhook    ApprovalMode = "webhook"
+	ApprovalAnnotation ApprovalMode = "annotation"
+)
+
+// ApprovalConfig - одобрение решений человеком или внешней системой перед выполнением
+type ApprovalConfig struct {
+	Mode ApprovalMode
+	// URL - endpoint, которому отправляются решения в режиме webhook
+	URL string
+	// Timeout - сколько решение ждет ответа, после чего применяется DefaultApprove
+	Timeout        time.Duration
+	DefaultApprove bool
+}
+
+// approvalVerdict - состояние одобрения решения
+type approvalVerdict string
+
+const (
+	verdictApproved approvalVerdict = "approved"
+	verdictDenied   approvalVerdict = "denied"
+	verdictPending  approvalVerdict = "awaiting-approval"
+)
+
+// ApprovalRequest - тело запроса к approval webhook
+type ApprovalRequest struct {
+	StuckPodReport
+	RequestedAt time.Time `json:"requestedAt"`
+}
+
+// ApprovalResponse - ответ approval webhook. Без поля approved решение
+// остается в ожидании и будет отправлено повторно при следующей оценке Pod'а.
+type ApprovalResponse struct {
+	Approved *bool  `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// approvalState - запрос одобрения для одного Pod'а
+type approvalState struct {
+	RequestedAt time.Time
+	// Denied и Reason запоминают отказ, чтобы не запрашивать одобрение заново при каждом resync
+	Denied bool
+	Reason string
+}
+
+// approvalTracker помнит запросы одобрения, пока Pod не вылечен или не удален
+type approvalTracker struct {
+	mu       sync.Mutex
+	requests map[types.UID]approvalState
+	client   *http.Client
+}
+
+func newApprovalTracker() *approvalTracker {
+	return &approvalTracker{
+		requests: make(map[types.UID]approvalState),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// request возвращает состояние запроса одобрения и true, если запрос новый
+func (t *approvalTracker) request(uid types.UID, now time.Time) (approvalState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state, exists := t.requests[uid]; exists {
+		return state, false
+	}
+	state := approvalState{RequestedAt: now}
+	t.requests[uid] = state
+	return state, true
+}
+
+func (t *approvalTracker) deny(uid types.UID, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.requests[uid]
+	state.Denied, state.Reason = true, reason
+	t.requests[uid] = state
+}
+
+func (t *approvalTracker) forget(uid types.UID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.requests, uid)
+}
+
+// requiresApproval - действия, меняющие кластер, выполняются только после одобрения
+func (h *PodHealer) requiresApproval(action HealingAction) bool {
+	if h.config.Approval.Mode == "" || h.config.Approval.Mode == ApprovalNone {
+		return false
+	}
+	return changesCluster(action)
+}
+
+// approve проверяет, одобрено ли решение. Пока ответа нет, решение ждет;
+// по истечении таймаута применяется --approval-default. Отказ действует,
+// пока Pod не восстановится сам или не будет удален; в режиме annotation
+// его можно отменить, сменив аннотацию на approved.
+func (h *PodHealer) approve(ctx context.Context, decision *healingDecision) (approvalVerdict, string) {
+	pod := decision.Pod
+	now := h.clock.Now()
+	state, first := h.approvals.request(pod.UID, now)
+
+	verdict, reason := verdictPending, ""
+	switch h.config.Approval.Mode {
+	case ApprovalWebhook:
+		if state.Denied {
+			return verdictDenied, state.Reason
+		}
+		var err error
+		verdict, reason, err = h.approvalWebhook(ctx, decision, state.RequestedAt)
+		if err != nil {
+			klog.ErrorS(err, "Failed to request healing approval", "cluster", h.cluster,
+				"namespace", pod.Namespace, "pod", pod.Name, "url", h.config.Approval.URL)
+			verdict = verdictPending
+		}
+	case ApprovalAnnotation:
+		verdict, reason = annotationVerdict(pod)
+		if verdict == verdictPending && state.Denied {
+			return verdictDenied, state.Reason
+		}
+		if verdict == verdictPending && first {
+			h.requestApprovalAnnotation(ctx, decision, state.RequestedAt)
+		}
+	}
+
+	if verdict == verdictPending && now.Sub(state.RequestedAt) >= h.config.Approval.Timeout {
+		verdict, reason = verdictDenied, fmt.Sprintf("no approval within %v", h.config.Approval.Timeout)
+		if h.config.Approval.DefaultApprove {
+			verdict, reason = verdictApproved, fmt.Sprintf("approved by default after %v", h.config.Approval.Timeout)
+		}
+	}
+	switch verdict {
+	case verdictApproved:
+		h.approvals.forget(pod.UID)
+	case verdictDenied:
+		if state.Denied {
+			return verdict, reason
+		}
+		h.approvals.deny(pod.UID, reason)
+	default:
+		return verdict, reason
+	}
+	approvalsTotal.WithLabelValues(h.cluster, string(verdict)).Inc()
+	return verdict, reason
+}
+
+func annotationVerdict(pod *corev1.Pod) (approvalVerdict, string) {
+	switch pod.Annotations[annotationApproval] {
+	case "approved", "true":
+		return verdictApproved, "approved by annotation"
+	case "denied", "false":
+		return verdictDenied, "denied by annotation"
+	}
+	return verdictPending, ""
+}
+
+// requestApprovalAnnotation помечает Pod ожидающим одобрения и сообщает об этом событием
+func (h *PodHealer) requestApprovalAnnotation(ctx context.Context, decision *healingDecision, requestedAt time.Time) {
+	pod := decision.Pod
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]string{
+			annotationApprovalRequested: requestedAt.UTC().Format(time.RFC3339),
+		}},
+	})
+	if err == nil {
+		_, err = h.clientset.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to annotate pod as awaiting approval", "cluster", h.cluster,
+			"namespace", pod.Namespace, "pod", pod.Name)
+	}
+	decisionEventf(h.recorder, pod, decision, corev1.EventTypeWarning, "HealingApprovalRequired",
+		"%s (%s) requires approval: annotate the pod with %s=approved or %s=denied within %v",
+		decision.Action, decision.Detail, annotationApproval, annotationApproval, h.config.Approval.Timeout)
+}
+
+// approvalWebhook отправляет решение внешнему endpoint'у
+func (h *PodHealer) approvalWebhook(ctx context.Context, decision *healingDecision, requestedAt time.Time) (approvalVerdict, string, error) {
+	body, err := json.Marshal(ApprovalRequest{StuckPodReport: h.reportEntry(decision), RequestedAt: requestedAt.UTC()})
+	if err != nil {
+		return "", "", err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, h.config.Approval.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := h.approvals.client.Do(request)
+	if err != nil {
+		return "", "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return "", "", fmt.Errorf("approval endpoint returned HTTP %d", response.StatusCode)
+	}
+
+	result := &ApprovalResponse{}
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return "", "", fmt.Errorf("invalid approval response: %v", err)
+	}
+	switch {
+	case result.Approved == nil:
+		return verdictPending, result.Reason, nil
+	case *result.Approved:
+		return verdictApproved, result.Reason, nil
+	default:
+		return verdictDenied, result.Reason, nil
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// healOnce оценивает Pod, выполняет решение и возвращает его результат из журнала решений
+func healOnce(t *testing.T, healer *PodHealer, pod *corev1.Pod) string {
+	t.Helper()
+	decision := healer.evaluatePod(context.Background(), pod, healer.clock.Now())
+	if decision == nil {
+		t.Fatalf("expected %s to be stuck", pod.Name)
+	}
+	healer.executeDecision(context.Background(), decision)
+	decisions := healer.state.recentDecisions()
+	return decisions[len(decisions)-1].Result
+}
+
+func podExists(t *testing.T, clientset *fake.Clientset, pod *corev1.Pod) bool {
+	t.Helper()
+	_, err := clientset.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestApprovalWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var approved *bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := &ApprovalRequest{}
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+			t.Errorf("invalid approval request: %v", err)
+		}
+		if request.Pod != "web-1" || request.Action != ActionDelete {
+			t.Errorf("unexpected approval request %+v", request)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_ = json.NewEncoder(w).Encode(ApprovalResponse{Approved: approved})
+	}))
+	defer server.Close()
+
+	pod := testPod("web-1", time.Hour, withRestarts(11), withOwner("ReplicaSet", "web-5d4f8"))
+	healer, clientset, _ := newTestHealer(t, Config{Approval: ApprovalConfig{Mode: ApprovalWebhook, URL: server.URL, Timeout: time.Hour}},
+		append(testDeployment("web"), pod)...)
+
+	if result := healOnce(t, healer, pod); result != string(verdictPending) {
+		t.Fatalf("expected decision to await approval, got %s", result)
+	}
+	if !podExists(t, clientset, pod) {
+		t.Fatal("pod was healed before approval")
+	}
+
+	mu.Lock()
+	yes := true
+	approved = &yes
+	mu.Unlock()
+	if result := healOnce(t, healer, pod); result != "healed" {
+		t.Fatalf("expected approved decision to be healed, got %s", result)
+	}
+	if podExists(t, clientset, pod) {
+		t.Fatal("expected approved pod to be deleted")
+	}
+}
+
+func TestApprovalAnnotationTimeout(t *testing.T) {
+	pod := testPod("web-1", time.Hour, withRestarts(11), withOwner("ReplicaSet", "web-5d4f8"))
+	healer, clientset, clock := newTestHealer(t, Config{Approval: ApprovalConfig{Mode: ApprovalAnnotation, Timeout: 10 * time.Minute}},
+		append(testDeployment("web"), pod)...)
+
+	if result := healOnce(t, healer, pod); result != string(verdictPending) {
+		t.Fatalf("expected decision to await approval, got %s", result)
+	}
+	annotated, err := clientset.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := annotated.Annotations[annotationApprovalRequested]; !exists {
+		t.Fatalf("expected pod to be annotated with %s", annotationApprovalRequested)
+	}
+
+	// Без ответа за таймаут применяется отказ по умолчанию, и он не сбрасывается при resync
+	clock.Step(10 * time.Minute)
+	for i := 0; i < 2; i++ {
+		if result := healOnce(t, healer, pod); result != string(verdictDenied) {
+			t.Fatalf("expected decision to be denied after the timeout, got %s", result)
+		}
+	}
+
+	approved := withAnnotation(annotationApproval, "approved")
+	approved(pod)
+	if result := healOnce(t, healer, pod); result != "healed" {
+		t.Fatalf("expected annotation approval to override the default, got %s", result)
+	}
+	if podExists(t, clientset, pod) {
+		t.Fatal("expected approved pod to be deleted")
+	}
+}
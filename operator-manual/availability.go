@@ -0,0 +1,47 @@
+package main
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ownerReplicas возвращает желаемое и доступное число реплик владельца.
+// ok == false для владельцев, к которым понятие доступности не применимо.
+func ownerReplicas(owner *workloadOwner) (desired, available int32, ok bool) {
+	switch obj := owner.Object.(type) {
+	case *appsv1.Deployment:
+		return replicasOrOne(obj.Spec.Replicas), obj.Status.AvailableReplicas, true
+	case *appsv1.ReplicaSet:
+		return replicasOrOne(obj.Spec.Replicas), obj.Status.AvailableReplicas, true
+	case *appsv1.StatefulSet:
+		return replicasOrOne(obj.Spec.Replicas), obj.Status.AvailableReplicas, true
+	case *appsv1.DaemonSet:
+		return obj.Status.DesiredNumberScheduled, obj.Status.NumberAvailable, true
+	}
+	return 0, 0, false
+}
+
+func replicasOrOne(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// violatesMinAvailable проверяет, опустится ли доступность владельца ниже
+// минимума после удаления Pod'а. Удаление неготового Pod'а доступность не меняет,
+// поэтому такие Pod'ы лечатся и у полностью недоступного владельца.
+func violatesMinAvailable(pod *corev1.Pod, owner *workloadOwner, minAvailable intstr.IntOrString) (bool, int32, int32) {
+	desired, available, ok := ownerReplicas(owner)
+	if !ok || desired == 0 || !isPodReady(pod) {
+		return false, desired, available
+	}
+
+	min, err := intstr.GetScaledValueFromIntOrPercent(&minAvailable, int(desired), true)
+	if err != nil {
+		return false, desired, available
+	}
+
+	return available-1 < int32(min), desired, available
+}
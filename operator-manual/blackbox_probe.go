@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// BlackboxProbeConfig - проверка readiness-эндпоинта NotReady Pod'а напрямую из healer'а.
+// Если эндпоинт отвечает, Pod жив, а проблема в kubelet'е или самой пробе: пересоздание не поможет.
+type BlackboxProbeConfig struct {
+	Enabled bool
+	Timeout time.Duration
+}
+
+// readinessEndpoint возвращает адрес HTTP или TCP readiness-пробы контейнера
+// так, как ее выполняет kubelet, или пустую строку для exec и gRPC проб
+func readinessEndpoint(pod *corev1.Pod, container *corev1.Container) (scheme, address string) {
+	probe := container.ReadinessProbe
+	if probe == nil {
+		return "", ""
+	}
+	resolve := func(port intstr.IntOrString, host string) string {
+		if host == "" {
+			host = pod.Status.PodIP
+		}
+		number := port.IntValue()
+		if port.Type == intstr.String {
+			number = 0
+			for _, containerPort := range container.Ports {
+				if containerPort.Name == port.StrVal {
+					number = int(containerPort.ContainerPort)
+				}
+			}
+		}
+		if host == "" || number <= 0 {
+			return ""
+		}
+		return net.JoinHostPort(host, strconv.Itoa(number))
+	}
+
+	switch {
+	case probe.HTTPGet != nil:
+		address := resolve(probe.HTTPGet.Port, probe.HTTPGet.Host)
+		if address == "" {
+			return "", ""
+		}
+		scheme := strings.ToLower(string(probe.HTTPGet.Scheme))
+		if scheme == "" {
+			scheme = "http"
+		}
+		path := probe.HTTPGet.Path
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		return scheme, scheme + "://" + address + path
+	case probe.TCPSocket != nil:
+		if address := resolve(probe.TCPSocket.Port, probe.TCPSocket.Host); address != "" {
+			return "tcp", address
+		}
+	}
+	return "", ""
+}
+
+// probeEndpoint выполняет пробу: HTTP-код 200-399, как у kubelet'а, или установленное TCP-соединение
+func (h *PodHealer) probeEndpoint(ctx context.Context, container *corev1.Container, scheme, address string) error {
+	ctx, cancel := context.WithTimeout(ctx, h.config.BlackboxProbe.Timeout)
+	defer cancel()
+
+	if scheme == "tcp" {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return err
+	}
+	for _, header := range container.ReadinessProbe.HTTPGet.HTTPHeaders {
+		if strings.EqualFold(header.Name, "Host") {
+			req.Host = header.Value
+			continue
+		}
+		req.Header.Add(header.Name, header.Value)
+	}
+	// Kubelet не проверяет сертификаты HTTPS-проб и не следует редиректам на другие хосты
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		CheckRedirect: func(redirect *http.Request, via []*http.Request) error {
+			if redirect.URL.Host != req.URL.Host {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// blackboxProbe проверяет readiness-эндпоинты неготовых работающих контейнеров Pod'а.
+// alive - все они отвечают healer'у; detail описывает результат проверки.
+// Контейнеры без HTTP и TCP проб проверить нельзя, тогда alive - false.
+func (h *PodHealer) blackboxProbe(ctx context.Context, pod *corev1.Pod) (alive bool, detail string) {
+	ready := make(map[string]bool)
+	running := make(map[string]bool)
+	for _, status := range pod.Status.ContainerStatuses {
+		ready[status.Name] = status.Ready
+		running[status.Name] = status.State.Running != nil
+	}
+
+	var results []string
+	checked := 0
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		if ready[container.Name] {
+			continue
+		}
+		// Упавший контейнер мертв независимо от пробы
+		if !running[container.Name] {
+			return false, ""
+		}
+		scheme, address := readinessEndpoint(pod, container)
+		if address == "" {
+			return false, ""
+		}
+		if err := h.probeEndpoint(ctx, container, scheme, address); err != nil {
+			return false, fmt.Sprintf("readiness endpoint %s of container %s fails from the healer too: %v",
+				address, container.Name, err)
+		}
+		checked++
+		results = append(results, fmt.Sprintf("container %s answers on %s", container.Name, address))
+	}
+	if checked == 0 {
+		return false, ""
+	}
+	return true, strings.Join(results, ", ")
+}
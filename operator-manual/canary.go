@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// inCanarySample проверяет, попадает ли Pod в долю --canary-percent.
+// Выборка детерминирована по UID: один и тот же Pod не выпадает из нее
+// между resync'ами, а его замена получает новый шанс.
+func (h *PodHealer) inCanarySample(pod *corev1.Pod) bool {
+	percent := h.config.CanaryPercent
+	if percent <= 0 || percent >= 100 {
+		return true
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(pod.UID))
+	return int(hash.Sum32()%100) < percent
+}
+
+func canaryReason(percent int) string {
+	return fmt.Sprintf("outside the %d%% canary sample", percent)
+}
@@ -0,0 +1,926 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	"sigs.k8s.io/yaml"
+)
+
+// options - значения флагов командной строки до разбора в Config
+type options struct {
+	config              Config
+	logFormat           string
+	contexts            string
+	maintenanceWindows  string
+	minAvailable        string
+	defaultAction       string
+	escalationAction    string
+	unownedPods         string
+	daemonSetPods       string
+	sidecarPods         string
+	readinessGatePods   string
+	exitCodePolicies    string
+	reasonActions       string
+	stuckRolloutAction  string
+	preemptionTaints    string
+	preemptionConds     string
+	ephemeralMaxRequest string
+	oomBumpMaxMemory    string
+	summaryConfigMap    string
+	deletePropagation   string
+	metricsAddr         string
+	output              string
+	namespaces          string
+	namespaceSelector   string
+	nodeSelector        string
+	finalizerAllowlist  string
+	promQLDetectors     string
+	thresholdSchedules  string
+	approvalMode        string
+	approvalDefault     string
+	stateConfigMap      string
+	alertReceiver       bool
+	alertReceiverToken  string
+	alertInsecure       bool
+	onDemandHeal        bool
+	onDemandHealToken   string
+	tracing             TracingConfig
+	pushgateway         PushgatewayConfig
+	enablePprof         bool
+	reportMode          bool
+	snapshot            bool
+	snapshotAt          string
+	checkCluster        bool
+}
+
+func newRootCommand() *cobra.Command {
+	opts := &options{config: Config{Thresholds: defaultThresholds}}
+
+	root := &cobra.Command{
+		Use:          "pod-healer-operator",
+		Short:        "Detects stuck pods and heals them",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupLogging(opts.logFormat); err != nil {
+				return fmt.Errorf("invalid --log-format: %w", err)
+			}
+			return nil
+		},
+		// Без подкоманды бинарник работает как run, чтобы старые манифесты продолжали работать
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.reportMode {
+				return runReport(cmd.OutOrStdout(), opts)
+			}
+			return runOperator(opts)
+		},
+	}
+
+	klog.InitFlags(nil)
+	root.PersistentFlags().AddGoFlagSet(flag.CommandLine)
+	opts.addClusterFlags(root.PersistentFlags())
+	opts.addPolicyFlags(root.PersistentFlags())
+	opts.addRunFlags(root.Flags())
+	opts.addOutputFlag(root.Flags())
+	opts.addPushgatewayFlags(root.Flags())
+	root.Flags().BoolVar(&opts.reportMode, "report", false,
+		"scan the cluster once, print stuck pods with proposed actions and exit without healing")
+	_ = root.Flags().MarkDeprecated("report", "use the report subcommand instead")
+
+	root.AddCommand(
+		newRunCommand(opts),
+		newReportCommand(opts),
+		newPolicyCommand(opts),
+		newSimulateCommand(opts),
+	)
+	return root
+}
+
+func newRunCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Watch the cluster and heal stuck pods",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runOperator(opts)
+		},
+	}
+	opts.addRunFlags(cmd.Flags())
+	return cmd
+}
+
+func newReportCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Scan the cluster once and print stuck pods with proposed actions without healing",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReport(cmd.OutOrStdout(), opts)
+		},
+	}
+	opts.addOutputFlag(cmd.Flags())
+	opts.addPushgatewayFlags(cmd.Flags())
+	return cmd
+}
+
+func newPolicyCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Inspect the healing policy",
+	}
+
+	validate := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate flags and print the effective policy",
+		Long: "Validate flags and print the effective policy. With --check-cluster also validates " +
+			"healing annotations and labels on every namespace of every configured cluster.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPolicyValidate(cmd.OutOrStdout(), opts)
+		},
+	}
+	opts.addOutputFlag(validate.Flags())
+	validate.Flags().BoolVar(&opts.checkCluster, "check-cluster", false,
+		"also validate healing annotations on namespaces of the configured clusters")
+
+	cmd.AddCommand(validate)
+	return cmd
+}
+
+func newSimulateCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "simulate <pod.yaml | snapshot>",
+		Short: "Show what the healer would do with the pod from a manifest",
+		Long: "Evaluate a pod manifest (for example from kubectl get pod -o yaml) against the policy and " +
+			"the current state of the first configured cluster. Nothing is changed in the cluster.\n\n" +
+			"With --snapshot the argument is a file or directory of pod, node, event and owner manifests, " +
+			"for example kubectl get pods,nodes,events,deployments,replicasets -A -o yaml recorded during an incident. " +
+			"All stuck pods of the snapshot are evaluated offline as of the latest time recorded in it.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.snapshot {
+				return runSnapshotSimulation(cmd.OutOrStdout(), opts, args[0])
+			}
+			return runSimulate(cmd.OutOrStdout(), opts, args[0])
+		},
+	}
+	opts.addOutputFlag(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.snapshot, "snapshot", false,
+		"evaluate a recorded cluster snapshot offline instead of a pod manifest against the cluster")
+	cmd.Flags().StringVar(&opts.snapshotAt, "at", "",
+		"RFC3339 time to evaluate the snapshot at, defaults to the latest time recorded in it")
+	return cmd
+}
+
+func (o *options) addClusterFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.logFormat, "log-format", "text", "log output format: json or text")
+	fs.StringVar(&o.config.Kubeconfig, "kubeconfig", "", "path to kubeconfig")
+	fs.StringVar(&o.contexts, "contexts", "", "comma-separated kubeconfig contexts to heal, one healer per cluster")
+	fs.StringVar(&o.config.KubeconfigDir, "kubeconfig-dir", "",
+		"directory with one kubeconfig file per cluster to heal")
+	fs.Float32Var(&o.config.ClientQPS, "kube-api-qps", 20, "queries per second allowed to the Kubernetes API server")
+	fs.IntVar(&o.config.ClientBurst, "kube-api-burst", 30, "burst of queries allowed to the Kubernetes API server")
+	fs.IntVar(&o.config.HealWorkers, "heal-workers", 1,
+		"number of pods evaluated and healed concurrently in each cluster, bounding simultaneous healing API writes")
+	fs.DurationVar(&o.config.ResyncPeriod, "resync-period", 30*time.Second,
+		"how often informers resend all pods, jobs and namespaces for re-evaluation")
+	fs.StringVar(&o.namespaces, "namespaces", "",
+		"comma-separated namespaces to watch with per-namespace informers, allows namespace-scoped RBAC; empty watches all")
+	fs.StringVar(&o.namespaceSelector, "namespace-selector", "",
+		"label selector restricting healing to matching namespaces, e.g. \"healing=enabled\"")
+	fs.StringVar(&o.nodeSelector, "node-selector", "",
+		"label selector restricting healing to pods on matching nodes, e.g. \"node.kubernetes.io/lifecycle=spot\"")
+	fs.BoolVar(&o.config.NamespaceOptIn, "namespace-opt-in", false,
+		"heal only namespaces labeled healing.kubernetes.io/enabled=true instead of all namespaces not opted out")
+	fs.IntVar(&o.config.Shard.Total, "shard-total", 1,
+		"number of healer replicas splitting namespaces by name hash, 1 disables sharding")
+	fs.IntVar(&o.config.Shard.Index, "shard-index", 0,
+		"index of this replica among --shard-total replicas, from 0")
+}
+
+func (o *options) addPolicyFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.maintenanceWindows, "maintenance-windows", "",
+		"semicolon-separated cron expressions of minutes during which pods are only observed and --memory-leak-detection restarts leaking pods, "+
+			"e.g. \"* 2-4 * * 6\" for Saturday 02:00-05:00")
+	fs.DurationVar(&o.config.HealCooldown, "heal-cooldown", 5*time.Minute,
+		"minimum time between heals of pods belonging to the same owner")
+	fs.DurationVar(&o.config.ReplacementTimeout, "replacement-timeout", 5*time.Minute,
+		"how long siblings of a healed pod in the same ReplicaSet or StatefulSet wait for its replacement to become ready, 0 disables")
+	fs.StringVar(&o.minAvailable, "min-available", "1",
+		"minimum available replicas (number or percentage) an owner must keep after a heal")
+	fs.StringVar(&o.defaultAction, "default-action", string(ActionDelete),
+		"action for stuck pods without an action annotation: delete, evict, rollout-restart, rollback, scale, notify-only or quarantine")
+	fs.IntVar(&o.config.Escalation.Threshold, "escalation-threshold", 5,
+		"heals of the same owner within --escalation-window after which healing stops and escalates, 0 disables")
+	fs.DurationVar(&o.config.Escalation.Window, "escalation-window", time.Hour,
+		"time window for counting heal attempts per owner")
+	fs.StringVar(&o.escalationAction, "escalation-action", string(EscalateAnnotate),
+		"what to do with an escalated owner: annotate or scale-to-zero")
+	fs.IntVar(&o.config.Flapping.Threshold, "flap-threshold", 20,
+		"container restarts and pod recreations of the same owner within --flap-window after which it is escalated as flapping, 0 disables")
+	fs.DurationVar(&o.config.Flapping.Window, "flap-window", 30*time.Minute,
+		"time window for counting restarts and recreations per owner")
+	fs.StringVar(&o.unownedPods, "unowned-pods", string(UnownedIgnore),
+		"what to do with stuck pods without owner: ignore, delete or recreate-from-spec")
+	fs.StringVar(&o.daemonSetPods, "daemonset-pods", string(DaemonSetNotify),
+		"what to do with stuck DaemonSet pods: notify, delete or cordon-node")
+	fs.StringVar(&o.sidecarPods, "sidecar-pods", string(SidecarPod),
+		"what to do with pods whose only crash-looping containers are listed in their healing.kubernetes.io/sidecars annotation: "+
+			"pod heals them like other stuck pods, rollout-restart restarts the owner once per --sidecar-restart-interval, notify")
+	fs.DurationVar(&o.config.Sidecars.RestartInterval, "sidecar-restart-interval", time.Hour,
+		"how long after a rollout restart for failing sidecars the healer only notifies about them")
+	fs.StringVar(&o.readinessGatePods, "readiness-gate-pods", string(ReadinessGateNotify),
+		"what to do with pods whose containers are ready but a readiness gate is not: notify or delete")
+	fs.StringVar(&o.stuckRolloutAction, "stuck-rollout-action", string(StuckRolloutNone),
+		"what to do with Deployments whose new ReplicaSet misses progressDeadlineSeconds: none, notify, pause or rollback; "+
+			"pods of such rollouts are not healed one by one")
+	fs.StringVar(&o.exitCodePolicies, "exit-code-policies", "",
+		"comma-separated CODE[@rollout]=ACTION rules choosing the action by the last container exit code or signal, "+
+			"e.g. \"137=notify-only,SIGTERM@rollout=skip\"; @rollout rules apply only while the owner rolls out")
+	fs.StringVar(&o.reasonActions, "reason-actions", "",
+		"comma-separated CODE=ACTION rules choosing the action by the reason code of a stuck pod, "+
+			"e.g. \"CRASHLOOP=rollout-restart,OOM=notify-only,IMAGE_PULL=notify-only\"; exit code policies take precedence, "+
+			"the healing.kubernetes.io/reason-actions namespace annotation overrides them per namespace")
+	fs.IntVar(&o.config.MaxHealsPerMinute, "max-heals-per-minute", 10,
+		"maximum number of pods healed per minute in each cluster, 0 disables the limit")
+	fs.StringVar(&o.config.Prometheus.URL, "prometheus-url", "",
+		"Prometheus HTTP API address queried by the PromQL detectors")
+	fs.StringVar(&o.thresholdSchedules, "threshold-schedules", "",
+		"YAML file with cron schedules overriding thresholds, e.g. a longer pending-timeout at night")
+	fs.StringVar(&o.promQLDetectors, "promql-detectors", "",
+		"YAML file with PromQL detectors whose non-zero results mark pods as stuck")
+	fs.DurationVar(&o.config.Prometheus.Interval, "promql-interval", time.Minute,
+		"how often PromQL detectors are evaluated")
+	fs.BoolVar(&o.config.NodePressure.Enabled, "node-pressure-eviction", false,
+		"proactively evict BestEffort and Burstable pods from nodes with memory, disk or PID pressure")
+	fs.IntVar(&o.config.NodePressure.MaxEvictionsPerNode, "node-pressure-max-evictions", 1,
+		"maximum number of pods evicted from one pressured node per check")
+	fs.DurationVar(&o.config.NodePressure.Interval, "node-pressure-interval", 30*time.Second,
+		"how often nodes under pressure are checked")
+	fs.BoolVar(&o.config.NodePreemption.Enabled, "node-preemption-eviction", false,
+		"proactively evict pods from spot nodes with a termination notice and nodes the autoscaler is about to delete")
+	fs.StringVar(&o.preemptionTaints, "node-preemption-taints", strings.Join(defaultPreemptionTaints, ","),
+		"comma-separated taint keys announcing that a node is about to be deleted")
+	fs.StringVar(&o.preemptionConds, "node-preemption-conditions", "",
+		"comma-separated node conditions announcing that a node is about to be deleted, e.g. \"TerminationNotice\"")
+	fs.DurationVar(&o.config.NodePreemption.Interval, "node-preemption-interval", 5*time.Second,
+		"how often nodes are checked for preemption notices")
+	fs.DurationVar(&o.config.ServiceEndpoints.Timeout, "service-endpoints-timeout", 0,
+		"heal pods of Services whose endpoints have all been NotReady for this long, before per-pod thresholds; 0 disables")
+	fs.DurationVar(&o.config.ServiceEndpoints.Interval, "service-endpoints-interval", 30*time.Second,
+		"how often Service endpoints are checked")
+	fs.DurationVar(&o.config.Summary.Period, "summary-period", 0,
+		"publish a healing summary every period aligned to UTC, e.g. 24h for days starting at midnight "+
+			"or 168h for weeks starting on Monday; 0 disables summaries")
+	fs.StringVar(&o.summaryConfigMap, "summary-configmap", "",
+		"namespace/name of the ConfigMap the healing summary is written to")
+	fs.StringVar(&o.config.Summary.WebhookURL, "summary-webhook-url", "",
+		"endpoint receiving the healing summary as a JSON POST")
+	fs.IntVar(&o.config.Summary.Top, "summary-top", 10, "number of workloads and reasons listed in the healing summary")
+	fs.StringVar(&o.approvalMode, "approval-mode", string(ApprovalNone),
+		"require approval before healing: none, webhook (POST decisions to --approval-url) or annotation")
+	fs.StringVar(&o.config.Approval.URL, "approval-url", "", "approval endpoint receiving healing decisions in webhook mode")
+	fs.DurationVar(&o.config.Approval.Timeout, "approval-timeout", 15*time.Minute,
+		"how long a decision waits for approval before --approval-default applies")
+	fs.StringVar(&o.approvalDefault, "approval-default", "deny", "verdict applied when approval times out: approve or deny")
+	fs.BoolVar(&o.config.HealingCondition.Enabled, "healing-condition", false,
+		"set the "+string(conditionSelectedForHealing)+" condition on pods before acting on them; "+
+			"setting its status to False vetoes the action")
+	fs.DurationVar(&o.config.HealingCondition.Delay, "healing-condition-delay", 0,
+		"how long an action waits after the "+string(conditionSelectedForHealing)+" condition is set, giving time to veto it")
+	fs.StringVar(&o.stateConfigMap, "state-configmap", "",
+		"namespace/name of the ConfigMap persisting heal counters across restarts, empty keeps them in memory only")
+	fs.DurationVar(&o.config.State.Interval, "state-save-interval", 30*time.Second,
+		"how often heal counters are saved to the state ConfigMap")
+	fs.IntVar(&o.config.CanaryPercent, "canary-percent", 0,
+		"heal only this percentage of stuck pods, sampled by pod UID, and only log the rest; 0 heals all")
+	fs.BoolVar(&o.config.Finalizers.Enabled, "strip-finalizers", false,
+		"remove allowlisted finalizers from pods stuck in Terminating longer than the terminating timeout")
+	fs.StringVar(&o.finalizerAllowlist, "finalizer-allowlist", "",
+		"comma-separated finalizers that are safe to remove, required with --strip-finalizers")
+	fs.DurationVar(&o.config.Thresholds.TerminatingTimeout, "terminating-timeout", defaultThresholds.TerminatingTimeout,
+		"how long a deleted pod may stay in Terminating before its finalizers are considered orphaned")
+	fs.BoolVar(&o.config.NotifyContainerConfigErrors, "notify-container-config-errors", false,
+		"report pods stuck in CreateContainerConfigError with StuckPod events on the pod and its owner instead of only a HealingSkipped event")
+	fs.DurationVar(&o.config.Delete.GracePeriod, "delete-grace-period", -time.Second,
+		"grace period of pods deleted by heals, negative uses the terminationGracePeriodSeconds of the pod; "+
+			"overridden by the healing.kubernetes.io/delete-grace-period pod annotation")
+	fs.StringVar(&o.deletePropagation, "delete-propagation-policy", "",
+		"propagation policy of pods deleted by heals: Background, Foreground or Orphan, empty uses the API server default; "+
+			"overridden by the healing.kubernetes.io/delete-propagation-policy pod annotation")
+	fs.BoolVar(&o.config.ForceDeleteLostPods, "force-delete-lost-pods", false,
+		"force delete pods stuck on NotReady or unreachable nodes longer than the node lost timeout")
+	fs.DurationVar(&o.config.OrphanedPodGracePeriod, "orphaned-pod-grace-period", 0,
+		"force delete pods bound to nodes that no longer exist after this long, 0 disables the cleanup")
+	fs.DurationVar(&o.config.Thresholds.NodeLostTimeout, "node-lost-timeout", defaultThresholds.NodeLostTimeout,
+		"how long a pod on a lost node waits for the node to return before it is force deleted")
+	fs.IntVar(&o.config.EphemeralStorage.Threshold, "ephemeral-eviction-threshold", 3,
+		"ephemeral-storage evictions of the same owner within --ephemeral-eviction-window after which the owner is annotated and notified, 0 disables")
+	fs.DurationVar(&o.config.EphemeralStorage.Window, "ephemeral-eviction-window", time.Hour,
+		"time window for counting ephemeral-storage evictions per owner")
+	fs.StringVar(&o.ephemeralMaxRequest, "ephemeral-storage-max-request", "",
+		"raise ephemeral-storage requests of repeatedly evicted owners up to this quantity, e.g. 10Gi; empty only notifies")
+	fs.IntVar(&o.config.OOMBump.Percent, "oom-bump-percent", 0,
+		"raise memory limits and requests of repeatedly OOMKilled containers in the owner template by this percentage, 0 disables")
+	fs.StringVar(&o.oomBumpMaxMemory, "oom-bump-max-memory", "",
+		"memory a container is never raised above by --oom-bump-percent, e.g. 4Gi")
+	fs.IntVar(&o.config.OOMBump.Threshold, "oom-bump-threshold", 3,
+		"OOM kills of the same owner within --oom-bump-window after which its memory is raised")
+	fs.DurationVar(&o.config.OOMBump.Window, "oom-bump-window", time.Hour,
+		"time window for counting OOM kills per owner")
+	fs.BoolVar(&o.config.BlackboxProbe.Enabled, "blackbox-probe", false,
+		"probe HTTP and TCP readiness endpoints of NotReady pods from the healer and skip healing pods that answer; "+
+			"requires network access from the healer to pod IPs")
+	fs.DurationVar(&o.config.BlackboxProbe.Timeout, "blackbox-probe-timeout", 2*time.Second,
+		"timeout of a --blackbox-probe request")
+	fs.BoolVar(&o.config.ResourceSignals.Enabled, "metrics-server-signals", false,
+		"query metrics-server for NotReady pods and only notify instead of restarting when a container is saturating its memory or CPU limit")
+	fs.Float64Var(&o.config.ResourceSignals.Saturation, "resource-saturation", 0.9,
+		"fraction of a container limit at which --metrics-server-signals considers it saturated")
+	fs.BoolVar(&o.config.MemoryLeak.Enabled, "memory-leak-detection", false,
+		"sample container memory from metrics-server and restart pods whose memory keeps growing towards the limit "+
+			"in the next maintenance window (at once without --maintenance-windows and namespace windows) before they are OOM killed")
+	fs.DurationVar(&o.config.MemoryLeak.Interval, "memory-leak-sample-interval", 5*time.Minute,
+		"how often --memory-leak-detection samples container memory")
+	fs.IntVar(&o.config.MemoryLeak.Samples, "memory-leak-samples", 12,
+		"number of consecutive non-decreasing memory samples that make a leak")
+	fs.DurationVar(&o.config.MemoryLeak.Horizon, "memory-leak-horizon", 6*time.Hour,
+		"restart a leaking container when its memory would reach the limit within this time")
+	fs.BoolVar(&o.config.Rollback.Enabled, "rollback-on-crashloop", false,
+		"roll a Deployment back to its previous revision when its new pods crash loop right after a rollout")
+	fs.DurationVar(&o.config.Rollback.Window, "rollback-window", 15*time.Minute,
+		"crash loops starting within this time after a Deployment rollout are attributed to the rollout")
+	fs.IntVar(&o.config.NamespaceBudget.Heals, "namespace-heal-budget", 3,
+		"maximum heals per namespace within --namespace-budget-window, 0 disables the per-namespace limit")
+	fs.DurationVar(&o.config.NamespaceBudget.Window, "namespace-budget-window", 10*time.Minute,
+		"time window for the per-namespace heal budget")
+	fs.StringVar(&o.config.ProtectedPriorityClass, "protected-priority-class", "system-cluster-critical",
+		"pods with the priority of this class or higher are never healed, empty disables the protection")
+}
+
+// addRunFlags - флаги, нужные только работающему оператору
+func (o *options) addRunFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.metricsAddr, "metrics-bind-address", ":8080", "address the metrics endpoint binds to")
+	fs.StringVar(&o.config.Webhook.BindAddress, "webhook-bind-address", "",
+		"address the mutating webhook injecting healing defaults binds to, empty disables the webhook")
+	fs.StringVar(&o.config.Webhook.CertFile, "webhook-cert-file", "/tmp/k8s-webhook-server/serving-certs/tls.crt",
+		"TLS certificate for the webhook server")
+	fs.StringVar(&o.config.Webhook.KeyFile, "webhook-key-file", "/tmp/k8s-webhook-server/serving-certs/tls.key",
+		"TLS key for the webhook server")
+	fs.BoolVar(&o.config.Webhook.SelfSigned.Enabled, "webhook-self-signed-cert", false,
+		"issue and rotate a self-signed webhook certificate in --webhook-cert-secret and patch the caBundle of "+
+			"--webhook-configuration instead of reading --webhook-cert-file and --webhook-key-file")
+	fs.StringVar(&o.config.Webhook.SelfSigned.Service, "webhook-service", "pod-healer-webhook",
+		"Service of the webhook, its DNS names are put into the self-signed certificate")
+	fs.StringVar(&o.config.Webhook.SelfSigned.Namespace, "webhook-service-namespace", "pod-healer-system",
+		"namespace of the webhook Service and the certificate Secret")
+	fs.StringVar(&o.config.Webhook.SelfSigned.Secret, "webhook-cert-secret", "pod-healer-webhook-cert",
+		"Secret storing the self-signed webhook certificate shared by all replicas")
+	fs.StringVar(&o.config.Webhook.SelfSigned.Configuration, "webhook-configuration", "pod-healer",
+		"MutatingWebhookConfiguration whose caBundle is kept in sync with the self-signed certificate")
+	fs.DurationVar(&o.config.Webhook.SelfSigned.Validity, "webhook-cert-validity", 365*24*time.Hour,
+		"validity of the self-signed webhook certificate, it is renewed after two thirds of it")
+	fs.BoolVar(&o.alertReceiver, "alert-receiver", false,
+		"serve an Alertmanager webhook receiver at /alertmanager/webhook on the metrics address")
+	fs.StringVar(&o.alertReceiverToken, "alert-receiver-token", "",
+		"bearer token required from Alertmanager, defaults to $ALERT_RECEIVER_TOKEN; --alert-receiver refuses to start without it")
+	fs.BoolVar(&o.alertInsecure, "alert-receiver-insecure", false,
+		"let --alert-receiver accept alerts without a bearer token, anyone reaching the metrics address can then heal pods")
+	fs.BoolVar(&o.onDemandHeal, "on-demand-heal", false,
+		"serve POST /api/v1/heal on the metrics address for kubectl heal pod, the request goes through all healing policies")
+	fs.StringVar(&o.onDemandHealToken, "on-demand-heal-token", "",
+		"token required in the X-Healer-Token header of on-demand heal requests, defaults to $ON_DEMAND_HEAL_TOKEN; "+
+			"--on-demand-heal refuses to start without it")
+	fs.BoolVar(&o.config.LeaderElection.Enabled, "leader-elect", false,
+		"elect an active replica through a Lease in every cluster, standby replicas take over when it stops")
+	fs.StringVar(&o.config.LeaderElection.Namespace, "leader-election-namespace", "pod-healer-system",
+		"namespace of the leader election Lease and --active-active work claims, must exist in every cluster")
+	fs.BoolVar(&o.config.ActiveActive.Enabled, "active-active", false,
+		"run every replica as active and claim each heal through a Lease instead of electing a leader")
+	fs.DurationVar(&o.config.ActiveActive.ClaimDuration, "active-active-claim-duration", 5*time.Minute,
+		"how long a claimed heal keeps other replicas from healing the same pod")
+	fs.BoolVar(&o.enablePprof, "enable-pprof", false,
+		"serve net/http/pprof and the /debug/cache informer store dump on the metrics address")
+	fs.StringVar(&o.tracing.Endpoint, "otlp-endpoint", "",
+		"host:port of the OTLP/HTTP collector receiving healing pipeline traces, empty disables tracing")
+	fs.BoolVar(&o.tracing.Insecure, "otlp-insecure", false, "send traces to the OTLP collector over plain HTTP")
+	fs.Float64Var(&o.tracing.SampleRatio, "trace-sample-ratio", 1, "fraction of healing pipeline traces to export")
+}
+
+func (o *options) addOutputFlag(fs *pflag.FlagSet) {
+	fs.StringVarP(&o.output, "output", "o", "json", "output format: json or yaml")
+}
+
+// addPushgatewayFlags - флаги отправки метрик отчета, у report нет scrape endpoint'а
+func (o *options) addPushgatewayFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.pushgateway.URL, "pushgateway-url", "",
+		"Prometheus Pushgateway URL to push report metrics to, for a healer running as a Job")
+	fs.StringVar(&o.pushgateway.Job, "pushgateway-job", "pod-healer-report", "job label of the metrics pushed to the Pushgateway")
+	fs.DurationVar(&o.pushgateway.Timeout, "pushgateway-timeout", 10*time.Second, "timeout of the push to the Pushgateway")
+}
+
+// parseMinAvailable разбирает число реплик или процент от 0% до 100%
+func parseMinAvailable(value string) (intstr.IntOrString, error) {
+	minAvailable := intstr.Parse(value)
+	if minAvailable.Type == intstr.Int {
+		if minAvailable.IntVal < 0 {
+			return minAvailable, fmt.Errorf("must not be negative")
+		}
+		return minAvailable, nil
+	}
+	percent, err := intstr.GetScaledValueFromIntOrPercent(&minAvailable, 100, true)
+	if err != nil {
+		return minAvailable, fmt.Errorf("expected a number of replicas or a percentage")
+	}
+	if percent < 0 || percent > 100 {
+		return minAvailable, fmt.Errorf("percentage must be between 0%% and 100%%")
+	}
+	return minAvailable, nil
+}
+
+// buildConfig проверяет значения флагов и собирает из них Config
+func (o *options) buildConfig() (Config, error) {
+	config := o.config
+
+	windows, err := parseSchedules(o.maintenanceWindows)
+	if err != nil {
+		return config, fmt.Errorf("invalid --maintenance-windows: %w", err)
+	}
+	config.MaintenanceWindows = windows
+	minAvailable, err := parseMinAvailable(o.minAvailable)
+	if err != nil {
+		return config, fmt.Errorf("invalid --min-available %q: %w", o.minAvailable, err)
+	}
+	config.MinAvailable = minAvailable
+
+	if action := HealingAction(o.defaultAction); isRemediationAction(action) {
+		config.DefaultAction = action
+	} else {
+		return config, fmt.Errorf("invalid --default-action %q, expected one of %s",
+			o.defaultAction, strings.Join(remediationActions(), ", "))
+	}
+	switch action := EscalationAction(o.escalationAction); action {
+	case EscalateAnnotate, EscalateScaleToZero:
+		config.Escalation.Action = action
+	default:
+		return config, fmt.Errorf("invalid --escalation-action %q, expected annotate or scale-to-zero", o.escalationAction)
+	}
+	switch policy := UnownedPodPolicy(o.unownedPods); policy {
+	case UnownedIgnore, UnownedDelete, UnownedRecreate:
+		config.UnownedPods = policy
+	default:
+		return config, fmt.Errorf("invalid --unowned-pods %q, expected ignore, delete or recreate-from-spec", o.unownedPods)
+	}
+	switch policy := DaemonSetPodPolicy(o.daemonSetPods); policy {
+	case DaemonSetNotify, DaemonSetDelete, DaemonSetCordonNode:
+		config.DaemonSetPods = policy
+	default:
+		return config, fmt.Errorf("invalid --daemonset-pods %q, expected notify, delete or cordon-node", o.daemonSetPods)
+	}
+	switch policy := SidecarPodPolicy(o.sidecarPods); policy {
+	case SidecarPod, SidecarRolloutRestart, SidecarNotify:
+		config.Sidecars.Policy = policy
+	default:
+		return config, fmt.Errorf("invalid --sidecar-pods %q, expected pod, rollout-restart or notify", o.sidecarPods)
+	}
+	switch policy := ReadinessGatePolicy(o.readinessGatePods); policy {
+	case ReadinessGateNotify, ReadinessGateDelete:
+		config.ReadinessGatePods = policy
+	default:
+		return config, fmt.Errorf("invalid --readiness-gate-pods %q, expected notify or delete", o.readinessGatePods)
+	}
+	switch action := StuckRolloutAction(o.stuckRolloutAction); action {
+	case StuckRolloutNone, StuckRolloutNotify, StuckRolloutPause, StuckRolloutRollback:
+		config.StuckRolloutAction = action
+	default:
+		return config, fmt.Errorf("invalid --stuck-rollout-action %q, expected none, notify, pause or rollback", o.stuckRolloutAction)
+	}
+	if o.exitCodePolicies != "" {
+		policies, err := parseExitCodePolicies(o.exitCodePolicies)
+		if err != nil {
+			return config, fmt.Errorf("invalid --exit-code-policies: %w", err)
+		}
+		config.ExitCodePolicies = policies
+	}
+	if o.reasonActions != "" {
+		if config.ReasonActions, err = parseReasonActions(o.reasonActions); err != nil {
+			return config, fmt.Errorf("invalid --reason-actions: %w", err)
+		}
+	}
+	if o.contexts != "" {
+		config.Contexts = strings.Split(o.contexts, ",")
+	}
+	if config.ClientQPS < 0 || config.ClientBurst < 0 {
+		return config, fmt.Errorf("--kube-api-qps and --kube-api-burst must not be negative")
+	}
+	if config.HealWorkers < 1 {
+		return config, fmt.Errorf("--heal-workers must be positive")
+	}
+	if config.ResyncPeriod < 0 {
+		return config, fmt.Errorf("--resync-period must not be negative")
+	}
+	if config.EphemeralStorage.Threshold > 0 && config.EphemeralStorage.Window <= 0 {
+		return config, fmt.Errorf("--ephemeral-eviction-window must be positive")
+	}
+	if o.ephemeralMaxRequest != "" {
+		maxRequest, err := resource.ParseQuantity(o.ephemeralMaxRequest)
+		if err != nil {
+			return config, fmt.Errorf("invalid --ephemeral-storage-max-request: %w", err)
+		}
+		config.EphemeralStorage.MaxRequest = maxRequest
+	}
+	if config.OOMBump.Percent < 0 {
+		return config, fmt.Errorf("--oom-bump-percent must not be negative")
+	}
+	if config.OOMBump.Percent > 0 {
+		if o.oomBumpMaxMemory == "" {
+			return config, fmt.Errorf("--oom-bump-percent requires --oom-bump-max-memory")
+		}
+		maxMemory, err := resource.ParseQuantity(o.oomBumpMaxMemory)
+		if err != nil {
+			return config, fmt.Errorf("invalid --oom-bump-max-memory: %w", err)
+		}
+		config.OOMBump.MaxMemory = maxMemory
+		if config.OOMBump.Threshold <= 0 || config.OOMBump.Window <= 0 {
+			return config, fmt.Errorf("--oom-bump-threshold and --oom-bump-window must be positive")
+		}
+	}
+	if config.BlackboxProbe.Enabled && config.BlackboxProbe.Timeout <= 0 {
+		return config, fmt.Errorf("--blackbox-probe-timeout must be positive")
+	}
+	if config.ResourceSignals.Enabled && (config.ResourceSignals.Saturation <= 0 || config.ResourceSignals.Saturation > 1) {
+		return config, fmt.Errorf("--resource-saturation must be between 0 and 1")
+	}
+	if config.Rollback.Enabled && config.Rollback.Window <= 0 {
+		return config, fmt.Errorf("--rollback-window must be positive")
+	}
+	if config.ActiveActive.Enabled {
+		// Общее состояние и сводки пишет одна реплика, в active-active режиме их писали бы все
+		switch {
+		case config.LeaderElection.Enabled:
+			return config, fmt.Errorf("--active-active and --leader-elect are mutually exclusive")
+		case o.stateConfigMap != "" || config.Summary.enabled():
+			return config, fmt.Errorf("--active-active does not support --state-configmap and --summary-period")
+		case config.ActiveActive.ClaimDuration < time.Second:
+			return config, fmt.Errorf("--active-active-claim-duration must be at least 1s")
+		}
+		if config.ActiveActive.Identity, err = os.Hostname(); err != nil {
+			return config, fmt.Errorf("failed to get replica identity: %w", err)
+		}
+	}
+	if o.deletePropagation != "" {
+		if config.Delete.Propagation, err = parsePropagationPolicy(o.deletePropagation); err != nil {
+			return config, fmt.Errorf("invalid --delete-propagation-policy: %w", err)
+		}
+	}
+	if config.Webhook.SelfSigned.Enabled && config.Webhook.SelfSigned.Validity <= 0 {
+		return config, fmt.Errorf("--webhook-cert-validity must be positive")
+	}
+	if config.OrphanedPodGracePeriod < 0 {
+		return config, fmt.Errorf("--orphaned-pod-grace-period must not be negative")
+	}
+	if config.NodePressure.Enabled && (config.NodePressure.MaxEvictionsPerNode <= 0 || config.NodePressure.Interval <= 0) {
+		return config, fmt.Errorf("--node-pressure-max-evictions and --node-pressure-interval must be positive")
+	}
+	if config.MemoryLeak.Enabled {
+		if config.MemoryLeak.Interval <= 0 || config.MemoryLeak.Horizon <= 0 || config.MemoryLeak.Samples < 2 {
+			return config, fmt.Errorf("--memory-leak-sample-interval and --memory-leak-horizon must be positive and --memory-leak-samples at least 2")
+		}
+	}
+	if config.ServiceEndpoints.Timeout < 0 || (config.ServiceEndpoints.enabled() && config.ServiceEndpoints.Interval <= 0) {
+		return config, fmt.Errorf("--service-endpoints-timeout must not be negative and --service-endpoints-interval must be positive")
+	}
+	if config.NodePreemption.Enabled {
+		if config.NodePreemption.Interval <= 0 {
+			return config, fmt.Errorf("--node-preemption-interval must be positive")
+		}
+		for _, key := range strings.Split(o.preemptionTaints, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				config.NodePreemption.Taints = append(config.NodePreemption.Taints, key)
+			}
+		}
+		for _, condition := range strings.Split(o.preemptionConds, ",") {
+			if condition = strings.TrimSpace(condition); condition != "" {
+				config.NodePreemption.Conditions = append(config.NodePreemption.Conditions, corev1.NodeConditionType(condition))
+			}
+		}
+		if len(config.NodePreemption.Taints) == 0 && len(config.NodePreemption.Conditions) == 0 {
+			return config, fmt.Errorf("--node-preemption-eviction requires --node-preemption-taints or --node-preemption-conditions")
+		}
+	}
+	switch mode := ApprovalMode(o.approvalMode); mode {
+	case ApprovalNone, ApprovalAnnotation:
+		config.Approval.Mode = mode
+	case ApprovalWebhook:
+		if config.Approval.URL == "" {
+			return config, fmt.Errorf("--approval-mode=webhook requires --approval-url")
+		}
+		config.Approval.Mode = mode
+	default:
+		return config, fmt.Errorf("invalid --approval-mode %q, expected none, webhook or annotation", o.approvalMode)
+	}
+	switch o.approvalDefault {
+	case "approve", "deny":
+		config.Approval.DefaultApprove = o.approvalDefault == "approve"
+	default:
+		return config, fmt.Errorf("invalid --approval-default %q, expected approve or deny", o.approvalDefault)
+	}
+	if config.HealingCondition.Delay < 0 {
+		return config, fmt.Errorf("--healing-condition-delay must not be negative")
+	}
+	if o.stateConfigMap != "" {
+		config.State.Namespace, config.State.Name, err = parseStateConfigMap(o.stateConfigMap)
+		if err != nil {
+			return config, fmt.Errorf("invalid --state-configmap: %w", err)
+		}
+		if config.State.Interval <= 0 {
+			return config, fmt.Errorf("--state-save-interval must be positive")
+		}
+	}
+	if o.summaryConfigMap != "" {
+		config.Summary.Namespace, config.Summary.Name, err = parseStateConfigMap(o.summaryConfigMap)
+		if err != nil {
+			return config, fmt.Errorf("invalid --summary-configmap: %w", err)
+		}
+	}
+	if config.Summary.Period < 0 {
+		return config, fmt.Errorf("--summary-period must not be negative")
+	}
+	if config.Summary.enabled() {
+		if config.Summary.Period%time.Hour != 0 {
+			return config, fmt.Errorf("--summary-period must be a whole number of hours")
+		}
+		if config.Summary.Name == "" && config.Summary.WebhookURL == "" {
+			return config, fmt.Errorf("--summary-period requires --summary-configmap or --summary-webhook-url")
+		}
+	}
+	if config.CanaryPercent < 0 || config.CanaryPercent > 100 {
+		return config, fmt.Errorf("--canary-percent must be between 0 and 100")
+	}
+	if o.finalizerAllowlist != "" {
+		config.Finalizers.Allowlist = strings.Split(o.finalizerAllowlist, ",")
+	}
+	if config.Finalizers.Enabled && len(config.Finalizers.Allowlist) == 0 {
+		return config, fmt.Errorf("--strip-finalizers requires --finalizer-allowlist")
+	}
+	if o.thresholdSchedules != "" {
+		config.ThresholdSchedules, err = loadThresholdSchedules(o.thresholdSchedules)
+		if err != nil {
+			return config, fmt.Errorf("invalid --threshold-schedules: %w", err)
+		}
+	}
+	if o.promQLDetectors != "" {
+		if config.Prometheus.URL == "" {
+			return config, fmt.Errorf("--promql-detectors requires --prometheus-url")
+		}
+		if config.Prometheus.Interval <= 0 {
+			return config, fmt.Errorf("--promql-interval must be positive")
+		}
+		config.Prometheus.Detectors, err = loadPromQLDetectors(o.promQLDetectors)
+		if err != nil {
+			return config, fmt.Errorf("invalid --promql-detectors: %w", err)
+		}
+	}
+	if config.Shard.Total < 1 || config.Shard.Index < 0 || config.Shard.Index >= config.Shard.Total {
+		return config, fmt.Errorf("--shard-index must be between 0 and --shard-total - 1 and --shard-total must be positive")
+	}
+	if o.namespaces != "" && o.namespaceSelector != "" {
+		return config, fmt.Errorf("--namespaces and --namespace-selector are mutually exclusive")
+	}
+	if o.namespaces != "" {
+		config.Namespaces = strings.Split(o.namespaces, ",")
+	}
+	if o.namespaceSelector != "" {
+		selector, err := labels.Parse(o.namespaceSelector)
+		if err != nil {
+			return config, fmt.Errorf("invalid --namespace-selector: %w", err)
+		}
+		config.NamespaceSelector = selector
+	}
+	if o.nodeSelector != "" {
+		selector, err := labels.Parse(o.nodeSelector)
+		if err != nil {
+			return config, fmt.Errorf("invalid --node-selector: %w", err)
+		}
+		config.NodeSelector = selector
+	}
+	return config, nil
+}
+
+// buildHealers создает по одному healer'у на каждый кластер
+func (o *options) buildHealers() ([]*PodHealer, error) {
+	config, err := o.buildConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := buildClusterConfigs(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cluster configs: %w", err)
+	}
+
+	var healers []*PodHealer
+	for _, cluster := range clusters {
+		healer, err := NewPodHealer(cluster, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pod healer for cluster %s: %w", cluster.Name, err)
+		}
+		healers = append(healers, healer)
+	}
+	return healers, nil
+}
+
+func runOperator(opts *options) error {
+	alertToken := opts.alertReceiverToken
+	if alertToken == "" {
+		alertToken = os.Getenv("ALERT_RECEIVER_TOKEN")
+	}
+	// Без токена лечить Pod'ы может любой, кто достучится до metrics-адреса
+	if opts.alertReceiver && alertToken == "" && !opts.alertInsecure {
+		return fmt.Errorf("--alert-receiver requires --alert-receiver-token or $ALERT_RECEIVER_TOKEN, " +
+			"pass --alert-receiver-insecure to accept unauthenticated alerts")
+	}
+	onDemandToken := opts.onDemandHealToken
+	if onDemandToken == "" {
+		onDemandToken = os.Getenv("ON_DEMAND_HEAL_TOKEN")
+	}
+	if opts.onDemandHeal && onDemandToken == "" {
+		return fmt.Errorf("--on-demand-heal requires --on-demand-heal-token or $ON_DEMAND_HEAL_TOKEN")
+	}
+
+	healers, err := opts.buildHealers()
+	if err != nil {
+		return err
+	}
+
+	shutdownTracing, err := setupTracing(context.Background(), opts.tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			klog.ErrorS(err, "Failed to flush traces")
+		}
+	}()
+
+	handlers := map[string]http.Handler{"/api/v1/": newAPIHandler(healers)}
+	if opts.alertReceiver {
+		handlers["/alertmanager/webhook"] = newAlertReceiver(healers, alertToken)
+	}
+	if opts.onDemandHeal {
+		handlers["/api/v1/heal"] = newOnDemandHealHandler(healers, onDemandToken)
+	}
+	if opts.enablePprof {
+		addDebugHandlers(handlers, healers)
+	}
+	go serveMetrics(opts.metricsAddr, handlers)
+	// Webhook обслуживает только кластер, в котором запущен healer
+	if opts.config.Webhook.BindAddress != "" {
+		go healers[0].serveWebhook(opts.config.Webhook)
+	}
+
+	// Каждый кластер работает под своим manager'ом; ошибка одного останавливает все
+	ctx, cancel := context.WithCancel(signals.SetupSignalHandler())
+	defer cancel()
+	errs := make(chan error, len(healers))
+	for _, healer := range healers {
+		go func(healer *PodHealer) {
+			err := healer.Run(ctx)
+			if err != nil {
+				err = fmt.Errorf("cluster %s: %w", healer.cluster, err)
+			}
+			errs <- err
+		}(healer)
+	}
+	var firstErr error
+	for range healers {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	return firstErr
+}
+
+func runReport(w io.Writer, opts *options) error {
+	if opts.pushgateway.enabled() && (opts.pushgateway.Job == "" || opts.pushgateway.Timeout <= 0) {
+		return fmt.Errorf("--pushgateway-url requires --pushgateway-job and a positive --pushgateway-timeout")
+	}
+	healers, err := opts.buildHealers()
+	if err != nil {
+		return err
+	}
+
+	report := &Report{GeneratedAt: time.Now().UTC(), StuckPods: []StuckPodReport{}}
+	for _, healer := range healers {
+		clusterReport, err := healer.Report(context.TODO())
+		if err != nil {
+			return fmt.Errorf("failed to build report for cluster %s: %w", healer.cluster, err)
+		}
+		report.ScannedPods += clusterReport.ScannedPods
+		report.StuckPods = append(report.StuckPods, clusterReport.StuckPods...)
+	}
+	if err := writeReport(w, report, opts.output); err != nil {
+		return err
+	}
+	if opts.pushgateway.enabled() {
+		return pushReportMetrics(opts.pushgateway, report)
+	}
+	return nil
+}
+
+func runPolicyValidate(w io.Writer, opts *options) error {
+	config, err := opts.buildConfig()
+	if err != nil {
+		return err
+	}
+
+	clusters := []string{}
+	if opts.checkCluster {
+		healers, err := opts.buildHealers()
+		if err != nil {
+			return err
+		}
+		var problems []string
+		for _, healer := range healers {
+			clusters = append(clusters, healer.cluster)
+			namespaces, err := healer.clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to list namespaces in cluster %s: %w", healer.cluster, err)
+			}
+			for i := range namespaces.Items {
+				for _, err := range validateNamespacePolicy(&namespaces.Items[i]) {
+					problems = append(problems, fmt.Sprintf("cluster %s: %v", healer.cluster, err))
+				}
+			}
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("invalid namespace policy:\n  %s", strings.Join(problems, "\n  "))
+		}
+	}
+
+	return writeOutput(w, policyView(config, clusters), opts.output)
+}
+
+func runSnapshotSimulation(w io.Writer, opts *options, path string) error {
+	config, err := opts.buildConfig()
+	if err != nil {
+		return err
+	}
+	var at time.Time
+	if opts.snapshotAt != "" {
+		if at, err = time.Parse(time.RFC3339, opts.snapshotAt); err != nil {
+			return fmt.Errorf("invalid --at: %w", err)
+		}
+	}
+	report, err := simulateSnapshot(context.TODO(), config, path, at)
+	if err != nil {
+		return fmt.Errorf("failed to simulate snapshot %s: %w", path, err)
+	}
+	return writeReport(w, report, opts.output)
+}
+
+func runSimulate(w io.Writer, opts *options, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pod := &corev1.Pod{}
+	if err := yaml.Unmarshal(data, pod); err != nil {
+		return fmt.Errorf("failed to parse pod manifest %s: %w", path, err)
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = corev1.NamespaceDefault
+	}
+
+	healers, err := opts.buildHealers()
+	if err != nil {
+		return err
+	}
+	healer := healers[0]
+	if err := healer.loadNamespaces(context.TODO()); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	report := &Report{GeneratedAt: now.UTC(), ScannedPods: 1, StuckPods: []StuckPodReport{}}
+	if decision := healer.evaluatePod(context.TODO(), pod, now); decision != nil {
+		report.StuckPods = append(report.StuckPods, healer.reportEntry(decision))
+	}
+	return writeReport(w, report, opts.output)
+}
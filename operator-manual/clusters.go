@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const defaultClusterName = "default"
+
+// clusterConfig - подключение к одному кластеру
+type clusterConfig struct {
+	Name       string
+	RestConfig *rest.Config
+}
+
+// buildClusterConfigs возвращает список кластеров, за которыми следит healer:
+// - все kubeconfig файлы из --kubeconfig-dir (имя кластера - имя файла);
+// - перечисленные в --contexts контексты kubeconfig;
+// - иначе один кластер: in-cluster или текущий контекст kubeconfig.
+func buildClusterConfigs(config Config) ([]clusterConfig, error) {
+	if config.KubeconfigDir != "" {
+		return clustersFromDir(config.KubeconfigDir)
+	}
+
+	if len(config.Contexts) > 0 {
+		var clusters []clusterConfig
+		for _, context := range config.Contexts {
+			restConfig, err := restConfigForContext(config.Kubeconfig, context)
+			if err != nil {
+				return nil, fmt.Errorf("context %s: %v", context, err)
+			}
+			clusters = append(clusters, clusterConfig{Name: context, RestConfig: restConfig})
+		}
+		return clusters, nil
+	}
+
+	// Попытка подключиться внутри кластера
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		// Fallback: использование kubeconfig для разработки
+		kubeconfig := config.Kubeconfig
+		if kubeconfig == "" {
+			kubeconfig = os.Getenv("KUBECONFIG")
+		}
+		restConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build config: %v", err)
+		}
+	}
+	return []clusterConfig{{Name: defaultClusterName, RestConfig: restConfig}}, nil
+}
+
+func clustersFromDir(dir string) ([]clusterConfig, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig directory: %v", err)
+	}
+
+	var clusters []clusterConfig
+	for _, entry := range entries {
+		// Пропускаем служебные файлы и симлинки ..data из смонтированных Secret'ов
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		restConfig, err := clientcmd.BuildConfigFromFlags("", path)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: %v", path, err)
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		clusters = append(clusters, clusterConfig{Name: name, RestConfig: restConfig})
+	}
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("no kubeconfig files found in %s", dir)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+	return clusters, nil
+}
+
+func restConfigForContext(kubeconfig, context string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		rules.ExplicitPath = kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+}
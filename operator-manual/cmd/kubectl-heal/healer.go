@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Типы повторяют ответы API healer'а (api.go и on_demand.go оператора)
+
+type stuckPod struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Owner     string `json:"owner,omitempty"`
+	Reason    string `json:"reason"`
+	Code      string `json:"code"`
+	Detail    string `json:"detail"`
+	Action    string `json:"action"`
+	Message   string `json:"message,omitempty"`
+}
+
+type decisionRecord struct {
+	Time time.Time `json:"time"`
+	stuckPod
+	Result  string `json:"result"`
+	TraceID string `json:"traceID,omitempty"`
+}
+
+type healRequest struct {
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Requester string `json:"requester,omitempty"`
+}
+
+type healResult struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Action    string `json:"action,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// healerClient обращается к API healer'а через proxy kube-apiserver'а к Pod'у лидера,
+// так что доступ определяется RBAC пользователя на pods/proxy
+type healerClient struct {
+	clientset kubernetes.Interface
+	namespace string
+	lease     string
+	selector  string
+	port      int
+	token     string
+}
+
+// leaderPod находит Pod healer'а, держащий Lease: только он лечит и знает о зависших Pod'ах.
+// Без leader election (Lease нет) используется первый Ready Pod healer'а.
+func (c *healerClient) leaderPod(ctx context.Context) (string, error) {
+	lease, err := c.clientset.CoordinationV1().Leases(c.namespace).Get(ctx, c.lease, metav1.GetOptions{})
+	switch {
+	case err == nil && lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity != "":
+		// controller-runtime записывает в holderIdentity "<hostname>_<uuid>", hostname - имя Pod'а
+		return strings.SplitN(*lease.Spec.HolderIdentity, "_", 2)[0], nil
+	case err != nil && !apierrors.IsNotFound(err):
+		return "", fmt.Errorf("failed to get lease %s/%s: %w", c.namespace, c.lease, err)
+	}
+
+	pods, err := c.clientset.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: c.selector})
+	if err != nil {
+		return "", fmt.Errorf("failed to list healer pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+				return pod.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no ready healer pod matches %q in namespace %s", c.selector, c.namespace)
+}
+
+func (c *healerClient) get(ctx context.Context, path string, into interface{}) error {
+	pod, err := c.leaderPod(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := c.clientset.CoreV1().RESTClient().Get().
+		Namespace(c.namespace).Resource("pods").Name(pod + ":" + strconv.Itoa(c.port)).
+		SubResource("proxy").Suffix(path).DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("healer %s: %w", pod, err)
+	}
+	return json.Unmarshal(data, into)
+}
+
+func (c *healerClient) stuckPods(ctx context.Context) ([]stuckPod, error) {
+	var pods []stuckPod
+	return pods, c.get(ctx, "api/v1/stuck-pods", &pods)
+}
+
+func (c *healerClient) decisions(ctx context.Context) ([]decisionRecord, error) {
+	var decisions []decisionRecord
+	return decisions, c.get(ctx, "api/v1/decisions", &decisions)
+}
+
+func (c *healerClient) heal(ctx context.Context, request healRequest) (*healResult, error) {
+	pod, err := c.leaderPod(ctx)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req := c.clientset.CoreV1().RESTClient().Post().
+		Namespace(c.namespace).Resource("pods").Name(pod+":"+strconv.Itoa(c.port)).
+		SubResource("proxy").Suffix("api/v1/heal").
+		SetHeader("Content-Type", "application/json").Body(body)
+	if c.token != "" {
+		req = req.SetHeader("X-Healer-Token", c.token)
+	}
+	data, err := req.DoRaw(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) || apierrors.IsMethodNotSupported(err) {
+			return nil, fmt.Errorf("healer %s: %w (is the operator running with --on-demand-heal?)", pod, err)
+		}
+		return nil, fmt.Errorf("healer %s: %w", pod, err)
+	}
+	result := &healResult{}
+	return result, json.Unmarshal(data, result)
+}
@@ -0,0 +1,335 @@
+// kubectl-heal - плагин kubectl для pod-healer-operator: показывает зависшие Pod'ы
+// и причины, запрашивает heal Pod'а и приостанавливает healing namespace'а.
+// Установка: положить бинарник kubectl-heal в PATH, вызов - kubectl heal.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Аннотация паузы, которую читает healer (maintenance.go оператора)
+const annotationPausedUntil = "healing.kubernetes.io/paused-until"
+
+type options struct {
+	kubeconfig    string
+	context       string
+	namespace     string
+	allNamespaces bool
+	cluster       string
+	output        string
+	healer        healerClient
+	pauseFor      time.Duration
+}
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCommand() *cobra.Command {
+	opts := &options{}
+	root := &cobra.Command{
+		Use:          "kubectl-heal",
+		Short:        "Inspect and control pod-healer-operator",
+		SilenceUsage: true,
+	}
+
+	fs := root.PersistentFlags()
+	fs.StringVar(&opts.kubeconfig, "kubeconfig", "", "path to the kubeconfig file")
+	fs.StringVar(&opts.context, "context", "", "kubeconfig context to use")
+	fs.StringVarP(&opts.namespace, "namespace", "n", "", "namespace, defaults to the namespace of the kubeconfig context")
+	fs.StringVar(&opts.cluster, "cluster", "", "healer cluster name for operators healing several clusters")
+	fs.StringVarP(&opts.output, "output", "o", "table", "output format: table or json")
+	fs.StringVar(&opts.healer.namespace, "healer-namespace", "pod-healer-system", "namespace the operator runs in")
+	fs.StringVar(&opts.healer.lease, "healer-lease", "pod-healer",
+		"leader election Lease of the operator, pod-healer-shard-<N> for a sharded operator")
+	fs.StringVar(&opts.healer.selector, "healer-selector", "app=pod-healer",
+		"label selector of the operator pods, used when there is no Lease")
+	fs.IntVar(&opts.healer.port, "healer-port", 8080, "metrics port of the operator serving its API")
+	fs.StringVar(&opts.healer.token, "token", os.Getenv("KUBECTL_HEAL_TOKEN"),
+		"token for --on-demand-heal-token of the operator, defaults to $KUBECTL_HEAL_TOKEN")
+
+	root.AddCommand(
+		newListCommand(opts),
+		newExplainCommand(opts),
+		newPodCommand(opts),
+		newPauseCommand(opts),
+		newResumeCommand(opts),
+	)
+	return root
+}
+
+func newListCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List pods the healer considers stuck",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.complete(); err != nil {
+				return err
+			}
+			pods, err := opts.healer.stuckPods(context.TODO())
+			if err != nil {
+				return err
+			}
+			var matched []stuckPod
+			for _, pod := range pods {
+				if opts.matches(pod.Cluster, pod.Namespace) {
+					matched = append(matched, pod)
+				}
+			}
+			if opts.output == "json" {
+				return writeJSON(cmd.OutOrStdout(), matched)
+			}
+			if len(matched) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No stuck pods found.")
+				return nil
+			}
+			return writeTable(cmd.OutOrStdout(), []string{"CLUSTER", "NAMESPACE", "POD", "REASON", "CODE", "ACTION", "OWNER"},
+				func(row func(...string)) {
+					for _, pod := range matched {
+						row(pod.Cluster, pod.Namespace, pod.Pod, pod.Reason, pod.Code, pod.Action, pod.Owner)
+					}
+				})
+		},
+	}
+	cmd.Flags().BoolVarP(&opts.allNamespaces, "all-namespaces", "A", false, "list stuck pods in all namespaces")
+	return cmd
+}
+
+func newExplainCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "explain POD",
+		Short: "Show why the healer considers a pod stuck and its recent decisions",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.complete(); err != nil {
+				return err
+			}
+			ctx := context.TODO()
+			pods, err := opts.healer.stuckPods(ctx)
+			if err != nil {
+				return err
+			}
+			decisions, err := opts.healer.decisions(ctx)
+			if err != nil {
+				return err
+			}
+
+			explanation := struct {
+				Stuck     *stuckPod        `json:"stuck,omitempty"`
+				Decisions []decisionRecord `json:"decisions"`
+			}{Decisions: []decisionRecord{}}
+			for i := range pods {
+				if pods[i].Pod == args[0] && opts.matches(pods[i].Cluster, pods[i].Namespace) {
+					explanation.Stuck = &pods[i]
+					break
+				}
+			}
+			for _, decision := range decisions {
+				if decision.Pod == args[0] && opts.matches(decision.Cluster, decision.Namespace) {
+					explanation.Decisions = append(explanation.Decisions, decision)
+				}
+			}
+			if opts.output == "json" {
+				return writeJSON(cmd.OutOrStdout(), explanation)
+			}
+
+			w := cmd.OutOrStdout()
+			if stuck := explanation.Stuck; stuck != nil {
+				fmt.Fprintf(w, "Pod:       %s/%s (cluster %s)\n", stuck.Namespace, stuck.Pod, stuck.Cluster)
+				fmt.Fprintf(w, "Owner:     %s\n", stuck.Owner)
+				fmt.Fprintf(w, "Reason:    %s (%s)\n", stuck.Reason, stuck.Code)
+				fmt.Fprintf(w, "Detail:    %s\n", stuck.Detail)
+				fmt.Fprintf(w, "Action:    %s\n", stuck.Action)
+				fmt.Fprintf(w, "Message:   %s\n", stuck.Message)
+			} else {
+				fmt.Fprintf(w, "Pod %s/%s is not stuck.\n", opts.namespace, args[0])
+			}
+			if len(explanation.Decisions) == 0 {
+				return nil
+			}
+			fmt.Fprintln(w, "\nRecent decisions:")
+			return writeTable(w, []string{"TIME", "CODE", "ACTION", "RESULT", "MESSAGE"}, func(row func(...string)) {
+				for _, decision := range explanation.Decisions {
+					row(decision.Time.Local().Format(time.RFC3339), decision.Code, decision.Action,
+						decision.Result, decision.Message)
+				}
+			})
+		},
+	}
+}
+
+func newPodCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "pod POD",
+		Short: "Ask the healer to heal a pod now, subject to all of its policies",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.complete(); err != nil {
+				return err
+			}
+			result, err := opts.healer.heal(context.TODO(), healRequest{
+				Cluster:   opts.cluster,
+				Namespace: opts.namespace,
+				Pod:       args[0],
+				Requester: opts.requester(),
+			})
+			if err != nil {
+				return err
+			}
+			if opts.output == "json" {
+				return writeJSON(cmd.OutOrStdout(), result)
+			}
+			action := result.Action
+			if action == "" {
+				action = "none"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "pod %s/%s: action %s: %s\n", result.Namespace, result.Pod, action, result.Message)
+			return nil
+		},
+	}
+}
+
+func newPauseCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pause NAMESPACE",
+		Short: "Pause healing in a namespace: the healer keeps detecting stuck pods but only observes them",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.pauseFor <= 0 {
+				return fmt.Errorf("--for must be positive")
+			}
+			until := time.Now().Add(opts.pauseFor).UTC().Format(time.RFC3339)
+			if err := opts.annotateNamespace(args[0], &until); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "namespace %s: healing paused until %s\n", args[0], until)
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&opts.pauseFor, "for", time.Hour, "how long healing stays paused")
+	return cmd
+}
+
+func newResumeCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "resume NAMESPACE",
+		Short: "Resume healing in a namespace paused by kubectl heal pause",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.annotateNamespace(args[0], nil); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "namespace %s: healing resumed\n", args[0])
+			return nil
+		},
+	}
+}
+
+func (o *options) clientConfig() clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: o.context}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
+// complete создает клиент и определяет namespace по kubeconfig
+func (o *options) complete() error {
+	if o.output != "table" && o.output != "json" {
+		return fmt.Errorf("unknown output format %q, expected table or json", o.output)
+	}
+	if o.healer.clientset != nil {
+		return nil
+	}
+	config := o.clientConfig()
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return err
+	}
+	if o.healer.clientset, err = kubernetes.NewForConfig(restConfig); err != nil {
+		return err
+	}
+	if o.namespace == "" {
+		if o.namespace, _, err = config.Namespace(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *options) matches(cluster, namespace string) bool {
+	if o.cluster != "" && cluster != o.cluster {
+		return false
+	}
+	return o.allNamespaces || namespace == o.namespace
+}
+
+// requester - пользователь kubeconfig, от имени которого запрошен heal
+func (o *options) requester() string {
+	raw, err := o.clientConfig().RawConfig()
+	if err != nil {
+		return ""
+	}
+	current := raw.CurrentContext
+	if o.context != "" {
+		current = o.context
+	}
+	if kubeContext, ok := raw.Contexts[current]; ok && kubeContext.AuthInfo != "" {
+		return kubeContext.AuthInfo
+	}
+	return os.Getenv("USER")
+}
+
+// annotateNamespace выставляет или, при nil, снимает паузу namespace'а.
+// Изменение делается с правами пользователя, а не healer'а.
+func (o *options) annotateNamespace(namespace string, until *string) error {
+	if err := o.complete(); err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{annotationPausedUntil: until},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = o.healer.clientset.CoreV1().Namespaces().Patch(context.TODO(), namespace, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func writeJSON(w io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func writeTable(w io.Writer, header []string, rows func(row func(...string))) error {
+	table := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	row := func(columns ...string) {
+		for i, column := range columns {
+			if i > 0 {
+				fmt.Fprint(table, "\t")
+			}
+			fmt.Fprint(table, column)
+		}
+		fmt.Fprintln(table)
+	}
+	row(header...)
+	rows(row)
+	return table.Flush()
+}
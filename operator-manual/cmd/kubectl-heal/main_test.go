@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPIServer отвечает на запросы плагина так, как kube-apiserver с healer'ом за pods/proxy
+type fakeAPIServer struct {
+	mu       sync.Mutex
+	patches  map[string]string
+	heals    []healRequest
+	tokens   []string
+	stuck    []stuckPod
+	proxyPod string
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	proxy := "/api/v1/namespaces/pod-healer-system/pods/" + s.proxyPod + "/proxy/"
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/apis/coordination.k8s.io/v1/namespaces/pod-healer-system/leases/pod-healer":
+		fmt.Fprint(w, `{"apiVersion": "coordination.k8s.io/v1", "kind": "Lease", "metadata": {"name": "pod-healer"},
+			"spec": {"holderIdentity": "pod-healer-7d9f_0c1f2e"}}`)
+	case r.Method == http.MethodGet && r.URL.Path == proxy+"api/v1/stuck-pods":
+		_ = json.NewEncoder(w).Encode(s.stuck)
+	case r.Method == http.MethodPost && r.URL.Path == proxy+"api/v1/heal":
+		request := healRequest{}
+		_ = json.Unmarshal(body, &request)
+		s.heals = append(s.heals, request)
+		s.tokens = append(s.tokens, r.Header.Get("X-Healer-Token"))
+		_ = json.NewEncoder(w).Encode(healResult{Cluster: "default", Namespace: request.Namespace, Pod: request.Pod,
+			Action: "delete", Message: "heal requested"})
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/api/v1/namespaces/"):
+		name := strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/")
+		s.patches[name] = string(body)
+		fmt.Fprintf(w, `{"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": %q}}`, name)
+	default:
+		http.Error(w, `{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404}`,
+			http.StatusNotFound)
+	}
+}
+
+// runPlugin запускает kubectl heal с kubeconfig, указывающим на server
+func runPlugin(t *testing.T, server *httptest.Server, args ...string) (string, error) {
+	t.Helper()
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster: {server: %q}
+users:
+- name: alice
+  user: {token: alice-token}
+contexts:
+- name: test
+  context: {cluster: test, user: alice, namespace: default}
+current-context: test
+`, server.URL)
+	if err := os.WriteFile(kubeconfig, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newRootCommand()
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs(append(args, "--kubeconfig", kubeconfig))
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestList(t *testing.T) {
+	api := &fakeAPIServer{proxyPod: "pod-healer-7d9f:8080", stuck: []stuckPod{
+		{Cluster: "default", Namespace: "default", Pod: "web-1", Owner: "Deployment default/web",
+			Reason: "CrashLoopBackOff", Code: "CRASH_LOOP", Action: "delete"},
+		{Cluster: "default", Namespace: "batch", Pod: "report-1", Reason: "Pending", Code: "PENDING", Action: "skip"},
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	out, err := runPlugin(t, server, "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `CLUSTER   NAMESPACE   POD     REASON             CODE         ACTION   OWNER
+default   default     web-1   CrashLoopBackOff   CRASH_LOOP   delete   Deployment default/web
+`
+	if out != want {
+		t.Errorf("table output:\n%s\nwant:\n%s", out, want)
+	}
+
+	out, err = runPlugin(t, server, "list", "-A", "-o", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pods []stuckPod
+	if err := json.Unmarshal([]byte(out), &pods); err != nil || len(pods) != 2 {
+		t.Errorf("json output must list stuck pods of all namespaces, got %q: %v", out, err)
+	}
+
+	api.stuck = nil
+	if out, err := runPlugin(t, server, "list"); err != nil || out != "No stuck pods found.\n" {
+		t.Errorf("empty list output %q: %v", out, err)
+	}
+	if _, err := runPlugin(t, server, "list", "-o", "yaml"); err == nil {
+		t.Errorf("unknown output format must be rejected")
+	}
+}
+
+func TestPod(t *testing.T) {
+	api := &fakeAPIServer{proxyPod: "pod-healer-7d9f:8080"}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	out, err := runPlugin(t, server, "pod", "web-1", "--token", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "pod default/web-1: action delete: heal requested\n" {
+		t.Errorf("output %q", out)
+	}
+	want := healRequest{Namespace: "default", Pod: "web-1", Requester: "alice"}
+	if len(api.heals) != 1 || api.heals[0] != want || api.tokens[0] != "secret" {
+		t.Errorf("heal requests %+v with tokens %q, want %+v with token secret", api.heals, api.tokens, want)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	api := &fakeAPIServer{patches: map[string]string{}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	before := time.Now()
+	out, err := runPlugin(t, server, "pause", "batch", "--for", "2h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch := struct {
+		Metadata struct {
+			Annotations map[string]*string `json:"annotations"`
+		} `json:"metadata"`
+	}{}
+	if err := json.Unmarshal([]byte(api.patches["batch"]), &patch); err != nil {
+		t.Fatal(err)
+	}
+	value := patch.Metadata.Annotations[annotationPausedUntil]
+	if value == nil {
+		t.Fatalf("pause must set %s, got patch %s", annotationPausedUntil, api.patches["batch"])
+	}
+	until, err := time.Parse(time.RFC3339, *value)
+	if err != nil || until.Before(before.Add(2*time.Hour).Truncate(time.Second)) || until.After(time.Now().Add(2*time.Hour)) {
+		t.Errorf("paused until %q, want two hours from now: %v", *value, err)
+	}
+	if out != "namespace batch: healing paused until "+*value+"\n" {
+		t.Errorf("output %q", out)
+	}
+
+	if _, err := runPlugin(t, server, "pause", "batch", "--for", "0s"); err == nil {
+		t.Errorf("non-positive --for must be rejected")
+	}
+
+	out, err = runPlugin(t, server, "resume", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"metadata":{"annotations":{"healing.kubernetes.io/paused-until":null}}}`; api.patches["batch"] != want {
+		t.Errorf("resume patch %s, want %s", api.patches["batch"], want)
+	}
+	if out != "namespace batch: healing resumed\n" {
+		t.Errorf("output %q", out)
+	}
+}
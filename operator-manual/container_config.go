@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const ReasonContainerConfig StuckReason = "CreateContainerConfigError"
+
+// containerConfigFailure - разобранное сообщение CreateContainerConfigError
+type containerConfigFailure struct {
+	Reason string
+	// Object - Secret или ConfigMap, на который ссылается контейнер
+	Object string
+	// Key - отсутствующий ключ объекта
+	Key string
+}
+
+var missingKeyPattern = regexp.MustCompile(`couldn't find key (\S+) in (Secret|ConfigMap) (\S+)`)
+
+// classifyContainerConfigError разбирает сообщение kubelet'а о невозможности собрать конфигурацию контейнера
+func classifyContainerConfigError(message string) containerConfigFailure {
+	if match := missingKeyPattern.FindStringSubmatch(message); match != nil {
+		return containerConfigFailure{Reason: "Missing" + match[2] + "Key", Object: match[3], Key: match[1]}
+	}
+	if match := missingSecretPattern.FindStringSubmatch(message); match != nil {
+		return containerConfigFailure{Reason: "MissingSecret", Object: match[1]}
+	}
+	if match := missingConfigMapPattern.FindStringSubmatch(message); match != nil {
+		return containerConfigFailure{Reason: "MissingConfigMap", Object: match[1]}
+	}
+	if strings.Contains(message, "runAsNonRoot") {
+		return containerConfigFailure{Reason: "RunAsNonRoot"}
+	}
+	return containerConfigFailure{Reason: "InvalidConfig"}
+}
+
+func (f containerConfigFailure) describe() string {
+	switch {
+	case f.Key != "":
+		return fmt.Sprintf("%s: key %s not found in %s", f.Reason, f.Key, f.Object)
+	case f.Object != "":
+		return fmt.Sprintf("%s: %s not found", f.Reason, f.Object)
+	}
+	return f.Reason
+}
+
+// containerConfigDetector - kubelet не может собрать конфигурацию контейнера: нет Secret'а,
+// ConfigMap'а или ключа в них, либо securityContext несовместим с образом.
+// Kubelet сам повторяет попытки, и пересоздание Pod'а ошибку не исправит.
+type containerConfigDetector struct{}
+
+func (containerConfigDetector) Reason() StuckReason { return ReasonContainerConfig }
+
+func (containerConfigDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	if pod.Status.Phase != corev1.PodPending {
+		return nil
+	}
+	for _, status := range podContainerStatuses(pod) {
+		waiting := status.State.Waiting
+		if waiting == nil || waiting.Reason != "CreateContainerConfigError" {
+			continue
+		}
+		since := pod.CreationTimestamp.Time
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionTrue {
+				since = condition.LastTransitionTime.Time
+			}
+		}
+		if now.Sub(since) <= thresholds.ContainerCreatingTimeout {
+			return nil
+		}
+		return &stuckCondition{
+			Reason: ReasonContainerConfig,
+			Detail: fmt.Sprintf("%s in %s (%s): %s", status.describe(), waiting.Reason,
+				classifyContainerConfigError(waiting.Message).describe(), waiting.Message),
+			Since: since,
+		}
+	}
+	return nil
+}
+
+// containerConfigDecision никогда не удаляет такой Pod: о причине сообщается событием
+// на Pod'е, а с --notify-container-config-errors и на его владельце
+func (h *PodHealer) containerConfigDecision(ctx context.Context, decision *healingDecision) *healingDecision {
+	decision.Message = "recreating will not help, " + decision.Detail
+	if h.config.NotifyContainerConfigErrors {
+		owner, err := h.getOwner(ctx, decision.Pod)
+		if err != nil {
+			klog.ErrorS(err, "Failed to get pod owner", "cluster", h.cluster,
+				"namespace", decision.Pod.Namespace, "pod", decision.Pod.Name)
+		}
+		decision.Owner, decision.Action = owner, ActionNotify
+		return decision
+	}
+	decision.Action, decision.Warn = ActionSkip, true
+	return decision
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// mountFailure - причина, по которой контейнеры Pod'а не могут быть созданы
+type mountFailure struct {
+	Reason  string
+	Message string
+	// Object - имя отсутствующего Secret/ConfigMap, если причина в нем
+	Object string
+	// Retryable - может ли помочь пересоздание Pod'а (например, на другой ноде)
+	Retryable bool
+}
+
+var (
+	missingSecretPattern    = regexp.MustCompile(`secrets? "([^"]+)" not found`)
+	missingConfigMapPattern = regexp.MustCompile(`configmaps? "([^"]+)" not found`)
+)
+
+// containerCreatingSince возвращает момент, с которого Pod ждет создания
+// контейнеров, или нулевое время, если контейнеры не в ContainerCreating/CreateContainerError
+func containerCreatingSince(pod *corev1.Pod) (time.Time, string) {
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		waiting := containerStatus.State.Waiting
+		if waiting == nil || (waiting.Reason != "ContainerCreating" && waiting.Reason != "CreateContainerError") {
+			continue
+		}
+		since := pod.CreationTimestamp.Time
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionTrue {
+				since = condition.LastTransitionTime.Time
+			}
+		}
+		return since, fmt.Sprintf("container %s in %s", containerStatus.Name, waiting.Reason)
+	}
+	return time.Time{}, ""
+}
+
+// classifyMountFailure разбирает последние события FailedMount/FailedAttachVolume
+func classifyMountFailure(events []corev1.Event) *mountFailure {
+	for _, event := range events {
+		switch event.Reason {
+		case "FailedMount":
+			if match := missingSecretPattern.FindStringSubmatch(event.Message); match != nil {
+				return &mountFailure{Reason: "MissingSecret", Message: event.Message, Object: match[1]}
+			}
+			if match := missingConfigMapPattern.FindStringSubmatch(event.Message); match != nil {
+				return &mountFailure{Reason: "MissingConfigMap", Message: event.Message, Object: match[1]}
+			}
+			return &mountFailure{Reason: "MountFailed", Message: event.Message, Retryable: true}
+		case "FailedAttachVolume":
+			reason := "AttachFailed"
+			if strings.Contains(event.Message, "Multi-Attach error") {
+				reason = "MultiAttach"
+			}
+			return &mountFailure{Reason: reason, Message: event.Message, Retryable: true}
+		}
+	}
+	return nil
+}
+
+// creatingSkipReason решает, поможет ли пересоздание Pod'а, застрявшего в ContainerCreating.
+// Отсутствующий Secret/ConfigMap не появится от удаления Pod'а: такой Pod
+// ждет объекта и перезапускается, когда тот будет создан.
+func (h *PodHealer) creatingSkipReason(ctx context.Context, pod *corev1.Pod) (string, bool) {
+	events, err := h.podEvents(ctx, pod)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get pod events", "namespace", pod.Namespace, "pod", pod.Name)
+		return "", false
+	}
+
+	failure := classifyMountFailure(events)
+	if failure == nil {
+		return "", false
+	}
+	// Том не подключается к текущей ноде - пересоздание имеет смысл,
+	// только если топология PersistentVolume допускает другую ноду
+	if failure.Reason == "AttachFailed" || failure.Reason == "MultiAttach" {
+		blocker, err := h.volumeTopologyBlocker(ctx, pod)
+		if err != nil {
+			klog.ErrorS(err, "Failed to check volume topology", "namespace", pod.Namespace, "pod", pod.Name)
+			return "failed to check volume topology", false
+		}
+		if blocker != "" {
+			return fmt.Sprintf("recreating will not help, volume attach is stuck (%s): %s", failure.Reason, blocker), true
+		}
+	}
+	if failure.Retryable {
+		return "", false
+	}
+	// Событие FailedMount остается и после создания объекта: если объект уже появился,
+	// перезапуск Pod'а подключит его сразу, не дожидаясь повторной попытки kubelet'а
+	dependency := mountDependency{Namespace: pod.Namespace, Reason: failure.Reason, Name: failure.Object}
+	exists, err := h.mountObjectExists(ctx, dependency)
+	if err != nil {
+		klog.ErrorS(err, "Failed to check missing mount object", "namespace", pod.Namespace, "pod", pod.Name)
+	}
+	if exists {
+		return "", false
+	}
+	h.mountWaiters.wait(dependency, pod.UID, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name})
+	return fmt.Sprintf("recreating will not help, pod is blocked by %s %s: %s",
+		failure.Reason, failure.Object, failure.Message), true
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// LeaderElectionConfig - выбор активной реплики healer'а в каждом кластере
+type LeaderElectionConfig struct {
+	Enabled bool
+	// Namespace - где хранится Lease, он должен существовать во всех кластерах healer'а
+	Namespace string
+}
+
+// leaderElectionID - имя Lease, у каждого шарда свой лидер
+func (c Config) leaderElectionID() string {
+	if c.Shard.enabled() {
+		return fmt.Sprintf("pod-healer-shard-%d", c.Shard.Index)
+	}
+	return "pod-healer"
+}
+
+// В кэше нужны только события неудачных проб Pod'ов, остальные события
+// читаются из API по требованию (podEvents)
+var unhealthyEventSelector = fields.Set{"reason": "Unhealthy", "involvedObject.kind": "Pod"}.AsSelector()
+
+// newManager создает controller-runtime manager кластера: общий кэш Pod'ов,
+// Job'ов и событий, очереди reconcile и leader election
+func (h *PodHealer) newManager() (manager.Manager, error) {
+	if h.restConfig == nil {
+		return nil, fmt.Errorf("cluster %s has no rest config", h.cluster)
+	}
+
+	selectors := cache.SelectorsByObject{&corev1.Event{}: {Field: unhealthyEventSelector}}
+	if h.config.NamespaceSelector != nil && !h.config.NamespaceSelector.Empty() {
+		selectors[&corev1.Namespace{}] = cache.ObjectSelector{Label: h.config.NamespaceSelector}
+	}
+	newCache := func(config *rest.Config, options cache.Options) (cache.Cache, error) {
+		options.SelectorsByObject = selectors
+		// С явным списком namespaces кэш строится по namespace'ам, что допускает namespace-scoped RBAC
+		if len(h.config.Namespaces) > 0 {
+			return cache.MultiNamespacedCacheBuilder(h.watchNamespaces())(config, options)
+		}
+		return cache.New(config, options)
+	}
+
+	resync := h.config.ResyncPeriod
+	return manager.New(h.restConfig, manager.Options{
+		Scheme:     clientgoscheme.Scheme,
+		SyncPeriod: &resync,
+		NewCache:   newCache,
+		// Метрики всех кластеров отдает общий сервер --metrics-bind-address
+		MetricsBindAddress:      "0",
+		HealthProbeBindAddress:  "0",
+		LeaderElection:          h.config.LeaderElection.Enabled,
+		LeaderElectionID:        h.config.leaderElectionID(),
+		LeaderElectionNamespace: h.config.LeaderElection.Namespace,
+		// Lease освобождается при остановке, чтобы новая реплика не ждала его истечения
+		LeaderElectionReleaseOnCancel: true,
+		Logger:                        klog.NewKlogr().WithValues("cluster", h.cluster),
+	})
+}
+
+// informerStore возвращает store informer'а из кэша manager'а.
+// До запуска manager'а informer только регистрируется и заполнится при старте кэша.
+func informerStore(ctx context.Context, c cache.Cache, obj client.Object) (toolscache.Store, error) {
+	informer, err := c.GetInformer(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	shared, ok := informer.(toolscache.SharedIndexInformer)
+	if !ok {
+		return nil, fmt.Errorf("informer for %T has no store", obj)
+	}
+	return shared.GetStore(), nil
+}
+
+// setupControllers регистрирует в manager'е reconciler'ы и фоновые задачи healer'а
+func (h *PodHealer) setupControllers(ctx context.Context, mgr manager.Manager) error {
+	h.cache = mgr.GetCache()
+	c := mgr.GetClient()
+
+	// Политики namespaces читаются из общего кэша; при явном списке namespaces
+	// объекты Namespace по-прежнему читаются по одному (см. startNamespaceInformers)
+	if len(h.config.Namespaces) == 0 {
+		store, err := informerStore(ctx, h.cache, &corev1.Namespace{})
+		if err != nil {
+			return err
+		}
+		h.namespaces = store
+	}
+	if h.config.NodePressure.Enabled || h.config.NodePreemption.Enabled || h.nodeSelectorEnabled() ||
+		h.config.OrphanedPodGracePeriod > 0 {
+		store, err := informerStore(ctx, h.cache, &corev1.Node{})
+		if err != nil {
+			return err
+		}
+		h.nodes = store
+	}
+
+	watched := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return h.namespaceWatched(obj.GetNamespace())
+	})
+	err := builder.ControllerManagedBy(mgr).
+		Named(h.cluster+"-pods").
+		For(&corev1.Pod{}, builder.WithPredicates(watched)).
+		// Разные Pod'ы оцениваются параллельно, один и тот же - никогда
+		WithOptions(controller.Options{MaxConcurrentReconciles: h.config.healWorkers()}).
+		// Удаленный Pod забывается по событию: в reconcile его уже нет в кэше
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.Funcs{
+			DeleteFunc: func(e event.DeleteEvent, _ workqueue.RateLimitingInterface) {
+				if pod, ok := e.Object.(*corev1.Pod); ok {
+					h.forgetPod(pod)
+				}
+			},
+		}).
+		Complete(&podReconciler{healer: h, client: c})
+	if err != nil {
+		return fmt.Errorf("failed to set up pod controller: %w", err)
+	}
+
+	err = builder.ControllerManagedBy(mgr).
+		Named(h.cluster+"-jobs").
+		For(&batchv1.Job{}, builder.WithPredicates(watched)).
+		Complete(reconcile.Func(func(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+			job := &batchv1.Job{}
+			if err := c.Get(ctx, request.NamespacedName, job); err != nil {
+				return reconcile.Result{}, client.IgnoreNotFound(err)
+			}
+			h.handleJob(job)
+			return reconcile.Result{}, nil
+		}))
+	if err != nil {
+		return fmt.Errorf("failed to set up job controller: %w", err)
+	}
+
+	// События Unhealthy для обнаружения постоянно падающих liveness-проб
+	err = builder.ControllerManagedBy(mgr).
+		Named(h.cluster+"-unhealthy-events").
+		For(&corev1.Event{}, builder.WithPredicates(watched)).
+		Complete(reconcile.Func(func(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+			unhealthy := &corev1.Event{}
+			if err := c.Get(ctx, request.NamespacedName, unhealthy); err != nil {
+				return reconcile.Result{}, client.IgnoreNotFound(err)
+			}
+			h.liveness.observe(unhealthy)
+			return reconcile.Result{}, nil
+		}))
+	if err != nil {
+		return fmt.Errorf("failed to set up event controller: %w", err)
+	}
+
+	return mgr.Add(manager.RunnableFunc(h.runBackgroundTasks))
+}
+
+// podReconciler оценивает Pod при каждом его изменении и resync'е кэша
+type podReconciler struct {
+	healer *PodHealer
+	client client.Client
+}
+
+func (r *podReconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	r.healer.startOnce.Do(func() { r.healer.onElected(ctx) })
+
+	pod := &corev1.Pod{}
+	if err := r.client.Get(ctx, request.NamespacedName, pod); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	r.healer.handlePod(pod)
+	return reconcile.Result{}, nil
+}
+
+// onElected готовит healer к работе до первого оцененного Pod'а: дожидается
+// кэша namespaces для политик и восстанавливает счетчики предыдущего лидера
+func (h *PodHealer) onElected(ctx context.Context) {
+	if h.cache != nil && !h.cache.WaitForCacheSync(ctx) {
+		klog.InfoS("Caches not synced before the first reconcile", "cluster", h.cluster)
+	}
+	if h.config.State.enabled() {
+		if err := h.loadState(ctx); err != nil {
+			klog.ErrorS(err, "Failed to restore healing state, starting with empty counters", "cluster", h.cluster)
+		}
+	}
+}
+
+// runBackgroundTasks выполняет периодические задачи healer'а. Как и reconciler'ы,
+// они работают только в реплике-лидере и останавливаются при потере лидерства.
+func (h *PodHealer) runBackgroundTasks(ctx context.Context) error {
+	stop := ctx.Done()
+	if h.config.State.enabled() {
+		h.runStatePersistence(stop)
+	}
+	go wait.Until(h.drainQueuedHeals, 5*time.Second, stop)
+	h.runPromQLDetectors(stop)
+	h.runMissingMountChecks(stop)
+	if h.config.NodePressure.Enabled {
+		go wait.Until(func() { h.relievePressuredNodes(ctx) }, h.config.NodePressure.Interval, stop)
+	}
+	if h.config.NodePreemption.Enabled {
+		go wait.Until(func() { h.evacuatePreemptedNodes(ctx) }, h.config.NodePreemption.Interval, stop)
+	}
+	if h.config.MemoryLeak.Enabled {
+		go wait.Until(func() { h.sampleMemory(ctx) }, h.config.MemoryLeak.Interval, stop)
+		go wait.Until(func() { h.restartLeakingPods(ctx) }, memoryLeakRestartInterval, stop)
+	}
+	if h.config.ServiceEndpoints.enabled() {
+		go wait.Until(func() { h.checkServiceEndpoints(ctx) }, h.config.ServiceEndpoints.Interval, stop)
+	}
+	if h.config.OrphanedPodGracePeriod > 0 {
+		go wait.Until(func() { h.cleanupOrphanedPods(ctx) }, orphanedPodSweepInterval, stop)
+	}
+	if h.config.Summary.enabled() {
+		go wait.Until(func() { h.publishSummary(ctx) }, summaryCheckInterval, stop)
+	}
+	if h.config.ActiveActive.Enabled {
+		go wait.Until(func() { h.sweepWorkClaims(ctx) }, workClaimSweepInterval, stop)
+	}
+	if h.config.StuckRolloutAction != StuckRolloutNone {
+		go wait.Until(func() { h.checkStuckRollouts(ctx) }, stuckRolloutCheckInterval, stop)
+	}
+	<-stop
+
+	// Последнее состояние сохраняется, чтобы следующий лидер продолжил с него
+	if h.config.State.enabled() {
+		saveCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := h.saveState(saveCtx); err != nil {
+			klog.ErrorS(err, "Failed to save healing state on shutdown", "cluster", h.cluster)
+		}
+	}
+	return nil
+}
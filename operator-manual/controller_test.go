@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestPodReconciler(t *testing.T) {
+	pod := testPod("web-1", time.Hour, withRestarts(11), withOwner("ReplicaSet", "web-5d4f8"))
+	healer, clientset, _ := newTestHealer(t, Config{}, append(testDeployment("web"), pod)...)
+	reconciler := &podReconciler{
+		healer: healer,
+		client: ctrlfake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(pod.DeepCopy()).Build(),
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}}
+	if _, err := reconciler.Reconcile(context.Background(), request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if podExists(t, clientset, pod) {
+		t.Errorf("stuck pod was not healed by reconcile")
+	}
+
+	// Pod, исчезнувший из кэша до reconcile, не считается ошибкой
+	request.Name = "gone"
+	if _, err := reconciler.Reconcile(context.Background(), request); err != nil {
+		t.Errorf("Reconcile of a deleted pod: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// DaemonSetPodPolicy определяет, что делать с зависшими Pod'ами DaemonSet.
+// Удаленный Pod DaemonSet пересоздается на той же ноде, поэтому если сломана
+// нода, удаление ничего не дает.
+type DaemonSetPodPolicy string
+
+const (
+	DaemonSetNotify     DaemonSetPodPolicy = "notify"
+	DaemonSetDelete     DaemonSetPodPolicy = "delete"
+	DaemonSetCordonNode DaemonSetPodPolicy = "cordon-node"
+)
+
+const (
+	ActionCordonNode HealingAction = "cordon-node"
+
+	// Ноды, закордоненные healer'ом, помечаются этой аннотацией с причиной
+	annotationCordonedBy = "healing.kubernetes.io/cordoned"
+)
+
+// daemonSetAction выбирает действие для зависшего Pod'а DaemonSet
+func (h *PodHealer) daemonSetAction(pod *corev1.Pod) HealingAction {
+	switch h.config.DaemonSetPods {
+	case DaemonSetDelete:
+		return h.healingAction(pod)
+	case DaemonSetCordonNode:
+		if pod.Spec.NodeName != "" {
+			return ActionCordonNode
+		}
+	}
+	return ActionNotify
+}
+
+// cordonNodeRemediator запрещает планирование на ноду зависшего Pod'а DaemonSet,
+// чтобы обратить на нее внимание и увести с нее остальные нагрузки
+type cordonNodeRemediator struct{ h *PodHealer }
+
+func (cordonNodeRemediator) Action() HealingAction { return ActionCordonNode }
+
+func (r cordonNodeRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	pod := decision.Pod
+	nodeName := pod.Spec.NodeName
+	if nodeName == "" {
+		return fmt.Errorf("pod is not scheduled to a node")
+	}
+
+	reason := fmt.Sprintf("%s: pod %s/%s %s", r.h.clock.Now().UTC().Format(time.RFC3339), pod.Namespace, pod.Name, decision.Detail)
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]string{annotationCordonedBy: reason}},
+		"spec":     map[string]interface{}{"unschedulable": true},
+	})
+	if err != nil {
+		return err
+	}
+	node, err := r.h.clientset.CoreV1().Nodes().Patch(ctx, nodeName, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+
+	klog.InfoS("Cordoned node of stuck DaemonSet pod", "cluster", r.h.cluster, "node", nodeName,
+		"namespace", pod.Namespace, "pod", pod.Name, "reason", decision.Reason, "code", decision.Code)
+	decisionEventf(r.h.recorder, node, decision, corev1.EventTypeWarning, "NodeCordoned",
+		"Node cordoned because DaemonSet pod %s/%s is stuck (%s): %s", pod.Namespace, pod.Name, decision.Reason, decision.Detail)
+	decisionEventf(r.h.recorder, pod, decision, corev1.EventTypeWarning, "NodeCordoned", "Node %s cordoned: %s", nodeName, decision.Detail)
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CacheDump - размеры кэшей одного healer'а для поиска утечек памяти
+type CacheDump struct {
+	Cluster string `json:"cluster"`
+	// Informers - число объектов в кэше каждого ресурса
+	Informers map[string]int `json:"informers"`
+	// Trackers - число записей во внутренних структурах healer'а
+	Trackers map[string]int `json:"trackers"`
+}
+
+// addDebugHandlers добавляет endpoints net/http/pprof и /debug/cache.
+// Обработчики регистрируются явно: DefaultServeMux сервер метрик не использует.
+func addDebugHandlers(handlers map[string]http.Handler, healers []*PodHealer) {
+	handlers["/debug/pprof/"] = http.HandlerFunc(pprof.Index)
+	handlers["/debug/pprof/cmdline"] = http.HandlerFunc(pprof.Cmdline)
+	handlers["/debug/pprof/profile"] = http.HandlerFunc(pprof.Profile)
+	handlers["/debug/pprof/symbol"] = http.HandlerFunc(pprof.Symbol)
+	handlers["/debug/pprof/trace"] = http.HandlerFunc(pprof.Trace)
+	handlers["/debug/cache"] = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dumps := []CacheDump{}
+		for _, healer := range healers {
+			dumps = append(dumps, healer.cacheDump())
+		}
+		sort.Slice(dumps, func(i, j int) bool { return dumps[i].Cluster < dumps[j].Cluster })
+		writeJSON(w, r, dumps)
+	})
+}
+
+func (h *PodHealer) cacheDump() CacheDump {
+	dump := CacheDump{Cluster: h.cluster, Informers: map[string]int{}, Trackers: map[string]int{}}
+
+	if h.cache != nil {
+		for resource, list := range map[string]client.ObjectList{
+			"pods":   &corev1.PodList{},
+			"jobs":   &batchv1.JobList{},
+			"events": &corev1.EventList{},
+		} {
+			if err := h.cache.List(context.TODO(), list); err == nil {
+				dump.Informers[resource] = meta.LenList(list)
+			}
+		}
+	}
+	if h.nodes != nil {
+		dump.Informers["nodes"] = len(h.nodes.ListKeys())
+	}
+	if h.namespaces != nil {
+		dump.Informers["namespaces"] = len(h.namespaces.ListKeys())
+	}
+
+	h.detectedMu.Lock()
+	dump.Trackers["detected"] = len(h.detected)
+	h.detectedMu.Unlock()
+
+	h.liveness.mu.Lock()
+	dump.Trackers["livenessFailures"] = len(h.liveness.failures)
+	h.liveness.mu.Unlock()
+
+	h.flaps.mu.Lock()
+	dump.Trackers["flapOwners"] = len(h.flaps.churn)
+	dump.Trackers["flapRestarts"] = len(h.flaps.restarts)
+	h.flaps.mu.Unlock()
+
+	h.state.mu.Lock()
+	dump.Trackers["stuckPods"] = len(h.state.stuck)
+	dump.Trackers["decisions"] = len(h.state.decisions)
+	h.state.mu.Unlock()
+
+	h.queueMu.Lock()
+	dump.Trackers["queuedHeals"] = len(h.queue)
+	h.queueMu.Unlock()
+
+	h.budgets.mu.Lock()
+	dump.Trackers["namespaceBudgets"] = len(h.budgets.heals)
+	h.budgets.mu.Unlock()
+
+	h.attemptsMu.Lock()
+	dump.Trackers["healAttemptOwners"] = len(h.attempts)
+	h.attemptsMu.Unlock()
+	return dump
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// StuckReason - причина, по которой Pod признан зависшим
+type StuckReason string
+
+const (
+	ReasonPending           StuckReason = "Pending"
+	ReasonImagePull         StuckReason = "ImagePull"
+	ReasonContainerCreating StuckReason = "ContainerCreating"
+	ReasonCrashLoop         StuckReason = "CrashLoopBackOff"
+	ReasonTooManyRestarts   StuckReason = "TooManyRestarts"
+	ReasonNotReady          StuckReason = "NotReady"
+	ReasonLivenessFailing   StuckReason = "LivenessFailing"
+	ReasonAlert             StuckReason = "Alert"
+	ReasonOnDemand          StuckReason = "OnDemand"
+	ReasonTerminating       StuckReason = "Terminating"
+)
+
+// annotationIgnoreUntil временно исключает Pod из healing
+const annotationIgnoreUntil = "healing.kubernetes.io/ignore-until"
+
+// HealingAction - действие, которое healer выбрал для зависшего Pod'а
+type HealingAction string
+
+const (
+	ActionDelete     HealingAction = "delete"
+	ActionQuarantine HealingAction = "quarantine"
+	ActionRecreate   HealingAction = "recreate"
+	ActionEscalate   HealingAction = "escalate"
+	ActionObserve    HealingAction = "observe"
+	ActionSkip       HealingAction = "skip"
+)
+
+// healingAction выбирает действие для Pod'а: аннотация action на Pod'е
+// имеет приоритет над глобальным --default-action
+func (h *PodHealer) healingAction(pod *corev1.Pod) HealingAction {
+	if action := HealingAction(pod.Annotations["healing.kubernetes.io/action"]); isRemediationAction(action) {
+		return action
+	}
+	if h.config.DefaultAction != "" {
+		return h.config.DefaultAction
+	}
+	return ActionDelete
+}
+
+func hasActionAnnotation(pod *corev1.Pod) bool {
+	return isRemediationAction(HealingAction(pod.Annotations["healing.kubernetes.io/action"]))
+}
+
+// healingDecision - результат оценки зависшего Pod'а
+type healingDecision struct {
+	Pod    *corev1.Pod
+	Owner  *workloadOwner
+	Stuck  *stuckCondition
+	Reason StuckReason
+	// Code - стабильный код причины для внешней автоматизации
+	Code    ReasonCode
+	Detail  string
+	Action  HealingAction
+	Message string
+	// Warn - сообщить о пропуске события Warning на Pod'е
+	Warn bool
+	// SpanContext - span оценки Pod'а, отложенный heal продолжает его трейс
+	SpanContext trace.SpanContext
+}
+
+// evaluatePod определяет, завис ли Pod и что с ним делать.
+// Возвращает nil, если Pod не завис или исключен из healing.
+// Сама оценка ничего не меняет в кластере.
+func (h *PodHealer) evaluatePod(ctx context.Context, pod *corev1.Pod, now time.Time) *healingDecision {
+	mode, eligible := h.podMode(pod)
+	if !eligible {
+		return nil
+	}
+
+	thresholds := thresholdsForPod(pod, thresholdsForMode(mode, h.thresholdsAt(now)))
+	_, detectSpan := tracer.Start(ctx, "Detect", h.podSpanAttributes(pod))
+	stuck := h.isPodStuck(pod, thresholds)
+	if stuck != nil {
+		detectSpan.SetAttributes(attribute.String("healing.reason", string(stuck.Reason)))
+	}
+	detectSpan.End()
+	if stuck == nil {
+		return nil
+	}
+
+	ctx, decideSpan := tracer.Start(ctx, "EvaluatePolicy", h.podSpanAttributes(pod))
+	defer decideSpan.End()
+	decision := h.decide(ctx, pod, stuck, mode, thresholds, now)
+	decisionSpanAttributes(decideSpan, decision)
+	return decision
+}
+
+// podMode возвращает режим healing для Pod'а и false, если Pod исключен из healing
+func (h *PodHealer) podMode(pod *corev1.Pod) (HealingMode, bool) {
+	// Игнорируем Pod'ы в namespaces kube-system
+	if pod.Namespace == "kube-system" {
+		return "", false
+	}
+	if !h.namespaceWatched(pod.Namespace) || !h.nodeWatched(pod) {
+		return "", false
+	}
+
+	// Pod'ы на карантине оставлены для отладки
+	if isQuarantined(pod) {
+		return "", false
+	}
+
+	// Игнорируем Pod'ы с аннотацией ignore
+	if pod.Annotations != nil {
+		if _, exists := pod.Annotations["healing.kubernetes.io/ignore"]; exists {
+			return "", false
+		}
+	}
+	if ignoredUntil(pod, h.clock.Now()) {
+		return "", false
+	}
+
+	mode := h.namespaceMode(pod.Namespace)
+	if mode == ModeDisabled {
+		return "", false
+	}
+	return mode, true
+}
+
+// ignoredUntil проверяет временное исключение из healing аннотацией ignore-until.
+// Значение - момент в RFC3339 или длительность от создания Pod'а, так что исключение
+// в шаблоне workload'а действует на каждый новый Pod ограниченное время.
+// Некорректное значение не исключает Pod, чтобы исключение не действовало бессрочно.
+func ignoredUntil(pod *corev1.Pod, now time.Time) bool {
+	value, exists := pod.Annotations[annotationIgnoreUntil]
+	if !exists {
+		return false
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		duration, durationErr := time.ParseDuration(value)
+		if durationErr != nil {
+			klog.ErrorS(err, "Invalid pod annotation", "namespace", pod.Namespace, "pod", pod.Name,
+				"annotation", annotationIgnoreUntil, "value", value)
+			return false
+		}
+		until = pod.CreationTimestamp.Add(duration)
+	}
+	return now.Before(until)
+}
+
+// decide применяет политики healing к Pod'у, признанному зависшим
+func (h *PodHealer) decide(ctx context.Context, pod *corev1.Pod, stuck *stuckCondition, mode HealingMode,
+	thresholds Thresholds, now time.Time) *healingDecision {
+	decision := &healingDecision{Pod: pod, Stuck: stuck, Reason: stuck.Reason, Code: reasonCode(pod, stuck.Reason), Detail: stuck.Detail}
+
+	skip := func(message string, warn bool) *healingDecision {
+		decision.Action, decision.Message, decision.Warn = ActionSkip, message, warn
+		return decision
+	}
+
+	if h.isPriorityProtected(pod) {
+		return skip(fmt.Sprintf("priority %d is protected by priority class %s",
+			podPriority(pod), h.config.ProtectedPriorityClass), false)
+	}
+
+	if pod.Annotations["healing.kubernetes.io/action"] == "ignore" {
+		return skip("ignore action annotation", false)
+	}
+
+	if mode == ModeObserve {
+		decision.Action, decision.Message = ActionObserve, "observe mode"
+		return decision
+	}
+	if until, paused := h.namespacePausedUntil(pod.Namespace, now); paused {
+		decision.Action, decision.Message = ActionObserve, "healing paused until "+until.UTC().Format(time.RFC3339)
+		return decision
+	}
+	// Рестарт при утечке памяти как раз назначается на окно обслуживания
+	if stuck.Reason != ReasonMemoryLeak && h.inMaintenanceWindow(pod.Namespace, now) {
+		decision.Action, decision.Message = ActionObserve, "maintenance window active"
+		return decision
+	}
+	if message, outside := outsideHealingWindow("pod", pod.Namespace+"/"+pod.Name, pod.Annotations, now); outside {
+		decision.Action, decision.Message = ActionObserve, message
+		return decision
+	}
+	if !h.inCanarySample(pod) {
+		decision.Action, decision.Message = ActionObserve, canaryReason(h.config.CanaryPercent)
+		return decision
+	}
+
+	// Проверяем по событиям, поможет ли пересоздание
+	switch stuck.Reason {
+	case ReasonPending:
+		if message, warn := h.pendingSkipReason(ctx, pod, thresholds); message != "" {
+			return skip(message, warn)
+		}
+	case ReasonContainerCreating:
+		if message, warn := h.creatingSkipReason(ctx, pod); message != "" {
+			return skip(message, warn)
+		}
+	case ReasonContainerConfig:
+		return h.containerConfigDecision(ctx, decision)
+	case ReasonTerminating:
+		// Pod уже удален: политики владельца и доступности к нему не относятся
+		return h.terminatingDecision(decision)
+	case ReasonNodeLost:
+		// Pod на потерянной ноде уже недоступен, политики доступности к нему не относятся
+		return h.nodeLostDecision(ctx, decision)
+	case ReasonNodeDeleted:
+		decision.Action, decision.Message = ActionForceDelete, "pod is bound to a deleted node"
+		return decision
+	}
+
+	// Pod'ы без владельца после удаления никто не пересоздаст
+	if isUnowned(pod) {
+		switch h.config.UnownedPods {
+		case UnownedDelete:
+			decision.Action = h.healingAction(pod)
+		case UnownedRecreate:
+			decision.Action = ActionRecreate
+		default:
+			return skip("pod has no owner and unowned pod policy is ignore", false)
+		}
+		return decision
+	}
+
+	owner, err := h.getOwner(ctx, pod)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get pod owner", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name)
+	}
+	decision.Owner = owner
+
+	// Окно Pod'а, если оно задано, важнее окна владельца
+	if _, podWindow := pod.Annotations[annotationHealingWindow]; owner != nil && !podWindow {
+		if message, outside := outsideHealingWindow(owner.Kind, owner.Namespace+"/"+owner.Name,
+			owner.Object.GetAnnotations(), now); outside {
+			decision.Action, decision.Message = ActionObserve, message
+			return decision
+		}
+	}
+
+	if owner != nil && isEscalated(owner) {
+		return skip(fmt.Sprintf("%s is escalated as broken", owner), false)
+	}
+	if owner != nil && h.ownerInCooldown(owner, now) {
+		return skip(fmt.Sprintf("%s was healed recently", owner), false)
+	}
+	if heal, waiting := h.replacements.waiting(pod, now, h.config.ReplacementTimeout); waiting {
+		return skip(replacementWaitReason(heal, now), false)
+	}
+	if owner != nil {
+		if violates, desired, available := violatesMinAvailable(pod, owner, h.config.MinAvailable); violates {
+			return skip(fmt.Sprintf("healing would drop %s below minimum availability (%d/%d available)",
+				owner, available, desired), true)
+		}
+	}
+
+	// Падает только sidecar: удаление Pod'а прервет работающий основной контейнер
+	sidecarPolicy := h.config.Sidecars.Policy
+	if owner != nil && (sidecarPolicy == SidecarRolloutRestart || sidecarPolicy == SidecarNotify) && !hasActionAnnotation(pod) {
+		if sidecars := failingSidecars(pod); len(sidecars) > 0 {
+			return h.sidecarDecision(decision, sidecars, now)
+		}
+	}
+
+	// Удаление Pod'а DaemonSet пересоздаст его на той же ноде
+	if owner != nil && owner.Kind == "DaemonSet" {
+		if decision.Action = h.daemonSetAction(pod); decision.Action != ActionDelete {
+			return decision
+		}
+	}
+
+	// Внешний контроллер gate'а не зарегистрирует и новый Pod, достаточно сообщить о проблеме
+	if stuck.Reason == ReasonReadinessGate && h.config.ReadinessGatePods != ReadinessGateDelete {
+		decision.Action, decision.Message = ActionNotify, "readiness gate pod policy is notify"
+		return decision
+	}
+
+	// Выселенные Pod'ы будут выселяться снова, пока владелец не получит больше ephemeral-storage
+	if owner != nil {
+		if due, evictions := h.ephemeralStorageDue(owner, stuck, now); due {
+			decision.Action = ActionEphemeralStorage
+			decision.Message = fmt.Sprintf("%d ephemeral-storage evictions within %v", evictions, h.config.EphemeralStorage.Window)
+			return decision
+		}
+	}
+
+	// Контейнеры, убитые за превышение памяти, будут убиты снова, пока ее не станет больше
+	if owner != nil {
+		if due, message := h.oomBumpDue(pod, owner, decision.Code, now); due {
+			decision.Action, decision.Message = ActionOOMBump, message
+			return decision
+		}
+	}
+
+	if owner != nil {
+		if message := h.stuckRolloutSkipReason(pod, owner); message != "" {
+			decision.Action, decision.Message = ActionSkip, message
+			return decision
+		}
+	}
+
+	// Бесконечные удаления и постоянные падения скрывают реальную проблему - эскалируем
+	if owner != nil {
+		if due, attempts := h.escalationDue(owner, now); due {
+			decision.Action = ActionEscalate
+			decision.Message = escalationReason(attempts, h.config.Escalation.Window, stuck)
+			return decision
+		}
+		if due, churn := h.flappingDue(owner, now); due {
+			decision.Action = ActionEscalate
+			decision.Message = flappingReason(churn, h.config.Flapping.Window, stuck)
+			return decision
+		}
+	}
+
+	// Контейнер уперся в limit: рестарт не поможет, сообщаем, каких ресурсов не хватает
+	if stuck.Reason == ReasonNotReady && h.config.ResourceSignals.Enabled && !hasActionAnnotation(pod) {
+		if saturated := h.resourceSaturation(ctx, pod); saturated != "" {
+			decision.Detail = fmt.Sprintf("%s, %s", decision.Detail, saturated)
+			decision.Action = ActionNotify
+			decision.Message = "resource limits are saturated, raising them is more likely to help than a restart"
+			return decision
+		}
+	}
+
+	// Эндпоинт отвечает healer'у: Pod жив, а проблема в kubelet'е или пробе
+	if stuck.Reason == ReasonNotReady && h.config.BlackboxProbe.Enabled && !hasActionAnnotation(pod) {
+		alive, detail := h.blackboxProbe(ctx, pod)
+		if detail != "" {
+			decision.Detail = fmt.Sprintf("%s, %s", decision.Detail, detail)
+		}
+		if alive {
+			return skip("readiness endpoints answer when probed from the healer, kubelet or probe problem suspected", true)
+		}
+	}
+
+	// Действие по коду завершения контейнера, явное действие Pod'а важнее
+	if !hasActionAnnotation(pod) {
+		if action, message, ok := h.exitCodeAction(pod, owner); ok {
+			decision.Action, decision.Message = action, message
+			return decision
+		}
+	}
+
+	// Crash loop сразу после rollout'а вызван новой конфигурацией, пересоздание не поможет
+	if owner != nil {
+		if message := h.rollbackReason(ctx, pod, owner, stuck); message != "" {
+			decision.Action, decision.Message = ActionRollback, message
+			return decision
+		}
+	}
+
+	// Действие по категории сбоя вместо одного действия для всех
+	if !hasActionAnnotation(pod) {
+		if action, message, ok := h.reasonAction(pod, decision.Code); ok {
+			decision.Action, decision.Message = action, message
+			return decision
+		}
+	}
+
+	decision.Action = h.healingAction(pod)
+	return decision
+}
+
+// executeDecision выполняет решение, принятое evaluatePod
+func (h *PodHealer) executeDecision(ctx context.Context, decision *healingDecision) {
+	pod := decision.Pod
+	decisionsTotal.WithLabelValues(h.cluster, string(decision.Action), string(decision.Code)).Inc()
+
+	ctx, span := tracer.Start(ctx, "ExecuteDecision", h.podSpanAttributes(pod))
+	decisionSpanAttributes(span, decision)
+	decision.SpanContext = span.SpanContext()
+
+	var result string
+	defer func() {
+		span.SetAttributes(attribute.String("healing.result", result))
+		span.End()
+		record := DecisionRecord{Time: h.clock.Now().UTC(), StuckPodReport: h.reportEntry(decision), Result: result}
+		if decision.SpanContext.HasTraceID() {
+			record.TraceID = decision.SpanContext.TraceID().String()
+		}
+		h.state.recordDecision(record)
+		if h.config.Summary.enabled() {
+			h.summaries.record(record)
+		}
+	}()
+
+	if h.requiresApproval(decision.Action) {
+		switch verdict, reason := h.approve(ctx, decision); verdict {
+		case verdictPending:
+			result = string(verdictPending)
+			klog.InfoS("Healing awaits approval", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name,
+				"reason", decision.Reason, "code", decision.Code, "action", decision.Action, "approval", h.config.Approval.Mode)
+			return
+		case verdictDenied:
+			result = string(verdictDenied)
+			klog.InfoS("Healing denied", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name,
+				"reason", decision.Reason, "code", decision.Code, "action", decision.Action, "message", reason)
+			return
+		}
+	}
+	// Другие контроллеры и люди видят запланированное действие в condition Pod'а и могут его отменить
+	if h.config.HealingCondition.Enabled && changesCluster(decision.Action) {
+		if result = h.healingSelection(ctx, decision); result != "" {
+			return
+		}
+	}
+
+	switch decision.Action {
+	case ActionObserve:
+		result = "observed"
+		klog.InfoS("Would heal pod", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name,
+			"reason", decision.Reason, "code", decision.Code, "action", decision.Action, "message", decision.Message)
+	case ActionSkip:
+		result = "skipped"
+		klog.InfoS("Skipping pod", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name,
+			"reason", decision.Reason, "code", decision.Code, "action", decision.Action, "message", decision.Message)
+		if decision.Warn {
+			decisionEventf(h.recorder, pod, decision, corev1.EventTypeWarning, "HealingSkipped", "%s", decision.Message)
+		}
+	case ActionEscalate:
+		result = "escalated"
+		if err := h.escalate(ctx, decision.Owner, decision.Message); err != nil {
+			result = "failed"
+			klog.ErrorS(err, "Failed to escalate", "cluster", h.cluster, "owner", decision.Owner.String())
+		}
+	case ActionNotify:
+		// Уведомления не расходуют бюджет rate limiter'а
+		result = h.performHeal(decision)
+	default:
+		result = h.scheduleHeal(decision)
+	}
+}
@@ -0,0 +1,1722 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+// testDeployment возвращает Deployment и его ReplicaSet, которым принадлежат тестовые Pod'ы
+func testDeployment(name string) []runtime.Object {
+	return testDeploymentAvailable(name, 3, 3)
+}
+
+// testDeploymentAvailable возвращает Deployment с заданным числом доступных реплик и его ReplicaSet
+func testDeploymentAvailable(name string, replicas, available int32) []runtime.Object {
+	controller := true
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: "deployment-uid"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{Replicas: replicas, UpdatedReplicas: replicas, AvailableReplicas: available},
+	}
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name + "-5d4f8",
+			Namespace: "default",
+			UID:       types.UID(name + "-5d4f8-uid"),
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       name,
+				UID:        deployment.UID,
+				Controller: &controller,
+			}},
+		},
+		Spec: appsv1.ReplicaSetSpec{Replicas: &replicas},
+	}
+	return []runtime.Object{deployment, replicaSet}
+}
+
+func TestEvaluatePod(t *testing.T) {
+	crashLooping := []podOption{withWaiting("CrashLoopBackOff"), withNotReady(time.Minute), withOwner("ReplicaSet", "web-5d4f8")}
+
+	tests := []struct {
+		name    string
+		config  Config
+		pod     *corev1.Pod
+		objects []runtime.Object
+		// wantAction пустой, если Pod не должен попасть в healing
+		wantAction  HealingAction
+		wantMessage string
+	}{
+		{
+			name: "healthy pod",
+			pod:  testPod("web-1", time.Hour, withOwner("ReplicaSet", "web-5d4f8")),
+		},
+		{
+			name: "kube-system is never healed",
+			pod: testPod("dns", time.Hour, append(crashLooping, func(pod *corev1.Pod) {
+				pod.Namespace = "kube-system"
+			})...),
+		},
+		{
+			name: "ignore annotation",
+			pod:  testPod("web-1", time.Hour, append(crashLooping, withAnnotation("healing.kubernetes.io/ignore", ""))...),
+		},
+		{
+			name: "ignored until a future time",
+			pod: testPod("web-1", time.Hour, append(crashLooping,
+				withAnnotation(annotationIgnoreUntil, testNow.Add(time.Hour).Format(time.RFC3339)))...),
+		},
+		{
+			name: "ignore until expired",
+			pod: testPod("web-1", time.Hour, append(crashLooping,
+				withAnnotation(annotationIgnoreUntil, testNow.Add(-time.Minute).Format(time.RFC3339)))...),
+			wantAction: ActionDelete,
+		},
+		{
+			name: "ignored for a duration after creation",
+			pod:  testPod("web-1", time.Hour, append(crashLooping, withAnnotation(annotationIgnoreUntil, "2h"))...),
+		},
+		{
+			name:       "ignore duration expired",
+			pod:        testPod("web-1", time.Hour, append(crashLooping, withAnnotation(annotationIgnoreUntil, "30m"))...),
+			wantAction: ActionDelete,
+		},
+		{
+			name:       "invalid ignore until is not an exemption",
+			pod:        testPod("web-1", time.Hour, append(crashLooping, withAnnotation(annotationIgnoreUntil, "tomorrow"))...),
+			wantAction: ActionDelete,
+		},
+		{
+			name:       "crash looping deployment pod is deleted",
+			pod:        testPod("web-1", time.Hour, crashLooping...),
+			wantAction: ActionDelete,
+		},
+		{
+			name:       "action annotation overrides default action",
+			config:     Config{DefaultAction: ActionEvict},
+			pod:        testPod("web-1", time.Hour, append(crashLooping, withAnnotation("healing.kubernetes.io/action", "rollout-restart"))...),
+			wantAction: ActionRolloutRestart,
+		},
+		{
+			name:       "default action",
+			config:     Config{DefaultAction: ActionEvict},
+			pod:        testPod("web-1", time.Hour, crashLooping...),
+			wantAction: ActionEvict,
+		},
+		{
+			name:        "unowned pod is skipped by default",
+			pod:         testPod("debug", time.Hour, withWaiting("CrashLoopBackOff")),
+			wantAction:  ActionSkip,
+			wantMessage: "unowned pod policy is ignore",
+		},
+		{
+			name:   "protected priority",
+			config: Config{ProtectedPriorityClass: "system-cluster-critical"},
+			pod: testPod("web-1", time.Hour, append(crashLooping, func(pod *corev1.Pod) {
+				priority := int32(2000000000)
+				pod.Spec.Priority = &priority
+			})...),
+			wantAction:  ActionSkip,
+			wantMessage: "is protected by priority class",
+		},
+		{
+			name: "missing secret blocks container creation",
+			pod: testPod("web-1", 12*time.Minute, withPhase(corev1.PodPending), withWaiting("ContainerCreating"),
+				withOwner("ReplicaSet", "web-5d4f8")),
+			objects: []runtime.Object{&corev1.Event{
+				ObjectMeta:     metav1.ObjectMeta{Name: "web-1.mount", Namespace: "default"},
+				InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-1", UID: "web-1-uid"},
+				Reason:         "FailedMount",
+				Message:        `MountVolume.SetUp failed for volume "creds" : secret "db-creds" not found`,
+				LastTimestamp:  metav1.NewTime(testNow.Add(-time.Minute)),
+			}},
+			wantAction:  ActionSkip,
+			wantMessage: "MissingSecret db-creds",
+		},
+		{
+			name: "container config error is never deleted",
+			pod: testPod("web-1", 12*time.Minute, withPhase(corev1.PodPending), withOwner("ReplicaSet", "web-5d4f8"),
+				func(pod *corev1.Pod) {
+					pod.Status.ContainerStatuses[0].State = corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+						Reason:  "CreateContainerConfigError",
+						Message: "couldn't find key password in Secret default/db-creds",
+					}}
+				}),
+			wantAction:  ActionSkip,
+			wantMessage: "MissingSecretKey: key password not found in default/db-creds",
+		},
+		{
+			name: "failing readiness gate is only notified",
+			pod: testPod("web-1", time.Hour, withNotReady(11*time.Minute), withOwner("ReplicaSet", "web-5d4f8"),
+				withReadinessGate("target-health.elbv2.k8s.aws/web", corev1.ConditionFalse)),
+			wantAction:  ActionNotify,
+			wantMessage: "readiness gate pod policy is notify",
+		},
+		{
+			name:   "failing readiness gate with delete policy",
+			config: Config{ReadinessGatePods: ReadinessGateDelete},
+			pod: testPod("web-1", time.Hour, withNotReady(11*time.Minute), withOwner("ReplicaSet", "web-5d4f8"),
+				withReadinessGate("target-health.elbv2.k8s.aws/web", corev1.ConditionFalse)),
+			wantAction: ActionDelete,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healer, _, _ := newTestHealer(t, tt.config, append(testDeployment("web"), tt.objects...)...)
+
+			decision := healer.evaluatePod(context.Background(), tt.pod, testNow)
+			if tt.wantAction == "" {
+				if decision != nil {
+					t.Fatalf("expected no decision, got %s (%s)", decision.Action, decision.Message)
+				}
+				return
+			}
+			if decision == nil {
+				t.Fatalf("expected %s decision, got none", tt.wantAction)
+			}
+			if decision.Action != tt.wantAction {
+				t.Fatalf("expected action %s, got %s (%s)", tt.wantAction, decision.Action, decision.Message)
+			}
+			if !strings.Contains(decision.Message, tt.wantMessage) {
+				t.Fatalf("expected message to contain %q, got %q", tt.wantMessage, decision.Message)
+			}
+		})
+	}
+}
+
+func TestDeleteOptions(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          DeleteConfig
+		annotations     map[string]string
+		wantGracePeriod string
+		wantPropagation string
+	}{
+		{name: "pod defaults", config: DeleteConfig{GracePeriod: -time.Second}},
+		{name: "configured", config: DeleteConfig{GracePeriod: 90 * time.Second, Propagation: metav1.DeletePropagationForeground},
+			wantGracePeriod: "90", wantPropagation: "Foreground"},
+		{name: "pod annotations override", config: DeleteConfig{GracePeriod: 90 * time.Second},
+			annotations:     map[string]string{annotationDeleteGracePeriod: "0s", annotationDeletePropagation: "Background"},
+			wantGracePeriod: "0", wantPropagation: "Background"},
+		{name: "invalid annotations are ignored", config: DeleteConfig{GracePeriod: 1500 * time.Millisecond},
+			annotations:     map[string]string{annotationDeleteGracePeriod: "-5s", annotationDeletePropagation: "cascade"},
+			wantGracePeriod: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod("web-1", time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Hour),
+				withOwner("ReplicaSet", "web-5d4f8"))
+			pod.Annotations = tt.annotations
+			healer, clientset, _ := newTestHealer(t, Config{Delete: tt.config}, append(testDeployment("web"), pod)...)
+			if result := healOnce(t, healer, pod); result != "healed" {
+				t.Fatalf("result %q, want healed", result)
+			}
+
+			var opts *metav1.DeleteOptions
+			for _, action := range clientset.Actions() {
+				if action.GetVerb() == "delete" && action.GetResource().Resource == "pods" {
+					deleteOptions := action.(k8stesting.DeleteAction).GetDeleteOptions()
+					opts = &deleteOptions
+				}
+			}
+			if opts == nil {
+				t.Fatal("pod was not deleted")
+			}
+			gracePeriod, propagation := "", ""
+			if opts.GracePeriodSeconds != nil {
+				gracePeriod = fmt.Sprint(*opts.GracePeriodSeconds)
+			}
+			if opts.PropagationPolicy != nil {
+				propagation = string(*opts.PropagationPolicy)
+			}
+			if gracePeriod != tt.wantGracePeriod || propagation != tt.wantPropagation {
+				t.Errorf("grace period %q, propagation %q, want %q, %q", gracePeriod, propagation, tt.wantGracePeriod, tt.wantPropagation)
+			}
+		})
+	}
+}
+
+func TestActiveActiveWorkClaims(t *testing.T) {
+	config := func(identity string) Config {
+		return Config{
+			Thresholds:     defaultThresholds,
+			LeaderElection: LeaderElectionConfig{Namespace: "pod-healer-system"},
+			ActiveActive:   ActiveActiveConfig{Enabled: true, Identity: identity, ClaimDuration: 5 * time.Minute},
+		}
+	}
+	pod := testPod("web-1", time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Hour),
+		withOwner("ReplicaSet", "web-5d4f8"))
+	first, clientset, clock := newTestHealer(t, config("replica-a"), append(testDeployment("web"), pod)...)
+	second, err := newPodHealer("test", clientset, clock, config("replica-b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := healOnce(t, first, pod); result != "healed" {
+		t.Fatalf("first replica result %q, want healed", result)
+	}
+	// Вторая реплика видит Pod зависшим по устаревшему кэшу, но heal уже закреплен
+	if result := healOnce(t, second, pod); result != "claimed" {
+		t.Fatalf("second replica result %q, want claimed", result)
+	}
+
+	// Истекший Lease перехватывается
+	clock.Step(5 * time.Minute)
+	if claimed, _, err := second.claimWork(context.Background(), pod.UID, "test"); err != nil || !claimed {
+		t.Fatalf("expired claim not taken over: claimed %v, err %v", claimed, err)
+	}
+	lease, err := clientset.CoordinationV1().Leases("pod-healer-system").Get(context.Background(), workClaimName(pod.UID), metav1.GetOptions{})
+	if err != nil || *lease.Spec.HolderIdentity != "replica-b" {
+		t.Fatalf("claim lease %+v, err %v", lease, err)
+	}
+
+	first.sweepWorkClaims(context.Background())
+	if _, err := clientset.CoordinationV1().Leases("pod-healer-system").Get(context.Background(), lease.Name, metav1.GetOptions{}); err != nil {
+		t.Fatalf("live claim was swept: %v", err)
+	}
+	clock.Step(5 * time.Minute)
+	first.sweepWorkClaims(context.Background())
+	if _, err := clientset.CoordinationV1().Leases("pod-healer-system").Get(context.Background(), lease.Name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expired claim was not swept: %v", err)
+	}
+}
+
+func TestActiveActiveOwnerClaims(t *testing.T) {
+	config := func(identity string) Config {
+		return Config{
+			Thresholds:     defaultThresholds,
+			LeaderElection: LeaderElectionConfig{Namespace: "pod-healer-system"},
+			ActiveActive:   ActiveActiveConfig{Enabled: true, Identity: identity, ClaimDuration: 5 * time.Minute},
+		}
+	}
+	crashLooping := func(name, action string) *corev1.Pod {
+		return testPod(name, time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Hour),
+			withOwner("ReplicaSet", "web-5d4f8"), withAnnotation("healing.kubernetes.io/action", action))
+	}
+	ctx := context.Background()
+
+	// Реплики берут разные Pod'ы одного Deployment'а: rollout restart выполняет только одна
+	web1, web2 := crashLooping("web-1", "rollout-restart"), crashLooping("web-2", "rollout-restart")
+	first, clientset, clock := newTestHealer(t, config("replica-a"), append(testDeployment("web"), web1, web2)...)
+	second, err := newPodHealer("test", clientset, clock, config("replica-b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restart1, restart2 := first.evaluatePod(ctx, web1, clock.Now()), second.evaluatePod(ctx, web2, clock.Now())
+	if restart1 == nil || restart2 == nil || restart1.Action != ActionRolloutRestart || restart2.Action != ActionRolloutRestart {
+		t.Fatalf("expected rollout restart decisions, got %+v and %+v", restart1, restart2)
+	}
+	if result := first.performHeal(restart1); result != "healed" {
+		t.Fatalf("first replica result %q, want healed", result)
+	}
+	if result := second.performHeal(restart2); result != "claimed" {
+		t.Fatalf("second replica result %q, want claimed by the owner claim", result)
+	}
+	if _, err := clientset.CoordinationV1().Leases("pod-healer-system").Get(ctx, workClaimName("deployment-uid"), metav1.GetOptions{}); err != nil {
+		t.Fatalf("rollout restart must be claimed by the deployment UID: %v", err)
+	}
+
+	// Удаление Pod'а по-прежнему закрепляется за самим Pod'ом
+	web3, web4 := crashLooping("web-3", "delete"), crashLooping("web-4", "delete")
+	for _, pod := range []*corev1.Pod{web3, web4} {
+		if _, err := clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result := healOnce(t, first, web3); result != "healed" {
+		t.Fatalf("first replica result %q, want healed", result)
+	}
+	if result := healOnce(t, second, web4); result != "healed" {
+		t.Fatalf("second replica result %q, want healed", result)
+	}
+}
+
+func TestHealCooldown(t *testing.T) {
+	first := testPod("web-1", time.Hour, withRestarts(11), withOwner("ReplicaSet", "web-5d4f8"))
+	second := testPod("web-2", time.Hour, withRestarts(11), withOwner("ReplicaSet", "web-5d4f8"))
+	healer, clientset, clock := newTestHealer(t, Config{HealCooldown: 10 * time.Minute},
+		append(testDeployment("web"), first, second)...)
+	ctx := context.Background()
+
+	decision := healer.evaluatePod(ctx, first, clock.Now())
+	if decision == nil || decision.Action != ActionDelete {
+		t.Fatalf("expected delete decision for %s, got %v", first.Name, decision)
+	}
+	if result := healer.performHeal(decision); result != "healed" {
+		t.Fatalf("expected pod to be healed, got %s", result)
+	}
+	if _, err := clientset.CoreV1().Pods(first.Namespace).Get(ctx, first.Name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected %s to be deleted, got %v", first.Name, err)
+	}
+
+	// Владелец только что вылечен - второй Pod ждет окончания cooldown
+	decision = healer.evaluatePod(ctx, second, clock.Now())
+	if decision == nil || decision.Action != ActionSkip || !strings.Contains(decision.Message, "healed recently") {
+		t.Fatalf("expected %s to be skipped during cooldown, got %v", second.Name, decision)
+	}
+
+	clock.Step(11 * time.Minute)
+	decision = healer.evaluatePod(ctx, second, clock.Now())
+	if decision == nil || decision.Action != ActionDelete {
+		t.Fatalf("expected delete decision after cooldown, got %v", decision)
+	}
+}
+
+func TestMinAvailable(t *testing.T) {
+	tests := []struct {
+		name         string
+		minAvailable string
+		replicas     int32
+		available    int32
+		pod          *corev1.Pod
+		wantSkip     bool
+	}{
+		{
+			name:         "ready pod of 3/3",
+			minAvailable: "1",
+			replicas:     3,
+			available:    3,
+			pod:          testPod("web-1", time.Hour, withRestarts(11), withOwner("ReplicaSet", "web-5d4f8")),
+		},
+		{
+			name:         "last ready pod of 1/3 is kept",
+			minAvailable: "1",
+			replicas:     3,
+			available:    1,
+			pod:          testPod("web-1", time.Hour, withRestarts(11), withOwner("ReplicaSet", "web-5d4f8")),
+			wantSkip:     true,
+		},
+		{
+			name:         "not ready pod of unavailable single replica",
+			minAvailable: "1",
+			replicas:     1,
+			available:    0,
+			pod:          testPod("web-1", time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Minute), withOwner("ReplicaSet", "web-5d4f8")),
+		},
+		{
+			name:         "percentage is rounded up",
+			minAvailable: "50%",
+			replicas:     3,
+			available:    2,
+			pod:          testPod("web-1", time.Hour, withRestarts(11), withOwner("ReplicaSet", "web-5d4f8")),
+			wantSkip:     true,
+		},
+		{
+			name:         "percentage above the minimum",
+			minAvailable: "50%",
+			replicas:     3,
+			available:    3,
+			pod:          testPod("web-1", time.Hour, withRestarts(11), withOwner("ReplicaSet", "web-5d4f8")),
+		},
+		{
+			name:         "zero disables the guard",
+			minAvailable: "0",
+			replicas:     1,
+			available:    1,
+			pod:          testPod("web-1", time.Hour, withRestarts(11), withOwner("ReplicaSet", "web-5d4f8")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minAvailable, err := parseMinAvailable(tt.minAvailable)
+			if err != nil {
+				t.Fatalf("parse %q: %v", tt.minAvailable, err)
+			}
+			healer, _, clock := newTestHealer(t, Config{MinAvailable: minAvailable},
+				append(testDeploymentAvailable("web", tt.replicas, tt.available), tt.pod)...)
+
+			decision := healer.evaluatePod(context.Background(), tt.pod, clock.Now())
+			if decision == nil {
+				t.Fatalf("expected a decision for %s", tt.pod.Name)
+			}
+			skipped := decision.Action == ActionSkip && strings.Contains(decision.Message, "minimum availability")
+			if skipped != tt.wantSkip {
+				t.Errorf("expected skip %v, got %s: %s", tt.wantSkip, decision.Action, decision.Message)
+			}
+		})
+	}
+}
+
+func TestOwnerReplicas(t *testing.T) {
+	replicas := int32(3)
+	tests := []struct {
+		name          string
+		owner         metav1.Object
+		wantDesired   int32
+		wantAvailable int32
+	}{
+		{
+			name: "StatefulSet",
+			owner: &appsv1.StatefulSet{
+				Spec:   appsv1.StatefulSetSpec{Replicas: &replicas},
+				Status: appsv1.StatefulSetStatus{AvailableReplicas: 2},
+			},
+			wantDesired:   3,
+			wantAvailable: 2,
+		},
+		{
+			name:          "StatefulSet without replicas",
+			owner:         &appsv1.StatefulSet{Status: appsv1.StatefulSetStatus{AvailableReplicas: 1}},
+			wantDesired:   1,
+			wantAvailable: 1,
+		},
+		{
+			name:          "DaemonSet",
+			owner:         &appsv1.DaemonSet{Status: appsv1.DaemonSetStatus{DesiredNumberScheduled: 4, NumberAvailable: 1}},
+			wantDesired:   4,
+			wantAvailable: 1,
+		},
+	}
+
+	ready := testPod("web-1", time.Hour)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner := &workloadOwner{Kind: tt.name, Namespace: "default", Name: "web", Object: tt.owner}
+			desired, available, ok := ownerReplicas(owner)
+			if !ok || desired != tt.wantDesired || available != tt.wantAvailable {
+				t.Fatalf("expected %d/%d, got %d/%d (ok %v)", tt.wantAvailable, tt.wantDesired, available, desired, ok)
+			}
+			violates, _, _ := violatesMinAvailable(ready, owner, intstr.FromInt(int(available)))
+			if !violates {
+				t.Errorf("expected deleting a ready pod at %d/%d to violate minimum %d", available, desired, available)
+			}
+		})
+	}
+
+	if _, _, ok := ownerReplicas(&workloadOwner{Kind: "Job", Object: &metav1.ObjectMeta{}}); ok {
+		t.Error("expected availability not to apply to a Job")
+	}
+}
+
+func TestParseMinAvailable(t *testing.T) {
+	for _, value := range []string{"0", "2", "0%", "50%", "100%"} {
+		if _, err := parseMinAvailable(value); err != nil {
+			t.Errorf("expected %q to be accepted: %v", value, err)
+		}
+	}
+	for _, value := range []string{"abc", "-1", "-5%", "150%"} {
+		if _, err := parseMinAvailable(value); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestCanarySample(t *testing.T) {
+	healer, _, _ := newTestHealer(t, Config{CanaryPercent: 25}, testDeployment("web")...)
+	ctx := context.Background()
+
+	healed := 0
+	for i := 0; i < 400; i++ {
+		pod := testPod(fmt.Sprintf("web-%d", i), time.Hour, withRestarts(11), withOwner("ReplicaSet", "web-5d4f8"))
+		decision := healer.evaluatePod(ctx, pod, testNow)
+		switch decision.Action {
+		case ActionDelete:
+			healed++
+		case ActionObserve:
+			if decision.Message != canaryReason(25) {
+				t.Fatalf("unexpected observe reason %q", decision.Message)
+			}
+		default:
+			t.Fatalf("unexpected action %s for %s", decision.Action, pod.Name)
+		}
+		// Повторная оценка того же Pod'а дает тот же результат
+		if again := healer.evaluatePod(ctx, pod, testNow); again.Action != decision.Action {
+			t.Fatalf("canary sample of %s changed from %s to %s", pod.Name, decision.Action, again.Action)
+		}
+	}
+	if healed < 60 || healed > 140 {
+		t.Fatalf("expected about 100 of 400 pods in a 25%% sample, got %d", healed)
+	}
+}
+
+func TestRelievePressuredNodes(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+			{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(testNow)},
+		}},
+	}
+	qos := func(class corev1.PodQOSClass) podOption {
+		return func(pod *corev1.Pod) { pod.Status.QOSClass = class }
+	}
+	owned := withOwner("ReplicaSet", "web-5d4f8")
+	guaranteed := testPod("guaranteed", time.Hour, owned, qos(corev1.PodQOSGuaranteed))
+	burstable := testPod("burstable", time.Hour, owned, qos(corev1.PodQOSBurstable))
+	bestEffort := testPod("best-effort", time.Hour, owned, qos(corev1.PodQOSBestEffort))
+	unowned := testPod("unowned", time.Hour, qos(corev1.PodQOSBestEffort))
+
+	healer, clientset, _ := newTestHealer(t, Config{NodePressure: NodePressureConfig{Enabled: true, MaxEvictionsPerNode: 1}},
+		append(testDeployment("web"), node, guaranteed, burstable, bestEffort, unowned)...)
+	healer.nodes = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	if err := healer.nodes.Add(node); err != nil {
+		t.Fatal(err)
+	}
+
+	healer.relievePressuredNodes(context.Background())
+
+	var evicted []string
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "create" && action.GetSubresource() == "eviction" {
+			evicted = append(evicted, action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction).Name)
+		}
+	}
+	if len(evicted) != 1 || evicted[0] != bestEffort.Name {
+		t.Fatalf("expected only %s to be evicted, got %v", bestEffort.Name, evicted)
+	}
+}
+
+func TestServiceEndpointsNotReady(t *testing.T) {
+	endpoints := func(name string, ready []string, pods ...*corev1.Pod) *corev1.Endpoints {
+		subset := corev1.EndpointSubset{}
+		for _, ip := range ready {
+			subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{IP: ip})
+		}
+		for _, pod := range pods {
+			subset.NotReadyAddresses = append(subset.NotReadyAddresses, corev1.EndpointAddress{
+				IP:        "10.0.0.1",
+				TargetRef: &corev1.ObjectReference{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name},
+			})
+		}
+		return &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}, Subsets: []corev1.EndpointSubset{subset}}
+	}
+	notReady := func(name string, duration time.Duration) *corev1.Pod {
+		return testPod(name, time.Hour, withNotReady(duration), withOwner("ReplicaSet", "web-5d4f8"))
+	}
+	web1, web2 := notReady("web-1", 10*time.Minute), notReady("web-2", 6*time.Minute)
+	recent := notReady("api-1", time.Minute)
+	partial := notReady("cache-1", time.Hour)
+	objects := append(testDeployment("web"), web1, web2, recent, partial,
+		endpoints("web", nil, web1, web2), endpoints("api", nil, recent), endpoints("cache", []string{"10.0.0.2"}, partial))
+
+	config := Config{ServiceEndpoints: ServiceEndpointsConfig{Timeout: 5 * time.Minute, Interval: time.Minute}}
+	healer, clientset, _ := newTestHealer(t, config, objects...)
+	healer.checkServiceEndpoints(context.Background())
+
+	for _, pod := range []*corev1.Pod{web1, web2} {
+		if podExists(t, clientset, pod) {
+			t.Errorf("pod %s of a service without ready endpoints was not healed", pod.Name)
+		}
+	}
+	if !podExists(t, clientset, recent) {
+		t.Error("pod of a service NotReady for less than the timeout was healed")
+	}
+	if !podExists(t, clientset, partial) {
+		t.Error("pod of a service with ready endpoints was healed")
+	}
+	decisions := healer.state.recentDecisions()
+	if len(decisions) != 2 || decisions[0].Code != CodeServiceEndpoints ||
+		!strings.Contains(decisions[0].Detail, "all 2 endpoints of service default/web are NotReady for 6m0s") {
+		t.Errorf("decisions %+v", decisions)
+	}
+}
+
+func TestEvacuatePreemptedNodes(t *testing.T) {
+	preempted := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+			{Key: "aws-node-termination-handler/spot-itn", Effect: corev1.TaintEffectNoSchedule},
+		}},
+	}
+	healthy := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}
+	onNode := func(name string) podOption {
+		return func(pod *corev1.Pod) { pod.Spec.NodeName = name }
+	}
+	owned := withOwner("ReplicaSet", "web-5d4f8")
+	guaranteed := testPod("guaranteed", time.Hour, owned, onNode("node-1"), func(pod *corev1.Pod) {
+		pod.Status.QOSClass = corev1.PodQOSGuaranteed
+	})
+	burstable := testPod("burstable", time.Hour, owned, onNode("node-1"))
+	unowned := testPod("unowned", time.Hour, onNode("node-1"))
+	elsewhere := testPod("elsewhere", time.Hour, owned, onNode("node-2"))
+
+	healer, clientset, _ := newTestHealer(t, Config{NodePreemption: NodePreemptionConfig{
+		Enabled: true, Taints: defaultPreemptionTaints,
+	}}, append(testDeployment("web"), preempted, healthy, guaranteed, burstable, unowned, elsewhere)...)
+	healer.nodes = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, node := range []*corev1.Node{preempted, healthy} {
+		if err := healer.nodes.Add(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	healer.evacuatePreemptedNodes(context.Background())
+
+	evicted := map[string]bool{}
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "create" && action.GetSubresource() == "eviction" {
+			evicted[action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction).Name] = true
+		}
+	}
+	if len(evicted) != 2 || !evicted[guaranteed.Name] || !evicted[burstable.Name] {
+		t.Fatalf("expected owned pods of the preempted node to be evicted, got %v", evicted)
+	}
+	decisions := healer.state.recentDecisions()
+	if last := decisions[len(decisions)-1]; last.Code != CodeNodePreemption || last.Action != ActionEvict {
+		t.Errorf("unexpected decision record %+v", last)
+	}
+}
+
+func TestForceDeleteLostPods(t *testing.T) {
+	node := func(ready corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}}},
+		}
+	}
+	tests := []struct {
+		name       string
+		config     Config
+		node       *corev1.Node
+		wantResult string
+		wantExists bool
+	}{
+		{name: "disabled", node: node(corev1.ConditionUnknown), wantResult: "skipped", wantExists: true},
+		{name: "node not ready", config: Config{ForceDeleteLostPods: true}, node: node(corev1.ConditionUnknown), wantResult: "healed"},
+		{name: "node deleted", config: Config{ForceDeleteLostPods: true}, wantResult: "healed"},
+		{name: "node ready again", config: Config{ForceDeleteLostPods: true}, node: node(corev1.ConditionTrue),
+			wantResult: "skipped", wantExists: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testPod("db-0", time.Hour, withPhase(corev1.PodUnknown), withNotReady(10*time.Minute),
+				withOwner("StatefulSet", "db"))
+			objects := []runtime.Object{pod}
+			if tt.node != nil {
+				objects = append(objects, tt.node)
+			}
+			healer, clientset, _ := newTestHealer(t, tt.config, objects...)
+
+			if result := healOnce(t, healer, pod); result != tt.wantResult {
+				t.Fatalf("result %q, want %q", result, tt.wantResult)
+			}
+			if exists := podExists(t, clientset, pod); exists != tt.wantExists {
+				t.Errorf("pod exists = %v, want %v", exists, tt.wantExists)
+			}
+		})
+	}
+}
+
+func TestCleanupOrphanedPods(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	onNode := func(name string) podOption {
+		return func(pod *corev1.Pod) { pod.Spec.NodeName = name }
+	}
+	scheduled := testPod("web-1", time.Hour, withOwner("ReplicaSet", "web-5d4f8"), onNode("node-1"))
+	orphaned := testPod("web-2", time.Hour, withOwner("ReplicaSet", "web-5d4f8"), onNode("node-2"))
+	ignored := testPod("web-3", time.Hour, withOwner("ReplicaSet", "web-5d4f8"), onNode("node-2"),
+		withAnnotation("healing.kubernetes.io/ignore", ""))
+	healer, clientset, clock := newTestHealer(t, Config{OrphanedPodGracePeriod: 10 * time.Minute},
+		append(testDeployment("web"), node, scheduled, orphaned, ignored)...)
+
+	healer.cleanupOrphanedPods(context.Background())
+	if !podExists(t, clientset, orphaned) {
+		t.Fatal("orphaned pod deleted before the grace period")
+	}
+
+	clock.Step(10 * time.Minute)
+	healer.cleanupOrphanedPods(context.Background())
+	if podExists(t, clientset, orphaned) {
+		t.Error("expected orphaned pod to be deleted after the grace period")
+	}
+	if !podExists(t, clientset, scheduled) || !podExists(t, clientset, ignored) {
+		t.Error("expected pods on existing nodes and ignored pods to be kept")
+	}
+	decisions := healer.state.recentDecisions()
+	if last := decisions[len(decisions)-1]; last.Code != CodeNodeDeleted || last.Action != ActionForceDelete {
+		t.Errorf("unexpected decision record %+v", last)
+	}
+}
+
+func TestRollbackAfterRollout(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         Config
+		rolloutAge     time.Duration
+		wantRolledBack bool
+	}{
+		{name: "crash loop right after rollout", config: Config{Rollback: RollbackConfig{Enabled: true, Window: 15 * time.Minute}},
+			rolloutAge: 10 * time.Minute, wantRolledBack: true},
+		{name: "crash loop long after rollout", config: Config{Rollback: RollbackConfig{Enabled: true, Window: 15 * time.Minute}},
+			rolloutAge: 2 * time.Hour},
+		{name: "disabled", rolloutAge: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := testDeployment("web")
+			deployment := objects[0].(*appsv1.Deployment)
+			deployment.Spec.Template.Spec.Containers = []corev1.Container{{Name: "web", Image: "web:v2"}}
+			current := objects[1].(*appsv1.ReplicaSet)
+			current.Annotations = map[string]string{annotationDeploymentRevision: "2"}
+			current.CreationTimestamp = metav1.NewTime(testNow.Add(-tt.rolloutAge))
+			previous := current.DeepCopy()
+			previous.Name, previous.UID = "web-7b9c6", "web-7b9c6-uid"
+			previous.Annotations = map[string]string{annotationDeploymentRevision: "1"}
+			previous.CreationTimestamp = metav1.NewTime(testNow.Add(-48 * time.Hour))
+			previous.Spec.Template = corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web", appsv1.DefaultDeploymentUniqueLabelKey: "7b9c6"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: "web:v1"}}},
+			}
+
+			pod := testPod("web-1", 9*time.Minute, withWaiting("CrashLoopBackOff"), withNotReady(8*time.Minute),
+				withOwner("ReplicaSet", "web-5d4f8"))
+			healer, clientset, _ := newTestHealer(t, tt.config, append(objects, previous, pod)...)
+
+			if result := healOnce(t, healer, pod); result != "healed" {
+				t.Fatalf("result %q, want healed", result)
+			}
+			got, err := clientset.AppsV1().Deployments("default").Get(context.Background(), "web", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rolledBack := got.Spec.Template.Spec.Containers[0].Image == "web:v1"
+			if rolledBack != tt.wantRolledBack {
+				t.Fatalf("deployment image %s, rolled back = %v, want %v",
+					got.Spec.Template.Spec.Containers[0].Image, rolledBack, tt.wantRolledBack)
+			}
+			if _, exists := got.Spec.Template.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; exists {
+				t.Errorf("rolled back template keeps the pod-template-hash label")
+			}
+			// Pod'ы упавшей ревизии убирает сам Deployment
+			if exists := podExists(t, clientset, pod); exists != tt.wantRolledBack {
+				t.Errorf("pod exists = %v, want %v", exists, tt.wantRolledBack)
+			}
+		})
+	}
+}
+
+func TestStuckRollouts(t *testing.T) {
+	objects := testDeployment("web")
+	deployment := objects[0].(*appsv1.Deployment)
+	deployment.Annotations = map[string]string{annotationDeploymentRevision: "2"}
+	deployment.Status.Conditions = []appsv1.DeploymentCondition{{
+		Type:    appsv1.DeploymentProgressing,
+		Status:  corev1.ConditionFalse,
+		Reason:  "ProgressDeadlineExceeded",
+		Message: `ReplicaSet "web-5d4f8" has timed out progressing.`,
+	}}
+	pod := testPod("web-1", time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Hour),
+		withOwner("ReplicaSet", "web-5d4f8"))
+	healer, clientset, _ := newTestHealer(t, Config{StuckRolloutAction: StuckRolloutPause}, append(objects, pod)...)
+
+	// Pod'ы зависшей ревизии по одному не лечатся
+	if result := healOnce(t, healer, pod); result != "skipped" {
+		t.Fatalf("pod of a stuck rollout result %q, want skipped", result)
+	}
+
+	healer.checkStuckRollouts(context.Background())
+	got, err := clientset.AppsV1().Deployments("default").Get(context.Background(), "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Spec.Paused || got.Annotations[annotationStuckRollout] != "2" {
+		t.Fatalf("deployment paused = %v, annotations %v", got.Spec.Paused, got.Annotations)
+	}
+
+	// Обработанная ревизия не трогается повторно, даже если rollout возобновили
+	got.Spec.Paused = false
+	if _, err := clientset.AppsV1().Deployments("default").Update(context.Background(), got, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	clientset.ClearActions()
+	healer.checkStuckRollouts(context.Background())
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("unexpected %s of %s for an already handled revision", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
+
+func TestOneHealPerOwnerUntilReplacementReady(t *testing.T) {
+	crashLooping := []podOption{withWaiting("CrashLoopBackOff"), withNotReady(time.Minute), withOwner("ReplicaSet", "web-5d4f8")}
+	first := testPod("web-1", time.Hour, crashLooping...)
+	second := testPod("web-2", time.Hour, crashLooping...)
+	third := testPod("web-4", time.Hour, crashLooping...)
+	healer, _, clock := newTestHealer(t, Config{ReplacementTimeout: 5 * time.Minute},
+		append(testDeployment("web"), first, second, third)...)
+
+	if result := healOnce(t, healer, first); result != "healed" {
+		t.Fatalf("first pod result %q, want healed", result)
+	}
+	if result := healOnce(t, healer, second); result != "skipped" {
+		t.Fatalf("sibling result %q while replacement is not ready, want skipped", result)
+	}
+
+	clock.Step(time.Minute)
+	healer.handlePod(testPod("web-3", 0, withOwner("ReplicaSet", "web-5d4f8")))
+	if result := healOnce(t, healer, second); result != "healed" {
+		t.Fatalf("sibling result %q after replacement became ready, want healed", result)
+	}
+
+	// Замена так и не стала Ready - соседи ждут не дольше таймаута
+	if result := healOnce(t, healer, third); result != "skipped" {
+		t.Fatalf("sibling result %q before the timeout, want skipped", result)
+	}
+	clock.Step(5 * time.Minute)
+	if result := healOnce(t, healer, third); result != "healed" {
+		t.Fatalf("sibling result %q after the timeout, want healed", result)
+	}
+}
+
+func TestEphemeralStorageEvictionLoop(t *testing.T) {
+	objects := testDeployment("web")
+	deployment := objects[0].(*appsv1.Deployment)
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "web",
+		Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+			corev1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+		}},
+	}}
+	var pods []*corev1.Pod
+	for _, name := range []string{"web-1", "web-2", "web-3"} {
+		pod := testPod(name, time.Hour, withPhase(corev1.PodFailed), withNotReady(time.Minute),
+			withOwner("ReplicaSet", "web-5d4f8"), func(pod *corev1.Pod) {
+				pod.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5d4f8"}
+				pod.Status.Reason = "Evicted"
+				pod.Status.Message = "The node was low on resource: ephemeral-storage. " +
+					"Container web was using 2Gi, request is 1Gi, has larger consumption of ephemeral-storage. "
+			})
+		pods = append(pods, pod)
+		objects = append(objects, pod)
+	}
+	config := Config{EphemeralStorage: EphemeralStorageConfig{Threshold: 3, Window: time.Hour, MaxRequest: resource.MustParse("10Gi")}}
+	healer, clientset, _ := newTestHealer(t, config, objects...)
+
+	for _, pod := range pods {
+		healer.handlePod(pod)
+	}
+	decisions := healer.state.recentDecisions()
+	if last := decisions[len(decisions)-1]; last.Action != ActionEphemeralStorage || last.Result != "healed" {
+		t.Fatalf("last decision %s/%s, want %s/healed", last.Action, last.Result, ActionEphemeralStorage)
+	}
+
+	got, err := clientset.AppsV1().Deployments("default").Get(context.Background(), "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Annotations[annotationEphemeralEvictions] == "" {
+		t.Error("deployment is not annotated with the evictions")
+	}
+	request := got.Spec.Template.Spec.Containers[0].Resources.Requests[corev1.ResourceEphemeralStorage]
+	if want := resource.MustParse("3Gi"); request.Cmp(want) != 0 {
+		t.Errorf("ephemeral-storage request %s, want %s", request.String(), want.String())
+	}
+	for _, pod := range pods {
+		if podExists(t, clientset, pod) {
+			t.Errorf("evicted pod %s was not cleaned up", pod.Name)
+		}
+	}
+}
+
+func TestOOMMemoryBump(t *testing.T) {
+	objects := testDeployment("web")
+	deployment := objects[0].(*appsv1.Deployment)
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "app",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+		},
+	}}
+	var pods []*corev1.Pod
+	for _, name := range []string{"web-1", "web-2", "web-3"} {
+		pod := testPod(name, time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Hour),
+			withOwner("ReplicaSet", "web-5d4f8"), func(pod *corev1.Pod) {
+				pod.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5d4f8"}
+				pod.Status.ContainerStatuses[0].RestartCount = 5
+				pod.Status.ContainerStatuses[0].LastTerminationState = corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137, ContainerID: "containerd://" + name},
+				}
+			})
+		pods = append(pods, pod)
+		objects = append(objects, pod)
+	}
+	config := Config{OOMBump: OOMBumpConfig{Percent: 50, MaxMemory: resource.MustParse("700Mi"), Threshold: 3, Window: time.Hour}}
+	healer, clientset, _ := newTestHealer(t, config, objects...)
+
+	for _, pod := range pods {
+		healer.handlePod(pod)
+	}
+	decisions := healer.state.recentDecisions()
+	if last := decisions[len(decisions)-1]; last.Action != ActionOOMBump || last.Code != CodeOOM || last.Result != "healed" {
+		t.Fatalf("last decision %s/%s/%s, want %s/%s/healed", last.Action, last.Code, last.Result, ActionOOMBump, CodeOOM)
+	}
+
+	got, err := clientset.AppsV1().Deployments("default").Get(context.Background(), "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Annotations[annotationOOMBump] == "" {
+		t.Error("deployment is not annotated with the memory change")
+	}
+	// Limit упирается в --oom-bump-max-memory, request растет на 50%
+	resources := got.Spec.Template.Spec.Containers[0].Resources
+	if limit, want := resources.Limits[corev1.ResourceMemory], resource.MustParse("700Mi"); limit.Cmp(want) != 0 {
+		t.Errorf("memory limit %s, want %s", limit.String(), want.String())
+	}
+	if request, want := resources.Requests[corev1.ResourceMemory], resource.MustParse("384Mi"); request.Cmp(want) != 0 {
+		t.Errorf("memory request %s, want %s", request.String(), want.String())
+	}
+
+	// Память уже на пределе - увеличивать нечего
+	deployment.Spec.Template.Spec.Containers[0].Resources = got.Spec.Template.Spec.Containers[0].Resources
+	deployment.Spec.Template.Spec.Containers[0].Resources.Requests = corev1.ResourceList{
+		corev1.ResourceMemory: resource.MustParse("700Mi"),
+	}
+	owner := &workloadOwner{Kind: "Deployment", Namespace: "default", Name: "web", Object: deployment}
+	if due, message := healer.oomBumpDue(pods[2], owner, CodeOOM, testNow); due {
+		t.Errorf("memory bump is due at the cap: %s", message)
+	}
+}
+
+func TestBlackboxProbe(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNumber, _ := strconv.Atoi(port)
+
+	httpProbe := &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+		Path: "/ready", Port: intstr.FromString("http"),
+	}}}
+	execProbe := &corev1.Probe{ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"true"}}}}
+	tests := []struct {
+		name       string
+		probe      *corev1.Probe
+		status     int
+		wantAction HealingAction
+	}{
+		{name: "endpoint answers", probe: httpProbe, status: http.StatusOK, wantAction: ActionSkip},
+		{name: "endpoint fails", probe: httpProbe, status: http.StatusServiceUnavailable, wantAction: ActionDelete},
+		{name: "exec probe can not be checked", probe: execProbe, status: http.StatusOK, wantAction: ActionDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status = tt.status
+			config := Config{BlackboxProbe: BlackboxProbeConfig{Enabled: true, Timeout: time.Second}}
+			healer, _, _ := newTestHealer(t, config, testDeployment("web")...)
+			pod := testPod("web-1", time.Hour, withNotReady(11*time.Minute), withOwner("ReplicaSet", "web-5d4f8"),
+				func(pod *corev1.Pod) {
+					pod.Status.PodIP = host
+					pod.Status.ContainerStatuses[0].Ready = false
+					pod.Spec.Containers = []corev1.Container{{
+						Name:           "app",
+						Ports:          []corev1.ContainerPort{{Name: "http", ContainerPort: int32(portNumber)}},
+						ReadinessProbe: tt.probe,
+					}}
+				})
+
+			decision := healer.evaluatePod(context.Background(), pod, testNow)
+			if decision == nil || decision.Action != tt.wantAction {
+				t.Fatalf("decision %+v, want action %s", decision, tt.wantAction)
+			}
+			if tt.wantAction == ActionSkip && !strings.Contains(decision.Detail, "container app answers on "+server.URL+"/ready") {
+				t.Errorf("detail %q does not describe the probe", decision.Detail)
+			}
+		})
+	}
+}
+
+func TestSidecarOnlyFailures(t *testing.T) {
+	withSidecar := func(reason string) podOption {
+		return func(pod *corev1.Pod) {
+			pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+				Name:  "proxy",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}},
+			})
+		}
+	}
+	sidecarPod := func(options ...podOption) *corev1.Pod {
+		return testPod("web-1", time.Hour, append([]podOption{withSidecar("CrashLoopBackOff"), withNotReady(time.Hour),
+			withOwner("ReplicaSet", "web-5d4f8"), withAnnotation(annotationSidecars, "proxy")}, options...)...)
+	}
+	config := Config{Sidecars: SidecarConfig{Policy: SidecarRolloutRestart, RestartInterval: time.Hour}}
+
+	pod := sidecarPod()
+	healer, clientset, clock := newTestHealer(t, config, append(testDeployment("web"), pod)...)
+	decision := healer.evaluatePod(context.Background(), pod, clock.Now())
+	if decision == nil || decision.Action != ActionSidecarRestart {
+		t.Fatalf("decision %+v, want %s", decision, ActionSidecarRestart)
+	}
+	if result := healOnce(t, healer, pod); result != "healed" {
+		t.Fatalf("result %q, want healed", result)
+	}
+	if !podExists(t, clientset, pod) {
+		t.Error("pod with a healthy main container was deleted")
+	}
+	deployment, err := clientset.AppsV1().Deployments("default").Get(context.Background(), "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] == "" ||
+		deployment.Annotations[annotationSidecarRestarted] == "" {
+		t.Fatalf("deployment was not restarted: %v, %v", deployment.Annotations, deployment.Spec.Template.Annotations)
+	}
+
+	// Sidecar'ы новых Pod'ов падают снова: повторного restart'а нет
+	clock.Step(30 * time.Minute)
+	if decision := healer.evaluatePod(context.Background(), pod, clock.Now()); decision == nil || decision.Action != ActionNotify {
+		t.Errorf("decision after restart %+v, want %s", decision, ActionNotify)
+	}
+	clock.Step(time.Hour)
+	if decision := healer.evaluatePod(context.Background(), pod, clock.Now()); decision == nil || decision.Action != ActionSidecarRestart {
+		t.Errorf("decision after restart interval %+v, want %s", decision, ActionSidecarRestart)
+	}
+
+	// Падает и основной контейнер - Pod лечится как обычно
+	broken := sidecarPod(withWaiting("CrashLoopBackOff"))
+	if decision := healer.evaluatePod(context.Background(), broken, clock.Now()); decision == nil || decision.Action != ActionDelete {
+		t.Errorf("decision with a failing main container %+v, want %s", decision, ActionDelete)
+	}
+
+	notify, _, _ := newTestHealer(t, Config{Sidecars: SidecarConfig{Policy: SidecarNotify}}, append(testDeployment("web"), pod)...)
+	if decision := notify.evaluatePod(context.Background(), pod, testNow); decision == nil || decision.Action != ActionNotify {
+		t.Errorf("decision with notify policy %+v, want %s", decision, ActionNotify)
+	}
+}
+
+func TestPushReportMetrics(t *testing.T) {
+	var method, path string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	pod := testPod("web-1", time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Hour))
+	healer, _, _ := newTestHealer(t, Config{}, pod)
+	report, err := healer.Report(context.Background())
+	if err != nil || len(report.StuckPods) != 1 {
+		t.Fatalf("report %+v, err %v", report, err)
+	}
+
+	config := PushgatewayConfig{URL: server.URL, Job: "pod-healer-report", Timeout: time.Second}
+	if err := pushReportMetrics(config, report); err != nil {
+		t.Fatal(err)
+	}
+	// Push заменяет всю группу job, метрики прошлого запуска не остаются
+	if method != http.MethodPut || path != "/metrics/job/pod-healer-report" {
+		t.Errorf("pushed with %s %s, want PUT /metrics/job/pod-healer-report", method, path)
+	}
+	for _, want := range []string{"pod_healer_report_scanned_pods", "pod_healer_report_stuck_pods",
+		"pod_healer_report_last_completion_timestamp_seconds", string(report.StuckPods[0].Code)} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("pushed metrics do not contain %q", want)
+		}
+	}
+
+	server.Close()
+	if err := pushReportMetrics(config, report); err == nil {
+		t.Error("push to an unavailable Pushgateway succeeded")
+	}
+}
+
+func TestMemoryLeakDetection(t *testing.T) {
+	pod := testPod("web-1", time.Hour, withOwner("ReplicaSet", "web-5d4f8"), func(pod *corev1.Pod) {
+		pod.Spec.Containers = []corev1.Container{{Name: "app", Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+		}}}
+	})
+	nightly, err := parseSchedules("* 3-5 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noon, err := parseSchedules("* 12 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		memory   []string
+		windows  []*Schedule
+		wantHeal bool
+		// wantHealInWindow - назначенный рестарт выполняется, когда открывается окно 03:00
+		wantHealInWindow bool
+	}{
+		{name: "growing towards the limit", memory: []string{"100Mi", "120Mi", "140Mi", "160Mi"}, wantHeal: true},
+		{name: "inside maintenance window", memory: []string{"100Mi", "120Mi", "140Mi", "160Mi"}, windows: noon, wantHeal: true},
+		{name: "waits for maintenance window", memory: []string{"100Mi", "120Mi", "140Mi", "160Mi"}, windows: nightly,
+			wantHealInWindow: true},
+		{name: "leak stopped before maintenance window", memory: []string{"100Mi", "120Mi", "140Mi", "160Mi", "90Mi"},
+			windows: nightly},
+		{name: "memory dropped", memory: []string{"100Mi", "120Mi", "90Mi", "160Mi"}},
+		{name: "slow growth", memory: []string{"100Mi", "101Mi", "102Mi", "103Mi"}},
+		{name: "too few samples", memory: []string{"100Mi", "200Mi", "300Mi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{MaintenanceWindows: tt.windows, MemoryLeak: MemoryLeakConfig{Enabled: true,
+				Interval: 5 * time.Minute, Samples: 4, Horizon: 6 * time.Hour}}
+			healer, clientset, clock := newTestHealer(t, config, append(testDeployment("web"), pod.DeepCopy())...)
+			metrics := metricsfake.NewSimpleClientset()
+			healer.podMetrics = metrics
+			podsResource := metricsv1beta1.SchemeGroupVersion.WithResource("pods")
+
+			for i, memory := range tt.memory {
+				sample := &metricsv1beta1.PodMetrics{
+					ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"},
+					Timestamp:  metav1.NewTime(clock.Now()),
+					Containers: []metricsv1beta1.ContainerMetrics{{Name: "app", Usage: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse(memory),
+					}}},
+				}
+				create := metrics.Tracker().Update
+				if i == 0 {
+					create = metrics.Tracker().Create
+				}
+				if err := create(podsResource, sample, "default"); err != nil {
+					t.Fatal(err)
+				}
+				healer.sampleMemory(context.Background())
+				clock.Step(5 * time.Minute)
+			}
+
+			if healed := !podExists(t, clientset, pod); healed != tt.wantHeal {
+				t.Fatalf("pod healed %v, want %v", healed, tt.wantHeal)
+			}
+			if tt.windows != nil && !tt.wantHeal {
+				healer.restartLeakingPods(context.Background())
+				if !podExists(t, clientset, pod) {
+					t.Fatalf("pod must not be restarted outside the maintenance window")
+				}
+				clock.SetTime(time.Date(2024, 3, 2, 3, 7, 0, 0, time.UTC))
+				healer.restartLeakingPods(context.Background())
+				if healed := !podExists(t, clientset, pod); healed != tt.wantHealInWindow {
+					t.Fatalf("pod healed in maintenance window %v, want %v", healed, tt.wantHealInWindow)
+				}
+			}
+			if !tt.wantHeal && !tt.wantHealInWindow {
+				return
+			}
+			decision := healer.state.recentDecisions()[0]
+			if decision.Code != CodeMemoryLeak || !strings.Contains(decision.Detail,
+				"container app memory grew from 100Mi to 160Mi over 15m0s and reaches its 512Mi limit in about 1h28m") {
+				t.Errorf("decision %+v", decision)
+			}
+		})
+	}
+}
+
+func TestSimulateSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		// Вывод kubectl get pods -o yaml
+		"pods.yaml": `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata: {name: web-1, namespace: default, uid: web-1-uid, creationTimestamp: "2024-03-01T11:00:00Z"}
+  spec: {nodeName: node-1, containers: [{name: app, image: web}]}
+  status:
+    phase: Pending
+    conditions: [{type: PodScheduled, status: "False", lastTransitionTime: "2024-03-01T11:00:00Z"}]
+- apiVersion: v1
+  kind: Pod
+  metadata: {name: api-1, namespace: default, uid: api-1-uid, creationTimestamp: "2024-03-01T11:00:00Z"}
+  spec: {containers: [{name: app, image: api}]}
+  status:
+    phase: Pending
+    conditions: [{type: PodScheduled, status: "False", lastTransitionTime: "2024-03-01T11:00:00Z"}]
+- apiVersion: v1
+  kind: Pod
+  metadata: {name: db-1, namespace: default, uid: db-1-uid, creationTimestamp: "2024-03-01T10:00:00Z"}
+  spec: {nodeName: node-1, containers: [{name: app, image: db}]}
+  status:
+    phase: Running
+    conditions: [{type: Ready, status: "True", lastTransitionTime: "2024-03-01T10:05:00Z"}]
+`,
+		"events/web-1.yml": `apiVersion: v1
+kind: Event
+metadata: {name: web-1.1, namespace: default}
+involvedObject: {kind: Pod, name: web-1, namespace: default, uid: web-1-uid}
+reason: FailedScheduling
+message: "0/3 nodes are available: 3 Insufficient cpu."
+lastTimestamp: "2024-03-01T12:30:00Z"
+---
+apiVersion: example.com/v1
+kind: Unknown
+metadata: {name: ignored}
+`,
+		"README.md": "not a manifest",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := Config{Thresholds: defaultThresholds, UnownedPods: UnownedDelete}
+	report, err := simulateSnapshot(context.Background(), config, dir, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC); !report.GeneratedAt.Equal(want) || report.ScannedPods != 3 {
+		t.Fatalf("report at %v of %d pods, want %v of 3 pods", report.GeneratedAt, report.ScannedPods, want)
+	}
+	actions := map[string]HealingAction{}
+	for _, pod := range report.StuckPods {
+		actions[pod.Pod] = pod.Action
+	}
+	// События другого Pod'а не должны влиять на решение: fake clientset сам их не фильтрует
+	if want := map[string]HealingAction{"web-1": ActionSkip, "api-1": ActionDelete}; fmt.Sprint(actions) != fmt.Sprint(want) {
+		t.Errorf("snapshot actions %v, want %v", actions, want)
+	}
+
+	// Раньше порога Pending Pod'ы еще не зависли
+	report, err = simulateSnapshot(context.Background(), config, filepath.Join(dir, "pods.yaml"),
+		time.Date(2024, 3, 1, 11, 1, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.StuckPods) != 0 {
+		t.Errorf("stuck pods %+v before the pending timeout", report.StuckPods)
+	}
+}
+
+func TestResourceSaturationSignal(t *testing.T) {
+	usage := func(memory string) *metricsv1beta1.PodMetrics {
+		return &metricsv1beta1.PodMetrics{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"},
+			Containers: []metricsv1beta1.ContainerMetrics{{Name: "app", Usage: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse(memory),
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+			}}},
+		}
+	}
+	tests := []struct {
+		name       string
+		memory     string
+		wantAction HealingAction
+	}{
+		{name: "memory limit saturated", memory: "490Mi", wantAction: ActionNotify},
+		{name: "memory below limit", memory: "200Mi", wantAction: ActionDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{ResourceSignals: ResourceSignalsConfig{Enabled: true, Saturation: 0.9}}
+			healer, _, _ := newTestHealer(t, config, testDeployment("web")...)
+			// metrics-server отдает PodMetrics как ресурс pods, fake tracker сам его так не назовет
+			metrics := metricsfake.NewSimpleClientset()
+			podsResource := metricsv1beta1.SchemeGroupVersion.WithResource("pods")
+			if err := metrics.Tracker().Create(podsResource, usage(tt.memory), "default"); err != nil {
+				t.Fatal(err)
+			}
+			healer.podMetrics = metrics
+			pod := testPod("web-1", time.Hour, withNotReady(11*time.Minute), withOwner("ReplicaSet", "web-5d4f8"),
+				func(pod *corev1.Pod) {
+					pod.Spec.Containers = []corev1.Container{{Name: "app", Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceMemory: resource.MustParse("512Mi"),
+							corev1.ResourceCPU:    resource.MustParse("1"),
+						},
+					}}}
+				})
+
+			decision := healer.evaluatePod(context.Background(), pod, testNow)
+			if decision == nil || decision.Action != tt.wantAction {
+				t.Fatalf("decision %+v, want action %s", decision, tt.wantAction)
+			}
+			if tt.wantAction == ActionNotify && !strings.Contains(decision.Detail, "container app uses 490Mi of 512Mi memory limit") {
+				t.Errorf("detail %q does not describe the saturated limit", decision.Detail)
+			}
+		})
+	}
+}
+
+func TestExitCodePolicies(t *testing.T) {
+	policies, err := parseExitCodePolicies("137=notify-only, SIGTERM@rollout=skip, 143=delete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []ExitCodePolicy{{ExitCode: 137, Action: ActionNotify}, {ExitCode: 143, DuringRollout: true, Action: ActionSkip},
+		{ExitCode: 143, Action: ActionDelete}}; fmt.Sprint(policies) != fmt.Sprint(want) {
+		t.Fatalf("parsed policies %v, want %v", policies, want)
+	}
+	for _, invalid := range []string{"137", "SIGFOO=delete", "1@deploy=skip", "1=reboot"} {
+		if _, err := parseExitCodePolicies(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+
+	exited := func(code int32) podOption {
+		return func(pod *corev1.Pod) {
+			pod.Status.ContainerStatuses[0].LastTerminationState = corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: code, FinishedAt: metav1.NewTime(testNow.Add(-time.Minute))},
+			}
+		}
+	}
+	crashLooping := func(code int32) *corev1.Pod {
+		return testPod("web-1", time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Minute),
+			withOwner("ReplicaSet", "web-5d4f8"), exited(code))
+	}
+	tests := []struct {
+		name       string
+		pod        *corev1.Pod
+		rollingOut bool
+		wantAction HealingAction
+	}{
+		{name: "OOM kill is notified", pod: crashLooping(137), wantAction: ActionNotify},
+		{name: "application error uses the default action", pod: crashLooping(1), wantAction: ActionDelete},
+		{name: "SIGTERM during rollout is skipped", pod: crashLooping(143), rollingOut: true, wantAction: ActionSkip},
+		{name: "SIGTERM after rollout", pod: crashLooping(143), wantAction: ActionDelete},
+		{
+			name:       "action annotation wins over exit code policy",
+			pod:        testPod("web-1", time.Hour, withAnnotation("healing.kubernetes.io/action", "evict"), withWaiting("CrashLoopBackOff"), withOwner("ReplicaSet", "web-5d4f8"), exited(137)),
+			wantAction: ActionEvict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := testDeployment("web")
+			if tt.rollingOut {
+				objects[0].(*appsv1.Deployment).Status.UpdatedReplicas = 1
+			}
+			healer, _, _ := newTestHealer(t, Config{ExitCodePolicies: policies}, objects...)
+			decision := healer.evaluatePod(context.Background(), tt.pod, testNow)
+			if decision == nil || decision.Action != tt.wantAction {
+				t.Fatalf("expected action %s, got %+v", tt.wantAction, decision)
+			}
+		})
+	}
+}
+
+func TestReasonActions(t *testing.T) {
+	actions, err := parseReasonActions("crashloop=rollout-restart, OOM=notify-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "CRASHLOOP=rollout-restart,OOM=notify-only"; actions.String() != want {
+		t.Fatalf("parsed actions %s, want %s", actions, want)
+	}
+	for _, value := range []string{"CRASHLOOP", "BROKEN=delete", "OOM=restart"} {
+		if _, err := parseReasonActions(value); err == nil {
+			t.Errorf("parseReasonActions(%q) succeeded", value)
+		}
+	}
+
+	oomKilled := func(pod *corev1.Pod) {
+		pod.Status.ContainerStatuses[0].LastTerminationState = corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137},
+		}
+	}
+	crashLooping := func(namespace string, options ...podOption) *corev1.Pod {
+		pod := testPod("web-1", time.Hour, append([]podOption{withWaiting("CrashLoopBackOff"), withNotReady(time.Minute),
+			withOwner("ReplicaSet", "web-5d4f8")}, options...)...)
+		pod.Namespace = namespace
+		return pod
+	}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments",
+		Annotations: map[string]string{annotationReasonActions: "CRASHLOOP=notify-only"}}}
+	objects := append(testDeployment("web"), namespace)
+	for _, obj := range testDeployment("web") {
+		obj.(metav1.Object).SetNamespace("payments")
+		objects = append(objects, obj)
+	}
+
+	tests := []struct {
+		name       string
+		pod        *corev1.Pod
+		wantAction HealingAction
+	}{
+		{name: "crash loop", pod: crashLooping("default"), wantAction: ActionRolloutRestart},
+		{name: "crash loop after OOM kill", pod: crashLooping("default", oomKilled), wantAction: ActionNotify},
+		{name: "not ready uses the default action", pod: testPod("web-1", time.Hour, withNotReady(time.Hour),
+			withOwner("ReplicaSet", "web-5d4f8")), wantAction: ActionDelete},
+		{name: "namespace annotation overrides", pod: crashLooping("payments"), wantAction: ActionNotify},
+		{name: "action annotation wins", pod: crashLooping("default", withAnnotation("healing.kubernetes.io/action", "evict")),
+			wantAction: ActionEvict},
+	}
+	healer, _, _ := newTestHealer(t, Config{ReasonActions: actions}, objects...)
+	if err := healer.loadNamespaces(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := healer.evaluatePod(context.Background(), tt.pod, testNow)
+			if decision == nil || decision.Action != tt.wantAction {
+				t.Fatalf("expected action %s, got %+v", tt.wantAction, decision)
+			}
+		})
+	}
+}
+
+func TestHealingWindow(t *testing.T) {
+	tests := []struct {
+		name        string
+		podWindow   string
+		ownerWindow string
+		// at - время проверки, по умолчанию testNow: пятница, 12:00 UTC
+		at         time.Time
+		wantAction HealingAction
+	}{
+		{name: "pod outside its window", podWindow: "* 22-6 * * *", wantAction: ActionObserve},
+		{name: "pod inside its window", podWindow: "* 22-6 * * *; * 9-17 * * 1-5", wantAction: ActionDelete},
+		{name: "pod inside its overnight window", podWindow: "* 22-6 * * *", at: testNow.Add(11*time.Hour + 30*time.Minute),
+			wantAction: ActionDelete},
+		{name: "window covers only its minutes", podWindow: "0 22-6 * * *", at: testNow.Add(11*time.Hour + 30*time.Minute),
+			wantAction: ActionObserve},
+		{name: "owner outside its window", ownerWindow: "* 22-6 * * *", wantAction: ActionObserve},
+		{name: "pod window overrides owner window", podWindow: "* 9-17 * * *", ownerWindow: "* 22-6 * * *", wantAction: ActionDelete},
+		{name: "invalid window does not restrict healing", podWindow: "nightly", wantAction: ActionDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := testDeployment("web")
+			if tt.ownerWindow != "" {
+				objects[0].(*appsv1.Deployment).Annotations = map[string]string{annotationHealingWindow: tt.ownerWindow}
+			}
+			healer, _, _ := newTestHealer(t, Config{}, objects...)
+			pod := testPod("web-1", time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Hour),
+				withOwner("ReplicaSet", "web-5d4f8"))
+			if tt.podWindow != "" {
+				pod.Annotations = map[string]string{annotationHealingWindow: tt.podWindow}
+			}
+
+			now := tt.at
+			if now.IsZero() {
+				now = testNow
+			}
+			decision := healer.evaluatePod(context.Background(), pod, now)
+			if decision == nil || decision.Action != tt.wantAction {
+				t.Fatalf("decision %+v, want action %s", decision, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestNamespaceOptIn(t *testing.T) {
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	healer, _, _ := newTestHealer(t, Config{NamespaceOptIn: true},
+		namespace("payments", map[string]string{labelEnabled: "true"}),
+		namespace("search", map[string]string{labelEnabled: "false"}),
+		namespace("batch", nil))
+	if err := healer.loadNamespaces(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{"payments": true, "search": false, "batch": false, "missing": false} {
+		if got := healer.namespaceWatched(name); got != want {
+			t.Errorf("namespace %s watched = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestNodeSelector(t *testing.T) {
+	node := func(name, lifecycle string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name,
+			Labels: map[string]string{"node.kubernetes.io/lifecycle": lifecycle}}}
+	}
+	onNode := func(name string) podOption {
+		return func(pod *corev1.Pod) { pod.Spec.NodeName = name }
+	}
+	selector, err := labels.Parse("node.kubernetes.io/lifecycle=spot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	healer, _, _ := newTestHealer(t, Config{NodeSelector: selector}, node("spot-1", "spot"), node("ondemand-1", "normal"))
+
+	pending := testPod("pending", time.Hour)
+	pending.Spec.NodeSelector = map[string]string{"node.kubernetes.io/lifecycle": "spot"}
+	for pod, want := range map[*corev1.Pod]bool{
+		testPod("on-spot", time.Hour, onNode("spot-1")):       true,
+		testPod("on-demand", time.Hour, onNode("ondemand-1")): false,
+		// Pod удаленной ноды и незапланированный Pod - по своему spec.nodeSelector
+		testPod("lost", time.Hour, onNode("spot-2")): false,
+		pending: true,
+	} {
+		if _, got := healer.podMode(pod); got != want {
+			t.Errorf("pod %s eligible = %v, want %v", pod.Name, got, want)
+		}
+	}
+}
+
+func TestNamespaceSharding(t *testing.T) {
+	const shards = 3
+	namespaces := []string{"default", "payments", "checkout", "search", "batch", "monitoring", "team-a", "team-b"}
+	owners := map[string]int{}
+	for index := 0; index < shards; index++ {
+		healer, _, _ := newTestHealer(t, Config{Shard: ShardConfig{Index: index, Total: shards}})
+		for _, namespace := range namespaces {
+			if healer.namespaceWatched(namespace) {
+				owners[namespace]++
+			}
+		}
+	}
+	for _, namespace := range namespaces {
+		if owners[namespace] != 1 {
+			t.Errorf("namespace %s is watched by %d shards, want exactly 1", namespace, owners[namespace])
+		}
+	}
+
+	healer, _, _ := newTestHealer(t, Config{Namespaces: namespaces, Shard: ShardConfig{Index: 1, Total: shards}})
+	for _, namespace := range healer.watchNamespaces() {
+		if !(ShardConfig{Index: 1, Total: shards}).owns(namespace) {
+			t.Errorf("informers started for namespace %s of another shard", namespace)
+		}
+	}
+}
+
+func TestHealingCondition(t *testing.T) {
+	ctx := context.Background()
+	config := Config{HealingCondition: HealingConditionConfig{Enabled: true, Delay: 5 * time.Minute}}
+	crashLooping := func(name string) *corev1.Pod {
+		return testPod(name, time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Minute),
+			withOwner("ReplicaSet", "web-5d4f8"))
+	}
+	vetoed, selected := crashLooping("web-1"), crashLooping("web-2")
+	healer, clientset, clock := newTestHealer(t, config, append(testDeployment("web"), vetoed, selected)...)
+	current := func(pod *corev1.Pod) *corev1.Pod {
+		t.Helper()
+		pod, err := clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pod
+	}
+
+	for _, pod := range []*corev1.Pod{vetoed, selected} {
+		if result := healOnce(t, healer, pod); result != "selected" {
+			t.Fatalf("%s: result %s, want selected", pod.Name, result)
+		}
+		condition := podCondition(current(pod), conditionSelectedForHealing)
+		if condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != string(CodeCrashLoop) ||
+			!strings.Contains(condition.Message, "scheduled at 2024-03-01T12:05:00Z") {
+			t.Fatalf("%s: unexpected condition %+v", pod.Name, condition)
+		}
+	}
+
+	// Решение ждет Delay, отсчитанный от выставления condition
+	clock.Step(2 * time.Minute)
+	if result := healOnce(t, healer, current(selected)); result != "selected" {
+		t.Fatalf("result %s before the delay, want selected", result)
+	}
+
+	// Статус False, выставленный другим контроллером, отменяет действие
+	pod := current(vetoed)
+	podCondition(pod, conditionSelectedForHealing).Status = corev1.ConditionFalse
+	if _, err := clientset.CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Step(5 * time.Minute)
+	if result := healOnce(t, healer, current(vetoed)); result != "vetoed" {
+		t.Fatalf("result %s, want vetoed", result)
+	}
+	if result := healOnce(t, healer, current(selected)); result != "healed" {
+		t.Fatalf("result %s after the delay, want healed", result)
+	}
+}
+
+// concurrencyRemediator считает, сколько heal'ов выполняется одновременно
+type concurrencyRemediator struct {
+	action            HealingAction
+	mu                sync.Mutex
+	inFlight, maxSeen int
+}
+
+func (r *concurrencyRemediator) Action() HealingAction { return r.action }
+
+func (r *concurrencyRemediator) Remediate(context.Context, *healingDecision) error {
+	r.mu.Lock()
+	r.inFlight++
+	if r.inFlight > r.maxSeen {
+		r.maxSeen = r.inFlight
+	}
+	r.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	r.mu.Lock()
+	r.inFlight--
+	r.mu.Unlock()
+	return nil
+}
+
+func TestHealWorkers(t *testing.T) {
+	objects := testDeployment("web")
+	var pods []*corev1.Pod
+	for i := 1; i <= 6; i++ {
+		pod := testPod(fmt.Sprintf("web-%d", i), time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Minute),
+			withOwner("ReplicaSet", "web-5d4f8"))
+		pods = append(pods, pod)
+		objects = append(objects, pod)
+	}
+	healer, _, _ := newTestHealer(t, Config{HealWorkers: 3}, objects...)
+
+	// Всплеск решений, накопленных в очереди, выполняется параллельно, но не больше чем HealWorkers сразу
+	var remediator *concurrencyRemediator
+	for _, pod := range pods {
+		decision := healer.evaluatePod(context.Background(), pod, healer.clock.Now())
+		if decision == nil {
+			t.Fatalf("expected %s to be stuck", pod.Name)
+		}
+		if remediator == nil {
+			remediator = &concurrencyRemediator{action: decision.Action}
+			healer.strategies.RegisterRemediator(remediator)
+		}
+		healer.queue[pod.UID] = decision
+	}
+	results := healer.drainHeals()
+	if len(results) != len(pods) {
+		t.Fatalf("drained %d heals, want %d", len(results), len(pods))
+	}
+	for _, healed := range results {
+		if healed.result != "healed" {
+			t.Errorf("%s: result %s, want healed", healed.decision.Pod.Name, healed.result)
+		}
+	}
+	if remediator.maxSeen != 3 {
+		t.Fatalf("%d heals ran concurrently, want 3", remediator.maxSeen)
+	}
+}
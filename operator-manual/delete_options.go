@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	annotationDeleteGracePeriod = "healing.kubernetes.io/delete-grace-period"
+	annotationDeletePropagation = "healing.kubernetes.io/delete-propagation-policy"
+)
+
+// DeleteConfig - параметры удаления Pod'а при heal'е. Аннотации Pod'а переопределяют их:
+// одним нагрузкам нужно долгое штатное завершение, другие лучше убить сразу.
+type DeleteConfig struct {
+	// GracePeriod - время на штатное завершение, отрицательное - terminationGracePeriodSeconds Pod'а
+	GracePeriod time.Duration
+	// Propagation - удаление зависимых объектов, пустое - по умолчанию API-сервера
+	Propagation metav1.DeletionPropagation
+}
+
+func parsePropagationPolicy(value string) (metav1.DeletionPropagation, error) {
+	switch policy := metav1.DeletionPropagation(value); policy {
+	case metav1.DeletePropagationBackground, metav1.DeletePropagationForeground, metav1.DeletePropagationOrphan:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid propagation policy %q, expected Background, Foreground or Orphan", value)
+}
+
+// gracePeriodSeconds округляет grace period вверх до секунды
+func gracePeriodSeconds(d time.Duration) *int64 {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	return &seconds
+}
+
+// deleteOptions возвращает параметры удаления Pod'а с учетом его аннотаций
+func (h *PodHealer) deleteOptions(pod *corev1.Pod) metav1.DeleteOptions {
+	opts := metav1.DeleteOptions{}
+	gracePeriod := h.config.Delete.GracePeriod
+	if value, exists := pod.Annotations[annotationDeleteGracePeriod]; exists {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			gracePeriod = d
+		} else {
+			klog.InfoS("Invalid pod annotation, using default", "namespace", pod.Namespace, "pod", pod.Name,
+				"annotation", annotationDeleteGracePeriod, "value", value, "default", gracePeriod)
+		}
+	}
+	if gracePeriod >= 0 {
+		opts.GracePeriodSeconds = gracePeriodSeconds(gracePeriod)
+	}
+
+	propagation := h.config.Delete.Propagation
+	if value, exists := pod.Annotations[annotationDeletePropagation]; exists {
+		if policy, err := parsePropagationPolicy(value); err == nil {
+			propagation = policy
+		} else {
+			klog.InfoS("Invalid pod annotation, using default", "namespace", pod.Namespace, "pod", pod.Name,
+				"annotation", annotationDeletePropagation, "value", value, "default", propagation)
+		}
+	}
+	if propagation != "" {
+		opts.PropagationPolicy = &propagation
+	}
+	return opts
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// recordDetection учитывает зависший Pod в метриках обнаружения.
+// Informer присылает один и тот же Pod многократно (обновления, resync),
+// поэтому каждый Pod учитывается один раз на каждую новую причину.
+// Возвращает true, если обнаружение новое.
+func (h *PodHealer) recordDetection(pod *corev1.Pod, stuck *stuckCondition, now time.Time) bool {
+	h.detectedMu.Lock()
+	defer h.detectedMu.Unlock()
+
+	if h.detected[pod.UID] == stuck.Reason {
+		return false
+	}
+	h.detected[pod.UID] = stuck.Reason
+
+	reason := string(stuck.Reason)
+	stuckPodsDetected.WithLabelValues(h.cluster, reason, string(reasonCode(pod, stuck.Reason))).Inc()
+	if !stuck.Since.IsZero() {
+		timeToDetect.WithLabelValues(h.cluster, reason).Observe(now.Sub(stuck.Since).Seconds())
+	}
+	return true
+}
+
+// forgetPod удаляет сведения об удаленном Pod'е
+func (h *PodHealer) forgetPod(pod *corev1.Pod) {
+	h.detectedMu.Lock()
+	defer h.detectedMu.Unlock()
+	delete(h.detected, pod.UID)
+	h.liveness.forget(pod.UID)
+	h.flaps.observeDeletion(pod, h.clock.Now())
+	h.state.forget(pod.UID)
+	h.approvals.forget(pod.UID)
+	h.mountWaiters.forget(pod.UID)
+	h.evictions.forget(pod.UID)
+	h.ooms.forget(pod.UID)
+	h.memory.forget(pod.Namespace + "/" + pod.Name)
+	h.orphans.forget(pod.UID)
+	h.dequeueHeal(pod)
+}
+
+// healDetectedPod проводит Pod, найденный периодической проверкой, а не informer'ом,
+// через те же политики, rate limit и журнал решений, что и остальные зависшие Pod'ы
+func (h *PodHealer) healDetectedPod(ctx context.Context, pod *corev1.Pod, stuck *stuckCondition, now time.Time) {
+	if pod.DeletionTimestamp != nil {
+		return
+	}
+	mode, eligible := h.podMode(pod)
+	if !eligible {
+		return
+	}
+	thresholds := thresholdsForPod(pod, thresholdsForMode(mode, h.thresholdsAt(now)))
+	decision := h.decide(ctx, pod, stuck, mode, thresholds, now)
+	klog.InfoS("Pod detected by a periodic check", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name,
+		"reason", stuck.Reason, "detail", stuck.Detail, "action", decision.Action)
+	h.executeDecision(ctx, decision)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// containerCreatingDetector - Pod запланирован, но контейнеры не создаются
+// (например, не монтируются тома)
+type containerCreatingDetector struct{}
+
+func (containerCreatingDetector) Reason() StuckReason { return ReasonContainerCreating }
+
+func (containerCreatingDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	if pod.Status.Phase != corev1.PodPending {
+		return nil
+	}
+	since, detail := containerCreatingSince(pod)
+	if since.IsZero() || now.Sub(since) <= thresholds.ContainerCreatingTimeout {
+		return nil
+	}
+	return &stuckCondition{
+		Reason: ReasonContainerCreating,
+		Detail: fmt.Sprintf("%s for %v", detail, now.Sub(since).Round(time.Second)),
+		Since:  since,
+	}
+}
+
+// imagePullDetector - Pending Pod дольше порога не может скачать образ
+type imagePullDetector struct{}
+
+func (imagePullDetector) Reason() StuckReason { return ReasonImagePull }
+
+func (imagePullDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	if pod.Status.Phase != corev1.PodPending || now.Sub(pod.CreationTimestamp.Time) <= thresholds.PendingTimeout {
+		return nil
+	}
+	for _, status := range podContainerStatuses(pod) {
+		if waiting := status.State.Waiting; waiting != nil &&
+			(waiting.Reason == "ImagePullBackOff" || waiting.Reason == "ErrImagePull") {
+			return &stuckCondition{
+				Reason: ReasonImagePull,
+				Detail: fmt.Sprintf("%s in %s: %s", status.describe(), waiting.Reason, waiting.Message),
+				Since:  pod.CreationTimestamp.Time,
+			}
+		}
+	}
+	return nil
+}
+
+// initContainerDetector - init-контейнер падает (Init:CrashLoopBackOff) или
+// перезапускался больше порога. Pod при этом остается в Pending без статусов
+// основных контейнеров, поэтому остальные детекторы его не замечают.
+type initContainerDetector struct{}
+
+func (initContainerDetector) Reason() StuckReason { return ReasonCrashLoop }
+
+func (initContainerDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	if pod.Status.Phase != corev1.PodPending {
+		return nil
+	}
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.RestartCount > thresholds.MaxRestarts {
+			return &stuckCondition{
+				Reason: ReasonTooManyRestarts,
+				Detail: fmt.Sprintf("init container %s restarted %d times", status.Name, status.RestartCount),
+				Since:  notReadySince(pod),
+			}
+		}
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason == "CrashLoopBackOff" {
+			return &stuckCondition{
+				Reason: ReasonCrashLoop,
+				Detail: fmt.Sprintf("init container %s in CrashLoopBackOff", status.Name),
+				Since:  notReadySince(pod),
+			}
+		}
+	}
+	return nil
+}
+
+// containerStatus - статус контейнера Pod'а с пометкой, init-контейнер ли это
+type containerStatus struct {
+	corev1.ContainerStatus
+	Init bool
+}
+
+func (s containerStatus) describe() string {
+	if s.Init {
+		return "init container " + s.Name
+	}
+	return "container " + s.Name
+}
+
+// podContainerStatuses возвращает статусы init- и основных контейнеров Pod'а
+func podContainerStatuses(pod *corev1.Pod) []containerStatus {
+	statuses := make([]containerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	for _, status := range pod.Status.InitContainerStatuses {
+		statuses = append(statuses, containerStatus{ContainerStatus: status, Init: true})
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		statuses = append(statuses, containerStatus{ContainerStatus: status})
+	}
+	return statuses
+}
+
+// pendingDetector - Pod в Pending состоянии дольше порога
+type pendingDetector struct{}
+
+func (pendingDetector) Reason() StuckReason { return ReasonPending }
+
+func (pendingDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	if pod.Status.Phase != corev1.PodPending {
+		return nil
+	}
+	pendingDuration := now.Sub(pod.CreationTimestamp.Time)
+	if pendingDuration <= thresholds.PendingTimeout {
+		return nil
+	}
+	return &stuckCondition{
+		Reason: ReasonPending,
+		Detail: fmt.Sprintf("stuck in Pending for %v", pendingDuration.Round(time.Second)),
+		Since:  pod.CreationTimestamp.Time,
+	}
+}
+
+// restartsDetector - контейнер Running Pod'а перезапускался больше порога
+type restartsDetector struct{}
+
+func (restartsDetector) Reason() StuckReason { return ReasonTooManyRestarts }
+
+func (restartsDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	if pod.Status.Phase != corev1.PodRunning {
+		return nil
+	}
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerStatus.RestartCount > thresholds.MaxRestarts {
+			return &stuckCondition{
+				Reason: ReasonTooManyRestarts,
+				Detail: fmt.Sprintf("container %s restarted %d times", containerStatus.Name, containerStatus.RestartCount),
+				Since:  notReadySince(pod),
+			}
+		}
+	}
+	return nil
+}
+
+// crashLoopDetector - контейнер Running Pod'а в CrashLoopBackOff
+type crashLoopDetector struct{}
+
+func (crashLoopDetector) Reason() StuckReason { return ReasonCrashLoop }
+
+func (crashLoopDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	if pod.Status.Phase != corev1.PodRunning {
+		return nil
+	}
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if waiting := containerStatus.State.Waiting; waiting != nil && waiting.Reason == "CrashLoopBackOff" {
+			return &stuckCondition{
+				Reason: ReasonCrashLoop,
+				Detail: fmt.Sprintf("container %s in CrashLoopBackOff", containerStatus.Name),
+				Since:  notReadySince(pod),
+			}
+		}
+	}
+	return nil
+}
+
+// livenessDetector - Pod "мигает" между Running и рестартами, не набирая порог рестартов
+type livenessDetector struct {
+	tracker *livenessTracker
+}
+
+func (livenessDetector) Reason() StuckReason { return ReasonLivenessFailing }
+
+func (d livenessDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	if pod.Status.Phase != corev1.PodRunning {
+		return nil
+	}
+	failures := d.tracker.recentFailures(pod.UID, now, thresholds.LivenessWindow)
+	if failures < thresholds.LivenessFailures {
+		return nil
+	}
+	return &stuckCondition{
+		Reason: ReasonLivenessFailing,
+		Detail: fmt.Sprintf("%d liveness probe failures within %v", failures, thresholds.LivenessWindow),
+		Since:  now.Add(-thresholds.LivenessWindow),
+	}
+}
+
+// notReadyDetector - Pod не Ready дольше порога
+type notReadyDetector struct{}
+
+func (notReadyDetector) Reason() StuckReason { return ReasonNotReady }
+
+func (notReadyDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	if isPodReady(pod) {
+		return nil
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionFalse {
+			notReadyDuration := now.Sub(condition.LastTransitionTime.Time)
+			if notReadyDuration > thresholds.NotReadyTimeout {
+				return &stuckCondition{
+					Reason: ReasonNotReady,
+					Detail: fmt.Sprintf("not ready for %v", notReadyDuration.Round(time.Second)),
+					Since:  condition.LastTransitionTime.Time,
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsPodStuck(t *testing.T) {
+	tests := []struct {
+		name     string
+		pod      *corev1.Pod
+		liveness []int32
+		want     StuckReason
+	}{
+		{
+			name: "healthy running pod",
+			pod:  testPod("healthy", time.Hour),
+		},
+		{
+			name: "pending below timeout",
+			pod:  testPod("pending", 10*time.Minute, withPhase(corev1.PodPending)),
+		},
+		{
+			name: "pending above timeout",
+			pod:  testPod("pending", 20*time.Minute, withPhase(corev1.PodPending)),
+			want: ReasonPending,
+		},
+		{
+			name: "pending timeout from annotation",
+			pod: testPod("pending", 20*time.Minute, withPhase(corev1.PodPending),
+				withAnnotation(annotationPendingTimeout, "1h")),
+		},
+		{
+			name: "unknown phase on lost node",
+			pod:  testPod("lost", time.Hour, withPhase(corev1.PodUnknown), withNotReady(10*time.Minute)),
+			want: ReasonNodeLost,
+		},
+		{
+			name: "unknown phase below node lost timeout",
+			pod:  testPod("lost", time.Hour, withPhase(corev1.PodUnknown), withNotReady(2*time.Minute)),
+		},
+		{
+			name: "evicted from unreachable node without finalizers",
+			pod: testPod("lost", time.Hour, withDeletion(10*time.Minute), func(pod *corev1.Pod) {
+				pod.Status.Conditions = append(pod.Status.Conditions, corev1.PodCondition{
+					Type: corev1.DisruptionTarget, Status: corev1.ConditionTrue, Reason: "DeletionByTaintManager",
+				})
+			}),
+			want: ReasonNodeLost,
+		},
+		{
+			name: "image pull backoff",
+			pod:  testPod("image", 20*time.Minute, withPhase(corev1.PodPending), withWaiting("ImagePullBackOff")),
+			want: ReasonImagePull,
+		},
+		{
+			name: "image pull error below timeout",
+			pod:  testPod("image", 5*time.Minute, withPhase(corev1.PodPending), withWaiting("ErrImagePull")),
+		},
+		{
+			name: "container creating above timeout",
+			pod:  testPod("creating", 12*time.Minute, withPhase(corev1.PodPending), withWaiting("ContainerCreating")),
+			want: ReasonContainerCreating,
+		},
+		{
+			name: "container creating below timeout",
+			pod:  testPod("creating", 5*time.Minute, withPhase(corev1.PodPending), withWaiting("ContainerCreating")),
+		},
+		{
+			name: "crash loop backoff",
+			pod:  testPod("crash", time.Hour, withWaiting("CrashLoopBackOff"), withRestarts(3), withNotReady(time.Minute)),
+			want: ReasonCrashLoop,
+		},
+		{
+			name: "too many restarts",
+			pod:  testPod("restarts", time.Hour, withRestarts(11)),
+			want: ReasonTooManyRestarts,
+		},
+		{
+			name: "restarts below annotated limit",
+			pod:  testPod("restarts", time.Hour, withRestarts(11), withAnnotation(annotationMaxRestarts, "20")),
+		},
+		{
+			name: "init container crash loop",
+			pod:  testPod("init", 5*time.Minute, withPhase(corev1.PodPending), withInitContainer("CrashLoopBackOff", 4)),
+			want: ReasonCrashLoop,
+		},
+		{
+			name: "init container restarts above limit",
+			pod:  testPod("init", 5*time.Minute, withPhase(corev1.PodPending), withInitContainer("PodInitializing", 11)),
+			want: ReasonTooManyRestarts,
+		},
+		{
+			name: "init container image pull backoff",
+			pod:  testPod("init", 20*time.Minute, withPhase(corev1.PodPending), withInitContainer("ImagePullBackOff", 0)),
+			want: ReasonImagePull,
+		},
+		{
+			name: "init container still running",
+			pod:  testPod("init", 5*time.Minute, withPhase(corev1.PodPending), withInitContainer("PodInitializing", 0)),
+		},
+		{
+			name: "not ready above timeout",
+			pod:  testPod("not-ready", time.Hour, withNotReady(11*time.Minute)),
+			want: ReasonNotReady,
+		},
+		{
+			name: "failing readiness gate",
+			pod: testPod("gated", time.Hour, withNotReady(11*time.Minute),
+				withReadinessGate("target-health.elbv2.k8s.aws/web", corev1.ConditionFalse)),
+			want: ReasonReadinessGate,
+		},
+		{
+			name: "readiness gate passed but pod not ready",
+			pod: testPod("gated", time.Hour, withNotReady(11*time.Minute),
+				withReadinessGate("target-health.elbv2.k8s.aws/web", corev1.ConditionTrue)),
+			want: ReasonNotReady,
+		},
+		{
+			name: "not ready below timeout",
+			pod:  testPod("not-ready", time.Hour, withNotReady(5*time.Minute)),
+		},
+		{
+			name:     "liveness failures within window",
+			pod:      testPod("liveness", time.Hour),
+			liveness: []int32{10},
+			want:     ReasonLivenessFailing,
+		},
+		{
+			name:     "liveness failures below limit",
+			pod:      testPod("liveness", time.Hour),
+			liveness: []int32{5},
+		},
+		{
+			name: "terminating with finalizers above timeout",
+			pod:  testPod("terminating", 3*time.Hour, withDeletion(2*time.Hour, "example.com/cleanup")),
+			want: ReasonTerminating,
+		},
+		{
+			name: "terminating with finalizers below timeout",
+			pod:  testPod("terminating", 3*time.Hour, withDeletion(10*time.Minute, "example.com/cleanup")),
+		},
+		{
+			name: "terminating without finalizers",
+			pod:  testPod("terminating", 3*time.Hour, withDeletion(2*time.Hour)),
+		},
+		{
+			name: "deleted pod is not checked for crash loop",
+			pod:  testPod("terminating", time.Hour, withDeletion(time.Minute), withWaiting("CrashLoopBackOff")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healer, _, _ := newTestHealer(t, Config{})
+			for _, count := range tt.liveness {
+				healer.liveness.observe(livenessEvent(tt.pod, count, testNow.Add(-time.Minute)))
+			}
+
+			stuck := healer.isPodStuck(tt.pod, thresholdsForPod(tt.pod, healer.config.Thresholds))
+			switch {
+			case tt.want == "" && stuck != nil:
+				t.Fatalf("expected pod not stuck, got %s (%s)", stuck.Reason, stuck.Detail)
+			case tt.want != "" && stuck == nil:
+				t.Fatalf("expected %s, pod is not stuck", tt.want)
+			case stuck != nil && stuck.Reason != tt.want:
+				t.Fatalf("expected %s, got %s (%s)", tt.want, stuck.Reason, stuck.Detail)
+			}
+		})
+	}
+}
+
+func TestClassifyContainerConfigError(t *testing.T) {
+	tests := []struct {
+		message string
+		want    containerConfigFailure
+	}{
+		{
+			message: "couldn't find key password in Secret default/db-creds",
+			want:    containerConfigFailure{Reason: "MissingSecretKey", Object: "default/db-creds", Key: "password"},
+		},
+		{
+			message: "couldn't find key LOG_LEVEL in ConfigMap default/web-config",
+			want:    containerConfigFailure{Reason: "MissingConfigMapKey", Object: "default/web-config", Key: "LOG_LEVEL"},
+		},
+		{message: `secret "db-creds" not found`, want: containerConfigFailure{Reason: "MissingSecret", Object: "db-creds"}},
+		{message: `configmap "web-config" not found`, want: containerConfigFailure{Reason: "MissingConfigMap", Object: "web-config"}},
+		{message: "container has runAsNonRoot and image will run as root", want: containerConfigFailure{Reason: "RunAsNonRoot"}},
+		{message: "something else", want: containerConfigFailure{Reason: "InvalidConfig"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if got := classifyContainerConfigError(tt.message); got != tt.want {
+				t.Errorf("classifyContainerConfigError = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReasonCode(t *testing.T) {
+	oomKilled := func(pod *corev1.Pod) {
+		pod.Status.ContainerStatuses[0].LastTerminationState = corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137},
+		}
+	}
+	tests := []struct {
+		name   string
+		pod    *corev1.Pod
+		reason StuckReason
+		want   ReasonCode
+	}{
+		{"pending", testPod("web", time.Hour, withPhase(corev1.PodPending)), ReasonPending, CodePendingTimeout},
+		{"crash loop", testPod("web", time.Hour, withWaiting("CrashLoopBackOff")), ReasonCrashLoop, CodeCrashLoop},
+		{"crash loop after OOM", testPod("web", time.Hour, withWaiting("CrashLoopBackOff"), oomKilled), ReasonCrashLoop, CodeOOM},
+		{"restarts after OOM", testPod("web", time.Hour, withRestarts(11), oomKilled), ReasonTooManyRestarts, CodeOOM},
+		{"not ready after OOM", testPod("web", time.Hour, withNotReady(time.Hour), oomKilled), ReasonNotReady, CodeNotReady},
+		{"node lost", testPod("web", time.Hour), ReasonNodeLost, CodeNodeLost},
+		{"unknown", testPod("web", time.Hour), StuckReason("Custom"), CodeUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reasonCode(tt.pod, tt.reason); got != tt.want {
+				t.Errorf("reasonCode = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThresholdSchedules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.yaml")
+	err := os.WriteFile(path, []byte(`schedules:
+- name: night
+  schedule: "* 20-7 * * *"
+  thresholds:
+    pending-timeout: 30m
+    max-restarts: "20"
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedules, err := loadThresholdSchedules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	healer, _, _ := newTestHealer(t, Config{ThresholdSchedules: schedules})
+
+	night := time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC)
+	if got := healer.thresholdsAt(night); got.PendingTimeout != 30*time.Minute || got.MaxRestarts != 20 {
+		t.Errorf("night thresholds pending %v, restarts %d, want 30m and 20", got.PendingTimeout, got.MaxRestarts)
+	}
+	if got := healer.thresholdsAt(testNow); got != defaultThresholds {
+		t.Errorf("daytime thresholds %+v, want defaults", got)
+	}
+
+	for _, invalid := range []string{"pending-timeout: soon", "unknown-timeout: 5m"} {
+		data := "schedules:\n- name: bad\n  schedule: \"* * * * *\"\n  thresholds:\n    " + invalid + "\n"
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadThresholdSchedules(path); err == nil {
+			t.Errorf("schedule with %q loaded without error", invalid)
+		}
+	}
+}
+
+func TestScheduleMatches(t *testing.T) {
+	// 1 марта 2024 - пятница
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		spec string
+		time time.Time
+		want bool
+	}{
+		{"* 2-4 * * 6", at(2, 2, 0), true},
+		{"* 2-4 * * 6", at(2, 4, 59), true},
+		{"* 2-4 * * 6", at(2, 5, 0), false},
+		{"* 2-4 * * 6", at(1, 3, 0), false},
+		// Каждое выражение задает отдельные минуты, а не интервал от первой из них
+		{"0 2-4 * * 6", at(2, 2, 0), true},
+		{"0 2-4 * * 6", at(2, 2, 30), false},
+		// Диапазоны через конец поля
+		{"* 22-2 * * *", at(1, 23, 10), true},
+		{"* 22-2 * * *", at(1, 1, 59), true},
+		{"* 22-2 * * *", at(1, 3, 0), false},
+		{"* * * * 5-1", at(3, 12, 0), true},
+		{"* * * * 5-1", at(4, 12, 0), true},
+		{"* * * * 5-1", at(6, 12, 0), false},
+		{"* * * * 7", at(3, 12, 0), true},
+		// День месяца и день недели объединяются через ИЛИ
+		{"0 12 1 * 1", at(1, 12, 0), true},
+		{"0 12 1 * 1", at(4, 12, 0), true},
+		{"0 12 1 * 1", at(5, 12, 0), false},
+		{"* * 15 * *", at(15, 0, 0), true},
+		{"* * 15 * *", at(16, 0, 0), false},
+		{"*/15 * * * *", at(1, 8, 45), true},
+		{"*/15 * * * *", at(1, 8, 50), false},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.spec, err)
+		}
+		if got := schedule.Matches(tt.time); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.spec, tt.time.Format("Mon 2006-01-02 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestIsPodStuckFollowsClock(t *testing.T) {
+	healer, _, clock := newTestHealer(t, Config{})
+	pod := testPod("pending", 10*time.Minute, withPhase(corev1.PodPending))
+
+	if stuck := healer.isPodStuck(pod, healer.config.Thresholds); stuck != nil {
+		t.Fatalf("expected pod not stuck yet, got %s", stuck.Reason)
+	}
+	clock.Step(6 * time.Minute)
+	stuck := healer.isPodStuck(pod, healer.config.Thresholds)
+	if stuck == nil || stuck.Reason != ReasonPending {
+		t.Fatalf("expected %s after the timeout passed, got %v", ReasonPending, stuck)
+	}
+}
+
+func TestLivenessFailuresExpire(t *testing.T) {
+	healer, _, clock := newTestHealer(t, Config{})
+	pod := testPod("liveness", time.Hour)
+	healer.liveness.observe(livenessEvent(pod, 10, testNow))
+
+	if stuck := healer.isPodStuck(pod, healer.config.Thresholds); stuck == nil || stuck.Reason != ReasonLivenessFailing {
+		t.Fatalf("expected %s, got %v", ReasonLivenessFailing, stuck)
+	}
+	clock.Step(healer.config.Thresholds.LivenessWindow)
+	if stuck := healer.isPodStuck(pod, healer.config.Thresholds); stuck != nil {
+		t.Fatalf("expected failures outside the window to be ignored, got %s", stuck.Reason)
+	}
+}
+
+func TestPromQLDetector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if query := r.URL.Query().Get("query"); query != "error_rate > 0.1" {
+			t.Errorf("unexpected query %q", query)
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"namespace":"default","pod":"web-1"},"value":[1709294400,"0.25"]},
+			{"metric":{"namespace":"default"},"value":[1709294400,"0.5"]}
+		]}}`)
+	}))
+	defer server.Close()
+
+	detector := newPromQLDetector(server.URL, PromQLDetectorConfig{
+		Name:           "errors",
+		Query:          "error_rate > 0.1",
+		For:            metav1.Duration{Duration: 5 * time.Minute},
+		NamespaceLabel: "namespace",
+		PodLabel:       "pod",
+	})
+	healer, _, clock := newTestHealer(t, Config{})
+	healer.strategies.RegisterDetector(detector)
+	flagged, other := testPod("web-1", time.Hour), testPod("web-2", time.Hour)
+
+	if err := detector.poll(context.Background(), clock.Now()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if stuck := healer.isPodStuck(flagged, healer.config.Thresholds); stuck != nil {
+		t.Fatalf("expected pod not stuck before the for duration, got %s", stuck.Reason)
+	}
+
+	clock.Step(5 * time.Minute)
+	if err := detector.poll(context.Background(), clock.Now()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	stuck := healer.isPodStuck(flagged, healer.config.Thresholds)
+	if stuck == nil || stuck.Reason != ReasonPromQL {
+		t.Fatalf("expected %s, got %v", ReasonPromQL, stuck)
+	}
+	if !strings.Contains(stuck.Detail, "detector errors") {
+		t.Fatalf("unexpected detail %q", stuck.Detail)
+	}
+	if stuck := healer.isPodStuck(other, healer.config.Thresholds); stuck != nil {
+		t.Fatalf("expected %s not to match the query, got %s", other.Name, stuck.Reason)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ReasonEphemeralStorage StuckReason   = "EphemeralStorageEviction"
+	ActionEphemeralStorage HealingAction = "ephemeral-storage"
+
+	// На владельце остается описание последней серии выселений
+	annotationEphemeralEvictions = "healing.kubernetes.io/ephemeral-storage-evictions"
+)
+
+// EphemeralStorageConfig - обработка владельцев, чьи Pod'ы раз за разом выселяются
+// за превышение ephemeral-storage. Удаление выселенных Pod'ов такой цикл не прерывает.
+type EphemeralStorageConfig struct {
+	// Threshold - число выселений владельца за Window, после которого healer сообщает о цикле, 0 отключает
+	Threshold int
+	Window    time.Duration
+	// MaxRequest - предел, до которого healer увеличивает requests.ephemeral-storage
+	// контейнеров владельца, нулевое значение отключает изменение requests
+	MaxRequest resource.Quantity
+}
+
+// Сообщение kubelet'а при выселении с ноды, на которой заканчивается ephemeral-storage:
+// "Container app was using 2Gi, request is 0, has larger consumption of ephemeral-storage."
+var ephemeralUsagePattern = regexp.MustCompile(`Container (\S+) was using (\S+), request is (\S+), has larger consumption of ephemeral-storage`)
+
+// isEphemeralStorageEviction - Pod выселен kubelet'ом из-за ephemeral-storage
+func isEphemeralStorageEviction(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodFailed && pod.Status.Reason == "Evicted" &&
+		(strings.Contains(pod.Status.Message, "ephemeral-storage") || strings.Contains(pod.Status.Message, "ephemeral local storage"))
+}
+
+// ephemeralUsage возвращает потребление ephemeral-storage контейнеров из сообщения о выселении
+func ephemeralUsage(message string) map[string]resource.Quantity {
+	usage := make(map[string]resource.Quantity)
+	for _, match := range ephemeralUsagePattern.FindAllStringSubmatch(message, -1) {
+		if used, err := resource.ParseQuantity(match[2]); err == nil {
+			usage[match[1]] = used
+		}
+	}
+	return usage
+}
+
+// ephemeralStorageDetector - Pod выселен за ephemeral-storage. Выселенный Pod остается
+// в Failed до сборки мусора, сам он не восстановится.
+type ephemeralStorageDetector struct{}
+
+func (ephemeralStorageDetector) Reason() StuckReason { return ReasonEphemeralStorage }
+
+func (ephemeralStorageDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	if !isEphemeralStorageEviction(pod) {
+		return nil
+	}
+	return &stuckCondition{
+		Reason: ReasonEphemeralStorage,
+		Detail: "evicted: " + pod.Status.Message,
+		Since:  notReadySince(pod),
+	}
+}
+
+// evictionTracker считает выселения за ephemeral-storage по владельцам
+type evictionTracker struct {
+	mu        sync.Mutex
+	evictions map[string][]time.Time
+	seen      map[types.UID]bool
+}
+
+func newEvictionTracker() *evictionTracker {
+	return &evictionTracker{evictions: make(map[string][]time.Time), seen: make(map[types.UID]bool)}
+}
+
+// observe учитывает выселение Pod'а один раз
+func (t *evictionTracker) observe(pod *corev1.Pod, now time.Time) {
+	key := flapOwnerKey(pod)
+	if key == "" || !isEphemeralStorageEviction(pod) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.seen[pod.UID] {
+		return
+	}
+	t.seen[pod.UID] = true
+	t.evictions[key] = append(t.evictions[key], now)
+}
+
+func (t *evictionTracker) forget(uid types.UID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.seen, uid)
+}
+
+func (t *evictionTracker) count(owner *workloadOwner, now time.Time, window time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := owner.String()
+	t.evictions[key] = recentAttempts(t.evictions[key], now, window)
+	return len(t.evictions[key])
+}
+
+// ephemeralStorageDue проверяет, выселяются ли Pod'ы владельца по кругу
+func (h *PodHealer) ephemeralStorageDue(owner *workloadOwner, stuck *stuckCondition, now time.Time) (bool, int) {
+	config := h.config.EphemeralStorage
+	if config.Threshold <= 0 || stuck.Reason != ReasonEphemeralStorage {
+		return false, 0
+	}
+	evictions := h.evictions.count(owner, now, config.Window)
+	return evictions >= config.Threshold, evictions
+}
+
+// ownerPodTemplate возвращает шаблон Pod'ов владельца, который можно изменить
+func ownerPodTemplate(owner *workloadOwner) *corev1.PodTemplateSpec {
+	switch obj := ownerObject(owner).(type) {
+	case *appsv1.Deployment:
+		return &obj.Spec.Template
+	case *appsv1.StatefulSet:
+		return &obj.Spec.Template
+	case *appsv1.DaemonSet:
+		return &obj.Spec.Template
+	}
+	return nil
+}
+
+// ephemeralRequests вычисляет новые requests.ephemeral-storage контейнеров шаблона:
+// потребление на момент выселения с запасом в половину, но не больше limit'а контейнера и maxRequest
+func ephemeralRequests(template *corev1.PodTemplateSpec, usage map[string]resource.Quantity,
+	maxRequest resource.Quantity) map[string]resource.Quantity {
+	requests := make(map[string]resource.Quantity)
+	for _, container := range template.Spec.Containers {
+		used, ok := usage[container.Name]
+		if !ok {
+			continue
+		}
+		target := *resource.NewQuantity(used.Value()+used.Value()/2, resource.BinarySI)
+		if target.Cmp(maxRequest) > 0 {
+			target = maxRequest.DeepCopy()
+		}
+		if limit, ok := container.Resources.Limits[corev1.ResourceEphemeralStorage]; ok && target.Cmp(limit) > 0 {
+			target = limit.DeepCopy()
+		}
+		if current, ok := container.Resources.Requests[corev1.ResourceEphemeralStorage]; ok && current.Cmp(target) >= 0 {
+			continue
+		}
+		requests[container.Name] = target
+	}
+	return requests
+}
+
+// ephemeralStorageRemediator сообщает владельцу о цикле выселений, при --ephemeral-storage-max-request
+// увеличивает requests.ephemeral-storage его контейнеров и убирает выселенный Pod
+type ephemeralStorageRemediator struct{ h *PodHealer }
+
+func (ephemeralStorageRemediator) Action() HealingAction { return ActionEphemeralStorage }
+
+func (r ephemeralStorageRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	owner, pod := decision.Owner, decision.Pod
+	if owner == nil {
+		return fmt.Errorf("ephemeral storage handling requires an owner")
+	}
+	if err := r.h.patchOwnerAnnotations(ctx, owner, map[string]string{
+		annotationEphemeralEvictions: decision.Message + ": " + pod.Status.Message,
+	}); err != nil {
+		return err
+	}
+
+	requests := map[string]resource.Quantity{}
+	if template := ownerPodTemplate(owner); template != nil && !r.h.config.EphemeralStorage.MaxRequest.IsZero() {
+		requests = ephemeralRequests(template, ephemeralUsage(pod.Status.Message), r.h.config.EphemeralStorage.MaxRequest)
+	}
+	if len(requests) > 0 {
+		if err := r.h.patchEphemeralRequests(ctx, owner, requests); err != nil {
+			return err
+		}
+	}
+
+	var changes []string
+	for name, request := range requests {
+		changes = append(changes, fmt.Sprintf("%s=%s", name, request.String()))
+	}
+	sort.Strings(changes)
+	klog.InfoS("Pods of owner are repeatedly evicted for ephemeral storage", "cluster", r.h.cluster,
+		"owner", owner.String(), "message", pod.Status.Message, "requests", strings.Join(changes, ","))
+	if obj, ok := owner.Object.(runtime.Object); ok {
+		message := fmt.Sprintf("%s, last eviction of pod %s: %s", decision.Message, pod.Name, pod.Status.Message)
+		if len(changes) > 0 {
+			message += fmt.Sprintf("; raised ephemeral-storage requests: %s", strings.Join(changes, ", "))
+		}
+		decisionEventf(r.h.recorder, obj, decision, corev1.EventTypeWarning, "EphemeralStorageEvictions", "%s", message)
+	}
+	return r.h.healPod(ctx, pod)
+}
+
+// patchEphemeralRequests выставляет requests.ephemeral-storage контейнерам шаблона владельца
+func (h *PodHealer) patchEphemeralRequests(ctx context.Context, owner *workloadOwner, requests map[string]resource.Quantity) error {
+	resources := make(map[string]corev1.ResourceRequirements)
+	for name, request := range requests {
+		resources[name] = corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceEphemeralStorage: request},
+		}
+	}
+	return h.patchContainerResources(ctx, owner, resources)
+}
+
+// patchContainerResources выставляет ресурсы контейнерам шаблона владельца.
+// Strategic merge patch сливает контейнеры по имени и ресурсы по ключу, не затрагивая остальные поля.
+func (h *PodHealer) patchContainerResources(ctx context.Context, owner *workloadOwner,
+	resources map[string]corev1.ResourceRequirements) error {
+	var containers []map[string]interface{}
+	for name, requirements := range resources {
+		containers = append(containers, map[string]interface{}{"name": name, "resources": requirements})
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{"containers": containers},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	opts := metav1.PatchOptions{}
+	switch owner.Kind {
+	case "Deployment":
+		_, err = h.clientset.AppsV1().Deployments(owner.Namespace).Patch(ctx, owner.Name, types.StrategicMergePatchType, patch, opts)
+	case "StatefulSet":
+		_, err = h.clientset.AppsV1().StatefulSets(owner.Namespace).Patch(ctx, owner.Name, types.StrategicMergePatchType, patch, opts)
+	case "DaemonSet":
+		_, err = h.clientset.AppsV1().DaemonSets(owner.Namespace).Patch(ctx, owner.Name, types.StrategicMergePatchType, patch, opts)
+	default:
+		err = fmt.Errorf("unsupported owner kind %s", owner.Kind)
+	}
+	return err
+}
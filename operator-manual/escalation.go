@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Владелец с этой аннотацией считается сломанным и больше не лечится.
+	// Чтобы возобновить healing, аннотацию нужно удалить вручную.
+	annotationEscalated        = "healing.kubernetes.io/escalated"
+	annotationEscalationReason = "healing.kubernetes.io/escalation-reason"
+)
+
+// EscalationAction - что сделать с владельцем после эскалации
+type EscalationAction string
+
+const (
+	// EscalateAnnotate только помечает владельца как сломанного
+	EscalateAnnotate EscalationAction = "annotate"
+	// EscalateScaleToZero дополнительно уменьшает число реплик до нуля
+	EscalateScaleToZero EscalationAction = "scale-to-zero"
+)
+
+// EscalationConfig - настройки эскалации после повторяющихся неудачных heal'ов
+type EscalationConfig struct {
+	// Threshold - число heal'ов одного владельца за Window, после которого
+	// healer перестает удалять Pod'ы. 0 отключает эскалацию.
+	Threshold int
+	Window    time.Duration
+	Action    EscalationAction
+}
+
+func isEscalated(owner *workloadOwner) bool {
+	_, exists := owner.Object.GetAnnotations()[annotationEscalated]
+	return exists
+}
+
+// recordHealAttempt запоминает heal владельца для подсчета попыток
+func (h *PodHealer) recordHealAttempt(owner *workloadOwner, now time.Time) {
+	h.attemptsMu.Lock()
+	defer h.attemptsMu.Unlock()
+
+	key := owner.String()
+	h.attempts[key] = append(recentAttempts(h.attempts[key], now, h.config.Escalation.Window), now)
+}
+
+// escalationDue проверяет, исчерпал ли владелец лимит heal'ов за окно
+func (h *PodHealer) escalationDue(owner *workloadOwner, now time.Time) (bool, int) {
+	if h.config.Escalation.Threshold <= 0 {
+		return false, 0
+	}
+
+	h.attemptsMu.Lock()
+	defer h.attemptsMu.Unlock()
+
+	attempts := len(recentAttempts(h.attempts[owner.String()], now, h.config.Escalation.Window))
+	return attempts >= h.config.Escalation.Threshold, attempts
+}
+
+func recentAttempts(attempts []time.Time, now time.Time, window time.Duration) []time.Time {
+	recent := attempts[:0]
+	for _, attempt := range attempts {
+		if now.Sub(attempt) < window {
+			recent = append(recent, attempt)
+		}
+	}
+	return recent
+}
+
+// escalate помечает владельца как сломанного, при необходимости уменьшает его
+// до нуля реплик и сообщает об этом событием Warning на владельце
+func (h *PodHealer) escalate(ctx context.Context, owner *workloadOwner, reason string) error {
+	action := h.config.Escalation.Action
+	if action == EscalateScaleToZero && owner.Kind != "Deployment" && owner.Kind != "StatefulSet" {
+		klog.InfoS("Scale to zero is not supported for owner kind, only annotating", "owner", owner.String())
+		action = EscalateAnnotate
+	}
+
+	if err := h.patchOwnerAnnotations(ctx, owner, map[string]string{
+		annotationEscalated:        h.clock.Now().UTC().Format(time.RFC3339),
+		annotationEscalationReason: reason,
+	}); err != nil {
+		return err
+	}
+
+	if action == EscalateScaleToZero {
+		if err := h.patchOwner(ctx, owner, []byte(`{"spec":{"replicas":0}}`)); err != nil {
+			return err
+		}
+	}
+
+	escalationsTotal.WithLabelValues(h.cluster, string(action)).Inc()
+	klog.ErrorS(nil, "Healing escalated, owner marked as broken", "cluster", h.cluster,
+		"owner", owner.String(), "action", action, "message", reason)
+	if obj, ok := owner.Object.(runtime.Object); ok {
+		h.recorder.Eventf(obj, corev1.EventTypeWarning, "HealingEscalated",
+			"Healing stopped (%s): %s. Remove the %s annotation to resume healing", action, reason, annotationEscalated)
+	}
+	return nil
+}
+
+func escalationReason(attempts int, window time.Duration, stuck *stuckCondition) string {
+	return fmt.Sprintf("%d heals within %v did not help, pods still %s", attempts, window, stuck.Reason)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ExitCodePolicy выбирает действие по коду завершения контейнера: OOMKilled (137)
+// лечится иначе, чем ошибка приложения (1), а SIGTERM (143) во время rollout'а -
+// обычная остановка старых Pod'ов, а не сбой
+type ExitCodePolicy struct {
+	ExitCode int32
+	// DuringRollout - политика действует, только пока владелец выкатывает новую ревизию
+	DuringRollout bool
+	Action        HealingAction
+}
+
+func (p ExitCodePolicy) String() string {
+	if p.DuringRollout {
+		return fmt.Sprintf("%d@rollout=%s", p.ExitCode, p.Action)
+	}
+	return fmt.Sprintf("%d=%s", p.ExitCode, p.Action)
+}
+
+// Сигналы, которые можно указать вместо кода: код завершения по сигналу - 128+номер
+var exitSignals = map[string]int32{
+	"SIGHUP": 1, "SIGINT": 2, "SIGQUIT": 3, "SIGABRT": 6, "SIGKILL": 9, "SIGSEGV": 11, "SIGTERM": 15,
+}
+
+// parseExitCodePolicies разбирает "137=notify-only,SIGTERM@rollout=skip,1=delete"
+func parseExitCodePolicies(value string) ([]ExitCodePolicy, error) {
+	var policies []ExitCodePolicy
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		match, action, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid exit code policy %q, expected CODE[@rollout]=ACTION", entry)
+		}
+		policy := ExitCodePolicy{Action: HealingAction(strings.TrimSpace(action))}
+		code, scope, scoped := strings.Cut(strings.TrimSpace(match), "@")
+		if scoped {
+			if scope != "rollout" {
+				return nil, fmt.Errorf("invalid exit code policy %q: unknown scope %q, expected rollout", entry, scope)
+			}
+			policy.DuringRollout = true
+		}
+		if signal, ok := exitSignals[strings.ToUpper(code)]; ok {
+			policy.ExitCode = 128 + signal
+		} else {
+			n, err := strconv.ParseInt(code, 10, 32)
+			if err != nil || n < 0 || n > 255 {
+				return nil, fmt.Errorf("invalid exit code policy %q: %q is neither an exit code nor a signal", entry, code)
+			}
+			policy.ExitCode = int32(n)
+		}
+		if !isRemediationAction(policy.Action) && policy.Action != ActionSkip && policy.Action != ActionObserve {
+			return nil, fmt.Errorf("invalid exit code policy %q: unknown action %q, expected skip, observe or one of %s",
+				entry, policy.Action, strings.Join(remediationActions(), ", "))
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// lastTermination возвращает последнее по времени завершение контейнеров Pod'а
+func lastTermination(pod *corev1.Pod) (string, *corev1.ContainerStateTerminated) {
+	var name string
+	var last *corev1.ContainerStateTerminated
+	for _, status := range podContainerStatuses(pod) {
+		terminated := status.LastTerminationState.Terminated
+		if terminated == nil {
+			terminated = status.State.Terminated
+		}
+		if terminated != nil && (last == nil || terminated.FinishedAt.After(last.FinishedAt.Time)) {
+			name, last = status.Name, terminated
+		}
+	}
+	return name, last
+}
+
+// ownerRollingOut проверяет, выкатывает ли владелец новую ревизию Pod'ов
+func ownerRollingOut(owner *workloadOwner) bool {
+	switch obj := ownerObject(owner).(type) {
+	case *appsv1.Deployment:
+		replicas := int32(1)
+		if obj.Spec.Replicas != nil {
+			replicas = *obj.Spec.Replicas
+		}
+		return obj.Generation > obj.Status.ObservedGeneration ||
+			obj.Status.UpdatedReplicas < replicas || obj.Status.Replicas > obj.Status.UpdatedReplicas
+	case *appsv1.StatefulSet:
+		return obj.Status.UpdateRevision != "" && obj.Status.CurrentRevision != obj.Status.UpdateRevision
+	case *appsv1.DaemonSet:
+		return obj.Status.UpdatedNumberScheduled < obj.Status.DesiredNumberScheduled
+	}
+	return false
+}
+
+// exitCodeAction выбирает действие по политикам кодов завершения. Политика с @rollout
+// для своего кода проверяется раньше общей, чтобы ее можно было задать поверх общей.
+func (h *PodHealer) exitCodeAction(pod *corev1.Pod, owner *workloadOwner) (HealingAction, string, bool) {
+	if len(h.config.ExitCodePolicies) == 0 {
+		return "", "", false
+	}
+	container, terminated := lastTermination(pod)
+	if terminated == nil {
+		return "", "", false
+	}
+
+	rollingOut := owner != nil && ownerRollingOut(owner)
+	for _, duringRollout := range []bool{true, false} {
+		if duringRollout && !rollingOut {
+			continue
+		}
+		for _, policy := range h.config.ExitCodePolicies {
+			if policy.DuringRollout != duringRollout || policy.ExitCode != terminated.ExitCode {
+				continue
+			}
+			message := fmt.Sprintf("container %s exited with code %d", container, terminated.ExitCode)
+			if terminated.Reason != "" {
+				message += " (" + terminated.Reason + ")"
+			}
+			if duringRollout {
+				message += " during rollout"
+			}
+			return policy.Action, message + ", exit code policy " + policy.String(), true
+		}
+	}
+	return "", "", false
+}
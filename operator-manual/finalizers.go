@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const ActionStripFinalizers HealingAction = "strip-finalizers"
+
+// FinalizerConfig - настройки снятия finalizer'ов с Pod'ов, навсегда зависших
+// в Terminating (например, после удаления контроллера, который их ставил).
+// Включается только явно и снимает только finalizer'ы из Allowlist.
+type FinalizerConfig struct {
+	Enabled   bool
+	Allowlist []string
+}
+
+// terminatingDetector - Pod удален, но дольше порога не исчезает из-за finalizer'ов
+type terminatingDetector struct{}
+
+func (terminatingDetector) Reason() StuckReason { return ReasonTerminating }
+
+func (terminatingDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	if pod.DeletionTimestamp == nil || len(pod.Finalizers) == 0 {
+		return nil
+	}
+	terminating := now.Sub(pod.DeletionTimestamp.Time)
+	if terminating <= thresholds.TerminatingTimeout {
+		return nil
+	}
+	return &stuckCondition{
+		Reason: ReasonTerminating,
+		Detail: fmt.Sprintf("terminating for %v with finalizers %s",
+			terminating.Round(time.Second), strings.Join(pod.Finalizers, ", ")),
+		Since: pod.DeletionTimestamp.Time,
+	}
+}
+
+// terminatingDecision решает, можно ли снять finalizer'ы с зависшего в Terminating Pod'а
+func (h *PodHealer) terminatingDecision(decision *healingDecision) *healingDecision {
+	skip := func(message string, warn bool) *healingDecision {
+		decision.Action, decision.Message, decision.Warn = ActionSkip, message, warn
+		return decision
+	}
+
+	if !h.config.Finalizers.Enabled {
+		return skip("finalizer stripping is disabled", false)
+	}
+	_, unknown := h.splitFinalizers(decision.Pod.Finalizers)
+	if len(unknown) > 0 {
+		return skip(fmt.Sprintf("finalizers %s are not in the allowlist", strings.Join(unknown, ", ")), true)
+	}
+	decision.Action = ActionStripFinalizers
+	return decision
+}
+
+// splitFinalizers делит finalizer'ы на разрешенные к снятию и остальные
+func (h *PodHealer) splitFinalizers(finalizers []string) (allowed, unknown []string) {
+	for _, finalizer := range finalizers {
+		isAllowed := false
+		for _, candidate := range h.config.Finalizers.Allowlist {
+			if finalizer == candidate {
+				isAllowed = true
+				break
+			}
+		}
+		if isAllowed {
+			allowed = append(allowed, finalizer)
+		} else {
+			unknown = append(unknown, finalizer)
+		}
+	}
+	return allowed, unknown
+}
+
+// finalizerRemediator снимает разрешенные finalizer'ы. JSON patch с test
+// не даст затереть finalizer'ы, изменившиеся с момента оценки.
+type finalizerRemediator struct{ h *PodHealer }
+
+func (finalizerRemediator) Action() HealingAction { return ActionStripFinalizers }
+
+func (r finalizerRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	pod := decision.Pod
+	allowed, unknown := r.h.splitFinalizers(pod.Finalizers)
+	if len(allowed) == 0 {
+		return nil
+	}
+	if unknown == nil {
+		unknown = []string{}
+	}
+
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": "/metadata/finalizers", "value": pod.Finalizers},
+		{"op": "replace", "path": "/metadata/finalizers", "value": unknown},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := r.h.clientset.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.JSONPatchType, patch,
+		metav1.PatchOptions{}); err != nil {
+		return err
+	}
+
+	klog.InfoS("Removed finalizers from pod stuck in Terminating", "cluster", r.h.cluster,
+		"namespace", pod.Namespace, "pod", pod.Name, "finalizers", allowed)
+	decisionEventf(r.h.recorder, pod, decision, corev1.EventTypeWarning, "FinalizersRemoved",
+		"Removed finalizers %s after pod was stuck in Terminating: %s", strings.Join(allowed, ", "), decision.Detail)
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// FlapConfig - настройки обнаружения владельцев, чьи Pod'ы постоянно
+// падают и пересоздаются. Threshold 0 отключает обнаружение.
+type FlapConfig struct {
+	Threshold int
+	Window    time.Duration
+}
+
+// flapTracker считает перезапуски контейнеров и пересоздания Pod'ов по владельцам.
+// Счетчик на уровне владельца переживает удаление отдельных Pod'ов, поэтому
+// цикл "упал - вылечен - снова упал" не обнуляет историю.
+type flapTracker struct {
+	mu       sync.Mutex
+	churn    map[string][]time.Time
+	restarts map[types.UID]int32
+	// periodChurn - churn владельцев с начала периода сводки, без окна
+	periodChurn map[string]int
+}
+
+func newFlapTracker() *flapTracker {
+	return &flapTracker{
+		churn:       make(map[string][]time.Time),
+		restarts:    make(map[types.UID]int32),
+		periodChurn: make(map[string]int),
+	}
+}
+
+// flapOwnerKey возвращает ключ владельца Pod'а в формате workloadOwner.String()
+// без обращения к API. Имя Deployment восстанавливается из имени ReplicaSet.
+func flapOwnerKey(pod *corev1.Pod) string {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return ""
+	}
+	if ref.Kind == "ReplicaSet" {
+		if hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; hash != "" && strings.HasSuffix(ref.Name, "-"+hash) {
+			return fmt.Sprintf("Deployment %s/%s", pod.Namespace, strings.TrimSuffix(ref.Name, "-"+hash))
+		}
+	}
+	return fmt.Sprintf("%s %s/%s", ref.Kind, pod.Namespace, ref.Name)
+}
+
+func podRestarts(pod *corev1.Pod) int32 {
+	var restarts int32
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		restarts += containerStatus.RestartCount
+	}
+	return restarts
+}
+
+// observe учитывает новые перезапуски контейнеров Pod'а.
+// Перезапуски, накопленные до первого наблюдения, не учитываются.
+func (t *flapTracker) observe(pod *corev1.Pod, now time.Time) {
+	key := flapOwnerKey(pod)
+	if key == "" {
+		return
+	}
+	restarts := podRestarts(pod)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous, seen := t.restarts[pod.UID]
+	t.restarts[pod.UID] = restarts
+	if !seen {
+		return
+	}
+	for i := previous; i < restarts; i++ {
+		t.churn[key] = append(t.churn[key], now)
+		t.periodChurn[key]++
+	}
+}
+
+// observeDeletion учитывает удаление Pod'а, который не завершился успешно:
+// владелец пересоздаст его, и это тоже churn
+func (t *flapTracker) observeDeletion(pod *corev1.Pod, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.restarts, pod.UID)
+	key := flapOwnerKey(pod)
+	if key == "" || pod.Status.Phase == corev1.PodSucceeded {
+		return
+	}
+	t.churn[key] = append(t.churn[key], now)
+	t.periodChurn[key]++
+}
+
+// takePeriodChurn возвращает churn владельцев с прошлого вызова и обнуляет его
+func (t *flapTracker) takePeriodChurn() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	churn := t.periodChurn
+	t.periodChurn = make(map[string]int)
+	return churn
+}
+
+// recentChurn возвращает число перезапусков и пересозданий Pod'ов владельца за окно
+func (t *flapTracker) recentChurn(owner *workloadOwner, now time.Time, window time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := owner.String()
+	recent := recentAttempts(t.churn[key], now, window)
+	if len(recent) == 0 {
+		delete(t.churn, key)
+		return 0
+	}
+	t.churn[key] = recent
+	return len(recent)
+}
+
+// flappingDue проверяет, флапает ли владелец
+func (h *PodHealer) flappingDue(owner *workloadOwner, now time.Time) (bool, int) {
+	if h.config.Flapping.Threshold <= 0 {
+		return false, 0
+	}
+	churn := h.flaps.recentChurn(owner, now, h.config.Flapping.Window)
+	return churn >= h.config.Flapping.Threshold, churn
+}
+
+func flappingReason(churn int, window time.Duration, stuck *stuckCondition) string {
+	return fmt.Sprintf("workload is flapping: %d pod restarts and recreations within %v, pods still %s",
+		churn, window, stuck.Reason)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+// testNow - момент, на котором стоят fake-часы тестового healer'а
+var testNow = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestHealer создает healer поверх fake clientset с перечисленными объектами
+func newTestHealer(t *testing.T, config Config, objects ...runtime.Object) (*PodHealer, *fake.Clientset, *clocktesting.FakeClock) {
+	t.Helper()
+	if config.Thresholds == (Thresholds{}) {
+		config.Thresholds = defaultThresholds
+	}
+	clientset := fake.NewSimpleClientset(objects...)
+	clock := clocktesting.NewFakeClock(testNow)
+	healer, err := newPodHealer("test", clientset, clock, config)
+	if err != nil {
+		t.Fatalf("newPodHealer: %v", err)
+	}
+	return healer, clientset, clock
+}
+
+// podOption изменяет Pod, собранный testPod
+type podOption func(*corev1.Pod)
+
+// testPod возвращает работающий готовый Pod, созданный age назад
+func testPod(name string, age time.Duration, options ...podOption) *corev1.Pod {
+	created := metav1.NewTime(testNow.Add(-age))
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			UID:               types.UID(name + "-uid"),
+			CreationTimestamp: created,
+		},
+		Spec: corev1.PodSpec{NodeName: "node-1"},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: created},
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue, LastTransitionTime: created},
+			},
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "app",
+				Ready: true,
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: created}},
+			}},
+		},
+	}
+	for _, option := range options {
+		option(pod)
+	}
+	return pod
+}
+
+func withPhase(phase corev1.PodPhase) podOption {
+	return func(pod *corev1.Pod) { pod.Status.Phase = phase }
+}
+
+func withWaiting(reason string) podOption {
+	return func(pod *corev1.Pod) {
+		pod.Status.ContainerStatuses[0].Ready = false
+		pod.Status.ContainerStatuses[0].State = corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: reason},
+		}
+	}
+}
+
+// withInitContainer добавляет Pod'у init-контейнер в ожидании reason
+func withInitContainer(reason string, restarts int32) podOption {
+	return func(pod *corev1.Pod) {
+		pod.Status.InitContainerStatuses = append(pod.Status.InitContainerStatuses, corev1.ContainerStatus{
+			Name:         "init",
+			RestartCount: restarts,
+			State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}},
+		})
+		pod.Status.ContainerStatuses[0].State = corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"},
+		}
+	}
+}
+
+func withRestarts(count int32) podOption {
+	return func(pod *corev1.Pod) { pod.Status.ContainerStatuses[0].RestartCount = count }
+}
+
+// withNotReady помечает Pod не готовым в течение duration
+func withNotReady(duration time.Duration) podOption {
+	return func(pod *corev1.Pod) {
+		for i := range pod.Status.Conditions {
+			if pod.Status.Conditions[i].Type == corev1.PodReady {
+				pod.Status.Conditions[i].Status = corev1.ConditionFalse
+				pod.Status.Conditions[i].LastTransitionTime = metav1.NewTime(testNow.Add(-duration))
+			}
+		}
+	}
+}
+
+// withDeletion помечает Pod удаленным duration назад с finalizer'ами
+func withDeletion(duration time.Duration, finalizers ...string) podOption {
+	return func(pod *corev1.Pod) {
+		deleted := metav1.NewTime(testNow.Add(-duration))
+		pod.DeletionTimestamp = &deleted
+		pod.Finalizers = finalizers
+	}
+}
+
+func withAnnotation(key, value string) podOption {
+	return func(pod *corev1.Pod) {
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[key] = value
+	}
+}
+
+// withReadinessGate добавляет Pod'у readiness gate с условием status при готовых контейнерах
+func withReadinessGate(conditionType corev1.PodConditionType, status corev1.ConditionStatus) podOption {
+	return func(pod *corev1.Pod) {
+		pod.Spec.ReadinessGates = append(pod.Spec.ReadinessGates, corev1.PodReadinessGate{ConditionType: conditionType})
+		pod.Status.Conditions = append(pod.Status.Conditions,
+			corev1.PodCondition{Type: corev1.ContainersReady, Status: corev1.ConditionTrue},
+			corev1.PodCondition{Type: conditionType, Status: status, Message: "target is unhealthy"})
+	}
+}
+
+func withOwner(kind, name string) podOption {
+	return func(pod *corev1.Pod) {
+		controller := true
+		pod.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "apps/v1",
+			Kind:       kind,
+			Name:       name,
+			UID:        types.UID(name + "-uid"),
+			Controller: &controller,
+		}}
+	}
+}
+
+// livenessEvent - событие Unhealthy о count неудачных liveness-пробах Pod'а
+func livenessEvent(pod *corev1.Pod, count int32, at time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name + ".liveness", Namespace: pod.Namespace},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:      "Pod",
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			UID:       pod.UID,
+		},
+		Reason:        "Unhealthy",
+		Message:       "Liveness probe failed: connection refused",
+		Count:         count,
+		LastTimestamp: metav1.NewTime(at),
+	}
+}
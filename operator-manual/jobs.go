@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Действие для сломанного Job'а: none, delete-failed-pods или recreate
+	annotationJobAction = "healing.kubernetes.io/job-action"
+	// Сколько раз можно пересоздать Job, по умолчанию defaultMaxJobRecreates
+	annotationMaxJobRecreates = "healing.kubernetes.io/max-job-recreates"
+	// Счетчик пересозданий, переносится на новый Job
+	annotationJobRecreates = "healing.kubernetes.io/job-recreates"
+)
+
+// JobAction - способ лечения Job'а
+type JobAction string
+
+const (
+	JobActionNone             JobAction = "none"
+	JobActionDeleteFailedPods JobAction = "delete-failed-pods"
+	JobActionRecreate         JobAction = "recreate"
+)
+
+const defaultMaxJobRecreates = 3
+
+// Labels, которые Job controller сам проставляет в шаблон Pod'а
+var jobGeneratedLabels = []string{
+	"controller-uid",
+	"job-name",
+	"batch.kubernetes.io/controller-uid",
+	"batch.kubernetes.io/job-name",
+}
+
+// jobFailure возвращает причину, по которой Job завершился неудачей
+// (BackoffLimitExceeded, DeadlineExceeded), или "" для работающего Job'а
+func jobFailure(job *batchv1.Job) (string, string) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return condition.Reason, condition.Message
+		}
+	}
+	return "", ""
+}
+
+// isJobStuck проверяет, что Job провалился или его Pod'ы постоянно падают
+func (h *PodHealer) isJobStuck(job *batchv1.Job) (string, bool) {
+	if reason, message := jobFailure(job); reason != "" {
+		return fmt.Sprintf("job failed with %s: %s", reason, message), true
+	}
+	if job.Status.Active > 0 && job.Status.Failed > h.config.Thresholds.MaxRestarts {
+		return fmt.Sprintf("job has %d failed pods", job.Status.Failed), true
+	}
+	return "", false
+}
+
+func (h *PodHealer) handleJob(job *batchv1.Job) {
+	if job.Namespace == "kube-system" || !h.namespaceWatched(job.Namespace) {
+		return
+	}
+
+	detail, stuck := h.isJobStuck(job)
+	if !stuck {
+		return
+	}
+
+	action := JobAction(job.Annotations[annotationJobAction])
+	if action == "" || action == JobActionNone {
+		return
+	}
+
+	mode := h.namespaceMode(job.Namespace)
+	if mode == ModeDisabled {
+		return
+	}
+	if mode == ModeObserve || h.inMaintenanceWindow(job.Namespace, h.clock.Now()) {
+		klog.InfoS("Would heal job", "cluster", h.cluster, "namespace", job.Namespace, "job", job.Name,
+			"action", action, "detail", detail)
+		return
+	}
+
+	if !h.limiter.Allow() {
+		rateLimitedTotal.WithLabelValues(h.cluster).Inc()
+		return
+	}
+
+	var err error
+	switch action {
+	case JobActionDeleteFailedPods:
+		err = h.deleteFailedJobPods(context.TODO(), job)
+	case JobActionRecreate:
+		err = h.recreateJob(context.TODO(), job)
+	default:
+		err = fmt.Errorf("unknown %s annotation value %q", annotationJobAction, action)
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to heal job", "cluster", h.cluster, "namespace", job.Namespace, "job", job.Name,
+			"action", action)
+		healsTotal.WithLabelValues(h.cluster, job.Namespace, string(action), "error").Inc()
+		return
+	}
+	healsTotal.WithLabelValues(h.cluster, job.Namespace, string(action), "success").Inc()
+}
+
+// deleteFailedJobPods удаляет упавшие Pod'ы работающего Job'а, чтобы он мог повторить попытку
+func (h *PodHealer) deleteFailedJobPods(ctx context.Context, job *batchv1.Job) error {
+	if reason, _ := jobFailure(job); reason != "" {
+		// Завершенный Job не запустит новые Pod'ы, удаление ничего не даст
+		return nil
+	}
+	if job.Spec.Selector == nil {
+		return fmt.Errorf("job has no selector")
+	}
+	selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return err
+	}
+
+	pods, err := h.clientset.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+	deleted := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != corev1.PodFailed {
+			continue
+		}
+		if err := h.clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		deleted++
+	}
+
+	klog.InfoS("Deleted failed job pods", "cluster", h.cluster, "namespace", job.Namespace, "job", job.Name, "count", deleted)
+	h.recorder.Eventf(job, corev1.EventTypeNormal, "FailedPodsDeleted", "Deleted %d failed pods to let the job retry", deleted)
+	return nil
+}
+
+// recreateJob пересоздает провалившийся Job из его спецификации, не более
+// max-job-recreates раз подряд
+func (h *PodHealer) recreateJob(ctx context.Context, job *batchv1.Job) error {
+	reason, _ := jobFailure(job)
+	if reason == "" {
+		// Job еще работает, достаточно дождаться его завершения
+		return nil
+	}
+
+	recreates, _ := strconv.Atoi(job.Annotations[annotationJobRecreates])
+	maxRecreates := defaultMaxJobRecreates
+	if value, exists := job.Annotations[annotationMaxJobRecreates]; exists {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			maxRecreates = n
+		}
+	}
+	if recreates >= maxRecreates {
+		h.recorder.Eventf(job, corev1.EventTypeWarning, "HealingSkipped",
+			"Job was already recreated %d times, not recreating again", recreates)
+		return nil
+	}
+
+	replacement := jobFromSpec(job, recreates+1)
+	propagation := metav1.DeletePropagationBackground
+	err := h.clientset.BatchV1().Jobs(job.Namespace).Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil {
+		return err
+	}
+	klog.InfoS("Deleted failed job, recreating from spec", "cluster", h.cluster, "namespace", job.Namespace,
+		"job", job.Name, "reason", reason, "attempt", recreates+1)
+
+	go func() {
+		err := wait.PollImmediate(2*time.Second, recreateTimeout, func() (bool, error) {
+			_, err := h.clientset.BatchV1().Jobs(job.Namespace).Get(ctx, job.Name, metav1.GetOptions{})
+			return errors.IsNotFound(err), nil
+		})
+		if err == nil {
+			var created *batchv1.Job
+			created, err = h.clientset.BatchV1().Jobs(job.Namespace).Create(ctx, replacement, metav1.CreateOptions{})
+			if err == nil {
+				h.recorder.Eventf(created, corev1.EventTypeNormal, "Recreated",
+					"Job recreated by pod healer after %s (attempt %d)", reason, recreates+1)
+			}
+		}
+		if err != nil {
+			klog.ErrorS(err, "Failed to recreate job", "cluster", h.cluster, "namespace", job.Namespace, "job", job.Name)
+		}
+	}()
+	return nil
+}
+
+// jobFromSpec готовит копию Job'а для повторного создания
+func jobFromSpec(job *batchv1.Job, recreates int) *batchv1.Job {
+	spec := job.Spec.DeepCopy()
+
+	// Селектор и его labels генерирует Job controller, кроме manualSelector
+	if spec.ManualSelector == nil || !*spec.ManualSelector {
+		spec.Selector = nil
+		templateLabels := labels.Set{}
+		for key, value := range spec.Template.Labels {
+			templateLabels[key] = value
+		}
+		for _, key := range jobGeneratedLabels {
+			delete(templateLabels, key)
+		}
+		spec.Template.Labels = templateLabels
+	}
+
+	annotations := map[string]string{}
+	for key, value := range job.Annotations {
+		annotations[key] = value
+	}
+	annotations[annotationJobRecreates] = strconv.Itoa(recreates)
+
+	jobLabels := map[string]string{}
+	for key, value := range job.Labels {
+		jobLabels[key] = value
+	}
+	for _, key := range jobGeneratedLabels {
+		delete(jobLabels, key)
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            job.Name,
+			Namespace:       job.Namespace,
+			Labels:          jobLabels,
+			Annotations:     annotations,
+			OwnerReferences: job.OwnerReferences,
+		},
+		Spec: *spec,
+	}
+}
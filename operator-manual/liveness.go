@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// livenessTracker накапливает неудачные liveness-пробы по событиям Unhealthy.
+// Kubelet агрегирует повторяющиеся события, увеличивая count, поэтому
+// хранится последний увиденный count и время каждого прироста.
+type livenessTracker struct {
+	mu       sync.Mutex
+	failures map[types.UID][]time.Time
+	counts   map[types.UID]map[string]int32
+}
+
+func newLivenessTracker() *livenessTracker {
+	return &livenessTracker{
+		failures: make(map[types.UID][]time.Time),
+		counts:   make(map[types.UID]map[string]int32),
+	}
+}
+
+func isLivenessFailure(event *corev1.Event) bool {
+	return event.Reason == "Unhealthy" && event.InvolvedObject.Kind == "Pod" &&
+		strings.HasPrefix(event.Message, "Liveness probe failed")
+}
+
+// observe учитывает новое или обновленное событие Unhealthy
+func (t *livenessTracker) observe(event *corev1.Event) {
+	if !isLivenessFailure(event) {
+		return
+	}
+	uid := event.InvolvedObject.UID
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := t.counts[uid]
+	if counts == nil {
+		counts = make(map[string]int32)
+		t.counts[uid] = counts
+	}
+	count := event.Count
+	if count == 0 {
+		count = 1
+	}
+	delta := count - counts[event.Name]
+	if delta <= 0 {
+		return
+	}
+	counts[event.Name] = count
+
+	at := eventTime(event)
+	for i := int32(0); i < delta; i++ {
+		t.failures[uid] = append(t.failures[uid], at)
+	}
+}
+
+// recentFailures возвращает число неудачных liveness-проб Pod'а за окно
+func (t *livenessTracker) recentFailures(uid types.UID, now time.Time, window time.Duration) int32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	recent := t.failures[uid][:0]
+	for _, at := range t.failures[uid] {
+		if now.Sub(at) < window {
+			recent = append(recent, at)
+		}
+	}
+	t.failures[uid] = recent
+	return int32(len(recent))
+}
+
+func (t *livenessTracker) forget(uid types.UID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, uid)
+	delete(t.counts, uid)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/klog/v2"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// setupLogging направляет вывод klog в zap: json для Loki/ELK или text для консоли.
+// Уровень детализации по-прежнему задается флагом -v klog.
+func setupLogging(format string) error {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "time"
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	var encoder zapcore.Encoder
+	switch format {
+	case "json":
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	case "text":
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	default:
+		return fmt.Errorf("unknown log format %q, expected json or text", format)
+	}
+
+	// Фильтрацию по уровню выполняет klog, zap пишет все, что получил
+	allLevels := zap.LevelEnablerFunc(func(zapcore.Level) bool { return true })
+	core := zapcore.NewCore(encoder, zapcore.Lock(os.Stderr), allLevels)
+	klog.SetLogger(zapr.NewLogger(zap.New(core)))
+	// controller-runtime пишет через тот же klog
+	ctrllog.SetLogger(klog.NewKlogr())
+	return nil
+}
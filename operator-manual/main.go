@@ -2,101 +2,269 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+	"k8s.io/utils/clock"
+	ctrlcache "sigs.k8s.io/controller-runtime/pkg/cache"
 )
 
+// Config - глобальные настройки healer'а
+type Config struct {
+	Kubeconfig    string
+	KubeconfigDir string
+	Contexts      []string
+	// ClientQPS и ClientBurst ограничивают запросы к API server, 0 - значения client-go
+	ClientQPS   float32
+	ClientBurst int
+	// HealWorkers - сколько Pod'ов оцениваются и лечатся одновременно, 0 - по одному
+	HealWorkers int
+	// ResyncPeriod - как часто informer'ы повторно присылают все объекты
+	ResyncPeriod       time.Duration
+	Thresholds         Thresholds
+	MaintenanceWindows []*Schedule
+	// ThresholdSchedules переопределяют Thresholds по расписанию, первое совпавшее побеждает
+	ThresholdSchedules []ThresholdSchedule
+	HealCooldown       time.Duration
+	// ReplacementTimeout - сколько соседи вылеченного Pod'а ждут готовности его замены, 0 не ждет
+	ReplacementTimeout time.Duration
+	MinAvailable       intstr.IntOrString
+	// DefaultAction - действие для зависших Pod'ов без аннотации action
+	DefaultAction HealingAction
+	Escalation    EscalationConfig
+	Flapping      FlapConfig
+	UnownedPods   UnownedPodPolicy
+	DaemonSetPods DaemonSetPodPolicy
+	Sidecars      SidecarConfig
+	// ReadinessGatePods - что делать с Pod'ами, не прошедшими readiness gate
+	ReadinessGatePods ReadinessGatePolicy
+	Finalizers        FinalizerConfig
+	// ForceDeleteLostPods - принудительно удалять Pod'ы с потерянных нод
+	ForceDeleteLostPods bool
+	// NotifyContainerConfigErrors - сообщать о CreateContainerConfigError и владельцу Pod'а
+	NotifyContainerConfigErrors bool
+	Rollback                    RollbackConfig
+	EphemeralStorage            EphemeralStorageConfig
+	OOMBump                     OOMBumpConfig
+	ResourceSignals             ResourceSignalsConfig
+	MemoryLeak                  MemoryLeakConfig
+	BlackboxProbe               BlackboxProbeConfig
+	// OrphanedPodGracePeriod - через сколько удаляются Pod'ы нод, которых больше нет, 0 отключает
+	OrphanedPodGracePeriod time.Duration
+	// StuckRolloutAction - действие с Deployment'ом, rollout которого превысил progressDeadlineSeconds
+	StuckRolloutAction StuckRolloutAction
+	// ExitCodePolicies - действия по коду завершения контейнера вместо действия по умолчанию
+	ExitCodePolicies []ExitCodePolicy
+	// ReasonActions - действия по коду причины вместо действия по умолчанию
+	ReasonActions ReasonActions
+	Webhook       WebhookConfig
+	// Namespaces - явный список namespaces, пустой список означает все
+	Namespaces []string
+	// NamespaceSelector ограничивает healing namespaces с подходящими labels
+	NamespaceSelector labels.Selector
+	// NodeSelector ограничивает healing Pod'ами на нодах с подходящими labels
+	NodeSelector labels.Selector
+	// NamespaceOptIn - лечить только namespaces с label healing.kubernetes.io/enabled=true
+	NamespaceOptIn bool
+	Shard          ShardConfig
+	LeaderElection LeaderElectionConfig
+	ActiveActive   ActiveActiveConfig
+	// ProtectedPriorityClass - Pod'ы с приоритетом этого класса и выше не лечатся
+	ProtectedPriorityClass string
+	// MaxHealsPerMinute ограничивает число удалений в каждом кластере, 0 - без ограничений
+	MaxHealsPerMinute int
+	NamespaceBudget   NamespaceBudget
+	// CanaryPercent - доля зависших Pod'ов, которые действительно лечатся, 0 - все
+	CanaryPercent int
+	Prometheus    PrometheusConfig
+	NodePressure  NodePressureConfig
+	// NodePreemption - выселение Pod'ов с нод, которые скоро будут удалены
+	NodePreemption NodePreemptionConfig
+	// ServiceEndpoints - healing Pod'ов Service'ов, у которых не осталось Ready endpoints
+	ServiceEndpoints ServiceEndpointsConfig
+	Approval         ApprovalConfig
+	// HealingCondition - condition SelectedForHealing на Pod'ах перед действием
+	HealingCondition HealingConditionConfig
+	State            StateConfig
+	Summary          SummaryConfig
+	Delete           DeleteConfig
+}
+
 type PodHealer struct {
-	clientset *kubernetes.Clientset
+	cluster    string
+	restConfig *rest.Config
+	clientset  kubernetes.Interface
+	// podMetrics - клиент metrics-server, nil без --metrics-server-signals и --memory-leak-detection
+	podMetrics metricsclient.Interface
+	// cache - кэш manager'а, nil до запуска Run
+	cache ctrlcache.Cache
+	// startOnce откладывает восстановление состояния до избрания лидером
+	startOnce  sync.Once
+	clock      clock.PassiveClock
+	config     Config
+	namespaces cache.Store
+	nodes      cache.Store
+	recorder   record.EventRecorder
+	limiter    *rate.Limiter
+
+	// UID'ы Pod'ов, уже учтенных в метриках обнаружения
+	detectedMu sync.Mutex
+	detected   map[types.UID]StuckReason
+
+	liveness  *livenessTracker
+	flaps     *flapTracker
+	state     *healerState
+	approvals *approvalTracker
+	// Pod'ы, ожидающие отсутствующих Secret'ов и ConfigMap'ов
+	mountWaiters *mountWaiters
+	// Вылеченные Pod'ы, замены которых еще не готовы
+	replacements *replacementTracker
+	// Выселения за ephemeral-storage по владельцам
+	evictions *evictionTracker
+	// Pod'ы на удаленных нодах
+	orphans *orphanTracker
+	// OOMKilled контейнеров по владельцам
+	ooms *oomTracker
+	// Замеры памяти контейнеров для --memory-leak-detection
+	memory *memoryTracker
+	// Решения текущего периода сводки
+	summaries *summaryTracker
+
+	strategies *strategyRegistry
+	promql     []*promQLDetector
+
+	// Приоритет, начиная с которого Pod'ы не лечатся, nil - без ограничений
+	protectedPriority *int32
+	// Отложенные rate limiter'ом heal'ы
+	queueMu sync.Mutex
+	queue   map[types.UID]*healingDecision
+	budgets *namespaceBudgets
+	// healSlots ограничивает число одновременных heal'ов значением HealWorkers
+	healSlots chan struct{}
+	// Время heal'ов за последнюю минуту, чтобы восстановить rate limiter после перезапуска
+	healTimes []time.Time
+	// Последнее сохраненное в ConfigMap состояние без SavedAt
+	unchangedState string
+
+	// Время последних heal'ов по владельцам для эскалации
+	attemptsMu sync.Mutex
+	attempts   map[string][]time.Time
 }
 
-func NewPodHealer() (*PodHealer, error) {
-	var config *rest.Config
-	var err error
+func (c Config) healWorkers() int {
+	if c.HealWorkers < 1 {
+		return 1
+	}
+	return c.HealWorkers
+}
 
-	// Попытка подключиться внутри кластера
-	config, err = rest.InClusterConfig()
+func NewPodHealer(cluster clusterConfig, healerConfig Config) (*PodHealer, error) {
+	restConfig := rest.CopyConfig(cluster.RestConfig)
+	if healerConfig.ClientQPS > 0 {
+		restConfig.QPS = healerConfig.ClientQPS
+	}
+	if healerConfig.ClientBurst > 0 {
+		restConfig.Burst = healerConfig.ClientBurst
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
-		// Fallback: использование kubeconfig для разработки
-		kubeconfig := flag.String("kubeconfig", "", "path to kubeconfig")
-		flag.Parse()
-		
-		if *kubeconfig != "" {
-			config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
-		} else {
-			config, err = clientcmd.BuildConfigFromFlags("", os.Getenv("KUBECONFIG"))
-		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to build config: %v", err)
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+	healer, err := newPodHealer(cluster.Name, clientset, clock.RealClock{}, healerConfig)
+	if err != nil {
+		return nil, err
+	}
+	healer.restConfig = restConfig
+	if healerConfig.ResourceSignals.Enabled || healerConfig.MemoryLeak.Enabled {
+		if healer.podMetrics, err = metricsclient.NewForConfig(restConfig); err != nil {
+			return nil, fmt.Errorf("failed to create metrics client: %v", err)
 		}
 	}
+	return healer, nil
+}
 
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create clientset: %v", err)
+// newPodHealer собирает healer поверх готового клиента и часов,
+// тесты передают сюда fake clientset и fake clock
+func newPodHealer(cluster string, clientset kubernetes.Interface, clock clock.PassiveClock, healerConfig Config) (*PodHealer, error) {
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if healerConfig.MaxHealsPerMinute > 0 {
+		limiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(healerConfig.MaxHealsPerMinute)),
+			healerConfig.MaxHealsPerMinute)
 	}
 
-	return &PodHealer{
-		clientset: clientset,
-	}, nil
-}
+	healer := &PodHealer{
+		cluster:      cluster,
+		clientset:    clientset,
+		clock:        clock,
+		config:       healerConfig,
+		recorder:     newEventRecorder(clientset),
+		limiter:      limiter,
+		detected:     make(map[types.UID]StuckReason),
+		attempts:     make(map[string][]time.Time),
+		liveness:     newLivenessTracker(),
+		flaps:        newFlapTracker(),
+		state:        newHealerState(),
+		queue:        make(map[types.UID]*healingDecision),
+		budgets:      newNamespaceBudgets(),
+		approvals:    newApprovalTracker(),
+		mountWaiters: newMountWaiters(),
+		replacements: newReplacementTracker(),
+		evictions:    newEvictionTracker(),
+		orphans:      newOrphanTracker(),
+		ooms:         newOOMTracker(),
+		memory:       newMemoryTracker(),
+		summaries:    newSummaryTracker(),
+		healSlots:    make(chan struct{}, healerConfig.healWorkers()),
+	}
 
-func (h *PodHealer) isPodStuck(pod *corev1.Pod) bool {
-	// Pod в Pending состоянии больше 15 минут
-	if pod.Status.Phase == corev1.PodPending {
-		pendingDuration := time.Since(pod.CreationTimestamp.Time)
-		if pendingDuration > 15*time.Minute {
-			klog.Infof("Pod %s/%s stuck in Pending for %v", 
-				pod.Namespace, pod.Name, pendingDuration)
-			return true
-		}
+	healer.strategies = newStrategyRegistry(healer)
+	for _, config := range healerConfig.Prometheus.Detectors {
+		detector := newPromQLDetector(healerConfig.Prometheus.URL, config)
+		healer.promql = append(healer.promql, detector)
+		healer.strategies.RegisterDetector(detector)
 	}
 
-	// Pod в CrashLoopBackOff
-	if pod.Status.Phase == corev1.PodRunning {
-		for _, containerStatus := range pod.Status.ContainerStatuses {
-			if containerStatus.RestartCount > 10 {
-				klog.Infof("Pod %s/%s in CrashLoopBackOff with %d restarts", 
-					pod.Namespace, pod.Name, containerStatus.RestartCount)
-				return true
-			}
-			
-			// Проверяем состояние контейнера
-			if containerStatus.State.Waiting != nil {
-				if containerStatus.State.Waiting.Reason == "CrashLoopBackOff" {
-					klog.Infof("Pod %s/%s container %s in CrashLoopBackOff", 
-						pod.Namespace, pod.Name, containerStatus.Name)
-					return true
-				}
-			}
-		}
+	var err error
+	healer.protectedPriority, err = healer.resolveProtectedPriority(context.TODO())
+	if err != nil {
+		return nil, err
 	}
+	return healer, nil
+}
+
+// stuckCondition описывает, почему и с какого момента Pod считается зависшим
+type stuckCondition struct {
+	Reason StuckReason
+	Detail string
+	Since  time.Time
+}
 
-	// Pod не Ready больше 10 минут
-	if !isPodReady(pod) {
-		for _, condition := range pod.Status.Conditions {
-			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionFalse {
-				if time.Since(condition.LastTransitionTime.Time) > 10*time.Minute {
-					klog.Infof("Pod %s/%s not ready for %v", 
-						pod.Namespace, pod.Name, time.Since(condition.LastTransitionTime.Time))
-					return true
-				}
-			}
+func (h *PodHealer) isPodStuck(pod *corev1.Pod, thresholds Thresholds) *stuckCondition {
+	return h.strategies.detect(pod, thresholds, h.clock.Now())
+}
+
+// notReadySince оценивает начало проблем Pod'а: момент, когда он
+// перестал быть Ready, либо момент создания Pod'а
+func notReadySince(pod *corev1.Pod) time.Time {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionFalse {
+			return condition.LastTransitionTime.Time
 		}
 	}
-
-	return false
+	return pod.CreationTimestamp.Time
 }
 
 func isPodReady(pod *corev1.Pod) bool {
@@ -108,104 +276,73 @@ func isPodReady(pod *corev1.Pod) bool {
 	return false
 }
 
-func (h *PodHealer) healPod(pod *corev1.Pod) error {
-	klog.Infof("Attempting to heal pod %s/%s", pod.Namespace, pod.Name)
-	
-	// Проверяем аннотации для кастомного поведения
-	if pod.Annotations != nil {
-		if healingAction, exists := pod.Annotations["healing.kubernetes.io/action"]; exists {
-			switch healingAction {
-			case "restart":
-				klog.Infof("Performing custom restart action for pod %s/%s", pod.Namespace, pod.Name)
-			case "delete":
-				klog.Infof("Performing custom delete action for pod %s/%s", pod.Namespace, pod.Name)
-			case "ignore":
-				klog.Infof("Skipping healing for pod %s/%s due to ignore annotation", pod.Namespace, pod.Name)
-				return nil
-			}
-		}
-	}
+// healPod удаляет зависший Pod, его владелец создаст новый
+func (h *PodHealer) healPod(ctx context.Context, pod *corev1.Pod) error {
+	klog.InfoS("Attempting to heal pod", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name)
 
 	// Удаляем проблемный Pod
-	err := h.clientset.CoreV1().Pods(pod.Namespace).Delete(
-		context.TODO(), 
-		pod.Name, 
-		metav1.DeleteOptions{},
-	)
-	
+	err := h.clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, h.deleteOptions(pod))
 	if err != nil {
-		klog.Errorf("Failed to heal pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		klog.ErrorS(err, "Failed to heal pod", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name)
 		return err
 	}
-	
-	klog.Infof("Successfully healed pod %s/%s", pod.Namespace, pod.Name)
+
+	klog.InfoS("Successfully healed pod", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name)
 	return nil
 }
 
-func (h *PodHealer) Run() {
-	klog.Info("Starting Pod Healer Operator...")
-
-	// Создаем watcher для Pod'ов
-	watchlist := cache.NewListWatchFromClient(
-		h.clientset.CoreV1().RESTClient(),
-		"pods",
-		corev1.NamespaceAll,
-		fields.Everything(),
-	)
-
-	_, controller := cache.NewInformer(
-		watchlist,
-		&corev1.Pod{},
-		time.Second*30, // Resync period
-		cache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				pod := obj.(*corev1.Pod)
-				h.handlePod(pod)
-			},
-			UpdateFunc: func(oldObj, newObj interface{}) {
-				newPod := newObj.(*corev1.Pod)
-				h.handlePod(newPod)
-			},
-		},
-	)
-
-	// Запускаем контроллер
-	stop := make(chan struct{})
-	defer close(stop)
-	go controller.Run(stop)
-
-	klog.Info("Pod Healer Operator is running...")
-	select {} // Бесконечное ожидание
+// Run запускает manager кластера и блокируется до отмены ctx
+func (h *PodHealer) Run(ctx context.Context) error {
+	klog.InfoS("Starting Pod Healer Operator", "cluster", h.cluster)
+
+	mgr, err := h.newManager()
+	if err != nil {
+		return fmt.Errorf("failed to create manager: %w", err)
+	}
+	if err := h.setupControllers(ctx, mgr); err != nil {
+		return err
+	}
+	// Кэш namespace'ов из явного списка живет вне manager'а
+	if len(h.config.Namespaces) > 0 {
+		h.startNamespaceInformers(ctx.Done())
+	}
+
+	klog.InfoS("Pod Healer Operator is running", "cluster", h.cluster, "namespaces", h.watchNamespaces(),
+		"shard", h.config.Shard.Index, "shards", h.config.Shard.Total, "leaderElection", h.config.LeaderElection.Enabled)
+	return mgr.Start(ctx)
 }
 
 func (h *PodHealer) handlePod(pod *corev1.Pod) {
-	// Игнорируем Pod'ы в namespaces kube-system
-	if pod.Namespace == "kube-system" {
+	if !h.namespaceWatched(pod.Namespace) {
 		return
 	}
+	now := h.clock.Now()
+	h.flaps.observe(pod, now)
+	h.replacements.observe(pod)
+	h.evictions.observe(pod, now)
+	h.ooms.observe(pod, now)
 
-	// Игнорируем Pod'ы с аннотацией ignore
-	if pod.Annotations != nil {
-		if _, exists := pod.Annotations["healing.kubernetes.io/ignore"]; exists {
-			return
-		}
+	ctx, span := tracer.Start(context.Background(), "HandlePod", h.podSpanAttributes(pod))
+	defer span.End()
+	decision := h.evaluatePod(ctx, pod, now)
+	if decision == nil {
+		h.state.forget(pod.UID)
+		h.approvals.forget(pod.UID)
+		h.mountWaiters.forget(pod.UID)
+		h.dequeueHeal(pod)
+		return
 	}
+	h.state.setStuck(pod.UID, h.reportEntry(decision))
 
-	if h.isPodStuck(pod) {
-		if err := h.healPod(pod); err != nil {
-			klog.Errorf("Error healing pod %s/%s: %v", pod.Namespace, pod.Name, err)
-		}
+	if h.recordDetection(pod, decision.Stuck, now) {
+		klog.InfoS("Stuck pod detected", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name,
+			"reason", decision.Reason, "code", decision.Code, "detail", decision.Detail)
 	}
+	h.executeDecision(ctx, decision)
 }
 
 func main() {
-	klog.InitFlags(nil)
-	flag.Parse()
-
-	healer, err := NewPodHealer()
-	if err != nil {
-		klog.Fatalf("Failed to create pod healer: %v", err)
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
 	}
-
-	healer.Run()
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	annotationMaintenanceWindows = "healing.kubernetes.io/maintenance-windows"
+	// annotationPausedUntil на namespace переводит его в наблюдение до указанного момента в RFC3339
+	annotationPausedUntil = "healing.kubernetes.io/paused-until"
+	// annotationHealingWindow на Pod'е или владельце разрешает healing только в окна,
+	// заданные cron-выражениями через ";", вне окон healer наблюдает. Выражение задает
+	// минуты окна, как и --maintenance-windows: ночное окно - "* 22-6 * * *",
+	// а "0 22-6 * * *" разрешает healing только в первую минуту каждого часа.
+	annotationHealingWindow = "healing.kubernetes.io/window"
+)
+
+// inMaintenanceWindow проверяет глобальные окна обслуживания и окна namespace'а.
+// Во время окна healer только наблюдает и ничего не удаляет.
+func (h *PodHealer) inMaintenanceWindow(namespace string, now time.Time) bool {
+	if anyScheduleMatches(h.config.MaintenanceWindows, now) {
+		return true
+	}
+	return anyScheduleMatches(h.namespaceMaintenanceWindows(namespace), now)
+}
+
+// hasMaintenanceWindows проверяет, заданы ли для namespace'а окна обслуживания
+func (h *PodHealer) hasMaintenanceWindows(namespace string) bool {
+	return len(h.config.MaintenanceWindows) > 0 || len(h.namespaceMaintenanceWindows(namespace)) > 0
+}
+
+func (h *PodHealer) namespaceMaintenanceWindows(namespace string) []*Schedule {
+	if h.namespaces == nil {
+		return nil
+	}
+
+	obj, exists, err := h.namespaces.GetByKey(namespace)
+	if err != nil || !exists {
+		return nil
+	}
+	ns := obj.(*corev1.Namespace)
+
+	value, exists := ns.Annotations[annotationMaintenanceWindows]
+	if !exists {
+		return nil
+	}
+	schedules, err := parseSchedules(value)
+	if err != nil {
+		klog.ErrorS(err, "Invalid namespace annotation", "namespace", namespace,
+			"annotation", annotationMaintenanceWindows)
+		return nil
+	}
+	return schedules
+}
+
+// outsideHealingWindow проверяет окна healing'а из аннотации объекта и возвращает
+// их описание, если now не попадает ни в одно. Некорректное значение healing не ограничивает.
+func outsideHealingWindow(kind, name string, annotations map[string]string, now time.Time) (string, bool) {
+	value, exists := annotations[annotationHealingWindow]
+	if !exists {
+		return "", false
+	}
+	schedules, err := parseSchedules(value)
+	if err != nil {
+		klog.ErrorS(err, "Invalid healing window annotation", "kind", kind, "name", name,
+			"annotation", annotationHealingWindow)
+		return "", false
+	}
+	if len(schedules) == 0 || anyScheduleMatches(schedules, now) {
+		return "", false
+	}
+	return fmt.Sprintf("outside healing window %q of %s %s", value, kind, name), true
+}
+
+// namespacePausedUntil читает паузу healing'а namespace'а (kubectl heal pause).
+// Некорректное значение паузу не включает.
+func (h *PodHealer) namespacePausedUntil(namespace string, now time.Time) (time.Time, bool) {
+	if h.namespaces == nil {
+		return time.Time{}, false
+	}
+
+	obj, exists, err := h.namespaces.GetByKey(namespace)
+	if err != nil || !exists {
+		return time.Time{}, false
+	}
+	value, exists := obj.(*corev1.Namespace).Annotations[annotationPausedUntil]
+	if !exists {
+		return time.Time{}, false
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		klog.ErrorS(err, "Invalid namespace annotation", "namespace", namespace,
+			"annotation", annotationPausedUntil)
+		return time.Time{}, false
+	}
+	return until, now.Before(until)
+}
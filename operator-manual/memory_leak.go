@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const ReasonMemoryLeak StuckReason = "MemoryLeak"
+
+// memoryLeakRestartInterval - как часто назначенные рестарты сверяются с окнами обслуживания.
+// Окна задаются с точностью до минуты, поэтому проверка идет каждую минуту, а не с частотой замеров.
+const memoryLeakRestartInterval = time.Minute
+
+// MemoryLeakConfig - упреждающий рестарт контейнеров, память которых растет без остановки.
+// Такой контейнер будет убит за OOM, и скорее всего в пик нагрузки, когда памяти нужно
+// больше всего; рестарт в окно обслуживания обходится дешевле. Без окон обслуживания
+// (глобальных и namespace'а) рестарт выполняется сразу.
+type MemoryLeakConfig struct {
+	Enabled bool
+	// Interval - как часто снимается потребление памяти из metrics-server
+	Interval time.Duration
+	// Samples - сколько последних замеров подряд должно расти
+	Samples int
+	// Horizon - рестарт назначается, если при текущем росте limit будет достигнут раньше
+	Horizon time.Duration
+}
+
+type memorySample struct {
+	time  time.Time
+	bytes int64
+}
+
+// memoryTracker хранит последние замеры памяти контейнеров и назначенные рестарты
+// в памяти healer'а: после рестарта healer'а ряды набираются заново
+type memoryTracker struct {
+	mu      sync.Mutex
+	samples map[string]map[string][]memorySample
+	// pending - Pod'ы с утечкой, ждущие окна обслуживания, по namespace/name
+	pending map[string]*stuckCondition
+}
+
+func newMemoryTracker() *memoryTracker {
+	return &memoryTracker{
+		samples: make(map[string]map[string][]memorySample),
+		pending: make(map[string]*stuckCondition),
+	}
+}
+
+// observe добавляет замер контейнера, оставляя не больше limit последних.
+// PodMetrics не содержит UID Pod'а, поэтому ряды хранятся по namespace/name.
+func (t *memoryTracker) observe(pod, container string, sample memorySample, limit int) []memorySample {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.samples[pod] == nil {
+		t.samples[pod] = make(map[string][]memorySample)
+	}
+	series := append(t.samples[pod][container], sample)
+	if len(series) > limit {
+		series = series[len(series)-limit:]
+	}
+	t.samples[pod][container] = series
+	return append([]memorySample(nil), series...)
+}
+
+func (t *memoryTracker) forget(pod string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.samples, pod)
+	delete(t.pending, pod)
+}
+
+// schedule назначает рестарт Pod'а, новый замер обновляет описание утечки
+func (t *memoryTracker) schedule(pod string, stuck *stuckCondition) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending[pod] = stuck
+}
+
+func (t *memoryTracker) unschedule(pod string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pending, pod)
+}
+
+func (t *memoryTracker) scheduled() map[string]*stuckCondition {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pending := make(map[string]*stuckCondition, len(t.pending))
+	for pod, stuck := range t.pending {
+		pending[pod] = stuck
+	}
+	return pending
+}
+
+// memoryLeakETA возвращает, через сколько при текущем росте будет достигнут limit.
+// Ряд должен быть полным и не убывать: после рестарта контейнера память падает,
+// и ряд набирается заново.
+func memoryLeakETA(series []memorySample, samples int, limit resource.Quantity) (time.Duration, bool) {
+	if len(series) < samples || samples < 2 {
+		return 0, false
+	}
+	for i := 1; i < len(series); i++ {
+		if series[i].bytes < series[i-1].bytes {
+			return 0, false
+		}
+	}
+	first, last := series[0], series[len(series)-1]
+	growth, elapsed := last.bytes-first.bytes, last.time.Sub(first.time)
+	if growth <= 0 || elapsed <= 0 {
+		return 0, false
+	}
+	remaining := limit.Value() - last.bytes
+	if remaining <= 0 {
+		return 0, true
+	}
+	return time.Duration(float64(remaining) / float64(growth) * float64(elapsed)), true
+}
+
+// sampleMemory снимает потребление памяти Pod'ов из metrics-server, назначает рестарт
+// Pod'ам, контейнеры которых дойдут до limit'а раньше Horizon, и выполняет назначенные
+// рестарты, если окно обслуживания уже открыто
+func (h *PodHealer) sampleMemory(ctx context.Context) {
+	if h.podMetrics == nil {
+		return
+	}
+	now := h.clock.Now()
+	for _, namespace := range h.watchNamespaces() {
+		list, err := h.podMetrics.MetricsV1beta1().PodMetricses(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			klog.ErrorS(err, "Failed to list pod metrics", "cluster", h.cluster, "namespace", namespace)
+			continue
+		}
+		for i := range list.Items {
+			metrics := &list.Items[i]
+			if !h.namespaceWatched(metrics.Namespace) {
+				continue
+			}
+			key := metrics.Namespace + "/" + metrics.Name
+			leaking := make(map[string][]memorySample)
+			for _, container := range metrics.Containers {
+				usage, ok := container.Usage[corev1.ResourceMemory]
+				if !ok {
+					continue
+				}
+				sample := memorySample{time: metrics.Timestamp.Time, bytes: usage.Value()}
+				if sample.time.IsZero() {
+					sample.time = now
+				}
+				series := h.memory.observe(key, container.Name, sample, h.config.MemoryLeak.Samples)
+				if len(series) == h.config.MemoryLeak.Samples {
+					leaking[container.Name] = series
+				}
+			}
+			if len(leaking) == 0 {
+				h.memory.unschedule(key)
+				continue
+			}
+			h.checkMemoryLeak(ctx, metrics.Namespace, metrics.Name, leaking)
+		}
+	}
+	h.restartLeakingPods(ctx)
+}
+
+// checkMemoryLeak сравнивает рост памяти контейнеров с их limit'ами и назначает рестарт
+// Pod'а, если limit будет достигнут раньше Horizon, иначе снимает назначенный
+func (h *PodHealer) checkMemoryLeak(ctx context.Context, namespace, name string, series map[string][]memorySample) {
+	key := namespace + "/" + name
+	pod, err := h.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.ErrorS(err, "Failed to get pod", "cluster", h.cluster, "namespace", namespace, "pod", name)
+		}
+		return
+	}
+
+	var leaks []string
+	for _, container := range pod.Spec.Containers {
+		limit, ok := container.Resources.Limits[corev1.ResourceMemory]
+		if !ok || limit.IsZero() || series[container.Name] == nil {
+			continue
+		}
+		samples := series[container.Name]
+		eta, ok := memoryLeakETA(samples, h.config.MemoryLeak.Samples, limit)
+		if !ok || eta > h.config.MemoryLeak.Horizon {
+			continue
+		}
+		first, last := samples[0], samples[len(samples)-1]
+		leaks = append(leaks, fmt.Sprintf("container %s memory grew from %s to %s over %v and reaches its %s limit in about %v",
+			container.Name, resource.NewQuantity(first.bytes, resource.BinarySI), resource.NewQuantity(last.bytes, resource.BinarySI),
+			last.time.Sub(first.time).Round(time.Second), limit.String(), eta.Round(time.Minute)))
+	}
+	if len(leaks) == 0 {
+		h.memory.unschedule(key)
+		return
+	}
+	sort.Strings(leaks)
+	detail := strings.Join(leaks, ", ")
+	klog.V(2).InfoS("Memory leak detected, restart scheduled for the maintenance window", "cluster", h.cluster,
+		"namespace", namespace, "pod", name, "detail", detail)
+	h.memory.schedule(key, &stuckCondition{Reason: ReasonMemoryLeak, Detail: detail, Since: memorySeriesStart(series)})
+}
+
+// restartLeakingPods выполняет назначенные рестарты Pod'ов, для namespace'ов которых
+// открыто окно обслуживания или окна не заданы вовсе. Рестарт проходит через decide
+// и rate limit; если он не состоялся, следующий замер назначит его снова.
+func (h *PodHealer) restartLeakingPods(ctx context.Context) {
+	now := h.clock.Now()
+	for key, stuck := range h.memory.scheduled() {
+		namespace, name, _ := strings.Cut(key, "/")
+		if h.hasMaintenanceWindows(namespace) && !h.inMaintenanceWindow(namespace, now) {
+			continue
+		}
+		h.memory.unschedule(key)
+		pod, err := h.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				klog.ErrorS(err, "Failed to get pod", "cluster", h.cluster, "namespace", namespace, "pod", name)
+			}
+			continue
+		}
+		h.healDetectedPod(ctx, pod, stuck, now)
+	}
+}
+
+// memorySeriesStart - время самого раннего замера рядов, с него виден рост памяти
+func memorySeriesStart(series map[string][]memorySample) time.Time {
+	var since time.Time
+	for _, samples := range series {
+		if since.IsZero() || samples[0].time.Before(since) {
+			since = samples[0].time
+		}
+	}
+	return since
+}
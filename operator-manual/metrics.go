@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	healsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_healer_heals_total",
+		Help: "Number of heal attempts by cluster, namespace, action and result.",
+	}, []string{"cluster", "namespace", "action", "result"})
+
+	decisionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_healer_decisions_total",
+		Help: "Number of healing decisions for stuck pods by cluster, action and reason code.",
+	}, []string{"cluster", "action", "code"})
+
+	rateLimitedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_healer_rate_limited_total",
+		Help: "Number of heals postponed by the cluster rate limit.",
+	}, []string{"cluster"})
+
+	stuckPodsDetected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_healer_stuck_pods_detected_total",
+		Help: "Number of pods detected as stuck by cluster, reason and reason code.",
+	}, []string{"cluster", "reason", "code"})
+
+	timeToDetect = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pod_healer_time_to_detect_seconds",
+		Help:    "How long a pod had been stuck when it was detected, by reason.",
+		Buckets: []float64{60, 300, 600, 900, 1800, 3600, 7200, 21600, 86400},
+	}, []string{"cluster", "reason"})
+
+	stuckRolloutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_healer_stuck_rollouts_total",
+		Help: "Number of Deployment rollouts past their progress deadline handled, by cluster, action and result.",
+	}, []string{"cluster", "action", "result"})
+
+	escalationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_healer_escalations_total",
+		Help: "Number of owners escalated as broken after repeated heals.",
+	}, []string{"cluster", "action"})
+
+	namespaceBudgetExhaustedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_healer_namespace_budget_exhausted_total",
+		Help: "Number of heals postponed because the namespace exhausted its heal budget.",
+	}, []string{"cluster", "namespace"})
+
+	alertRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_healer_alert_requests_total",
+		Help: "Number of firing alerts received from Alertmanager that requested healing.",
+	}, []string{"cluster", "alertname"})
+
+	promQLQueriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_healer_promql_queries_total",
+		Help: "Number of PromQL detector queries by cluster, detector and result.",
+	}, []string{"cluster", "detector", "result"})
+
+	approvalsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_healer_approvals_total",
+		Help: "Number of healing decisions approved or denied before execution.",
+	}, []string{"cluster", "result"})
+
+	healDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pod_healer_heal_duration_seconds",
+		Help:    "Duration of heal API actions.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"cluster"})
+)
+
+// Метрики healer'а регистрируются рядом с метриками controller-runtime
+// (очереди reconcile, клиенты API) и отдаются одним endpoint'ом
+func init() {
+	ctrlmetrics.Registry.MustRegister(healsTotal, decisionsTotal, rateLimitedTotal,
+		stuckPodsDetected, timeToDetect, healDuration, escalationsTotal, alertRequestsTotal,
+		namespaceBudgetExhaustedTotal, promQLQueriesTotal, approvalsTotal, stuckRolloutsTotal)
+}
+
+// serveMetrics запускает HTTP сервер с метриками Prometheus и дополнительными обработчиками
+func serveMetrics(addr string, handlers map[string]http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(ctrlmetrics.Registry, promhttp.HandlerOpts{}))
+	for pattern, handler := range handlers {
+		mux.Handle(pattern, handler)
+	}
+
+	klog.InfoS("Serving metrics", "address", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		klog.Fatalf("Metrics server failed: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// Как часто проверяется, появились ли отсутствующие Secret'ы и ConfigMap'ы
+const missingMountRecheckInterval = 30 * time.Second
+
+// mountDependency - Secret или ConfigMap, без которого Pod не может подключить том
+type mountDependency struct {
+	Namespace string
+	Reason    string
+	Name      string
+}
+
+// mountWaiters помнит Pod'ы, ожидающие появления отсутствующих объектов.
+// Секреты не кэшируются informer'ом: отслеживаются только объекты, на которые ссылаются зависшие Pod'ы.
+type mountWaiters struct {
+	mu   sync.Mutex
+	pods map[mountDependency]map[types.UID]types.NamespacedName
+}
+
+func newMountWaiters() *mountWaiters {
+	return &mountWaiters{pods: make(map[mountDependency]map[types.UID]types.NamespacedName)}
+}
+
+func (w *mountWaiters) wait(dependency mountDependency, uid types.UID, pod types.NamespacedName) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pods[dependency] == nil {
+		w.pods[dependency] = make(map[types.UID]types.NamespacedName)
+	}
+	w.pods[dependency][uid] = pod
+}
+
+func (w *mountWaiters) forget(uid types.UID) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for dependency, pods := range w.pods {
+		delete(pods, uid)
+		if len(pods) == 0 {
+			delete(w.pods, dependency)
+		}
+	}
+}
+
+// resolve снимает ожидание объекта и возвращает ожидавшие его Pod'ы
+func (w *mountWaiters) resolve(dependency mountDependency) []types.NamespacedName {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var pods []types.NamespacedName
+	for _, pod := range w.pods[dependency] {
+		pods = append(pods, pod)
+	}
+	delete(w.pods, dependency)
+	return pods
+}
+
+func (w *mountWaiters) dependencies() []mountDependency {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dependencies := make([]mountDependency, 0, len(w.pods))
+	for dependency := range w.pods {
+		dependencies = append(dependencies, dependency)
+	}
+	return dependencies
+}
+
+// mountObjectExists проверяет, появился ли отсутствовавший Secret/ConfigMap
+func (h *PodHealer) mountObjectExists(ctx context.Context, dependency mountDependency) (bool, error) {
+	var err error
+	switch dependency.Reason {
+	case "MissingSecret":
+		_, err = h.clientset.CoreV1().Secrets(dependency.Namespace).Get(ctx, dependency.Name, metav1.GetOptions{})
+	case "MissingConfigMap":
+		_, err = h.clientset.CoreV1().ConfigMaps(dependency.Namespace).Get(ctx, dependency.Name, metav1.GetOptions{})
+	default:
+		return false, nil
+	}
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// recheckMissingMounts заново оценивает Pod'ы, чьи Secret'ы и ConfigMap'ы появились.
+// Событие FailedMount у Pod'а остается, но creatingSkipReason уже не пропустит
+// его heal, и Pod перезапускается по обычным политикам.
+func (h *PodHealer) recheckMissingMounts(ctx context.Context) {
+	for _, dependency := range h.mountWaiters.dependencies() {
+		exists, err := h.mountObjectExists(ctx, dependency)
+		if err != nil {
+			klog.ErrorS(err, "Failed to check missing mount object", "cluster", h.cluster,
+				"namespace", dependency.Namespace, "reason", dependency.Reason, "name", dependency.Name)
+			continue
+		}
+		if !exists {
+			continue
+		}
+
+		for _, key := range h.mountWaiters.resolve(dependency) {
+			pod, err := h.clientset.CoreV1().Pods(key.Namespace).Get(ctx, key.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				klog.ErrorS(err, "Failed to get pod waiting for mount object", "cluster", h.cluster,
+					"namespace", key.Namespace, "pod", key.Name)
+				continue
+			}
+			klog.InfoS("Missing mount object appeared, re-evaluating pod", "cluster", h.cluster,
+				"namespace", pod.Namespace, "pod", pod.Name, "reason", dependency.Reason, "name", dependency.Name)
+			h.handlePod(pod)
+		}
+	}
+}
+
+// runMissingMountChecks периодически проверяет ожидаемые Pod'ами объекты
+func (h *PodHealer) runMissingMountChecks(stop <-chan struct{}) {
+	go wait.Until(func() { h.recheckMissingMounts(context.TODO()) }, missingMountRecheckInterval, stop)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMissingConfigMapAppears(t *testing.T) {
+	pod := testPod("web-1", 12*time.Minute, withPhase(corev1.PodPending), withWaiting("ContainerCreating"),
+		withOwner("ReplicaSet", "web-5d4f8"))
+	event := &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "web-1.mount", Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-1", UID: "web-1-uid"},
+		Reason:         "FailedMount",
+		Message:        `MountVolume.SetUp failed for volume "config" : configmap "web-config" not found`,
+		LastTimestamp:  metav1.NewTime(testNow.Add(-time.Minute)),
+	}
+	healer, clientset, _ := newTestHealer(t, Config{}, append(testDeployment("web"), pod, event)...)
+
+	if result := healOnce(t, healer, pod); result != "skipped" {
+		t.Fatalf("pod with missing configmap: result %q, want skipped", result)
+	}
+	// Пока ConfigMap нет, повторная проверка ничего не делает
+	healer.recheckMissingMounts(context.Background())
+	if !podExists(t, clientset, pod) {
+		t.Fatalf("pod deleted while configmap is still missing")
+	}
+
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "web-config", Namespace: "default"}}
+	if _, err := clientset.CoreV1().ConfigMaps("default").Create(context.Background(), configMap, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	healer.recheckMissingMounts(context.Background())
+	if podExists(t, clientset, pod) {
+		t.Errorf("pod was not restarted after the configmap appeared")
+	}
+	if dependencies := healer.mountWaiters.dependencies(); len(dependencies) != 0 {
+		t.Errorf("resolved dependencies are still tracked: %v", dependencies)
+	}
+}
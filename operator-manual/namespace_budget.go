@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// NamespaceBudget ограничивает число heal'ов в одном namespace за окно,
+// чтобы один шумный tenant не расходовал весь глобальный лимит кластера.
+// Heals 0 отключает ограничение.
+type NamespaceBudget struct {
+	Heals  int
+	Window time.Duration
+}
+
+// namespaceBudgets хранит время heal'ов по namespaces
+type namespaceBudgets struct {
+	mu    sync.Mutex
+	heals map[string][]time.Time
+}
+
+func newNamespaceBudgets() *namespaceBudgets {
+	return &namespaceBudgets{heals: make(map[string][]time.Time)}
+}
+
+// available проверяет, остался ли у namespace бюджет heal'ов
+func (b *namespaceBudgets) available(namespace string, now time.Time, budget NamespaceBudget) bool {
+	if budget.Heals <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	recent := recentAttempts(b.heals[namespace], now, budget.Window)
+	if len(recent) == 0 {
+		delete(b.heals, namespace)
+	} else {
+		b.heals[namespace] = recent
+	}
+	return len(recent) < budget.Heals
+}
+
+// spend учитывает heal в бюджете namespace
+func (b *namespaceBudgets) spend(namespace string, now time.Time, budget NamespaceBudget) {
+	if budget.Heals <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.heals[namespace] = append(b.heals[namespace], now)
+}
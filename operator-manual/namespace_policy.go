@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	annotationMode = "healing.kubernetes.io/mode"
+	// labelEnabled включает healing namespace'а в режиме --namespace-opt-in
+	labelEnabled = "healing.kubernetes.io/enabled"
+)
+
+// HealingMode определяет поведение healer'а для всех Pod'ов namespace
+type HealingMode string
+
+const (
+	// ModeNormal - поведение по умолчанию
+	ModeNormal HealingMode = "normal"
+	// ModeObserve - dry-run: зависшие Pod'ы только логируются
+	ModeObserve HealingMode = "observe"
+	// ModeAggressive - пороги обнаружения уменьшаются вдвое
+	ModeAggressive HealingMode = "aggressive"
+	// ModeDisabled - healing в namespace выключен
+	ModeDisabled HealingMode = "disabled"
+)
+
+func parseHealingMode(value string) (HealingMode, bool) {
+	switch mode := HealingMode(value); mode {
+	case ModeNormal, ModeObserve, ModeAggressive, ModeDisabled:
+		return mode, true
+	}
+	return "", false
+}
+
+// namespaceMode читает режим из аннотаций или labels namespace.
+// Аннотация имеет приоритет над label.
+func (h *PodHealer) namespaceMode(namespace string) HealingMode {
+	if h.namespaces == nil {
+		return ModeNormal
+	}
+
+	obj, exists, err := h.namespaces.GetByKey(namespace)
+	if err != nil || !exists {
+		return ModeNormal
+	}
+	ns := obj.(*corev1.Namespace)
+
+	for _, source := range []map[string]string{ns.Annotations, ns.Labels} {
+		value, exists := source[annotationMode]
+		if !exists {
+			continue
+		}
+		if mode, ok := parseHealingMode(value); ok {
+			return mode
+		}
+		klog.InfoS("Invalid namespace healing mode, using default", "namespace", namespace,
+			"annotation", annotationMode, "value", value, "default", ModeNormal)
+		return ModeNormal
+	}
+
+	return ModeNormal
+}
+
+// namespaceOptedIn проверяет label healing.kubernetes.io/enabled=true на namespace.
+// Namespace, который не удалось прочитать, считается не включенным.
+func (h *PodHealer) namespaceOptedIn(namespace string) bool {
+	if h.namespaces == nil {
+		return false
+	}
+	obj, exists, err := h.namespaces.GetByKey(namespace)
+	if err != nil || !exists {
+		return false
+	}
+	return obj.(*corev1.Namespace).Labels[labelEnabled] == "true"
+}
+
+// thresholdsForMode возвращает глобальные пороги с учетом режима namespace
+func thresholdsForMode(mode HealingMode, global Thresholds) Thresholds {
+	t := global
+	if mode == ModeAggressive {
+		t.PendingTimeout /= 2
+		t.MaxRestarts = (t.MaxRestarts + 1) / 2
+		t.NotReadyTimeout /= 2
+		t.ScaleUpPendingTimeout /= 2
+		t.LivenessFailures = (t.LivenessFailures + 1) / 2
+		t.ContainerCreatingTimeout /= 2
+	}
+	return t
+}
+
+// validateNamespacePolicy проверяет аннотации и labels healing на namespace
+func validateNamespacePolicy(ns *corev1.Namespace) []error {
+	var errs []error
+	for _, source := range []map[string]string{ns.Annotations, ns.Labels} {
+		if value, exists := source[annotationMode]; exists {
+			if _, ok := parseHealingMode(value); !ok {
+				errs = append(errs, fmt.Errorf("namespace %s: invalid %s %q, expected normal, observe, aggressive or disabled",
+					ns.Name, annotationMode, value))
+			}
+		}
+	}
+	if value, exists := ns.Annotations[annotationMaintenanceWindows]; exists {
+		if _, err := parseSchedules(value); err != nil {
+			errs = append(errs, fmt.Errorf("namespace %s: invalid %s: %v", ns.Name, annotationMaintenanceWindows, err))
+		}
+	}
+	if value, exists := ns.Annotations[annotationReasonActions]; exists {
+		if _, err := parseReasonActions(value); err != nil {
+			errs = append(errs, fmt.Errorf("namespace %s: invalid %s: %v", ns.Name, annotationReasonActions, err))
+		}
+	}
+	if value, exists := ns.Annotations[annotationPausedUntil]; exists {
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			errs = append(errs, fmt.Errorf("namespace %s: invalid %s %q: %v", ns.Name, annotationPausedUntil, value, err))
+		}
+	}
+
+	// Значения по умолчанию для Pod'ов проверяются так же, как аннотации на самих Pod'ах
+	for key, value := range ns.Annotations {
+		if !strings.HasPrefix(key, podDefaultsPrefix) {
+			continue
+		}
+		podKey := "healing.kubernetes.io/" + strings.TrimPrefix(key, podDefaultsPrefix)
+		switch podKey {
+		case annotationPendingTimeout, annotationNotReadyTimeout, annotationScaleUpTimeout,
+			annotationLivenessWindow, annotationCreatingTimeout, annotationTerminatingTimeout:
+			if _, err := time.ParseDuration(value); err != nil {
+				errs = append(errs, fmt.Errorf("namespace %s: invalid %s %q: %v", ns.Name, key, value, err))
+			}
+		case annotationDeleteGracePeriod:
+			if d, err := time.ParseDuration(value); err != nil || d < 0 {
+				errs = append(errs, fmt.Errorf("namespace %s: invalid %s %q, expected a non-negative duration", ns.Name, key, value))
+			}
+		case annotationDeletePropagation:
+			if _, err := parsePropagationPolicy(value); err != nil {
+				errs = append(errs, fmt.Errorf("namespace %s: invalid %s: %v", ns.Name, key, err))
+			}
+		case annotationMaxRestarts, annotationLivenessFailures:
+			if _, err := strconv.ParseInt(value, 10, 32); err != nil {
+				errs = append(errs, fmt.Errorf("namespace %s: invalid %s %q: %v", ns.Name, key, value, err))
+			}
+		}
+	}
+	return errs
+}
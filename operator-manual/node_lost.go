@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ReasonNodeLost    StuckReason   = "NodeLost"
+	ActionForceDelete HealingAction = "force-delete"
+)
+
+// nodeLostDetector - Pod на недоступной ноде: kubelet не подтвердит его удаление,
+// и StatefulSet не создаст замену с тем же именем, пока Pod не удален принудительно
+type nodeLostDetector struct{}
+
+func (nodeLostDetector) Reason() StuckReason { return ReasonNodeLost }
+
+func (nodeLostDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	detail := ""
+	switch {
+	case pod.Status.Reason == "NodeLost":
+		detail = "node lost"
+	case pod.Status.Phase == corev1.PodUnknown:
+		detail = "phase Unknown"
+	case pod.DeletionTimestamp != nil && evictedByTaintManager(pod):
+		detail = "evicted from unreachable node"
+	default:
+		return nil
+	}
+
+	since := pod.CreationTimestamp.Time
+	if pod.DeletionTimestamp != nil {
+		since = pod.DeletionTimestamp.Time
+	} else {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status != corev1.ConditionTrue {
+				since = condition.LastTransitionTime.Time
+			}
+		}
+	}
+	lost := now.Sub(since)
+	if lost <= thresholds.NodeLostTimeout {
+		return nil
+	}
+	return &stuckCondition{
+		Reason: ReasonNodeLost,
+		Detail: fmt.Sprintf("%s on node %s for %v", detail, pod.Spec.NodeName, lost.Round(time.Second)),
+		Since:  since,
+	}
+}
+
+// evictedByTaintManager - Pod удален node lifecycle controller'ом из-за taint'а недоступной ноды
+func evictedByTaintManager(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.DisruptionTarget && condition.Status == corev1.ConditionTrue &&
+			condition.Reason == "DeletionByTaintManager" {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeLostDecision решает, можно ли принудительно удалить Pod с потерянной ноды.
+// Принудительное удаление безопасно, только если нода действительно не работает:
+// иначе у StatefulSet окажутся два Pod'а с одной identity.
+func (h *PodHealer) nodeLostDecision(ctx context.Context, decision *healingDecision) *healingDecision {
+	skip := func(message string, warn bool) *healingDecision {
+		decision.Action, decision.Message, decision.Warn = ActionSkip, message, warn
+		return decision
+	}
+
+	if !h.config.ForceDeleteLostPods {
+		return skip("force deletion of pods on lost nodes is disabled", false)
+	}
+	pod := decision.Pod
+	if pod.Spec.NodeName == "" {
+		return skip("pod is not bound to a node", false)
+	}
+	node, err := h.clientset.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		decision.Message = fmt.Sprintf("node %s no longer exists", pod.Spec.NodeName)
+	case err != nil:
+		klog.ErrorS(err, "Failed to get pod node", "cluster", h.cluster, "node", pod.Spec.NodeName)
+		return skip("failed to check node readiness", false)
+	case isNodeReady(node):
+		return skip(fmt.Sprintf("node %s is ready again, kubelet will finish the pod", node.Name), false)
+	default:
+		decision.Message = fmt.Sprintf("node %s is not ready", node.Name)
+	}
+	decision.Action = ActionForceDelete
+	return decision
+}
+
+func isNodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// forceDeleteRemediator удаляет Pod без ожидания подтверждения от kubelet'а
+type forceDeleteRemediator struct{ h *PodHealer }
+
+func (forceDeleteRemediator) Action() HealingAction { return ActionForceDelete }
+
+func (r forceDeleteRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	pod := decision.Pod
+	gracePeriod := int64(0)
+	err := r.h.clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		Preconditions:      &metav1.Preconditions{UID: &pod.UID},
+	})
+	if err != nil {
+		return err
+	}
+
+	klog.InfoS("Force deleted pod from lost node", "cluster", r.h.cluster,
+		"namespace", pod.Namespace, "pod", pod.Name, "node", pod.Spec.NodeName)
+	decisionEventf(r.h.recorder, pod, decision, corev1.EventTypeWarning, "ForceDeleted",
+		"Force deleted pod so its replacement can be scheduled: %s (%s)", decision.Detail, decision.Message)
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+const ReasonNodePreemption StuckReason = "NodePreemption"
+
+// Таинты, которыми cluster-autoscaler и обработчики уведомлений облаков
+// помечают ноду незадолго до ее удаления
+var defaultPreemptionTaints = []string{
+	"ToBeDeletedByClusterAutoscaler",
+	"aws-node-termination-handler/spot-itn",
+	"aws-node-termination-handler/asg-lifecycle-termination",
+	"cloud.google.com/impending-node-termination",
+	"node.kubernetes.io/out-of-service",
+}
+
+// NodePreemptionConfig - упреждающее выселение Pod'ов с нод, которые вот-вот будут
+// удалены: spot-инстансы, получившие уведомление о прерывании, и ноды, выбранные
+// autoscaler'ом на удаление. После уведомления у Pod'ов остаются секунды или минуты,
+// и выселение через Eviction API дает им завершиться штатно, а не быть убитыми с нодой.
+type NodePreemptionConfig struct {
+	Enabled bool
+	// Taints - ключи таинтов, означающих скорое удаление ноды
+	Taints []string
+	// Conditions - условия ноды, означающие то же, например от node-problem-detector
+	Conditions []corev1.NodeConditionType
+	// Interval - как часто проверяются ноды
+	Interval time.Duration
+}
+
+// nodePreemption описывает уведомление о скором удалении ноды или возвращает пустую строку.
+// since - момент уведомления, если он известен.
+func nodePreemption(node *corev1.Node, config NodePreemptionConfig) (detail string, since time.Time) {
+	for _, taint := range node.Spec.Taints {
+		for _, key := range config.Taints {
+			if taint.Key != key {
+				continue
+			}
+			if taint.TimeAdded != nil {
+				since = taint.TimeAdded.Time
+			}
+			return fmt.Sprintf("node %s is tainted with %s", node.Name, taint.Key), since
+		}
+	}
+	for _, condition := range node.Status.Conditions {
+		for _, conditionType := range config.Conditions {
+			if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+				return fmt.Sprintf("node %s has %s", node.Name, condition.Type), condition.LastTransitionTime.Time
+			}
+		}
+	}
+	return "", since
+}
+
+// evacuatePreemptedNodes выселяет Pod'ы с нод, получивших уведомление о прерывании.
+// В отличие от давления на ноду, уходят все Pod'ы, включая Guaranteed: нода исчезнет целиком.
+// Выселения проходят через те же политики, rate limiter, бюджеты namespaces и
+// PodDisruptionBudget'ы; отложенные повторяются на следующем проходе, пока нода жива.
+func (h *PodHealer) evacuatePreemptedNodes(ctx context.Context) {
+	if h.nodes == nil {
+		return
+	}
+	for _, obj := range h.nodes.List() {
+		node := obj.(*corev1.Node)
+		if h.nodeSelectorEnabled() && !h.config.NodeSelector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		detail, since := nodePreemption(node, h.config.NodePreemption)
+		if detail == "" {
+			continue
+		}
+		if since.IsZero() {
+			since = h.clock.Now()
+		}
+
+		pods, err := h.runningNodePods(ctx, node.Name)
+		if err != nil {
+			klog.ErrorS(err, "Failed to list pods on preempted node", "cluster", h.cluster, "node", node.Name)
+			continue
+		}
+		for _, pod := range pods {
+			stuck := &stuckCondition{Reason: ReasonNodePreemption, Detail: detail, Since: since}
+			decision := h.nodeEvictionDecision(ctx, pod, stuck, "proactive eviction from a node about to be preempted")
+			if decision == nil {
+				continue
+			}
+			h.executeDecision(ctx, decision)
+		}
+	}
+}
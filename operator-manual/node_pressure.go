@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+const ReasonNodePressure StuckReason = "NodePressure"
+
+// Условия ноды, при которых kubelet начинает выселять Pod'ы сам
+var pressureConditions = []corev1.NodeConditionType{
+	corev1.NodeMemoryPressure,
+	corev1.NodeDiskPressure,
+	corev1.NodePIDPressure,
+}
+
+// NodePressureConfig - упреждающее выселение Pod'ов с нод под давлением
+type NodePressureConfig struct {
+	Enabled bool
+	// MaxEvictionsPerNode - сколько Pod'ов выселяется с одной ноды за проход
+	MaxEvictionsPerNode int
+	// Interval - как часто проверяются ноды под давлением
+	Interval time.Duration
+}
+
+// nodePressure возвращает первое активное условие давления на ноде
+func nodePressure(node *corev1.Node) *corev1.NodeCondition {
+	for _, conditionType := range pressureConditions {
+		for i := range node.Status.Conditions {
+			condition := &node.Status.Conditions[i]
+			if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+				return condition
+			}
+		}
+	}
+	return nil
+}
+
+// relievePressuredNodes выселяет наименее важные Pod'ы с нод под давлением,
+// пока kubelet не начал жесткое выселение. Выселения проходят через те же
+// политики, rate limiter и бюджеты namespaces, что и обычный healing.
+// Отложенные лимитами выселения повторяются на следующем проходе, пока давление не спадет.
+func (h *PodHealer) relievePressuredNodes(ctx context.Context) {
+	if h.nodes == nil {
+		return
+	}
+	for _, obj := range h.nodes.List() {
+		node := obj.(*corev1.Node)
+		if h.nodeSelectorEnabled() && !h.config.NodeSelector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		condition := nodePressure(node)
+		if condition == nil {
+			continue
+		}
+
+		candidates, err := h.pressureCandidates(ctx, node.Name)
+		if err != nil {
+			klog.ErrorS(err, "Failed to list pods on pressured node", "cluster", h.cluster, "node", node.Name)
+			continue
+		}
+		evicted := 0
+		for _, pod := range candidates {
+			if evicted >= h.config.NodePressure.MaxEvictionsPerNode {
+				break
+			}
+			stuck := &stuckCondition{
+				Reason: ReasonNodePressure,
+				Detail: fmt.Sprintf("node %s has %s", node.Name, condition.Type),
+				Since:  condition.LastTransitionTime.Time,
+			}
+			decision := h.nodeEvictionDecision(ctx, pod, stuck, "proactive eviction from a node under pressure")
+			if decision == nil {
+				continue
+			}
+			if decision.Action == ActionEvict {
+				evicted++
+			}
+			h.executeDecision(ctx, decision)
+		}
+	}
+}
+
+// pressureCandidates возвращает Pod'ы ноды в порядке выселения kubelet'ом:
+// сначала BestEffort, затем Burstable, внутри класса - по возрастанию приоритета.
+// Guaranteed Pod'ы упреждающе не выселяются.
+func (h *PodHealer) pressureCandidates(ctx context.Context, nodeName string) ([]*corev1.Pod, error) {
+	pods, err := h.runningNodePods(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	qosOrder := map[corev1.PodQOSClass]int{corev1.PodQOSBestEffort: 0, corev1.PodQOSBurstable: 1}
+	var candidates []*corev1.Pod
+	for _, pod := range pods {
+		if _, evictable := qosOrder[pod.Status.QOSClass]; !evictable {
+			continue
+		}
+		candidates = append(candidates, pod)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		qi, qj := qosOrder[candidates[i].Status.QOSClass], qosOrder[candidates[j].Status.QOSClass]
+		if qi != qj {
+			return qi < qj
+		}
+		return podPriority(candidates[i]) < podPriority(candidates[j])
+	})
+	return candidates, nil
+}
+
+// runningNodePods возвращает работающие и не удаляемые Pod'ы ноды
+func (h *PodHealer) runningNodePods(ctx context.Context, nodeName string) ([]*corev1.Pod, error) {
+	list, err := h.clientset.CoreV1().Pods(corev1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var pods []*corev1.Pod
+	for i := range list.Items {
+		pod := &list.Items[i]
+		if pod.Spec.NodeName != nodeName || pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// nodeEvictionDecision применяет политики healing к здоровому Pod'у, который нужно
+// увести с проблемной ноды. Возвращает nil для Pod'ов, исключенных из healing.
+func (h *PodHealer) nodeEvictionDecision(ctx context.Context, pod *corev1.Pod, stuck *stuckCondition,
+	message string) *healingDecision {
+	mode, eligible := h.podMode(pod)
+	if !eligible {
+		return nil
+	}
+	// Pod без владельца после выселения никто не пересоздаст,
+	// а Pod DaemonSet вернется на ту же ноду
+	if isUnowned(pod) {
+		return nil
+	}
+	if ref := metav1.GetControllerOf(pod); ref != nil && ref.Kind == "DaemonSet" {
+		return nil
+	}
+
+	thresholds := thresholdsForPod(pod, thresholdsForMode(mode, h.thresholdsAt(h.clock.Now())))
+	decision := h.decide(ctx, pod, stuck, mode, thresholds, h.clock.Now())
+	switch decision.Action {
+	case ActionSkip, ActionObserve:
+	default:
+		// Pod здоров, проблема в ноде: эскалация владельца или его перезапуск не помогут,
+		// а Eviction API соблюдает PodDisruptionBudget
+		decision.Action, decision.Message = ActionEvict, message
+	}
+	return decision
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// headerHealToken передает токен on-demand heal'а. Authorization не подходит:
+// kube-apiserver убирает его из запросов, проксируемых к Pod'у (kubectl heal).
+const headerHealToken = "X-Healer-Token"
+
+// OnDemandHealRequest - тело POST /api/v1/heal
+type OnDemandHealRequest struct {
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	// Requester - кто запросил heal, попадает в журнал решений
+	Requester string `json:"requester,omitempty"`
+}
+
+// OnDemandHealResult - что healer сделал с Pod'ом по запросу
+type OnDemandHealResult struct {
+	Cluster   string        `json:"cluster"`
+	Namespace string        `json:"namespace"`
+	Pod       string        `json:"pod"`
+	Action    HealingAction `json:"action,omitempty"`
+	Message   string        `json:"message,omitempty"`
+}
+
+// onDemandHealHandler лечит Pod по запросу оператора кластера (kubectl heal pod).
+// Без token обработчик отклоняет все запросы.
+type onDemandHealHandler struct {
+	healers []*PodHealer
+	token   string
+}
+
+func newOnDemandHealHandler(healers []*PodHealer, token string) http.Handler {
+	return &onDemandHealHandler{healers: healers, token: token}
+}
+
+func (o *onDemandHealHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if o.token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get(headerHealToken)), []byte(o.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	request := &OnDemandHealRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid heal request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if request.Namespace == "" || request.Pod == "" {
+		http.Error(w, "namespace and pod are required", http.StatusBadRequest)
+		return
+	}
+
+	healer := findHealer(o.healers, request.Cluster)
+	if healer == nil {
+		http.Error(w, "unknown cluster", http.StatusNotFound)
+		return
+	}
+	pod, err := healer.clientset.CoreV1().Pods(request.Namespace).Get(r.Context(), request.Pod, metav1.GetOptions{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	result := OnDemandHealResult{Cluster: healer.cluster, Namespace: pod.Namespace, Pod: pod.Name}
+	if decision := healer.healOnDemand(r.Context(), pod, request.Requester); decision == nil {
+		result.Message = "pod is excluded from healing"
+	} else {
+		result.Action, result.Message = decision.Action, decision.Message
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		klog.ErrorS(err, "Failed to write heal response")
+	}
+}
+
+// healOnDemand считает Pod зависшим по запросу и, как healFromAlert, проводит его
+// через политики, rate limit и журнал решений: запрос не обходит защиту workload'ов
+func (h *PodHealer) healOnDemand(ctx context.Context, pod *corev1.Pod, requester string) *healingDecision {
+	mode, eligible := h.podMode(pod)
+	if !eligible {
+		return nil
+	}
+
+	if requester == "" {
+		requester = "unknown"
+	}
+	now := h.clock.Now()
+	stuck := &stuckCondition{Reason: ReasonOnDemand, Detail: "heal requested by " + requester, Since: now}
+	thresholds := thresholdsForPod(pod, thresholdsForMode(mode, h.thresholdsAt(now)))
+
+	decision := h.decide(ctx, pod, stuck, mode, thresholds, now)
+	klog.InfoS("Healing requested on demand", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name,
+		"requester", requester, "action", decision.Action)
+	h.executeDecision(ctx, decision)
+	return decision
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOnDemandHeal(t *testing.T) {
+	pod := testPod("web-1", time.Hour, withOwner("ReplicaSet", "web-5d4f8"))
+	paused := testPod("batch-1", time.Hour)
+	paused.Namespace = "batch"
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "batch",
+		Annotations: map[string]string{annotationPausedUntil: testNow.Add(time.Hour).Format(time.RFC3339)}}}
+	healer, clientset, _ := newTestHealer(t, Config{}, append(testDeployment("web"), pod, paused, namespace)...)
+	if err := healer.loadNamespaces(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	handler := newOnDemandHealHandler([]*PodHealer{healer}, "secret")
+
+	heal := func(target *corev1.Pod, token string) (int, OnDemandHealResult) {
+		body, _ := json.Marshal(OnDemandHealRequest{Namespace: target.Namespace, Pod: target.Name, Requester: "alice"})
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/heal", bytes.NewReader(body))
+		request.Header.Set(headerHealToken, token)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		result := OnDemandHealResult{}
+		if recorder.Code == http.StatusOK {
+			if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return recorder.Code, result
+	}
+
+	if code, _ := heal(pod, "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("expected request with a wrong token to be rejected, got %d", code)
+	}
+	if code, _ := heal(pod, ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected request without a token to be rejected, got %d", code)
+	}
+	// Пауза namespace'а действует и на запросы: healer только наблюдает
+	if _, result := heal(paused, "secret"); result.Action != ActionObserve || !podExists(t, clientset, paused) {
+		t.Fatalf("expected paused namespace to be observed, got %+v", result)
+	}
+	if _, result := heal(pod, "secret"); result.Action != ActionDelete || podExists(t, clientset, pod) {
+		t.Fatalf("expected pod to be healed on demand, got %+v", result)
+	}
+	decisions := healer.state.recentDecisions()
+	if last := decisions[len(decisions)-1]; last.Code != CodeOnDemand || last.Detail != "heal requested by alice" {
+		t.Errorf("unexpected decision record %+v", last)
+	}
+}
+
+func TestOnDemandHealRequiresToken(t *testing.T) {
+	pod := testPod("web-1", time.Hour, withOwner("ReplicaSet", "web-5d4f8"))
+	healer, clientset, _ := newTestHealer(t, Config{}, append(testDeployment("web"), pod)...)
+	handler := newOnDemandHealHandler([]*PodHealer{healer}, "")
+
+	body, _ := json.Marshal(OnDemandHealRequest{Namespace: pod.Namespace, Pod: pod.Name})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/heal", bytes.NewReader(body)))
+	if recorder.Code != http.StatusUnauthorized || !podExists(t, clientset, pod) {
+		t.Fatalf("handler without a token must reject requests, got %d", recorder.Code)
+	}
+}
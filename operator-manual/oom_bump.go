@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ActionOOMBump HealingAction = "oom-memory-bump"
+
+	// На владельце остается описание последнего увеличения памяти
+	annotationOOMBump = "healing.kubernetes.io/oom-memory-bump"
+)
+
+// OOMBumpConfig - увеличение памяти контейнеров владельцев, чьи Pod'ы раз за разом
+// убиваются за превышение limit'а. Пересоздание Pod'а этот цикл не прерывает.
+type OOMBumpConfig struct {
+	// Percent - на сколько процентов увеличиваются limits и requests памяти, 0 отключает увеличение
+	Percent int
+	// MaxMemory - предел, до которого увеличивается память контейнера
+	MaxMemory resource.Quantity
+	// Threshold - число OOMKilled владельца за Window, после которого увеличивается память
+	Threshold int
+	Window    time.Duration
+}
+
+// oomTracker считает OOMKilled контейнеров по владельцам. Каждое завершение
+// учитывается один раз по ID контейнера, который kubelet меняет при рестарте.
+type oomTracker struct {
+	mu    sync.Mutex
+	kills map[string][]time.Time
+	seen  map[types.UID]map[string]bool
+}
+
+func newOOMTracker() *oomTracker {
+	return &oomTracker{kills: make(map[string][]time.Time), seen: make(map[types.UID]map[string]bool)}
+}
+
+// oomKilledContainers возвращает имена контейнеров Pod'а, последнее завершение которых - OOMKilled
+func oomKilledContainers(pod *corev1.Pod) map[string]*corev1.ContainerStateTerminated {
+	killed := make(map[string]*corev1.ContainerStateTerminated)
+	for _, status := range podContainerStatuses(pod) {
+		terminated := status.State.Terminated
+		if terminated == nil {
+			terminated = status.LastTerminationState.Terminated
+		}
+		if !status.Init && terminated != nil && terminated.Reason == "OOMKilled" {
+			killed[status.Name] = terminated
+		}
+	}
+	return killed
+}
+
+func (t *oomTracker) observe(pod *corev1.Pod, now time.Time) {
+	key := flapOwnerKey(pod)
+	if key == "" {
+		return
+	}
+	killed := oomKilledContainers(pod)
+	if len(killed) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.seen[pod.UID] == nil {
+		t.seen[pod.UID] = make(map[string]bool)
+	}
+	for name, terminated := range killed {
+		id := name + "/" + terminated.ContainerID + "/" + terminated.FinishedAt.String()
+		if t.seen[pod.UID][id] {
+			continue
+		}
+		t.seen[pod.UID][id] = true
+		t.kills[key] = append(t.kills[key], now)
+	}
+}
+
+func (t *oomTracker) forget(uid types.UID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.seen, uid)
+}
+
+func (t *oomTracker) count(owner *workloadOwner, now time.Time, window time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := owner.String()
+	t.kills[key] = recentAttempts(t.kills[key], now, window)
+	return len(t.kills[key])
+}
+
+// raiseMemory увеличивает quantity на percent процентов с округлением вверх до Mi, но не больше max
+func raiseMemory(quantity resource.Quantity, percent int, max resource.Quantity) resource.Quantity {
+	const mi = 1 << 20
+	value := quantity.Value() + quantity.Value()*int64(percent)/100
+	raised := *resource.NewQuantity((value+mi-1)/mi*mi, resource.BinarySI)
+	if raised.Cmp(max) > 0 {
+		return max.DeepCopy()
+	}
+	return raised
+}
+
+// oomMemoryBump вычисляет новые limits и requests памяти убитых контейнеров шаблона.
+// Контейнеры без limit'а и request'а памяти и уже достигшие max не меняются.
+func oomMemoryBump(template *corev1.PodTemplateSpec, killed map[string]*corev1.ContainerStateTerminated,
+	percent int, max resource.Quantity) (map[string]corev1.ResourceRequirements, []string) {
+	resources := make(map[string]corev1.ResourceRequirements)
+	var changes []string
+	for _, container := range template.Spec.Containers {
+		if _, ok := killed[container.Name]; !ok {
+			continue
+		}
+		requirements := corev1.ResourceRequirements{}
+		var change []string
+		limit, hasLimit := container.Resources.Limits[corev1.ResourceMemory]
+		if hasLimit {
+			if raised := raiseMemory(limit, percent, max); raised.Cmp(limit) > 0 {
+				requirements.Limits = corev1.ResourceList{corev1.ResourceMemory: raised}
+				change = append(change, fmt.Sprintf("limit %s -> %s", limit.String(), raised.String()))
+				limit = raised
+			}
+		}
+		if request, ok := container.Resources.Requests[corev1.ResourceMemory]; ok {
+			ceiling := max
+			if hasLimit {
+				ceiling = limit
+			}
+			if raised := raiseMemory(request, percent, ceiling); raised.Cmp(request) > 0 {
+				requirements.Requests = corev1.ResourceList{corev1.ResourceMemory: raised}
+				change = append(change, fmt.Sprintf("request %s -> %s", request.String(), raised.String()))
+			}
+		}
+		if len(change) > 0 {
+			resources[container.Name] = requirements
+			changes = append(changes, fmt.Sprintf("%s memory %s", container.Name, strings.Join(change, ", ")))
+		}
+	}
+	sort.Strings(changes)
+	return resources, changes
+}
+
+// oomBumpDue проверяет, убиваются ли Pod'ы владельца за память по кругу и можно ли ее увеличить.
+// Если все убитые контейнеры достигли --oom-bump-max-memory, Pod идет обычным путем до эскалации.
+func (h *PodHealer) oomBumpDue(pod *corev1.Pod, owner *workloadOwner, code ReasonCode, now time.Time) (bool, string) {
+	config := h.config.OOMBump
+	if config.Percent <= 0 || code != CodeOOM {
+		return false, ""
+	}
+	kills := h.ooms.count(owner, now, config.Window)
+	if kills < config.Threshold {
+		return false, ""
+	}
+	template := ownerPodTemplate(owner)
+	if template == nil {
+		return false, ""
+	}
+	if _, changes := oomMemoryBump(template, oomKilledContainers(pod), config.Percent, config.MaxMemory); len(changes) > 0 {
+		return true, fmt.Sprintf("%d OOM kills within %v, raising %s", kills, config.Window, strings.Join(changes, "; "))
+	}
+	return false, ""
+}
+
+// oomBumpRemediator увеличивает память убитых контейнеров в шаблоне владельца
+// и убирает Pod, чтобы он был пересоздан с новыми limits
+type oomBumpRemediator struct{ h *PodHealer }
+
+func (oomBumpRemediator) Action() HealingAction { return ActionOOMBump }
+
+func (r oomBumpRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	owner, pod := decision.Owner, decision.Pod
+	template := ownerPodTemplate(owner)
+	if owner == nil || template == nil {
+		return fmt.Errorf("raising memory requires a Deployment, StatefulSet or DaemonSet owner")
+	}
+	config := r.h.config.OOMBump
+	resources, changes := oomMemoryBump(template, oomKilledContainers(pod), config.Percent, config.MaxMemory)
+	if len(resources) == 0 {
+		return fmt.Errorf("memory of OOMKilled containers of %s is already at %s", owner, config.MaxMemory.String())
+	}
+	if err := r.h.patchContainerResources(ctx, owner, resources); err != nil {
+		return err
+	}
+	if err := r.h.patchOwnerAnnotations(ctx, owner, map[string]string{
+		annotationOOMBump: r.h.clock.Now().UTC().Format(time.RFC3339) + ": " + strings.Join(changes, "; "),
+	}); err != nil {
+		return err
+	}
+
+	klog.InfoS("Raised memory of repeatedly OOMKilled containers", "cluster", r.h.cluster,
+		"owner", owner.String(), "changes", strings.Join(changes, "; "))
+	if obj, ok := owner.Object.(runtime.Object); ok {
+		decisionEventf(r.h.recorder, obj, decision, corev1.EventTypeWarning, "MemoryRaised",
+			"Containers of pod %s were repeatedly OOMKilled, raised %s", pod.Name, strings.Join(changes, "; "))
+	}
+	return r.h.healPod(ctx, pod)
+}
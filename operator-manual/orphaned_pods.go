@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ReasonNodeDeleted StuckReason = "NodeDeleted"
+
+	// Как часто ищутся Pod'ы удаленных нод
+	orphanedPodSweepInterval = time.Minute
+)
+
+// orphanTracker запоминает, когда Pod впервые оказался на несуществующей ноде.
+// Момент удаления ноды неизвестен, поэтому grace period отсчитывается от него.
+type orphanTracker struct {
+	mu    sync.Mutex
+	since map[types.UID]time.Time
+}
+
+func newOrphanTracker() *orphanTracker {
+	return &orphanTracker{since: make(map[types.UID]time.Time)}
+}
+
+// observe возвращает момент обнаружения и признак, что Pod обнаружен впервые
+func (t *orphanTracker) observe(uid types.UID, now time.Time) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if since, exists := t.since[uid]; exists {
+		return since, false
+	}
+	t.since[uid] = now
+	return now, true
+}
+
+func (t *orphanTracker) forget(uid types.UID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.since, uid)
+}
+
+// retain забывает Pod'ы, которые больше не осиротевшие: нода вернулась или Pod удален
+func (t *orphanTracker) retain(orphaned map[types.UID]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for uid := range t.since {
+		if !orphaned[uid] {
+			delete(t.since, uid)
+		}
+	}
+}
+
+// cleanupOrphanedPods удаляет Pod'ы, привязанные к нодам, которых больше нет:
+// kubelet'а, который завершил бы их, нет, и планировщик их тоже не тронет
+func (h *PodHealer) cleanupOrphanedPods(ctx context.Context) {
+	nodes, err := h.nodeNames(ctx)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list nodes", "cluster", h.cluster)
+		return
+	}
+	// Пустой список - скорее несинхронизированный кэш, чем кластер без нод
+	if len(nodes) == 0 {
+		return
+	}
+	pods, err := h.listWatchedPods(ctx)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list pods", "cluster", h.cluster)
+		return
+	}
+
+	now := h.clock.Now()
+	orphaned := make(map[types.UID]bool)
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Spec.NodeName == "" || nodes[pod.Spec.NodeName] {
+			continue
+		}
+		orphaned[pod.UID] = true
+		since, first := h.orphans.observe(pod.UID, now)
+		if first {
+			h.recorder.Eventf(pod, corev1.EventTypeWarning, "NodeDeleted",
+				"Node %s no longer exists, the pod will be deleted in %v", pod.Spec.NodeName, h.config.OrphanedPodGracePeriod)
+		}
+		if now.Sub(since) < h.config.OrphanedPodGracePeriod {
+			continue
+		}
+		if decision := h.orphanDecision(ctx, pod, since); decision != nil {
+			h.executeDecision(ctx, decision)
+		}
+	}
+	h.orphans.retain(orphaned)
+}
+
+func (h *PodHealer) nodeNames(ctx context.Context) (map[string]bool, error) {
+	names := make(map[string]bool)
+	if h.nodes != nil {
+		for _, name := range h.nodes.ListKeys() {
+			names[name] = true
+		}
+		return names, nil
+	}
+	list, err := h.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range list.Items {
+		names[node.Name] = true
+	}
+	return names, nil
+}
+
+// orphanDecision проводит Pod удаленной ноды через политики healing.
+// Возвращает nil для Pod'ов, исключенных из healing.
+func (h *PodHealer) orphanDecision(ctx context.Context, pod *corev1.Pod, since time.Time) *healingDecision {
+	mode, eligible := h.podMode(pod)
+	if !eligible {
+		return nil
+	}
+	now := h.clock.Now()
+	stuck := &stuckCondition{
+		Reason: ReasonNodeDeleted,
+		Detail: fmt.Sprintf("node %s no longer exists, noticed %v ago", pod.Spec.NodeName, now.Sub(since).Round(time.Second)),
+		Since:  since,
+	}
+	thresholds := thresholdsForPod(pod, thresholdsForMode(mode, h.thresholdsAt(now)))
+	return h.decide(ctx, pod, stuck, mode, thresholds, now)
+}
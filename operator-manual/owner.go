@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const annotationLastHealed = "healing.kubernetes.io/last-healed"
+
+// workloadOwner - контроллер верхнего уровня, управляющий Pod'ом
+// (для Pod'ов Deployment это сам Deployment, а не ReplicaSet)
+type workloadOwner struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Object    metav1.Object
+}
+
+func (o *workloadOwner) String() string {
+	return fmt.Sprintf("%s %s/%s", o.Kind, o.Namespace, o.Name)
+}
+
+// getOwner возвращает владельца Pod'а или nil, если у Pod'а нет контроллера
+func (h *PodHealer) getOwner(ctx context.Context, pod *corev1.Pod) (*workloadOwner, error) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil, nil
+	}
+
+	obj, err := h.getOwnerObject(ctx, pod.Namespace, ref.Kind, ref.Name)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+
+	// ReplicaSet под управлением Deployment: поднимаемся на уровень выше
+	if ref.Kind == "ReplicaSet" {
+		if rsRef := metav1.GetControllerOf(obj); rsRef != nil && rsRef.Kind == "Deployment" {
+			deployment, err := h.getOwnerObject(ctx, pod.Namespace, rsRef.Kind, rsRef.Name)
+			if err != nil {
+				return nil, err
+			}
+			if deployment != nil {
+				return &workloadOwner{Kind: rsRef.Kind, Namespace: pod.Namespace, Name: rsRef.Name, Object: deployment}, nil
+			}
+		}
+	}
+
+	return &workloadOwner{Kind: ref.Kind, Namespace: pod.Namespace, Name: ref.Name, Object: obj}, nil
+}
+
+func (h *PodHealer) getOwnerObject(ctx context.Context, namespace, kind, name string) (metav1.Object, error) {
+	switch kind {
+	case "Deployment":
+		return h.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "ReplicaSet":
+		return h.clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "StatefulSet":
+		return h.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "DaemonSet":
+		return h.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "Job":
+		return h.clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+	// Неизвестные контроллеры (CRD) не поддерживаются
+	return nil, nil
+}
+
+// patchOwnerAnnotations выставляет аннотации на владельце через merge patch
+func (h *PodHealer) patchOwnerAnnotations(ctx context.Context, owner *workloadOwner, annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	return h.patchOwner(ctx, owner, patch)
+}
+
+// patchOwner применяет merge patch к владельцу
+func (h *PodHealer) patchOwner(ctx context.Context, owner *workloadOwner, patch []byte) error {
+	var err error
+	opts := metav1.PatchOptions{}
+	switch owner.Kind {
+	case "Deployment":
+		_, err = h.clientset.AppsV1().Deployments(owner.Namespace).Patch(ctx, owner.Name, types.MergePatchType, patch, opts)
+	case "ReplicaSet":
+		_, err = h.clientset.AppsV1().ReplicaSets(owner.Namespace).Patch(ctx, owner.Name, types.MergePatchType, patch, opts)
+	case "StatefulSet":
+		_, err = h.clientset.AppsV1().StatefulSets(owner.Namespace).Patch(ctx, owner.Name, types.MergePatchType, patch, opts)
+	case "DaemonSet":
+		_, err = h.clientset.AppsV1().DaemonSets(owner.Namespace).Patch(ctx, owner.Name, types.MergePatchType, patch, opts)
+	case "Job":
+		_, err = h.clientset.BatchV1().Jobs(owner.Namespace).Patch(ctx, owner.Name, types.MergePatchType, patch, opts)
+	default:
+		err = fmt.Errorf("unsupported owner kind %s", owner.Kind)
+	}
+	return err
+}
+
+// ownerInCooldown проверяет аннотацию last-healed на владельце.
+// Аннотация переживает рестарт healer'а, в отличие от состояния в памяти.
+func (h *PodHealer) ownerInCooldown(owner *workloadOwner, now time.Time) bool {
+	value, exists := owner.Object.GetAnnotations()[annotationLastHealed]
+	if !exists {
+		return false
+	}
+	lastHealed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		klog.ErrorS(err, "Invalid owner annotation", "owner", owner.String(), "annotation", annotationLastHealed, "value", value)
+		return false
+	}
+	return now.Sub(lastHealed) < h.config.HealCooldown
+}
+
+func (h *PodHealer) markOwnerHealed(ctx context.Context, owner *workloadOwner, now time.Time) {
+	err := h.patchOwnerAnnotations(ctx, owner, map[string]string{
+		annotationLastHealed: now.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		klog.ErrorS(err, "Failed to annotate owner as healed", "owner", owner.String())
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// schedulingBlocker - причина, по которой Pod не может быть запланирован.
+// Пересоздание Pod'а такую причину не устраняет.
+type schedulingBlocker struct {
+	Reason  string
+	Message string
+}
+
+// Подстроки сообщений FailedScheduling и соответствующие им причины
+var schedulingBlockerPatterns = []struct {
+	substring string
+	reason    string
+}{
+	{"Insufficient cpu", "InsufficientCPU"},
+	{"Insufficient memory", "InsufficientMemory"},
+	{"Insufficient ", "InsufficientResources"},
+	{"unbound immediate PersistentVolumeClaims", "UnboundPVC"},
+	{"unbound PersistentVolumeClaims", "UnboundPVC"},
+	{"persistentvolumeclaim", "UnboundPVC"},
+	{"untolerated taint", "UntoleratedTaint"},
+	{"had taint", "UntoleratedTaint"},
+	{"didn't match Pod's node affinity", "NodeAffinity"},
+	{"didn't match node selector", "NodeAffinity"},
+}
+
+// pendingSkipReason решает, имеет ли смысл пересоздавать зависший Pending Pod.
+// Возвращает причину пропуска и нужно ли сообщить о ней событием, либо "".
+func (h *PodHealer) pendingSkipReason(ctx context.Context, pod *corev1.Pod, thresholds Thresholds) (string, bool) {
+	events, err := h.podEvents(ctx, pod)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get pod events", "namespace", pod.Namespace, "pod", pod.Name)
+		return "", false
+	}
+
+	// Cluster autoscaler уже заказал новую ноду - ждем дольше обычного
+	pendingDuration := h.clock.Since(pod.CreationTimestamp.Time)
+	if waitingForScaleUp(events) && pendingDuration < thresholds.ScaleUpPendingTimeout {
+		return fmt.Sprintf("cluster autoscaler scale-up in progress for %v", pendingDuration.Round(time.Second)), false
+	}
+
+	// Конфликт с node affinity тома: удаляем Pod, только если есть нода,
+	// на которую его можно перепланировать
+	if latest := latestSchedulingFailure(events); strings.Contains(latest, volumeNodeAffinityConflict) {
+		blocker, err := h.volumeTopologyBlocker(ctx, pod)
+		if err != nil {
+			klog.ErrorS(err, "Failed to check volume topology", "namespace", pod.Namespace, "pod", pod.Name)
+			return "failed to check volume topology", false
+		}
+		if blocker != "" {
+			return fmt.Sprintf("rescheduling will not help, pod is blocked by VolumeNodeAffinityConflict: %s", blocker), true
+		}
+		return "", false
+	}
+
+	if blocker := pendingBlocker(events); blocker != nil {
+		return fmt.Sprintf("rescheduling will not help, pod is blocked by %s: %s", blocker.Reason, blocker.Message), true
+	}
+
+	return "", false
+}
+
+// waitingForScaleUp проверяет, инициировал ли cluster autoscaler добавление ноды для Pod'а
+func waitingForScaleUp(events []corev1.Event) bool {
+	for _, event := range events {
+		if event.Reason == "TriggeredScaleUp" {
+			return true
+		}
+	}
+	return false
+}
+
+// latestSchedulingFailure возвращает сообщение последнего события FailedScheduling
+func latestSchedulingFailure(events []corev1.Event) string {
+	for _, event := range events {
+		if event.Reason == "FailedScheduling" {
+			return event.Message
+		}
+	}
+	return ""
+}
+
+// pendingBlocker ищет в последнем событии FailedScheduling причину,
+// которую удаление Pod'а не исправит. Возвращает nil, если такой причины нет.
+func pendingBlocker(events []corev1.Event) *schedulingBlocker {
+	for _, event := range events {
+		if event.Reason != "FailedScheduling" {
+			continue
+		}
+		return classifySchedulingFailure(event.Message)
+	}
+	return nil
+}
+
+func classifySchedulingFailure(message string) *schedulingBlocker {
+	for _, pattern := range schedulingBlockerPatterns {
+		if strings.Contains(message, pattern.substring) {
+			return &schedulingBlocker{Reason: pattern.reason, Message: message}
+		}
+	}
+	return nil
+}
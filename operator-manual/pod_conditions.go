@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// conditionSelectedForHealing - condition Pod'а, выбранного для healing'а. Пока она True,
+// действие запланировано; статус False, выставленный человеком или другим контроллером, отменяет его.
+const conditionSelectedForHealing corev1.PodConditionType = "healing.kubernetes.io/SelectedForHealing"
+
+// HealingConditionConfig - публикация решений condition'ом Pod'а перед их выполнением
+type HealingConditionConfig struct {
+	Enabled bool
+	// Delay - сколько действие ждет после выставления condition, чтобы его успели отменить
+	Delay time.Duration
+}
+
+// changesCluster - действия, которые меняют кластер, а не только сообщают о Pod'е
+func changesCluster(action HealingAction) bool {
+	switch action {
+	case ActionObserve, ActionSkip, ActionNotify:
+		return false
+	}
+	return true
+}
+
+func podCondition(pod *corev1.Pod, conditionType corev1.PodConditionType) *corev1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == conditionType {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// healingSelection проверяет condition SelectedForHealing перед действием. Condition
+// прошлого эпизода или другой причины заменяется новой, и Delay отсчитывается заново.
+// Возвращает пустую строку, если действие можно выполнять, иначе результат решения.
+func (h *PodHealer) healingSelection(ctx context.Context, decision *healingDecision) string {
+	pod, now := decision.Pod, h.clock.Now()
+	condition := podCondition(pod, conditionSelectedForHealing)
+	current := condition != nil && condition.Reason == string(decision.Code) &&
+		(decision.Stuck == nil || !condition.LastTransitionTime.Time.Before(decision.Stuck.Since))
+
+	if current && condition.Status == corev1.ConditionFalse {
+		klog.InfoS("Healing vetoed by pod condition", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name,
+			"reason", decision.Reason, "code", decision.Code, "action", decision.Action, "message", condition.Message)
+		return "vetoed"
+	}
+	selectedAt := now
+	if current {
+		selectedAt = condition.LastTransitionTime.Time
+	} else if err := h.patchSelectedCondition(ctx, decision, now); err != nil {
+		klog.ErrorS(err, "Failed to mark pod as selected for healing", "cluster", h.cluster,
+			"namespace", pod.Namespace, "pod", pod.Name)
+		return "failed"
+	}
+	if scheduled := selectedAt.Add(h.config.HealingCondition.Delay); now.Before(scheduled) {
+		if !current {
+			decisionEventf(h.recorder, pod, decision, corev1.EventTypeWarning, "HealingScheduled",
+				"%s (%s) is scheduled at %s: set condition %s to False to cancel it",
+				decision.Action, decision.Detail, scheduled.UTC().Format(time.RFC3339), conditionSelectedForHealing)
+		}
+		return "selected"
+	}
+	return ""
+}
+
+// patchSelectedCondition выставляет Pod'у condition SelectedForHealing с кодом причины и временем действия
+func (h *PodHealer) patchSelectedCondition(ctx context.Context, decision *healingDecision, now time.Time) error {
+	pod := decision.Pod
+	scheduled := now.Add(h.config.HealingCondition.Delay)
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{"conditions": []corev1.PodCondition{{
+			Type:               conditionSelectedForHealing,
+			Status:             corev1.ConditionTrue,
+			Reason:             string(decision.Code),
+			Message:            fmt.Sprintf("%s scheduled at %s: %s", decision.Action, scheduled.UTC().Format(time.RFC3339), decision.Detail),
+			LastTransitionTime: metav1.NewTime(now),
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = h.clientset.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.StrategicMergePatchType, patch,
+		metav1.PatchOptions{}, "status")
+	return err
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// Значения встроенных PriorityClass, если их нельзя прочитать из API
+var builtinPriorityClasses = map[string]int32{
+	"system-cluster-critical": 2000000000,
+	"system-node-critical":    2000001000,
+}
+
+// resolveProtectedPriority возвращает приоритет класса --protected-priority-class.
+// Pod'ы с таким же или более высоким приоритетом никогда не лечатся.
+func (h *PodHealer) resolveProtectedPriority(ctx context.Context) (*int32, error) {
+	name := h.config.ProtectedPriorityClass
+	if name == "" {
+		return nil, nil
+	}
+
+	class, err := h.clientset.SchedulingV1().PriorityClasses().Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return &class.Value, nil
+	}
+	if value, builtin := builtinPriorityClasses[name]; builtin {
+		klog.InfoS("Failed to get priority class, using builtin value", "cluster", h.cluster,
+			"priorityClass", name, "value", value, "err", err)
+		return &value, nil
+	}
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("priority class %s not found", name)
+	}
+	return nil, fmt.Errorf("failed to get priority class %s: %w", name, err)
+}
+
+func podPriority(pod *corev1.Pod) int32 {
+	if pod.Spec.Priority != nil {
+		return *pod.Spec.Priority
+	}
+	return 0
+}
+
+// isPriorityProtected проверяет, защищен ли Pod своим приоритетом
+func (h *PodHealer) isPriorityProtected(pod *corev1.Pod) bool {
+	return h.protectedPriority != nil && podPriority(pod) >= *h.protectedPriority
+}
+
+type healResult struct {
+	decision *healingDecision
+	result   string
+}
+
+// scheduleHeal ставит heal в очередь и выполняет столько heal'ов, сколько
+// позволяют rate limiter и бюджеты namespaces. Когда лимит исчерпан, первыми лечатся Pod'ы
+// с меньшим приоритетом. Возвращает результат для переданного решения.
+func (h *PodHealer) scheduleHeal(decision *healingDecision) string {
+	pod := decision.Pod
+
+	h.queueMu.Lock()
+	h.queue[pod.UID] = decision
+	h.queueMu.Unlock()
+
+	result := "rate-limited"
+	for _, healed := range h.drainHeals() {
+		if healed.decision == decision {
+			result = healed.result
+			continue
+		}
+		h.recordResult(healed)
+	}
+
+	if result == "rate-limited" {
+		if !h.budgets.available(pod.Namespace, h.clock.Now(), h.config.NamespaceBudget) {
+			klog.InfoS("Namespace heal budget exhausted, postponing heal", "cluster", h.cluster,
+				"namespace", pod.Namespace, "pod", pod.Name, "reason", decision.Reason, "code", decision.Code, "action", decision.Action,
+				"budget", h.config.NamespaceBudget.Heals, "window", h.config.NamespaceBudget.Window)
+			namespaceBudgetExhaustedTotal.WithLabelValues(h.cluster, pod.Namespace).Inc()
+			return result
+		}
+		klog.InfoS("Rate limit reached, postponing heal", "cluster", h.cluster,
+			"namespace", pod.Namespace, "pod", pod.Name, "reason", decision.Reason, "code", decision.Code, "action", decision.Action,
+			"priority", podPriority(pod))
+		rateLimitedTotal.WithLabelValues(h.cluster).Inc()
+	}
+	return result
+}
+
+// drainQueuedHeals периодически выполняет отложенные heal'ы
+func (h *PodHealer) drainQueuedHeals() {
+	for _, healed := range h.drainHeals() {
+		h.recordResult(healed)
+	}
+}
+
+func (h *PodHealer) recordResult(healed healResult) {
+	h.state.recordDecision(DecisionRecord{
+		Time:           h.clock.Now().UTC(),
+		StuckPodReport: h.reportEntry(healed.decision),
+		Result:         healed.result,
+	})
+}
+
+func (h *PodHealer) drainHeals() []healResult {
+	h.queueMu.Lock()
+	queued := make([]*healingDecision, 0, len(h.queue))
+	for _, decision := range h.queue {
+		queued = append(queued, decision)
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		pi, pj := podPriority(queued[i].Pod), podPriority(queued[j].Pod)
+		if pi != pj {
+			return pi < pj
+		}
+		return queued[i].Stuck.Since.Before(queued[j].Stuck.Since)
+	})
+
+	now := h.clock.Now()
+	budget := h.config.NamespaceBudget
+	var ready []*healingDecision
+	var results []healResult
+	for _, decision := range queued {
+		// Сосед уже вылечен в этом же проходе или раньше - Pod будет оценен заново после его замены
+		if heal, waiting := h.replacements.waiting(decision.Pod, now, h.config.ReplacementTimeout); waiting {
+			klog.InfoS("Postponing heal until replacement is ready", "cluster", h.cluster,
+				"namespace", decision.Pod.Namespace, "pod", decision.Pod.Name, "healed", heal.Pod)
+			delete(h.queue, decision.Pod.UID)
+			results = append(results, healResult{decision: decision, result: "skipped"})
+			continue
+		}
+		// Namespace исчерпал свой бюджет - очередь остальных namespaces не ждет
+		if !h.budgets.available(decision.Pod.Namespace, now, budget) {
+			continue
+		}
+		if !h.limiter.AllowN(now, 1) {
+			break
+		}
+		h.budgets.spend(decision.Pod.Namespace, now, budget)
+		h.healTimes = append(recentAttempts(h.healTimes, now, time.Minute), now)
+		delete(h.queue, decision.Pod.UID)
+		if h.config.ReplacementTimeout > 0 {
+			h.replacements.start(decision.Pod, now)
+		}
+		ready = append(ready, decision)
+	}
+	h.queueMu.Unlock()
+
+	return append(results, h.performHeals(ready)...)
+}
+
+// performHeals выполняет готовые heal'ы пулом из HealWorkers воркеров в порядке очереди
+func (h *PodHealer) performHeals(ready []*healingDecision) []healResult {
+	results := make([]healResult, len(ready))
+	next := make(chan int, len(ready))
+	for i := range ready {
+		next <- i
+	}
+	close(next)
+
+	workers := h.config.healWorkers()
+	if workers > len(ready) {
+		workers = len(ready)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = healResult{decision: ready[i], result: h.performHeal(ready[i])}
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// dequeueHeal убирает отложенный heal Pod'а, который больше не нужно лечить
+func (h *PodHealer) dequeueHeal(pod *corev1.Pod) {
+	h.queueMu.Lock()
+	defer h.queueMu.Unlock()
+	delete(h.queue, pod.UID)
+}
+
+// performHeal выполняет действие решения через зарегистрированный Remediator
+func (h *PodHealer) performHeal(decision *healingDecision) string {
+	pod := decision.Pod
+	// Параллельные reconcile'ы делят общий лимит одновременных heal'ов
+	h.healSlots <- struct{}{}
+	defer func() { <-h.healSlots }()
+
+	// Отложенный rate limiter'ом heal выполняется позже, но остается в трейсе оценки Pod'а
+	ctx := trace.ContextWithSpanContext(context.Background(), decision.SpanContext)
+	ctx, span := tracer.Start(ctx, "Remediate", h.podSpanAttributes(pod))
+	defer span.End()
+	decisionSpanAttributes(span, decision)
+
+	// В active-active режиме тот же Pod могла уже взять другая реплика
+	if !h.claimHeal(ctx, decision) {
+		h.replacements.cancel(pod)
+		return "claimed"
+	}
+
+	remediator, err := h.strategies.remediator(decision.Action)
+	if err == nil {
+		start := time.Now()
+		err = remediator.Remediate(ctx, decision)
+		healDuration.WithLabelValues(h.cluster).Observe(time.Since(start).Seconds())
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		healsTotal.WithLabelValues(h.cluster, pod.Namespace, string(decision.Action), "error").Inc()
+		klog.ErrorS(err, "Error healing pod", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name,
+			"reason", decision.Reason, "code", decision.Code, "action", decision.Action, "traceID", span.SpanContext().TraceID())
+		h.replacements.cancel(pod)
+		return "failed"
+	}
+	healsTotal.WithLabelValues(h.cluster, pod.Namespace, string(decision.Action), "success").Inc()
+
+	// Уведомление ничего не меняет и не считается попыткой heal'а
+	if decision.Action == ActionNotify {
+		return "notified"
+	}
+	if decision.Owner != nil {
+		h.markOwnerHealed(ctx, decision.Owner, h.clock.Now())
+		h.recordHealAttempt(decision.Owner, h.clock.Now())
+	}
+	return "healed"
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const ReasonPromQL StuckReason = "PromQL"
+
+// PrometheusConfig - детекторы, признающие Pod'ы зависшими по PromQL-запросам
+type PrometheusConfig struct {
+	// URL - адрес HTTP API Prometheus, например http://prometheus:9090
+	URL string
+	// Interval - как часто выполняются запросы детекторов
+	Interval  time.Duration
+	Detectors []PromQLDetectorConfig
+}
+
+// PromQLDetectorConfig - один детектор из файла --promql-detectors.
+// Каждый ненулевой сэмпл результата с labels namespace и pod помечает Pod
+// неисправным, например rate(http_errors_total[5m]) > 0.1.
+type PromQLDetectorConfig struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	// For - сколько Pod должен непрерывно попадать в результат, прежде чем он будет признан зависшим
+	For metav1.Duration `json:"for,omitempty"`
+	// NamespaceLabel и PodLabel переопределяют имена labels с namespace и именем Pod'а
+	NamespaceLabel string `json:"namespaceLabel,omitempty"`
+	PodLabel       string `json:"podLabel,omitempty"`
+}
+
+// loadPromQLDetectors читает список детекторов из YAML файла
+func loadPromQLDetectors(path string) ([]PromQLDetectorConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Detectors []PromQLDetectorConfig `json:"detectors"`
+	}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for i := range file.Detectors {
+		detector := &file.Detectors[i]
+		if detector.Name == "" || detector.Query == "" {
+			return nil, fmt.Errorf("detector %d: name and query are required", i)
+		}
+		if names[detector.Name] {
+			return nil, fmt.Errorf("duplicate detector name %q", detector.Name)
+		}
+		names[detector.Name] = true
+		if detector.NamespaceLabel == "" {
+			detector.NamespaceLabel = "namespace"
+		}
+		if detector.PodLabel == "" {
+			detector.PodLabel = "pod"
+		}
+	}
+	return file.Detectors, nil
+}
+
+// promQLMatch - Pod, попавший в результат запроса детектора
+type promQLMatch struct {
+	Value float64
+	// Since - с какого опроса Pod непрерывно попадает в результат
+	Since time.Time
+}
+
+// promQLDetector признает зависшими Pod'ы из последнего результата своего запроса.
+// Запрос выполняется фоново в poll, Detect читает только закэшированный результат.
+type promQLDetector struct {
+	config   PromQLDetectorConfig
+	endpoint string
+	client   *http.Client
+
+	mu      sync.Mutex
+	matches map[types.NamespacedName]promQLMatch
+}
+
+func newPromQLDetector(endpoint string, config PromQLDetectorConfig) *promQLDetector {
+	return &promQLDetector{
+		config:   config,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: 30 * time.Second},
+		matches:  make(map[types.NamespacedName]promQLMatch),
+	}
+}
+
+func (d *promQLDetector) Reason() StuckReason { return ReasonPromQL }
+
+func (d *promQLDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	d.mu.Lock()
+	match, exists := d.matches[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}]
+	d.mu.Unlock()
+	if !exists || now.Sub(match.Since) < d.config.For.Duration {
+		return nil
+	}
+	return &stuckCondition{
+		Reason: ReasonPromQL,
+		Detail: fmt.Sprintf("detector %s: query returned %s", d.config.Name, strconv.FormatFloat(match.Value, 'g', 4, 64)),
+		Since:  match.Since,
+	}
+}
+
+// promQLResponse - ответ /api/v1/query для результата типа vector
+type promQLResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]interface{}    `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// poll выполняет запрос и заменяет закэшированный результат.
+// При ошибке прежний результат сохраняется, чтобы сбой Prometheus не сбрасывал For.
+func (d *promQLDetector) poll(ctx context.Context, now time.Time) error {
+	query := url.Values{"query": {d.config.Query}}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, d.endpoint+"/api/v1/query?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	result := &promQLResponse{}
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return fmt.Errorf("invalid prometheus response (HTTP %d): %v", response.StatusCode, err)
+	}
+	if result.Status != "success" {
+		return fmt.Errorf("prometheus query failed: %s", result.Error)
+	}
+	if result.Data.ResultType != "vector" {
+		return fmt.Errorf("query must return an instant vector, got %s", result.Data.ResultType)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	matches := make(map[types.NamespacedName]promQLMatch)
+	for _, sample := range result.Data.Result {
+		key := types.NamespacedName{Namespace: sample.Metric[d.config.NamespaceLabel], Name: sample.Metric[d.config.PodLabel]}
+		if key.Namespace == "" || key.Name == "" {
+			continue
+		}
+		raw, _ := sample.Value[1].(string)
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || value == 0 {
+			continue
+		}
+		since := now
+		if previous, exists := d.matches[key]; exists {
+			since = previous.Since
+		}
+		matches[key] = promQLMatch{Value: value, Since: since}
+	}
+	d.matches = matches
+	return nil
+}
+
+// runPromQLDetectors периодически опрашивает Prometheus для каждого детектора.
+// Помеченные Pod'ы лечатся при следующем обновлении или resync informer'а.
+func (h *PodHealer) runPromQLDetectors(stop <-chan struct{}) {
+	for _, detector := range h.promql {
+		detector := detector
+		go wait.Until(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), h.config.Prometheus.Interval)
+			defer cancel()
+			result := "success"
+			if err := detector.poll(ctx, h.clock.Now()); err != nil {
+				result = "error"
+				klog.ErrorS(err, "Failed to run PromQL detector", "cluster", h.cluster, "detector", detector.config.Name)
+			}
+			promQLQueriesTotal.WithLabelValues(h.cluster, detector.config.Name, result).Inc()
+		}, h.config.Prometheus.Interval, stop)
+	}
+}
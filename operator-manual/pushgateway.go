@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"k8s.io/klog/v2"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// PushgatewayConfig - отправка метрик отчета в Prometheus Pushgateway. Healer, запущенный
+// как короткоживущий Job в режиме report, завершается раньше, чем Prometheus его опросит.
+type PushgatewayConfig struct {
+	URL string
+	Job string
+	// Timeout ограничивает отправку, чтобы недоступный Pushgateway не задерживал Job
+	Timeout time.Duration
+}
+
+func (c PushgatewayConfig) enabled() bool { return c.URL != "" }
+
+// reportCollectors - метрики одного сканирования, их нет на scrape endpoint'е оператора
+func reportCollectors(report *Report) []prometheus.Collector {
+	scanned := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pod_healer_report_scanned_pods",
+		Help: "Number of pods scanned by the last report.",
+	})
+	scanned.Set(float64(report.ScannedPods))
+
+	stuck := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pod_healer_report_stuck_pods",
+		Help: "Number of stuck pods found by the last report, by cluster, namespace, reason code and proposed action.",
+	}, []string{"cluster", "namespace", "code", "action"})
+	for _, pod := range report.StuckPods {
+		stuck.WithLabelValues(pod.Cluster, pod.Namespace, string(pod.Code), string(pod.Action)).Inc()
+	}
+
+	completed := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pod_healer_report_last_completion_timestamp_seconds",
+		Help: "Unix time the last report completed.",
+	})
+	completed.Set(float64(report.GeneratedAt.Unix()))
+	return []prometheus.Collector{scanned, stuck, completed}
+}
+
+// pushReportMetrics заменяет метрики группы job в Pushgateway метриками отчета и healer'а
+func pushReportMetrics(config PushgatewayConfig, report *Report) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	pusher := push.New(config.URL, config.Job).Gatherer(ctrlmetrics.Registry)
+	for _, collector := range reportCollectors(report) {
+		pusher = pusher.Collector(collector)
+	}
+	if err := pusher.PushContext(ctx); err != nil {
+		return fmt.Errorf("failed to push metrics to %s: %w", config.URL, err)
+	}
+	klog.InfoS("Pushed report metrics", "pushgateway", config.URL, "job", config.Job,
+		"stuckPods", len(report.StuckPods))
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	labelQuarantined = "healing.kubernetes.io/quarantined"
+	// В аннотации сохраняются снятые при карантине labels, чтобы Pod можно было вернуть
+	annotationQuarantinedLabels = "healing.kubernetes.io/quarantined-labels"
+)
+
+func isQuarantined(pod *corev1.Pod) bool {
+	return pod.Labels[labelQuarantined] == "true"
+}
+
+// quarantinePod изолирует Pod вместо удаления: снимает labels, по которым его
+// выбирают Service'ы, и помечает его как quarantined. Pod остается жив для отладки,
+// а владелец (ReplicaSet и т.п.) теряет его и создает замену.
+func (h *PodHealer) quarantinePod(ctx context.Context, pod *corev1.Pod) error {
+	klog.InfoS("Quarantining pod", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name)
+
+	services, err := h.clientset.CoreV1().Services(pod.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	removed := map[string]string{}
+	var serviceNames []string
+	for _, service := range services.Items {
+		if len(service.Spec.Selector) == 0 {
+			continue
+		}
+		if !labels.SelectorFromSet(service.Spec.Selector).Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		serviceNames = append(serviceNames, service.Name)
+		for key := range service.Spec.Selector {
+			removed[key] = pod.Labels[key]
+		}
+	}
+	sort.Strings(serviceNames)
+
+	savedLabels, err := json.Marshal(removed)
+	if err != nil {
+		return err
+	}
+	// null в merge patch удаляет label
+	patchLabels := map[string]interface{}{labelQuarantined: "true"}
+	for key := range removed {
+		patchLabels[key] = nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      patchLabels,
+			"annotations": map[string]string{annotationQuarantinedLabels: string(savedLabels)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = h.clientset.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+
+	message := "Pod quarantined for debugging"
+	if len(serviceNames) > 0 {
+		message += ", removed from services " + strings.Join(serviceNames, ", ")
+	}
+	h.recorder.Event(pod, corev1.EventTypeWarning, "Quarantined", message)
+	klog.InfoS("Successfully quarantined pod", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name,
+		"services", serviceNames)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestQuarantine(t *testing.T) {
+	service := func(name string, selector map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: corev1.ServiceSpec{Selector: selector}}
+	}
+	pod := testPod("web-1", time.Hour, withWaiting("CrashLoopBackOff"), withNotReady(time.Hour),
+		withOwner("ReplicaSet", "web-5d4f8"), withAnnotation("healing.kubernetes.io/action", "quarantine"),
+		func(pod *corev1.Pod) {
+			pod.Labels = map[string]string{"app": "web", "tier": "frontend", "version": "v1"}
+		})
+	healer, clientset, _ := newTestHealer(t, Config{}, append(testDeployment("web"), pod,
+		service("web", map[string]string{"app": "web"}),
+		service("web-frontend", map[string]string{"app": "web", "tier": "frontend"}),
+		service("api", map[string]string{"app": "api"}),
+		service("external", nil))...)
+
+	if result := healOnce(t, healer, pod); result != "healed" {
+		t.Fatalf("expected pod to be quarantined, got %s", result)
+	}
+	quarantined, err := clientset.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("quarantined pod must be kept: %v", err)
+	}
+
+	// Сняты только labels, по которым Pod выбирают Service'ы
+	want := map[string]string{"version": "v1", labelQuarantined: "true"}
+	if len(quarantined.Labels) != len(want) {
+		t.Fatalf("labels %v, want %v", quarantined.Labels, want)
+	}
+	for key, value := range want {
+		if quarantined.Labels[key] != value {
+			t.Errorf("labels %v, want %v", quarantined.Labels, want)
+		}
+	}
+	saved := map[string]string{}
+	if err := json.Unmarshal([]byte(quarantined.Annotations[annotationQuarantinedLabels]), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 || saved["app"] != "web" || saved["tier"] != "frontend" {
+		t.Errorf("saved labels %v, want app and tier", saved)
+	}
+
+	// Pod на карантине больше не лечится
+	if decision := healer.evaluatePod(context.Background(), quarantined, healer.clock.Now()); decision != nil {
+		t.Errorf("quarantined pod must be excluded from healing, got %+v", decision)
+	}
+}
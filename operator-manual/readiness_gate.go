@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const ReasonReadinessGate StuckReason = "ReadinessGate"
+
+// ReadinessGatePolicy определяет, что делать с Pod'ами, которые не становятся Ready
+// из-за readiness gate. Условие gate'а выставляет внешний контроллер (например,
+// регистрация в target group ALB), и пересоздание Pod'а его обычно не исправляет.
+type ReadinessGatePolicy string
+
+const (
+	ReadinessGateNotify ReadinessGatePolicy = "notify"
+	ReadinessGateDelete ReadinessGatePolicy = "delete"
+)
+
+// readinessGateDetector - контейнеры Pod'а готовы, но Pod не Ready из-за невыполненного readiness gate
+type readinessGateDetector struct{}
+
+func (readinessGateDetector) Reason() StuckReason { return ReasonReadinessGate }
+
+func (readinessGateDetector) Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	if len(pod.Spec.ReadinessGates) == 0 || isPodReady(pod) || !podConditionTrue(pod, corev1.ContainersReady) {
+		return nil
+	}
+	var ready *corev1.PodCondition
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == corev1.PodReady {
+			ready = &pod.Status.Conditions[i]
+		}
+	}
+	if ready == nil {
+		return nil
+	}
+	notReadyDuration := now.Sub(ready.LastTransitionTime.Time)
+	if notReadyDuration <= thresholds.NotReadyTimeout {
+		return nil
+	}
+
+	gate := failingReadinessGate(pod)
+	if gate == "" {
+		return nil
+	}
+	return &stuckCondition{
+		Reason: ReasonReadinessGate,
+		Detail: fmt.Sprintf("%s for %v", gate, notReadyDuration.Round(time.Second)),
+		Since:  ready.LastTransitionTime.Time,
+	}
+}
+
+// failingReadinessGate описывает первый невыполненный readiness gate Pod'а
+func failingReadinessGate(pod *corev1.Pod) string {
+	for _, gate := range pod.Spec.ReadinessGates {
+		var condition *corev1.PodCondition
+		for i := range pod.Status.Conditions {
+			if pod.Status.Conditions[i].Type == gate.ConditionType {
+				condition = &pod.Status.Conditions[i]
+			}
+		}
+		switch {
+		case condition == nil:
+			return fmt.Sprintf("readiness gate %s has no condition", gate.ConditionType)
+		case condition.Status == corev1.ConditionTrue:
+			continue
+		case condition.Message != "":
+			return fmt.Sprintf("readiness gate %s is %s: %s", gate.ConditionType, condition.Status, condition.Message)
+		default:
+			return fmt.Sprintf("readiness gate %s is %s", gate.ConditionType, condition.Status)
+		}
+	}
+	return ""
+}
+
+func podConditionTrue(pod *corev1.Pod, conditionType corev1.PodConditionType) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
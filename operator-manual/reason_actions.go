@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// annotationReasonActions на namespace переопределяет --reason-actions для его Pod'ов
+const annotationReasonActions = "healing.kubernetes.io/reason-actions"
+
+// ReasonActions сопоставляет категории сбоев - коды причин - с действиями. Код уже
+// классифицирует состояние контейнеров и события Pod'а: CrashLoopBackOff из-за OOMKilled
+// относится к OOM, а не к CRASHLOOP. Без сопоставления для кода используется действие по умолчанию.
+type ReasonActions map[ReasonCode]HealingAction
+
+func (a ReasonActions) String() string {
+	var entries []string
+	for code, action := range a {
+		entries = append(entries, string(code)+"="+string(action))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// knownReasonCodes - коды, которые может получить решение
+func knownReasonCodes() map[ReasonCode]bool {
+	codes := map[ReasonCode]bool{CodeOOM: true}
+	for _, code := range reasonCodes {
+		codes[code] = true
+	}
+	return codes
+}
+
+// parseReasonActions разбирает "CRASHLOOP=rollout-restart,OOM=notify-only,IMAGE_PULL=notify-only"
+func parseReasonActions(value string) (ReasonActions, error) {
+	known := knownReasonCodes()
+	actions := make(ReasonActions)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		code, action, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid reason action %q, expected CODE=ACTION", entry)
+		}
+		reason, healing := ReasonCode(strings.ToUpper(strings.TrimSpace(code))), HealingAction(strings.TrimSpace(action))
+		if !known[reason] {
+			return nil, fmt.Errorf("invalid reason action %q: unknown reason code %q", entry, code)
+		}
+		if !isRemediationAction(healing) && healing != ActionSkip && healing != ActionObserve {
+			return nil, fmt.Errorf("invalid reason action %q: unknown action %q, expected skip, observe or one of %s",
+				entry, healing, strings.Join(remediationActions(), ", "))
+		}
+		actions[reason] = healing
+	}
+	return actions, nil
+}
+
+// reasonAction выбирает действие по коду причины: сопоставление namespace'а важнее глобального
+func (h *PodHealer) reasonAction(pod *corev1.Pod, code ReasonCode) (HealingAction, string, bool) {
+	if action, ok := h.namespaceReasonActions(pod.Namespace)[code]; ok {
+		return action, fmt.Sprintf("namespace reason action %s=%s", code, action), true
+	}
+	if action, ok := h.config.ReasonActions[code]; ok {
+		return action, fmt.Sprintf("reason action %s=%s", code, action), true
+	}
+	return "", "", false
+}
+
+func (h *PodHealer) namespaceReasonActions(namespace string) ReasonActions {
+	if h.namespaces == nil {
+		return nil
+	}
+	obj, exists, err := h.namespaces.GetByKey(namespace)
+	if err != nil || !exists {
+		return nil
+	}
+	value, exists := obj.(*corev1.Namespace).Annotations[annotationReasonActions]
+	if !exists {
+		return nil
+	}
+	actions, err := parseReasonActions(value)
+	if err != nil {
+		klog.ErrorS(err, "Invalid namespace annotation", "namespace", namespace, "annotation", annotationReasonActions)
+		return nil
+	}
+	return actions
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// ReasonCode - стабильный машиночитаемый код причины решения. В отличие от
+// StuckReason и текста сообщений коды не меняются между версиями: по ним
+// внешняя автоматизация разбирает логи, события, метрики и журнал решений.
+type ReasonCode string
+
+const (
+	CodePendingTimeout    ReasonCode = "PENDING_TIMEOUT"
+	CodeImagePull         ReasonCode = "IMAGE_PULL"
+	CodeContainerCreating ReasonCode = "CONTAINER_CREATING"
+	CodeContainerConfig   ReasonCode = "CONTAINER_CONFIG"
+	CodeCrashLoop         ReasonCode = "CRASHLOOP"
+	CodeTooManyRestarts   ReasonCode = "TOO_MANY_RESTARTS"
+	CodeOOM               ReasonCode = "OOM"
+	CodeNotReady          ReasonCode = "NOT_READY"
+	CodeReadinessGate     ReasonCode = "READINESS_GATE"
+	CodeLivenessFailing   ReasonCode = "LIVENESS_FAILING"
+	CodeTerminating       ReasonCode = "TERMINATING"
+	CodeNodeLost          ReasonCode = "NODE_LOST"
+	CodeNodeDeleted       ReasonCode = "NODE_DELETED"
+	CodeNodePressure      ReasonCode = "NODE_PRESSURE"
+	CodeNodePreemption    ReasonCode = "NODE_PREEMPTION"
+	CodeServiceEndpoints  ReasonCode = "SERVICE_ENDPOINTS"
+	CodeMemoryLeak        ReasonCode = "MEMORY_LEAK"
+	CodeEphemeralStorage  ReasonCode = "EPHEMERAL_STORAGE"
+	CodeAlert             ReasonCode = "ALERT"
+	CodeOnDemand          ReasonCode = "ON_DEMAND"
+	CodePromQL            ReasonCode = "PROMQL"
+	CodeUnknown           ReasonCode = "UNKNOWN"
+)
+
+// annotationReasonCode - аннотация событий healer'а с кодом причины решения
+const annotationReasonCode = "healing.kubernetes.io/reason-code"
+
+var reasonCodes = map[StuckReason]ReasonCode{
+	ReasonPending:           CodePendingTimeout,
+	ReasonImagePull:         CodeImagePull,
+	ReasonContainerCreating: CodeContainerCreating,
+	ReasonContainerConfig:   CodeContainerConfig,
+	ReasonCrashLoop:         CodeCrashLoop,
+	ReasonTooManyRestarts:   CodeTooManyRestarts,
+	ReasonNotReady:          CodeNotReady,
+	ReasonReadinessGate:     CodeReadinessGate,
+	ReasonLivenessFailing:   CodeLivenessFailing,
+	ReasonTerminating:       CodeTerminating,
+	ReasonNodeLost:          CodeNodeLost,
+	ReasonNodeDeleted:       CodeNodeDeleted,
+	ReasonNodePressure:      CodeNodePressure,
+	ReasonNodePreemption:    CodeNodePreemption,
+	ReasonServiceEndpoints:  CodeServiceEndpoints,
+	ReasonMemoryLeak:        CodeMemoryLeak,
+	ReasonEphemeralStorage:  CodeEphemeralStorage,
+	ReasonAlert:             CodeAlert,
+	ReasonOnDemand:          CodeOnDemand,
+	ReasonPromQL:            CodePromQL,
+}
+
+// reasonCode возвращает код причины. Рестарты из-за OOMKilled выделены в OOM:
+// таким Pod'ам нужна память, а не пересоздание.
+func reasonCode(pod *corev1.Pod, reason StuckReason) ReasonCode {
+	code, ok := reasonCodes[reason]
+	if !ok {
+		return CodeUnknown
+	}
+	if code == CodeCrashLoop || code == CodeTooManyRestarts {
+		for _, status := range podContainerStatuses(pod) {
+			if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.Reason == "OOMKilled" {
+				return CodeOOM
+			}
+		}
+	}
+	return code
+}
+
+// decisionEventf создает событие о решении с кодом причины в аннотации
+func decisionEventf(recorder record.EventRecorder, obj runtime.Object, decision *healingDecision,
+	eventType, reason, messageFmt string, args ...interface{}) {
+	recorder.AnnotatedEventf(obj, map[string]string{annotationReasonCode: string(decision.Code)},
+		eventType, reason, messageFmt, args...)
+}
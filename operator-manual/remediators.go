@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	ActionEvict          HealingAction = "evict"
+	ActionRolloutRestart HealingAction = "rollout-restart"
+	ActionScale          HealingAction = "scale"
+	ActionNotify         HealingAction = "notify-only"
+)
+
+// deleteRemediator удаляет Pod, владелец создаст новый
+type deleteRemediator struct{ h *PodHealer }
+
+func (deleteRemediator) Action() HealingAction { return ActionDelete }
+
+func (r deleteRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	return r.h.healPod(ctx, decision.Pod)
+}
+
+// evictRemediator выселяет Pod через Eviction API, соблюдая PodDisruptionBudget
+type evictRemediator struct{ h *PodHealer }
+
+func (evictRemediator) Action() HealingAction { return ActionEvict }
+
+func (r evictRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	pod := decision.Pod
+	return r.h.clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	})
+}
+
+// rolloutRestartRemediator перезапускает все Pod'ы владельца, как kubectl rollout restart
+type rolloutRestartRemediator struct{ h *PodHealer }
+
+func (rolloutRestartRemediator) Action() HealingAction { return ActionRolloutRestart }
+
+func (r rolloutRestartRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	owner := decision.Owner
+	if owner == nil || (owner.Kind != "Deployment" && owner.Kind != "StatefulSet" && owner.Kind != "DaemonSet") {
+		return fmt.Errorf("rollout restart requires a Deployment, StatefulSet or DaemonSet owner")
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{
+						"kubectl.kubernetes.io/restartedAt": r.h.clock.Now().UTC().Format(time.RFC3339),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return r.h.patchOwner(ctx, owner, patch)
+}
+
+// scaleRemediator добавляет владельцу реплику, чтобы восстановить емкость,
+// не трогая зависший Pod
+type scaleRemediator struct{ h *PodHealer }
+
+func (scaleRemediator) Action() HealingAction { return ActionScale }
+
+func (r scaleRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	owner := decision.Owner
+	var replicas int32
+	switch obj := ownerObject(owner).(type) {
+	case *appsv1.Deployment:
+		replicas = replicasOrOne(obj.Spec.Replicas)
+	case *appsv1.StatefulSet:
+		replicas = replicasOrOne(obj.Spec.Replicas)
+	default:
+		return fmt.Errorf("scale requires a Deployment or StatefulSet owner")
+	}
+	return r.h.patchOwner(ctx, owner, []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas+1)))
+}
+
+func ownerObject(owner *workloadOwner) interface{} {
+	if owner == nil {
+		return nil
+	}
+	return owner.Object
+}
+
+// notifyRemediator только сообщает о зависшем Pod'е событием Warning
+type notifyRemediator struct{ h *PodHealer }
+
+func (notifyRemediator) Action() HealingAction { return ActionNotify }
+
+func (r notifyRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	message := fmt.Sprintf("Pod is stuck (%s): %s", decision.Reason, decision.Detail)
+	decisionEventf(r.h.recorder, decision.Pod, decision, corev1.EventTypeWarning, "StuckPod", "%s", message)
+	if decision.Owner != nil {
+		if obj, ok := decision.Owner.Object.(runtime.Object); ok {
+			decisionEventf(r.h.recorder, obj, decision, corev1.EventTypeWarning, "StuckPod", "Pod %s is stuck (%s): %s",
+				decision.Pod.Name, decision.Reason, decision.Detail)
+		}
+	}
+	return nil
+}
+
+// quarantineRemediator изолирует Pod от сервисов для отладки
+type quarantineRemediator struct{ h *PodHealer }
+
+func (quarantineRemediator) Action() HealingAction { return ActionQuarantine }
+
+func (r quarantineRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	return r.h.quarantinePod(ctx, decision.Pod)
+}
+
+// recreateRemediator пересоздает Pod без владельца из его spec
+type recreateRemediator struct{ h *PodHealer }
+
+func (recreateRemediator) Action() HealingAction { return ActionRecreate }
+
+func (r recreateRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	return r.h.recreatePod(ctx, decision.Pod)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// inFlightHeal - вылеченный Pod контроллера, замена которого еще не стала Ready
+type inFlightHeal struct {
+	Pod   string
+	Since time.Time
+}
+
+// replacementTracker пропускает не больше одного heal'а на ReplicaSet или StatefulSet:
+// соседние Pod'ы лечатся только после того, как замена вылеченного Pod'а стала Ready
+// или истек --replacement-timeout. Иначе healer сам может положить весь workload.
+type replacementTracker struct {
+	mu       sync.Mutex
+	inFlight map[types.UID]inFlightHeal
+}
+
+func newReplacementTracker() *replacementTracker {
+	return &replacementTracker{inFlight: make(map[types.UID]inFlightHeal)}
+}
+
+func controllerUID(pod *corev1.Pod) (types.UID, bool) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return "", false
+	}
+	return ref.UID, true
+}
+
+// start отмечает начало heal'а Pod'а
+func (t *replacementTracker) start(pod *corev1.Pod, now time.Time) {
+	uid, ok := controllerUID(pod)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inFlight[uid] = inFlightHeal{Pod: pod.Name, Since: now}
+}
+
+// cancel снимает отметку неудавшегося heal'а: замены не будет
+func (t *replacementTracker) cancel(pod *corev1.Pod) {
+	uid, ok := controllerUID(pod)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if heal, exists := t.inFlight[uid]; exists && heal.Pod == pod.Name {
+		delete(t.inFlight, uid)
+	}
+}
+
+// waiting возвращает незавершенный heal соседа Pod'а. Истекшие ожидания снимаются.
+func (t *replacementTracker) waiting(pod *corev1.Pod, now time.Time, timeout time.Duration) (inFlightHeal, bool) {
+	uid, ok := controllerUID(pod)
+	if !ok || timeout <= 0 {
+		return inFlightHeal{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	heal, exists := t.inFlight[uid]
+	if !exists {
+		return inFlightHeal{}, false
+	}
+	if now.Sub(heal.Since) >= timeout {
+		delete(t.inFlight, uid)
+		return inFlightHeal{}, false
+	}
+	return heal, true
+}
+
+// observe снимает ожидание, когда Pod того же контроллера, созданный после heal'а, стал Ready.
+// Замена Pod'а StatefulSet получает то же имя, поэтому сравнивается время создания.
+func (t *replacementTracker) observe(pod *corev1.Pod) {
+	uid, ok := controllerUID(pod)
+	if !ok || !isPodReady(pod) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	heal, exists := t.inFlight[uid]
+	if !exists || pod.CreationTimestamp.Time.Before(heal.Since.Truncate(time.Second)) {
+		return
+	}
+	delete(t.inFlight, uid)
+}
+
+func replacementWaitReason(heal inFlightHeal, now time.Time) string {
+	return fmt.Sprintf("waiting for the replacement of pod %s healed %v ago to become ready",
+		heal.Pod, now.Sub(heal.Since).Round(time.Second))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// StuckPodReport - одна запись отчета о зависшем Pod'е
+type StuckPodReport struct {
+	Cluster   string        `json:"cluster"`
+	Namespace string        `json:"namespace"`
+	Pod       string        `json:"pod"`
+	Owner     string        `json:"owner,omitempty"`
+	Reason    StuckReason   `json:"reason"`
+	Code      ReasonCode    `json:"code"`
+	Detail    string        `json:"detail"`
+	Action    HealingAction `json:"action"`
+	Message   string        `json:"message,omitempty"`
+}
+
+// Report - результат однократного сканирования кластера
+type Report struct {
+	GeneratedAt time.Time        `json:"generatedAt"`
+	ScannedPods int              `json:"scannedPods"`
+	StuckPods   []StuckPodReport `json:"stuckPods"`
+}
+
+// Report сканирует кластер один раз и описывает, что healer сделал бы с каждым
+// зависшим Pod'ом. Ничего не удаляет и не создает событий.
+func (h *PodHealer) Report(ctx context.Context) (*Report, error) {
+	if err := h.loadNamespaces(ctx); err != nil {
+		return nil, err
+	}
+
+	pods, err := h.listWatchedPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := h.clock.Now()
+	report := &Report{
+		GeneratedAt: now.UTC(),
+		ScannedPods: len(pods),
+		StuckPods:   []StuckPodReport{},
+	}
+	for i := range pods {
+		decision := h.evaluatePod(ctx, &pods[i], now)
+		if decision == nil {
+			continue
+		}
+
+		report.StuckPods = append(report.StuckPods, h.reportEntry(decision))
+	}
+
+	return report, nil
+}
+
+func (h *PodHealer) reportEntry(decision *healingDecision) StuckPodReport {
+	entry := StuckPodReport{
+		Cluster:   h.cluster,
+		Namespace: decision.Pod.Namespace,
+		Pod:       decision.Pod.Name,
+		Reason:    decision.Reason,
+		Code:      decision.Code,
+		Detail:    decision.Detail,
+		Action:    decision.Action,
+		Message:   decision.Message,
+	}
+	if decision.Owner != nil {
+		entry.Owner = decision.Owner.String()
+	}
+	return entry
+}
+
+// writeReport печатает отчет в формате json или yaml
+func writeReport(w io.Writer, report *Report, format string) error {
+	return writeOutput(w, report, format)
+}
+
+func writeOutput(w io.Writer, value interface{}, format string) error {
+	var data []byte
+	var err error
+
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(value, "", "  ")
+		data = append(data, '\n')
+	case "yaml":
+		data, err = yaml.Marshal(value)
+	default:
+		return fmt.Errorf("unknown output format %q, expected json or yaml", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// ResourceSignalsConfig - потребление ресурсов из metrics-server как дополнительный сигнал
+// для NotReady Pod'ов. Контейнер, упершийся в limit памяти или CPU, после рестарта
+// упрется в него снова: ему нужны ресурсы, а не пересоздание.
+type ResourceSignalsConfig struct {
+	Enabled bool
+	// Saturation - доля limit'а, начиная с которой контейнер считается упершимся в него
+	Saturation float64
+}
+
+// resourceSaturation описывает контейнеры Pod'а, потребление которых близко к limit'ам,
+// или возвращает пустую строку
+func (h *PodHealer) resourceSaturation(ctx context.Context, pod *corev1.Pod) string {
+	if h.podMetrics == nil {
+		return ""
+	}
+	metrics, err := h.podMetrics.MetricsV1beta1().PodMetricses(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		klog.ErrorS(err, "Failed to get pod metrics", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name)
+		return ""
+	}
+
+	limits := make(map[string]corev1.ResourceList)
+	for _, container := range pod.Spec.Containers {
+		limits[container.Name] = container.Resources.Limits
+	}
+	var saturated []string
+	for _, container := range metrics.Containers {
+		for _, name := range []corev1.ResourceName{corev1.ResourceMemory, corev1.ResourceCPU} {
+			limit, ok := limits[container.Name][name]
+			usage, used := container.Usage[name]
+			if !ok || !used || limit.IsZero() {
+				continue
+			}
+			if ratio := quantityRatio(usage, limit); ratio >= h.config.ResourceSignals.Saturation {
+				saturated = append(saturated, fmt.Sprintf("container %s uses %s of %s %s limit (%.0f%%)",
+					container.Name, usage.String(), limit.String(), name, ratio*100))
+			}
+		}
+	}
+	return strings.Join(saturated, ", ")
+}
+
+func quantityRatio(usage, limit resource.Quantity) float64 {
+	return float64(usage.MilliValue()) / float64(limit.MilliValue())
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ActionRollback HealingAction = "rollback"
+
+	annotationDeploymentRevision = "deployment.kubernetes.io/revision"
+)
+
+// RollbackConfig - откат Deployment'а, новый ReplicaSet которого сразу ушел в crash loop.
+// Удаление таких Pod'ов бесполезно: новые Pod'ы с той же конфигурацией упадут снова.
+type RollbackConfig struct {
+	Enabled bool
+	// Window - crash loop, начавшийся в пределах Window после rollout'а, считается вызванным им
+	Window time.Duration
+}
+
+// deploymentRevisions - текущий и предыдущий ReplicaSet'ы Deployment'а
+type deploymentRevisions struct {
+	Current  *appsv1.ReplicaSet
+	Previous *appsv1.ReplicaSet
+}
+
+func replicaSetRevision(rs *appsv1.ReplicaSet) int64 {
+	revision, err := strconv.ParseInt(rs.Annotations[annotationDeploymentRevision], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return revision
+}
+
+// getDeploymentRevisions находит ReplicaSet'ы Deployment'а с наибольшей и предыдущей ревизиями
+func (h *PodHealer) getDeploymentRevisions(ctx context.Context, deployment *appsv1.Deployment) (*deploymentRevisions, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	list, err := h.clientset.AppsV1().ReplicaSets(deployment.Namespace).List(ctx,
+		metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := &deploymentRevisions{}
+	for i := range list.Items {
+		rs := &list.Items[i]
+		if !metav1.IsControlledBy(rs, deployment) || replicaSetRevision(rs) == 0 {
+			continue
+		}
+		switch {
+		case revisions.Current == nil || replicaSetRevision(rs) > replicaSetRevision(revisions.Current):
+			revisions.Previous, revisions.Current = revisions.Current, rs
+		case revisions.Previous == nil || replicaSetRevision(rs) > replicaSetRevision(revisions.Previous):
+			revisions.Previous = rs
+		}
+	}
+	return revisions, nil
+}
+
+// rollbackReason проверяет, начался ли crash loop Pod'а сразу после rollout'а Deployment'а,
+// и возвращает причину отката или пустую строку
+func (h *PodHealer) rollbackReason(ctx context.Context, pod *corev1.Pod, owner *workloadOwner, stuck *stuckCondition) string {
+	if !h.config.Rollback.Enabled || (stuck.Reason != ReasonCrashLoop && stuck.Reason != ReasonTooManyRestarts) {
+		return ""
+	}
+	deployment, ok := owner.Object.(*appsv1.Deployment)
+	if !ok {
+		return ""
+	}
+	revisions, err := h.getDeploymentRevisions(ctx, deployment)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list deployment revisions", "cluster", h.cluster, "owner", owner.String())
+		return ""
+	}
+	if revisions.Current == nil || revisions.Previous == nil {
+		return ""
+	}
+
+	// Падают Pod'ы последней ревизии, и падать они начали вскоре после ее появления.
+	// После отката текущим становится старый ReplicaSet, поэтому повторного отката не будет.
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil || ref.UID != revisions.Current.UID {
+		return ""
+	}
+	sinceRollout := stuck.Since.Sub(revisions.Current.CreationTimestamp.Time)
+	if sinceRollout > h.config.Rollback.Window {
+		return ""
+	}
+	if sinceRollout < 0 {
+		sinceRollout = 0
+	}
+	return fmt.Sprintf("crash loop started %v after rollout of revision %d, rolling back to revision %d",
+		sinceRollout.Round(time.Second), replicaSetRevision(revisions.Current), replicaSetRevision(revisions.Previous))
+}
+
+// rollbackDeployment возвращает Deployment к шаблону предыдущего ReplicaSet'а
+func (h *PodHealer) rollbackDeployment(ctx context.Context, deployment *appsv1.Deployment) (*deploymentRevisions, error) {
+	name := deployment.Namespace + "/" + deployment.Name
+	if deployment.Spec.Paused {
+		return nil, fmt.Errorf("Deployment %s is paused", name)
+	}
+	revisions, err := h.getDeploymentRevisions(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+	if revisions.Previous == nil {
+		return nil, fmt.Errorf("Deployment %s has no previous revision to roll back to", name)
+	}
+
+	// pod-template-hash выставляет контроллер Deployment'ов, в шаблоне его быть не должно
+	template := revisions.Previous.Spec.Template.DeepCopy()
+	delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "replace", "path": "/spec/template", "value": template},
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = h.clientset.AppsV1().Deployments(deployment.Namespace).Patch(ctx, deployment.Name,
+		types.JSONPatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	klog.InfoS("Rolled back deployment", "cluster", h.cluster, "owner", "Deployment "+name,
+		"fromRevision", replicaSetRevision(revisions.Current), "toRevision", replicaSetRevision(revisions.Previous))
+	return revisions, nil
+}
+
+// rollbackRemediator возвращает Deployment к шаблону предыдущего ReplicaSet'а, как kubectl rollout undo
+type rollbackRemediator struct{ h *PodHealer }
+
+func (rollbackRemediator) Action() HealingAction { return ActionRollback }
+
+func (r rollbackRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	deployment, ok := ownerObject(decision.Owner).(*appsv1.Deployment)
+	if !ok {
+		return fmt.Errorf("rollback requires a Deployment owner")
+	}
+	revisions, err := r.h.rollbackDeployment(ctx, deployment)
+	if err != nil {
+		return err
+	}
+	decisionEventf(r.h.recorder, deployment, decision, corev1.EventTypeWarning, "RolledBack",
+		"Rolled back to revision %d after pod %s crash looped: %s",
+		replicaSetRevision(revisions.Previous), decision.Pod.Name, decision.Detail)
+	return nil
+}
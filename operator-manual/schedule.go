@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule - cron-выражение из 5 полей: минута, час, день месяца, месяц, день недели.
+// Момент времени попадает в окно, если выражение совпадает с его минутой.
+// Диапазоны вида "22-6" переходят через границу поля (22-23 и 0-6).
+type Schedule struct {
+	spec   string
+	minute []bool
+	hour   []bool
+	dom    []bool
+	month  []bool
+	dow    []bool
+	anyDom bool
+	anyDow bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// ParseSchedule разбирает cron-выражение
+func ParseSchedule(spec string) (*Schedule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, got %d", spec, len(parts))
+	}
+
+	var parsed [5][]bool
+	for i, part := range parts {
+		values, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+		parsed[i] = values
+	}
+
+	return &Schedule{
+		spec:   spec,
+		minute: parsed[0],
+		hour:   parsed[1],
+		dom:    parsed[2],
+		month:  parsed[3],
+		dow:    parsed[4],
+		anyDom: parts[2] == "*",
+		anyDow: parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(value string, field cronField) ([]bool, error) {
+	result := make([]bool, field.max+1)
+	for _, item := range strings.Split(value, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step in %s field %q", field.name, item)
+			}
+			step = n
+			item = item[:i]
+		}
+
+		start, end := field.min, field.max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if start, err = parseCronValue(bounds[0], field); err != nil {
+				return nil, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = parseCronValue(bounds[1], field); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		span := end - start
+		if span < 0 {
+			span += field.max - field.min + 1
+		}
+		for offset := 0; offset <= span; offset += step {
+			v := start + offset
+			if v > field.max {
+				v -= field.max - field.min + 1
+			}
+			result[v] = true
+		}
+	}
+	return result, nil
+}
+
+func parseCronValue(value string, field cronField) (int, error) {
+	n, err := strconv.Atoi(value)
+	// 7 - допустимое обозначение воскресенья
+	if err == nil && field.name == "day of week" && n == 7 {
+		n = 0
+	}
+	if err != nil || n < field.min || n > field.max {
+		return 0, fmt.Errorf("invalid %s value %q", field.name, value)
+	}
+	return n, nil
+}
+
+// Matches проверяет, попадает ли момент времени в расписание
+func (s *Schedule) Matches(t time.Time) bool {
+	if !s.minute[t.Minute()] || !s.hour[t.Hour()] || !s.month[int(t.Month())] {
+		return false
+	}
+
+	// Как в cron: если заданы и день месяца, и день недели, достаточно совпадения одного из них
+	domMatch, dowMatch := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	switch {
+	case s.anyDom && s.anyDow:
+		return true
+	case s.anyDom:
+		return dowMatch
+	case s.anyDow:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// parseSchedules разбирает список cron-выражений, разделенных ";"
+func parseSchedules(value string) ([]*Schedule, error) {
+	var schedules []*Schedule
+	for _, spec := range strings.Split(value, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		schedule, err := ParseSchedule(spec)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+// anyScheduleMatches проверяет, попадает ли момент времени хотя бы в одно расписание
+func anyScheduleMatches(schedules []*Schedule, t time.Time) bool {
+	for _, schedule := range schedules {
+		if schedule.Matches(t) {
+			return true
+		}
+	}
+	return false
+}
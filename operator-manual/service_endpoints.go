@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const ReasonServiceEndpoints StuckReason = "ServiceEndpointsNotReady"
+
+// ServiceEndpointsConfig - обнаружение Service'ов, все endpoints которых NotReady.
+// Пороги отдельных Pod'ов рассчитаны на одиночные сбои: когда NotReady все Pod'ы
+// Service'а сразу, сервис уже недоступен, и ждать порога каждого Pod'а незачем.
+type ServiceEndpointsConfig struct {
+	// Timeout - сколько все endpoints Service'а должны быть NotReady, 0 отключает проверку
+	Timeout time.Duration
+	// Interval - как часто проверяются Service'ы
+	Interval time.Duration
+}
+
+func (c ServiceEndpointsConfig) enabled() bool { return c.Timeout > 0 }
+
+// serviceBackingPods возвращает Pod'ы за NotReady адресами Service'а, если готовых адресов нет
+func (h *PodHealer) serviceBackingPods(ctx context.Context, endpoints *corev1.Endpoints) ([]*corev1.Pod, error) {
+	var pods []*corev1.Pod
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) > 0 {
+			return nil, nil
+		}
+		for _, address := range subset.NotReadyAddresses {
+			if address.TargetRef == nil || address.TargetRef.Kind != "Pod" {
+				continue
+			}
+			pod, err := h.clientset.CoreV1().Pods(endpoints.Namespace).Get(ctx, address.TargetRef.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// checkServiceEndpoints находит Service'ы без единого Ready endpoint'а дольше Timeout и
+// проводит их Pod'ы через политики healing. Начало сбоя - момент, когда NotReady стал
+// последний из Pod'ов Service'а, так что проверке не нужно помнить прошлые проходы.
+func (h *PodHealer) checkServiceEndpoints(ctx context.Context) {
+	now := h.clock.Now()
+	for _, namespace := range h.watchNamespaces() {
+		list, err := h.clientset.CoreV1().Endpoints(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			klog.ErrorS(err, "Failed to list endpoints", "cluster", h.cluster, "namespace", namespace)
+			continue
+		}
+		for i := range list.Items {
+			endpoints := &list.Items[i]
+			if endpoints.Namespace == "kube-system" || !h.namespaceWatched(endpoints.Namespace) {
+				continue
+			}
+			pods, err := h.serviceBackingPods(ctx, endpoints)
+			if err != nil {
+				klog.ErrorS(err, "Failed to get service pods", "cluster", h.cluster, "namespace", endpoints.Namespace,
+					"service", endpoints.Name)
+				continue
+			}
+			if len(pods) == 0 {
+				continue
+			}
+
+			var since time.Time
+			for _, pod := range pods {
+				if isPodReady(pod) {
+					// Endpoints отстают от Pod'а, который уже стал Ready
+					since = time.Time{}
+					break
+				}
+				if notReady := notReadySince(pod); notReady.After(since) {
+					since = notReady
+				}
+			}
+			if since.IsZero() || now.Sub(since) < h.config.ServiceEndpoints.Timeout {
+				continue
+			}
+			detail := fmt.Sprintf("all %d endpoints of service %s/%s are NotReady for %v",
+				len(pods), endpoints.Namespace, endpoints.Name, now.Sub(since).Round(time.Second))
+			for _, pod := range pods {
+				h.healDetectedPod(ctx, pod, &stuckCondition{Reason: ReasonServiceEndpoints, Detail: detail, Since: since}, now)
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import "hash/fnv"
+
+// ShardConfig делит namespaces между репликами healer'а по хэшу имени.
+// Каждая реплика лечит Pod'ы только своих namespaces; с явным списком
+// namespaces она и кэширует только их.
+type ShardConfig struct {
+	// Index - номер реплики от 0 до Total-1
+	Index int
+	// Total - число реплик, 1 отключает шардирование
+	Total int
+}
+
+func (c ShardConfig) enabled() bool {
+	return c.Total > 1
+}
+
+// owns проверяет, относится ли namespace к шарду. Распределение зависит
+// только от имени namespace и Total, поэтому реплики не пересекаются.
+func (c ShardConfig) owns(namespace string) bool {
+	if !c.enabled() {
+		return true
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(namespace))
+	return int(hash.Sum32()%uint32(c.Total)) == c.Index
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SidecarPodPolicy определяет, что делать с Pod'ом, у которого падают только sidecar'ы.
+// Основной контейнер такого Pod'а работает, и удаление Pod'а раз за разом прерывает его
+// ради контейнера, который в новом Pod'е упадет так же.
+type SidecarPodPolicy string
+
+const (
+	// SidecarPod - лечить Pod как обычный зависший Pod
+	SidecarPod            SidecarPodPolicy = "pod"
+	SidecarRolloutRestart SidecarPodPolicy = "rollout-restart"
+	SidecarNotify         SidecarPodPolicy = "notify"
+)
+
+const (
+	ActionSidecarRestart HealingAction = "sidecar-rollout-restart"
+
+	// Имена sidecar-контейнеров Pod'а через запятую
+	annotationSidecars = "healing.kubernetes.io/sidecars"
+	// На владельце остается время последнего rollout restart'а из-за sidecar'ов
+	annotationSidecarRestarted = "healing.kubernetes.io/sidecar-restarted"
+)
+
+// SidecarConfig - обработка Pod'ов, у которых падают только sidecar-контейнеры
+type SidecarConfig struct {
+	Policy SidecarPodPolicy
+	// RestartInterval - как долго после rollout restart'а владельца healer только сообщает о sidecar'ах
+	RestartInterval time.Duration
+}
+
+// failingSidecars возвращает sidecar-контейнеры Pod'а в CrashLoopBackOff, если падают только они,
+// а остальные контейнеры работают и готовы. Sidecar'ы перечисляются аннотацией Pod'а.
+func failingSidecars(pod *corev1.Pod) []string {
+	sidecars := make(map[string]bool)
+	for _, name := range strings.Split(pod.Annotations[annotationSidecars], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			sidecars[name] = true
+		}
+	}
+	if len(sidecars) == 0 || pod.Status.Phase != corev1.PodRunning {
+		return nil
+	}
+
+	var failing []string
+	healthy := 0
+	for _, status := range pod.Status.ContainerStatuses {
+		crashLooping := status.State.Waiting != nil && status.State.Waiting.Reason == "CrashLoopBackOff"
+		switch {
+		case sidecars[status.Name] && crashLooping:
+			failing = append(failing, status.Name)
+		case sidecars[status.Name]:
+		case status.State.Running == nil || !status.Ready:
+			return nil
+		default:
+			healthy++
+		}
+	}
+	if healthy == 0 {
+		return nil
+	}
+	return failing
+}
+
+// sidecarDecision выбирает действие для Pod'а, у которого падают только sidecar'ы.
+// Rollout restart владельца делается один раз за RestartInterval: если sidecar'ы
+// новых Pod'ов падают снова, пересоздание не помогает и остается сообщить о них.
+func (h *PodHealer) sidecarDecision(decision *healingDecision, sidecars []string, now time.Time) *healingDecision {
+	message := fmt.Sprintf("only sidecar containers %s are failing, main containers are healthy", strings.Join(sidecars, ", "))
+	decision.Action, decision.Message = ActionNotify, message+", sidecar pod policy is notify"
+	if h.config.Sidecars.Policy != SidecarRolloutRestart {
+		return decision
+	}
+	if ownerPodTemplate(decision.Owner) == nil {
+		decision.Message = fmt.Sprintf("%s, %s does not support rollout restart", message, decision.Owner)
+		return decision
+	}
+	if value := decision.Owner.Object.GetAnnotations()[annotationSidecarRestarted]; value != "" {
+		if restarted, err := time.Parse(time.RFC3339, value); err == nil && now.Before(restarted.Add(h.config.Sidecars.RestartInterval)) {
+			decision.Message = fmt.Sprintf("%s, %s was already restarted for sidecars at %s", message, decision.Owner, value)
+			return decision
+		}
+	}
+	decision.Action, decision.Message = ActionSidecarRestart, message
+	return decision
+}
+
+// sidecarRestartRemediator перезапускает Pod'ы владельца и запоминает время перезапуска на нем
+type sidecarRestartRemediator struct{ h *PodHealer }
+
+func (sidecarRestartRemediator) Action() HealingAction { return ActionSidecarRestart }
+
+func (r sidecarRestartRemediator) Remediate(ctx context.Context, decision *healingDecision) error {
+	if decision.Owner == nil {
+		return fmt.Errorf("sidecar rollout restart requires an owner")
+	}
+	now := r.h.clock.Now().UTC().Format(time.RFC3339)
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{annotationSidecarRestarted: now},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{"kubectl.kubernetes.io/restartedAt": now},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.h.patchOwner(ctx, decision.Owner, patch); err != nil {
+		return err
+	}
+	decisionEventf(r.h.recorder, decision.Pod, decision, corev1.EventTypeWarning, "SidecarRolloutRestart",
+		"%s, restarted %s", decision.Message, decision.Owner)
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/klog/v2"
+)
+
+// snapshotClock - часы, остановленные на моменте снимка кластера
+type snapshotClock struct{ at time.Time }
+
+func (c snapshotClock) Now() time.Time                  { return c.at }
+func (c snapshotClock) Since(t time.Time) time.Duration { return c.at.Sub(t) }
+
+// loadSnapshot читает объекты кластера из YAML или JSON файла либо из всех .yaml, .yml
+// и .json файлов каталога. Файл может содержать несколько документов и списки kind: List,
+// как вывод kubectl get -o yaml. Объекты неизвестных healer'у видов пропускаются.
+func loadSnapshot(path string) ([]runtime.Object, error) {
+	var files []string
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		err = filepath.WalkDir(path, func(file string, entry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(file)) {
+			case ".yaml", ".yml", ".json":
+				if !entry.IsDir() {
+					files = append(files, file)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		files = []string{path}
+	}
+
+	var objects []runtime.Object
+	for _, file := range files {
+		loaded, err := loadSnapshotFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		objects = append(objects, loaded...)
+	}
+	return objects, nil
+}
+
+func loadSnapshotFile(path string) ([]runtime.Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var objects []runtime.Object
+	decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		document := &unstructured.Unstructured{}
+		if err := decoder.Decode(&document.Object); err == io.EOF {
+			return objects, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if len(document.Object) == 0 {
+			continue
+		}
+		items := []*unstructured.Unstructured{document}
+		if document.IsList() {
+			items = nil
+			err := document.EachListItem(func(item runtime.Object) error {
+				items = append(items, item.(*unstructured.Unstructured))
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, item := range items {
+			obj, err := scheme.Scheme.New(item.GroupVersionKind())
+			if err != nil {
+				klog.V(2).InfoS("Skipping snapshot object of unknown kind", "file", path, "kind", item.GetKind(), "name", item.GetName())
+				continue
+			}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, obj); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", item.GetKind(), item.GetName(), err)
+			}
+			objects = append(objects, obj)
+		}
+	}
+}
+
+// snapshotTime - самый поздний момент, записанный в объектах снимка: состояние
+// кластера оценивается так, как healer увидел бы его при снятии снимка
+func snapshotTime(objects []runtime.Object) time.Time {
+	var latest time.Time
+	observe := func(t time.Time) {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	for _, obj := range objects {
+		switch obj := obj.(type) {
+		case *corev1.Pod:
+			observe(obj.CreationTimestamp.Time)
+			for _, condition := range obj.Status.Conditions {
+				observe(condition.LastTransitionTime.Time)
+			}
+			for _, status := range podContainerStatuses(obj) {
+				for _, state := range []corev1.ContainerState{status.State, status.LastTerminationState} {
+					if state.Running != nil {
+						observe(state.Running.StartedAt.Time)
+					}
+					if state.Terminated != nil {
+						observe(state.Terminated.FinishedAt.Time)
+					}
+				}
+			}
+		case *corev1.Event:
+			observe(eventTime(obj))
+		case *corev1.Node:
+			for _, condition := range obj.Status.Conditions {
+				observe(condition.LastHeartbeatTime.Time)
+			}
+		}
+	}
+	return latest
+}
+
+// newSnapshotClientset создает fake clientset с объектами снимка. Fake clientset
+// не фильтрует списки по field selector'ам, а события Pod'а выбираются именно так.
+func newSnapshotClientset(objects []runtime.Object) *fake.Clientset {
+	clientset := fake.NewSimpleClientset(objects...)
+	clientset.PrependReactor("list", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		restrictions := action.(k8stesting.ListAction).GetListRestrictions()
+		if restrictions.Fields == nil || restrictions.Fields.Empty() {
+			return false, nil, nil
+		}
+		list := &corev1.EventList{}
+		for _, obj := range objects {
+			event, ok := obj.(*corev1.Event)
+			if !ok || (action.GetNamespace() != "" && event.Namespace != action.GetNamespace()) {
+				continue
+			}
+			if restrictions.Fields.Matches(fields.Set{
+				"involvedObject.kind": event.InvolvedObject.Kind,
+				"involvedObject.name": event.InvolvedObject.Name,
+				"involvedObject.uid":  string(event.InvolvedObject.UID),
+			}) {
+				list.Items = append(list.Items, *event)
+			}
+		}
+		return true, list, nil
+	})
+	return clientset
+}
+
+// simulateSnapshot оценивает политику на снимке кластера без подключения к нему.
+// Нулевой at означает момент снимка.
+func simulateSnapshot(ctx context.Context, config Config, path string, at time.Time) (*Report, error) {
+	objects, err := loadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	if at.IsZero() {
+		if at = snapshotTime(objects); at.IsZero() {
+			at = time.Now()
+		}
+	}
+
+	// Как и report, healer без informer'ов читает ноды и владельцев из clientset'а
+	healer, err := newPodHealer("snapshot", newSnapshotClientset(objects), snapshotClock{at: at}, config)
+	if err != nil {
+		return nil, err
+	}
+	return healer.Report(ctx)
+}
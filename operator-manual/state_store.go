@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const stateConfigMapKey = "state.json"
+
+// StateConfig - ConfigMap, в котором healer хранит счетчики между перезапусками.
+// Cooldown владельцев и эскалация и так хранятся в их аннотациях.
+type StateConfig struct {
+	Namespace string
+	Name      string
+	// Interval - как часто состояние сохраняется в ConfigMap
+	Interval time.Duration
+}
+
+func (c StateConfig) enabled() bool {
+	return c.Name != ""
+}
+
+// parseStateConfigMap разбирает значение --state-configmap вида namespace/name
+func parseStateConfigMap(value string) (string, string, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("expected namespace/name, got %q", value)
+	}
+	return parts[0], parts[1], nil
+}
+
+// persistedState - счетчики heal'ов, без которых после перезапуска healer
+// снова вылечил бы все сразу: попытки для эскалации, churn для флаппинга,
+// бюджеты namespaces и недавние heal'ы для rate limiter'а
+type persistedState struct {
+	SavedAt        time.Time              `json:"savedAt"`
+	HealAttempts   map[string][]time.Time `json:"healAttempts,omitempty"`
+	OwnerChurn     map[string][]time.Time `json:"ownerChurn,omitempty"`
+	NamespaceHeals map[string][]time.Time `json:"namespaceHeals,omitempty"`
+	RecentHeals    []time.Time            `json:"recentHeals,omitempty"`
+}
+
+// snapshotState копирует счетчики, отбрасывая записи за пределами их окон
+func (h *PodHealer) snapshotState(now time.Time) persistedState {
+	state := persistedState{
+		SavedAt:        now.UTC(),
+		HealAttempts:   map[string][]time.Time{},
+		OwnerChurn:     map[string][]time.Time{},
+		NamespaceHeals: map[string][]time.Time{},
+	}
+	copyRecent := func(target, source map[string][]time.Time, window time.Duration) {
+		for key, times := range source {
+			if recent := recentAttempts(append([]time.Time(nil), times...), now, window); len(recent) > 0 {
+				target[key] = recent
+			}
+		}
+	}
+
+	h.attemptsMu.Lock()
+	copyRecent(state.HealAttempts, h.attempts, h.config.Escalation.Window)
+	h.attemptsMu.Unlock()
+
+	h.flaps.mu.Lock()
+	copyRecent(state.OwnerChurn, h.flaps.churn, h.config.Flapping.Window)
+	h.flaps.mu.Unlock()
+
+	h.budgets.mu.Lock()
+	copyRecent(state.NamespaceHeals, h.budgets.heals, h.config.NamespaceBudget.Window)
+	h.budgets.mu.Unlock()
+
+	h.queueMu.Lock()
+	state.RecentHeals = recentAttempts(append([]time.Time(nil), h.healTimes...), now, time.Minute)
+	h.queueMu.Unlock()
+	return state
+}
+
+// restoreState возвращает сохраненные счетчики и расходует токены rate limiter'а
+// на heal'ы, выполненные за последнюю минуту до перезапуска
+func (h *PodHealer) restoreState(state persistedState, now time.Time) {
+	h.attemptsMu.Lock()
+	for key, times := range state.HealAttempts {
+		h.attempts[key] = append(h.attempts[key], times...)
+	}
+	h.attemptsMu.Unlock()
+
+	h.flaps.mu.Lock()
+	for key, times := range state.OwnerChurn {
+		h.flaps.churn[key] = append(h.flaps.churn[key], times...)
+	}
+	h.flaps.mu.Unlock()
+
+	h.budgets.mu.Lock()
+	for namespace, times := range state.NamespaceHeals {
+		h.budgets.heals[namespace] = append(h.budgets.heals[namespace], times...)
+	}
+	h.budgets.mu.Unlock()
+
+	h.queueMu.Lock()
+	h.healTimes = append(h.healTimes, recentAttempts(state.RecentHeals, now, time.Minute)...)
+	spent := len(h.healTimes)
+	if burst := h.limiter.Burst(); spent > burst {
+		spent = burst
+	}
+	h.queueMu.Unlock()
+	if spent > 0 {
+		h.limiter.AllowN(now, spent)
+	}
+}
+
+// loadState читает состояние из ConfigMap, отсутствие ConfigMap не ошибка
+func (h *PodHealer) loadState(ctx context.Context) error {
+	config := h.config.State
+	configMap, err := h.clientset.CoreV1().ConfigMaps(config.Namespace).Get(ctx, config.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	state := persistedState{}
+	if err := json.Unmarshal([]byte(configMap.Data[stateConfigMapKey]), &state); err != nil {
+		return fmt.Errorf("invalid state in configmap %s/%s: %v", config.Namespace, config.Name, err)
+	}
+	h.restoreState(state, h.clock.Now())
+	klog.InfoS("Restored healing state", "cluster", h.cluster, "configmap", config.Namespace+"/"+config.Name,
+		"savedAt", state.SavedAt, "owners", len(state.HealAttempts), "recentHeals", len(state.RecentHeals))
+	return nil
+}
+
+// saveState записывает состояние в ConfigMap, если оно изменилось
+func (h *PodHealer) saveState(ctx context.Context) error {
+	state := h.snapshotState(h.clock.Now())
+	// SavedAt не должен делать каждое сохранение изменением
+	savedAt := state.SavedAt
+	state.SavedAt = time.Time{}
+	unchanged, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if string(unchanged) == h.unchangedState {
+		return nil
+	}
+	state.SavedAt = savedAt
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	config := h.config.State
+	if err := h.writeConfigMap(ctx, config.Namespace, config.Name, map[string]string{stateConfigMapKey: string(data)}); err != nil {
+		return err
+	}
+	h.unchangedState = string(unchanged)
+	return nil
+}
+
+// writeConfigMap создает ConfigMap или обновляет в нем ключи data, не трогая остальные
+func (h *PodHealer) writeConfigMap(ctx context.Context, namespace, name string, data map[string]string) error {
+	configMaps := h.clientset.CoreV1().ConfigMaps(namespace)
+	configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": eventComponent},
+			},
+			Data: data,
+		}, metav1.CreateOptions{})
+	case err == nil:
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		for key, value := range data {
+			configMap.Data[key] = value
+		}
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// runStatePersistence периодически сохраняет состояние healer'а
+func (h *PodHealer) runStatePersistence(stop <-chan struct{}) {
+	go wait.Until(func() {
+		if err := h.saveState(context.TODO()); err != nil {
+			klog.ErrorS(err, "Failed to save healing state", "cluster", h.cluster,
+				"configmap", h.config.State.Namespace+"/"+h.config.State.Name)
+		}
+	}, h.config.State.Interval, stop)
+}
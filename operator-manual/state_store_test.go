@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStatePersistence(t *testing.T) {
+	config := Config{
+		MaxHealsPerMinute: 3,
+		Escalation:        EscalationConfig{Threshold: 3, Window: time.Hour},
+		State:             StateConfig{Namespace: "pod-healer-system", Name: "pod-healer-state", Interval: time.Minute},
+	}
+	healer, clientset, _ := newTestHealer(t, config)
+	healer.attempts["Deployment/default/web"] = []time.Time{testNow.Add(-2 * time.Hour), testNow.Add(-10 * time.Minute)}
+	healer.healTimes = []time.Time{testNow.Add(-30 * time.Second), testNow.Add(-10 * time.Second)}
+	if err := healer.saveState(context.TODO()); err != nil {
+		t.Fatalf("saveState: %v", err)
+	}
+
+	configMap, err := clientset.CoreV1().ConfigMaps("pod-healer-system").Get(context.TODO(), "pod-healer-state", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("state configmap not created: %v", err)
+	}
+	// Неизменившееся состояние повторно не записывается
+	configMap.Data[stateConfigMapKey] = "{}"
+	if _, err := clientset.CoreV1().ConfigMaps("pod-healer-system").Update(context.TODO(), configMap, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := healer.saveState(context.TODO()); err != nil {
+		t.Fatalf("saveState: %v", err)
+	}
+	if stored, _ := clientset.CoreV1().ConfigMaps("pod-healer-system").Get(context.TODO(), "pod-healer-state", metav1.GetOptions{}); stored.Data[stateConfigMapKey] != "{}" {
+		t.Errorf("unchanged state was saved again")
+	}
+	healer.unchangedState = ""
+	if err := healer.saveState(context.TODO()); err != nil {
+		t.Fatalf("saveState: %v", err)
+	}
+	configMap, _ = clientset.CoreV1().ConfigMaps("pod-healer-system").Get(context.TODO(), "pod-healer-state", metav1.GetOptions{})
+
+	restarted, _, _ := newTestHealer(t, config, configMap)
+	if err := restarted.loadState(context.TODO()); err != nil {
+		t.Fatalf("loadState: %v", err)
+	}
+	if attempts := restarted.attempts["Deployment/default/web"]; len(attempts) != 1 {
+		t.Errorf("restored attempts = %v, want only the one inside the escalation window", attempts)
+	}
+	// Два heal'а до перезапуска оставляют один токен из трех
+	if !restarted.limiter.AllowN(testNow, 1) {
+		t.Errorf("limiter has no tokens left after restore")
+	}
+	if restarted.limiter.AllowN(testNow, 1) {
+		t.Errorf("limiter tokens spent before restart were not restored")
+	}
+}
+
+func TestLoadStateWithoutConfigMap(t *testing.T) {
+	healer, _, _ := newTestHealer(t, Config{State: StateConfig{Namespace: "pod-healer-system", Name: "pod-healer-state"}})
+	if err := healer.loadState(context.TODO()); err != nil {
+		t.Errorf("loadState without configmap: %v", err)
+	}
+}
+
+func TestHealingSummary(t *testing.T) {
+	config := Config{Summary: SummaryConfig{
+		Period: 24 * time.Hour, Namespace: "pod-healer-system", Name: "pod-healer-summary", Top: 1,
+	}}
+	healer, clientset, clock := newTestHealer(t, config)
+	healer.publishSummary(context.TODO())
+
+	record := func(namespace, owner string, code ReasonCode, result string) {
+		healer.summaries.record(DecisionRecord{
+			StuckPodReport: StuckPodReport{Namespace: namespace, Owner: owner, Code: code},
+			Result:         result,
+		})
+	}
+	record("default", "Deployment default/web", CodeCrashLoop, "healed")
+	record("default", "Deployment default/web", CodeCrashLoop, "healed")
+	record("batch", "StatefulSet batch/db", CodeOOM, "healed")
+	record("batch", "StatefulSet batch/db", CodeOOM, "failed")
+	record("default", "Deployment default/web", CodeCrashLoop, "rate-limited")
+	healer.flaps.observeDeletion(testPod("db-0", time.Hour, withOwner("StatefulSet", "db"),
+		func(pod *corev1.Pod) { pod.Namespace = "batch" }), testNow)
+
+	// Период еще не закончился
+	healer.publishSummary(context.TODO())
+	if _, err := clientset.CoreV1().ConfigMaps("pod-healer-system").Get(context.TODO(), "pod-healer-summary", metav1.GetOptions{}); err == nil {
+		t.Fatal("summary written before the end of the period")
+	}
+
+	clock.Step(24 * time.Hour)
+	healer.publishSummary(context.TODO())
+	configMap, err := clientset.CoreV1().ConfigMaps("pod-healer-system").Get(context.TODO(), "pod-healer-summary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("summary configmap not created: %v", err)
+	}
+	summary := HealingSummary{}
+	if err := json.Unmarshal([]byte(configMap.Data[summaryConfigMapKey]), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Decisions != 4 || summary.Heals != 3 || summary.Failed != 1 {
+		t.Errorf("summary counts %d decisions, %d heals, %d failed, want 4, 3, 1", summary.Decisions, summary.Heals, summary.Failed)
+	}
+	want := []SummaryCount{{Name: "default", Count: 2}, {Name: "batch", Count: 1}}
+	if !reflect.DeepEqual(summary.HealsByNamespace, want) {
+		t.Errorf("heals by namespace %v, want %v", summary.HealsByNamespace, want)
+	}
+	if len(summary.TopWorkloads) != 1 || summary.TopWorkloads[0].Name != "Deployment default/web" {
+		t.Errorf("top workloads %v", summary.TopWorkloads)
+	}
+	if len(summary.TopFlapping) != 1 || summary.TopFlapping[0].Name != "StatefulSet batch/db" {
+		t.Errorf("top flapping %v", summary.TopFlapping)
+	}
+	if !summary.To.Equal(summary.From.Add(24*time.Hour)) || summary.From.Hour() != 0 {
+		t.Errorf("summary period %v - %v is not a UTC day", summary.From, summary.To)
+	}
+
+	// Следующая сводка сдвигает прошлую
+	clock.Step(24 * time.Hour)
+	healer.publishSummary(context.TODO())
+	configMap, _ = clientset.CoreV1().ConfigMaps("pod-healer-system").Get(context.TODO(), "pod-healer-summary", metav1.GetOptions{})
+	if configMap.Data[previousSummaryKey] == "" || configMap.Data[previousSummaryKey] == configMap.Data[summaryConfigMapKey] {
+		t.Errorf("previous summary was not kept")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Detector обнаруживает одну причину зависания Pod'а.
+// Detect возвращает nil, если причина к Pod'у не относится.
+type Detector interface {
+	Reason() StuckReason
+	Detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition
+}
+
+// Remediator выполняет одно действие над зависшим Pod'ом.
+// Метрики, cooldown владельца и учет попыток ведет вызывающий код.
+type Remediator interface {
+	Action() HealingAction
+	Remediate(ctx context.Context, decision *healingDecision) error
+}
+
+// Встроенные детекторы в порядке проверки: первый сработавший определяет причину
+var builtinDetectors = []func(h *PodHealer) Detector{
+	func(h *PodHealer) Detector { return nodeLostDetector{} },
+	func(h *PodHealer) Detector { return terminatingDetector{} },
+	func(h *PodHealer) Detector { return ephemeralStorageDetector{} },
+	func(h *PodHealer) Detector { return containerConfigDetector{} },
+	func(h *PodHealer) Detector { return containerCreatingDetector{} },
+	func(h *PodHealer) Detector { return imagePullDetector{} },
+	func(h *PodHealer) Detector { return initContainerDetector{} },
+	func(h *PodHealer) Detector { return pendingDetector{} },
+	func(h *PodHealer) Detector { return restartsDetector{} },
+	func(h *PodHealer) Detector { return crashLoopDetector{} },
+	func(h *PodHealer) Detector { return livenessDetector{tracker: h.liveness} },
+	func(h *PodHealer) Detector { return readinessGateDetector{} },
+	func(h *PodHealer) Detector { return notReadyDetector{} },
+}
+
+// Встроенные действия, доступные через --default-action и аннотацию action
+var builtinRemediators = map[HealingAction]func(h *PodHealer) Remediator{
+	ActionDelete:         func(h *PodHealer) Remediator { return deleteRemediator{h} },
+	ActionEvict:          func(h *PodHealer) Remediator { return evictRemediator{h} },
+	ActionRolloutRestart: func(h *PodHealer) Remediator { return rolloutRestartRemediator{h} },
+	ActionScale:          func(h *PodHealer) Remediator { return scaleRemediator{h} },
+	ActionNotify:         func(h *PodHealer) Remediator { return notifyRemediator{h} },
+	ActionQuarantine:     func(h *PodHealer) Remediator { return quarantineRemediator{h} },
+	ActionRecreate:       func(h *PodHealer) Remediator { return recreateRemediator{h} },
+	ActionRollback:       func(h *PodHealer) Remediator { return rollbackRemediator{h} },
+}
+
+// strategyRegistry - детекторы и действия, которыми пользуется healer
+type strategyRegistry struct {
+	detectors   []Detector
+	remediators map[HealingAction]Remediator
+}
+
+func newStrategyRegistry(h *PodHealer) *strategyRegistry {
+	registry := &strategyRegistry{remediators: make(map[HealingAction]Remediator)}
+	for _, factory := range builtinDetectors {
+		registry.RegisterDetector(factory(h))
+	}
+	for _, factory := range builtinRemediators {
+		registry.RegisterRemediator(factory(h))
+	}
+	// Эти действия выбираются только для особых случаев, не через --default-action
+	// Снятие finalizer'ов - для Pod'ов в Terminating
+	registry.RegisterRemediator(finalizerRemediator{h})
+	// Кордон ноды - для Pod'ов DaemonSet
+	registry.RegisterRemediator(cordonNodeRemediator{h})
+	// Принудительное удаление - для Pod'ов на потерянных нодах
+	registry.RegisterRemediator(forceDeleteRemediator{h})
+	// Обработка цикла выселений за ephemeral-storage - для владельцев таких Pod'ов
+	registry.RegisterRemediator(ephemeralStorageRemediator{h})
+	// Увеличение памяти - для владельцев, чьи контейнеры раз за разом убиваются за OOM
+	registry.RegisterRemediator(oomBumpRemediator{h})
+	// Однократный rollout restart - для владельцев, у Pod'ов которых падают только sidecar'ы
+	registry.RegisterRemediator(sidecarRestartRemediator{h})
+	return registry
+}
+
+// RegisterDetector добавляет детектор в конец списка проверок
+func (r *strategyRegistry) RegisterDetector(detector Detector) {
+	r.detectors = append(r.detectors, detector)
+}
+
+// RegisterRemediator добавляет действие или заменяет действие с тем же именем
+func (r *strategyRegistry) RegisterRemediator(remediator Remediator) {
+	r.remediators[remediator.Action()] = remediator
+}
+
+// detect возвращает первое сработавшее условие зависания
+func (r *strategyRegistry) detect(pod *corev1.Pod, thresholds Thresholds, now time.Time) *stuckCondition {
+	for _, detector := range r.detectors {
+		// Удаляемый Pod интересен только детекторам зависшего Terminating и потерянной ноды
+		if pod.DeletionTimestamp != nil && detector.Reason() != ReasonTerminating && detector.Reason() != ReasonNodeLost {
+			continue
+		}
+		if stuck := detector.Detect(pod, thresholds, now); stuck != nil {
+			return stuck
+		}
+	}
+	return nil
+}
+
+func (r *strategyRegistry) remediator(action HealingAction) (Remediator, error) {
+	remediator, exists := r.remediators[action]
+	if !exists {
+		return nil, fmt.Errorf("no remediator registered for action %s", action)
+	}
+	return remediator, nil
+}
+
+// isRemediationAction проверяет, есть ли встроенное действие с таким именем
+func isRemediationAction(action HealingAction) bool {
+	_, exists := builtinRemediators[action]
+	return exists
+}
+
+// remediationActions возвращает имена встроенных действий для сообщений об ошибках
+func remediationActions() []string {
+	var actions []string
+	for action := range builtinRemediators {
+		actions = append(actions, string(action))
+	}
+	sort.Strings(actions)
+	return actions
+}
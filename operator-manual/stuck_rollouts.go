@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// StuckRolloutAction - что делать с Deployment'ом, новый ReplicaSet которого
+// не стал доступным за spec.progressDeadlineSeconds
+type StuckRolloutAction string
+
+const (
+	StuckRolloutNone     StuckRolloutAction = "none"
+	StuckRolloutNotify   StuckRolloutAction = "notify"
+	StuckRolloutPause    StuckRolloutAction = "pause"
+	StuckRolloutRollback StuckRolloutAction = "rollback"
+
+	// annotationStuckRollout - ревизия, зависший rollout которой healer уже обработал
+	annotationStuckRollout = "healing.kubernetes.io/stuck-rollout"
+
+	// Как часто проверяются rollout'ы Deployment'ов
+	stuckRolloutCheckInterval = time.Minute
+)
+
+// stuckRolloutCondition возвращает условие Progressing зависшего rollout'а или nil
+func stuckRolloutCondition(deployment *appsv1.Deployment) *appsv1.DeploymentCondition {
+	if deployment.Generation > deployment.Status.ObservedGeneration || deployment.Spec.Paused {
+		return nil
+	}
+	for i := range deployment.Status.Conditions {
+		condition := &deployment.Status.Conditions[i]
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse &&
+			condition.Reason == "ProgressDeadlineExceeded" {
+			return condition
+		}
+	}
+	return nil
+}
+
+// stuckRolloutSkipReason возвращает причину не лечить Pod зависшего rollout'а: Pod'ы нового
+// ReplicaSet'а с той же конфигурацией упадут снова, rollout обрабатывается целиком
+func (h *PodHealer) stuckRolloutSkipReason(pod *corev1.Pod, owner *workloadOwner) string {
+	if h.config.StuckRolloutAction == StuckRolloutNone {
+		return ""
+	}
+	deployment, ok := owner.Object.(*appsv1.Deployment)
+	if !ok {
+		return ""
+	}
+	condition := stuckRolloutCondition(deployment)
+	ref := metav1.GetControllerOf(pod)
+	// Контроллер Deployment'ов называет в сообщении зависший ReplicaSet: `ReplicaSet "web-5d4f8" has timed out progressing.`
+	if condition == nil || ref == nil || !strings.Contains(condition.Message, `"`+ref.Name+`"`) {
+		return ""
+	}
+	return fmt.Sprintf("rollout of %s exceeded its progress deadline, stuck rollout action is %s",
+		owner, h.config.StuckRolloutAction)
+}
+
+// checkStuckRollouts обрабатывает Deployment'ы с зависшим rollout'ом, каждую ревизию один раз
+func (h *PodHealer) checkStuckRollouts(ctx context.Context) {
+	for _, namespace := range h.watchNamespaces() {
+		list, err := h.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			klog.ErrorS(err, "Failed to list deployments", "cluster", h.cluster, "namespace", namespace)
+			continue
+		}
+		for i := range list.Items {
+			deployment := &list.Items[i]
+			condition := stuckRolloutCondition(deployment)
+			if condition == nil || deployment.Namespace == "kube-system" || !h.namespaceWatched(deployment.Namespace) {
+				continue
+			}
+			revision := deployment.Annotations[annotationDeploymentRevision]
+			if deployment.Annotations[annotationStuckRollout] == revision {
+				continue
+			}
+			if _, ignored := deployment.Annotations["healing.kubernetes.io/ignore"]; ignored {
+				continue
+			}
+			h.handleStuckRollout(ctx, deployment, condition, revision)
+		}
+	}
+}
+
+func (h *PodHealer) handleStuckRollout(ctx context.Context, deployment *appsv1.Deployment,
+	condition *appsv1.DeploymentCondition, revision string) {
+	owner := &workloadOwner{Kind: "Deployment", Namespace: deployment.Namespace, Name: deployment.Name, Object: deployment}
+	action := h.config.StuckRolloutAction
+	now := h.clock.Now()
+
+	// Режимы namespace'а и окна обслуживания действуют так же, как для Pod'ов
+	mode := h.namespaceMode(deployment.Namespace)
+	_, paused := h.namespacePausedUntil(deployment.Namespace, now)
+	if mode == ModeDisabled {
+		return
+	}
+	if mode == ModeObserve || paused || h.inMaintenanceWindow(deployment.Namespace, now) {
+		klog.InfoS("Would handle stuck rollout", "cluster", h.cluster, "owner", owner.String(),
+			"revision", revision, "action", action, "message", condition.Message)
+		return
+	}
+
+	if h.config.ActiveActive.Enabled {
+		claimed, _, err := h.claimWork(ctx, deployment.UID, fmt.Sprintf("stuck rollout of %s revision %s", owner, revision))
+		if err != nil {
+			klog.ErrorS(err, "Failed to claim stuck rollout", "cluster", h.cluster, "owner", owner.String())
+		}
+		if err != nil || !claimed {
+			return
+		}
+	}
+
+	var err error
+	message := fmt.Sprintf("Rollout of revision %s exceeded its progress deadline: %s", revision, condition.Message)
+	switch action {
+	case StuckRolloutPause:
+		err = h.patchOwner(ctx, owner, []byte(`{"spec":{"paused":true}}`))
+		message += "; rollout paused, resume it with kubectl rollout resume after fixing the new revision"
+	case StuckRolloutRollback:
+		var revisions *deploymentRevisions
+		if revisions, err = h.rollbackDeployment(ctx, deployment); err == nil {
+			message += fmt.Sprintf("; rolled back to revision %d", replicaSetRevision(revisions.Previous))
+		}
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to handle stuck rollout", "cluster", h.cluster, "owner", owner.String(), "action", action)
+		stuckRolloutsTotal.WithLabelValues(h.cluster, string(action), "error").Inc()
+		return
+	}
+
+	// Ревизия отмечается, чтобы не повторять действие на каждой проверке
+	if err := h.patchOwnerAnnotations(ctx, owner, map[string]string{annotationStuckRollout: revision}); err != nil {
+		klog.ErrorS(err, "Failed to annotate deployment with handled stuck rollout", "cluster", h.cluster, "owner", owner.String())
+	}
+	stuckRolloutsTotal.WithLabelValues(h.cluster, string(action), "success").Inc()
+	klog.InfoS("Handled stuck rollout", "cluster", h.cluster, "owner", owner.String(), "revision", revision,
+		"action", action, "message", condition.Message)
+	h.recorder.Event(deployment, corev1.EventTypeWarning, "RolloutStuck", message)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Последняя сводка хранится под этим ключом, предыдущая - под previousSummaryKey
+	summaryConfigMapKey = "summary.json"
+	previousSummaryKey  = "previous-summary.json"
+
+	// Как часто проверяется, не закончился ли период сводки
+	summaryCheckInterval = time.Minute
+)
+
+// SummaryConfig - периодическая сводка healing'а: сколько heal'ов в каких namespaces,
+// какие владельцы флапают и какие причины встречаются чаще, чтобы тренды были видны
+// без своего конвейера поверх логов и метрик
+type SummaryConfig struct {
+	// Period - длительность периода сводки, 24h - сутки, 168h - неделя, 0 отключает сводки.
+	// Периоды выровнены по UTC: сутки начинаются в полночь, неделя - в понедельник.
+	Period time.Duration
+	// ConfigMap, в который записывается сводка, пустое Name - не записывается
+	Namespace string
+	Name      string
+	// WebhookURL - endpoint, которому сводка отправляется POST'ом в JSON
+	WebhookURL string
+	// Top - сколько владельцев и причин попадает в сводку
+	Top int
+}
+
+func (c SummaryConfig) enabled() bool {
+	return c.Period > 0
+}
+
+// SummaryCount - число решений по namespace, владельцу или причине
+type SummaryCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// HealingSummary - сводка за период
+type HealingSummary struct {
+	Cluster string    `json:"cluster"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	// Decisions - все решения по зависшим Pod'ам, Heals - выполненные heal'ы
+	Decisions int `json:"decisions"`
+	Heals     int `json:"heals"`
+	Failed    int `json:"failed"`
+	Escalated int `json:"escalated"`
+	// HealsByNamespace - heal'ы по namespaces, по убыванию
+	HealsByNamespace []SummaryCount `json:"healsByNamespace"`
+	// TopWorkloads - владельцы с наибольшим числом heal'ов
+	TopWorkloads []SummaryCount `json:"topWorkloads"`
+	// TopFlapping - владельцы с наибольшим числом рестартов и пересозданий Pod'ов
+	TopFlapping []SummaryCount `json:"topFlapping"`
+	// TopReasons - самые частые коды причин решений
+	TopReasons []SummaryCount `json:"topReasons"`
+}
+
+// summaryTracker накапливает решения текущего периода. Накопленное не переживает
+// перезапуск healer'а: сводка периода с перезапуском неполная.
+type summaryTracker struct {
+	mu         sync.Mutex
+	from       time.Time
+	decisions  int
+	heals      int
+	failed     int
+	escalated  int
+	namespaces map[string]int
+	workloads  map[string]int
+	reasons    map[string]int
+	client     *http.Client
+}
+
+func newSummaryTracker() *summaryTracker {
+	tracker := &summaryTracker{client: &http.Client{Timeout: 10 * time.Second}}
+	tracker.reset(time.Time{})
+	return tracker
+}
+
+func (t *summaryTracker) reset(from time.Time) {
+	t.from = from
+	t.decisions, t.heals, t.failed, t.escalated = 0, 0, 0, 0
+	t.namespaces = make(map[string]int)
+	t.workloads = make(map[string]int)
+	t.reasons = make(map[string]int)
+}
+
+// record учитывает решение. Решения, отложенные лимитами, повторяются,
+// поэтому в сводку попадают только завершенные.
+func (t *summaryTracker) record(record DecisionRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch record.Result {
+	case "healed":
+		t.heals++
+		t.namespaces[record.Namespace]++
+		if record.Owner != "" {
+			t.workloads[record.Owner]++
+		}
+	case "failed":
+		t.failed++
+	case "escalated":
+		t.escalated++
+	case "skipped", "observed", string(verdictDenied):
+	default:
+		return
+	}
+	t.decisions++
+	t.reasons[string(record.Code)]++
+}
+
+// topCounts сортирует счетчики по убыванию и оставляет первые top, 0 - все
+func topCounts(counts map[string]int, top int) []SummaryCount {
+	sorted := make([]SummaryCount, 0, len(counts))
+	for name, count := range counts {
+		sorted = append(sorted, SummaryCount{Name: name, Count: count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	if top > 0 && len(sorted) > top {
+		sorted = sorted[:top]
+	}
+	return sorted
+}
+
+// summaryPeriodStart - начало периода сводки, в который попадает now
+func summaryPeriodStart(now time.Time, period time.Duration) time.Time {
+	// Нулевое время Go - понедельник, поэтому недельные периоды начинаются с понедельника
+	return now.UTC().Truncate(period)
+}
+
+// takeSummary возвращает сводку закончившегося периода и начинает новый.
+// ok - false, пока период не закончился.
+func (h *PodHealer) takeSummary(now time.Time) (summary *HealingSummary, ok bool) {
+	t := h.summaries
+	start := summaryPeriodStart(now, h.config.Summary.Period)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.from.IsZero() {
+		// Первый период после запуска неполный
+		t.from = start
+		return nil, false
+	}
+	if start.Equal(t.from) {
+		return nil, false
+	}
+
+	top := h.config.Summary.Top
+	summary = &HealingSummary{
+		Cluster:          h.cluster,
+		From:             t.from,
+		To:               t.from.Add(h.config.Summary.Period),
+		Decisions:        t.decisions,
+		Heals:            t.heals,
+		Failed:           t.failed,
+		Escalated:        t.escalated,
+		HealsByNamespace: topCounts(t.namespaces, 0),
+		TopWorkloads:     topCounts(t.workloads, top),
+		TopFlapping:      topCounts(h.flaps.takePeriodChurn(), top),
+		TopReasons:       topCounts(t.reasons, top),
+	}
+	t.reset(start)
+	return summary, true
+}
+
+// publishSummary записывает сводку закончившегося периода в ConfigMap и отправляет webhook'у
+func (h *PodHealer) publishSummary(ctx context.Context) {
+	summary, ok := h.takeSummary(h.clock.Now())
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		klog.ErrorS(err, "Failed to encode healing summary", "cluster", h.cluster)
+		return
+	}
+	klog.InfoS("Healing summary", "cluster", h.cluster, "from", summary.From, "to", summary.To,
+		"decisions", summary.Decisions, "heals", summary.Heals, "failed", summary.Failed, "escalated", summary.Escalated)
+
+	config := h.config.Summary
+	if config.Name != "" {
+		if err := h.writeSummaryConfigMap(ctx, string(data)); err != nil {
+			klog.ErrorS(err, "Failed to write healing summary", "cluster", h.cluster,
+				"configmap", config.Namespace+"/"+config.Name)
+		}
+	}
+	if config.WebhookURL != "" {
+		if err := h.postSummary(ctx, data); err != nil {
+			klog.ErrorS(err, "Failed to send healing summary", "cluster", h.cluster, "url", config.WebhookURL)
+		}
+	}
+}
+
+// writeSummaryConfigMap сохраняет сводку, сдвигая прошлую в previousSummaryKey
+func (h *PodHealer) writeSummaryConfigMap(ctx context.Context, summary string) error {
+	config := h.config.Summary
+	data := map[string]string{summaryConfigMapKey: summary}
+	configMap, err := h.clientset.CoreV1().ConfigMaps(config.Namespace).Get(ctx, config.Name, metav1.GetOptions{})
+	if err == nil && configMap.Data[summaryConfigMapKey] != "" {
+		data[previousSummaryKey] = configMap.Data[summaryConfigMapKey]
+	}
+	return h.writeConfigMap(ctx, config.Namespace, config.Name, data)
+}
+
+func (h *PodHealer) postSummary(ctx context.Context, data []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, h.config.Summary.WebhookURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := h.summaries.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("summary endpoint returned HTTP %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ThresholdSchedule - пороги, действующие в минуты, совпадающие с Schedule.
+// Например, ночью autoscaler медленнее, и Pending Pod ждет дольше, чем днем.
+type ThresholdSchedule struct {
+	Name string `json:"name"`
+	// Schedule - cron-выражения через ";" в формате --maintenance-windows
+	Schedule string `json:"schedule"`
+	// Thresholds - пороги под именами аннотаций Pod'а без префикса healing.kubernetes.io/,
+	// например pending-timeout: 30m
+	Thresholds map[string]string `json:"thresholds"`
+
+	schedules []*Schedule
+}
+
+// loadThresholdSchedules читает расписания порогов из YAML файла
+func loadThresholdSchedules(path string) ([]ThresholdSchedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Schedules []ThresholdSchedule `json:"schedules"`
+	}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+
+	for i := range file.Schedules {
+		schedule := &file.Schedules[i]
+		if schedule.Name == "" || schedule.Schedule == "" || len(schedule.Thresholds) == 0 {
+			return nil, fmt.Errorf("schedule %d: name, schedule and thresholds are required", i)
+		}
+		if schedule.schedules, err = parseSchedules(schedule.Schedule); err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", schedule.Name, err)
+		}
+		if _, err := schedule.apply(defaultThresholds); err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", schedule.Name, err)
+		}
+	}
+	return file.Schedules, nil
+}
+
+// apply переопределяет пороги значениями расписания
+func (s ThresholdSchedule) apply(t Thresholds) (Thresholds, error) {
+	durations := map[string]*time.Duration{
+		annotationPendingTimeout:     &t.PendingTimeout,
+		annotationNotReadyTimeout:    &t.NotReadyTimeout,
+		annotationScaleUpTimeout:     &t.ScaleUpPendingTimeout,
+		annotationLivenessWindow:     &t.LivenessWindow,
+		annotationCreatingTimeout:    &t.ContainerCreatingTimeout,
+		annotationTerminatingTimeout: &t.TerminatingTimeout,
+		annotationNodeLostTimeout:    &t.NodeLostTimeout,
+	}
+	counts := map[string]*int32{
+		annotationMaxRestarts:      &t.MaxRestarts,
+		annotationLivenessFailures: &t.LivenessFailures,
+	}
+
+	for name, value := range s.Thresholds {
+		key := "healing.kubernetes.io/" + name
+		if target, ok := durations[key]; ok {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return t, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*target = d
+			continue
+		}
+		if target, ok := counts[key]; ok {
+			n, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || n <= 0 {
+				return t, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*target = int32(n)
+			continue
+		}
+		return t, fmt.Errorf("unknown threshold %q", name)
+	}
+	return t, nil
+}
+
+// thresholdsAt возвращает глобальные пороги с учетом первого расписания, совпавшего с now.
+// Режим namespace и аннотации Pod'а применяются поверх них.
+func (h *PodHealer) thresholdsAt(now time.Time) Thresholds {
+	for _, schedule := range h.config.ThresholdSchedules {
+		if anyScheduleMatches(schedule.schedules, now) {
+			// Значения проверены при загрузке файла
+			t, _ := schedule.apply(h.config.Thresholds)
+			return t
+		}
+	}
+	return h.config.Thresholds
+}
+
+func thresholdScheduleNames(schedules []ThresholdSchedule) []string {
+	var names []string
+	for _, schedule := range schedules {
+		names = append(names, schedule.Name+" ("+strings.TrimSpace(schedule.Schedule)+")")
+	}
+	return names
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	annotationPendingTimeout     = "healing.kubernetes.io/pending-timeout"
+	annotationMaxRestarts        = "healing.kubernetes.io/max-restarts"
+	annotationNotReadyTimeout    = "healing.kubernetes.io/not-ready-timeout"
+	annotationScaleUpTimeout     = "healing.kubernetes.io/scale-up-pending-timeout"
+	annotationLivenessFailures   = "healing.kubernetes.io/liveness-failures"
+	annotationLivenessWindow     = "healing.kubernetes.io/liveness-window"
+	annotationCreatingTimeout    = "healing.kubernetes.io/container-creating-timeout"
+	annotationTerminatingTimeout = "healing.kubernetes.io/terminating-timeout"
+	annotationNodeLostTimeout    = "healing.kubernetes.io/node-lost-timeout"
+)
+
+// Thresholds описывает пороги, после которых Pod считается зависшим
+type Thresholds struct {
+	PendingTimeout  time.Duration
+	MaxRestarts     int32
+	NotReadyTimeout time.Duration
+	// ScaleUpPendingTimeout применяется к Pending Pod'ам, для которых
+	// cluster autoscaler уже заказал новую ноду
+	ScaleUpPendingTimeout time.Duration
+	// LivenessFailures неудачных liveness-проб за LivenessWindow означают зависший Pod
+	LivenessFailures int32
+	LivenessWindow   time.Duration
+	// ContainerCreatingTimeout - сколько запланированный Pod может ждать создания контейнеров
+	ContainerCreatingTimeout time.Duration
+	// TerminatingTimeout - сколько удаленный Pod может висеть в Terminating из-за finalizer'ов
+	TerminatingTimeout time.Duration
+	// NodeLostTimeout - сколько Pod на недоступной ноде ждет ее возвращения перед принудительным удалением
+	NodeLostTimeout time.Duration
+}
+
+// Глобальные пороги, используемые если Pod не переопределяет их аннотациями
+var defaultThresholds = Thresholds{
+	PendingTimeout:           15 * time.Minute,
+	MaxRestarts:              10,
+	NotReadyTimeout:          10 * time.Minute,
+	ScaleUpPendingTimeout:    30 * time.Minute,
+	LivenessFailures:         10,
+	LivenessWindow:           15 * time.Minute,
+	ContainerCreatingTimeout: 10 * time.Minute,
+	TerminatingTimeout:       time.Hour,
+	NodeLostTimeout:          5 * time.Minute,
+}
+
+// thresholdsForPod возвращает пороги с учетом аннотаций Pod'а.
+// Некорректные значения игнорируются с предупреждением в логе.
+func thresholdsForPod(pod *corev1.Pod, global Thresholds) Thresholds {
+	t := global
+	if pod.Annotations == nil {
+		return t
+	}
+
+	durationAnnotation(pod, annotationPendingTimeout, &t.PendingTimeout)
+	durationAnnotation(pod, annotationNotReadyTimeout, &t.NotReadyTimeout)
+	durationAnnotation(pod, annotationScaleUpTimeout, &t.ScaleUpPendingTimeout)
+	durationAnnotation(pod, annotationLivenessWindow, &t.LivenessWindow)
+	durationAnnotation(pod, annotationCreatingTimeout, &t.ContainerCreatingTimeout)
+	durationAnnotation(pod, annotationTerminatingTimeout, &t.TerminatingTimeout)
+	durationAnnotation(pod, annotationNodeLostTimeout, &t.NodeLostTimeout)
+	countAnnotation(pod, annotationMaxRestarts, &t.MaxRestarts)
+	countAnnotation(pod, annotationLivenessFailures, &t.LivenessFailures)
+
+	return t
+}
+
+// countAnnotation перезаписывает target положительным числом из аннотации
+func countAnnotation(pod *corev1.Pod, annotation string, target *int32) {
+	value, exists := pod.Annotations[annotation]
+	if !exists {
+		return
+	}
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || n <= 0 {
+		klog.InfoS("Invalid pod annotation, using default", "namespace", pod.Namespace, "pod", pod.Name,
+			"annotation", annotation, "value", value, "default", *target)
+		return
+	}
+	*target = int32(n)
+}
+
+// durationAnnotation перезаписывает target значением аннотации, если оно корректно
+func durationAnnotation(pod *corev1.Pod, annotation string, target *time.Duration) {
+	value, exists := pod.Annotations[annotation]
+	if !exists {
+		return
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		klog.InfoS("Invalid pod annotation, using default", "namespace", pod.Namespace, "pod", pod.Name,
+			"annotation", annotation, "value", value, "default", *target)
+		return
+	}
+	*target = d
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TracingConfig - настройки экспорта трейсов через OTLP
+type TracingConfig struct {
+	// Endpoint - host:port OTLP/HTTP коллектора, пустая строка отключает трейсинг
+	Endpoint string
+	Insecure bool
+	// SampleRatio - доля трейсов, которые будут отправлены
+	SampleRatio float64
+}
+
+// tracer создает span'ы конвейера healing. Пока трейсинг не настроен,
+// глобальный provider OTel возвращает no-op span'ы.
+var tracer = otel.Tracer("pod-healer-operator")
+
+// setupTracing регистрирует глобальный TracerProvider с OTLP экспортером.
+// Возвращенная функция отправляет накопленные span'ы при остановке.
+func setupTracing(ctx context.Context, config TracingConfig) (func(context.Context) error, error) {
+	if config.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.Endpoint)}
+	if config.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName("pod-healer-operator"))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// podSpanAttributes - атрибуты span'а, по которым действия healer'а
+// сопоставляются с трейсами приложения
+func (h *PodHealer) podSpanAttributes(pod *corev1.Pod) trace.SpanStartOption {
+	return trace.WithAttributes(
+		attribute.String("k8s.cluster.name", h.cluster),
+		attribute.String("k8s.namespace.name", pod.Namespace),
+		attribute.String("k8s.pod.name", pod.Name),
+		attribute.String("k8s.pod.uid", string(pod.UID)),
+	)
+}
+
+// decisionSpanAttributes добавляет в span итог оценки Pod'а
+func decisionSpanAttributes(span trace.Span, decision *healingDecision) {
+	span.SetAttributes(
+		attribute.String("healing.reason", string(decision.Reason)),
+		attribute.String("healing.code", string(decision.Code)),
+		attribute.String("healing.action", string(decision.Action)),
+	)
+	if decision.Message != "" {
+		span.SetAttributes(attribute.String("healing.message", decision.Message))
+	}
+	if decision.Owner != nil {
+		span.SetAttributes(attribute.String("healing.owner", decision.Owner.String()))
+	}
+}
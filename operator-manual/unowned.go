@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// UnownedPodPolicy определяет, что делать с зависшими Pod'ами без ownerReferences.
+// Удаление такого Pod'а уничтожает его навсегда, поэтому по умолчанию они игнорируются.
+type UnownedPodPolicy string
+
+const (
+	UnownedIgnore   UnownedPodPolicy = "ignore"
+	UnownedDelete   UnownedPodPolicy = "delete"
+	UnownedRecreate UnownedPodPolicy = "recreate-from-spec"
+)
+
+// Сколько ждать удаления старого Pod'а перед созданием нового
+const recreateTimeout = 5 * time.Minute
+
+func isUnowned(pod *corev1.Pod) bool {
+	return len(pod.OwnerReferences) == 0
+}
+
+// recreatePod удаляет Pod и создает новый с тем же именем и спецификацией.
+// Создание выполняется в фоне после фактического удаления старого Pod'а.
+func (h *PodHealer) recreatePod(ctx context.Context, pod *corev1.Pod) error {
+	replacement := podFromSpec(pod)
+
+	if err := h.healPod(ctx, pod); err != nil {
+		return err
+	}
+
+	go func() {
+		err := wait.PollImmediate(2*time.Second, recreateTimeout, func() (bool, error) {
+			_, err := h.clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, nil
+		})
+		if err == nil {
+			_, err = h.clientset.CoreV1().Pods(pod.Namespace).Create(ctx, replacement, metav1.CreateOptions{})
+		}
+		if err != nil {
+			klog.ErrorS(err, "Failed to recreate unowned pod", "cluster", h.cluster,
+				"namespace", pod.Namespace, "pod", pod.Name)
+			return
+		}
+		klog.InfoS("Recreated unowned pod from spec", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name)
+	}()
+	return nil
+}
+
+// podFromSpec готовит копию Pod'а для повторного создания
+func podFromSpec(pod *corev1.Pod) *corev1.Pod {
+	spec := pod.Spec.DeepCopy()
+	// Даем планировщику выбрать ноду заново
+	spec.NodeName = ""
+	// Ephemeral-контейнеры нельзя задать при создании Pod'а
+	spec.EphemeralContainers = nil
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pod.Name,
+			Namespace:   pod.Namespace,
+			Labels:      pod.Labels,
+			Annotations: pod.Annotations,
+		},
+		Spec: *spec,
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// Сообщение планировщика, когда нода не подходит под node affinity PersistentVolume
+const volumeNodeAffinityConflict = "volume node affinity conflict"
+
+// volumeTopologyBlocker проверяет, есть ли в кластере нода, на которую Pod
+// может быть перепланирован с учетом node affinity всех его PersistentVolume.
+// Возвращает описание проблемы, если такой ноды нет, либо "".
+func (h *PodHealer) volumeTopologyBlocker(ctx context.Context, pod *corev1.Pod) (string, error) {
+	var volumes []*corev1.PersistentVolume
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+		claimName := volume.PersistentVolumeClaim.ClaimName
+		pvc, err := h.clientset.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(ctx, claimName, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get PVC %s: %w", claimName, err)
+		}
+		if pvc.Spec.VolumeName == "" {
+			continue
+		}
+		pv, err := h.clientset.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get PV %s: %w", pvc.Spec.VolumeName, err)
+		}
+		if pv.Spec.NodeAffinity != nil && pv.Spec.NodeAffinity.Required != nil {
+			volumes = append(volumes, pv)
+		}
+	}
+	if len(volumes) == 0 {
+		return "", nil
+	}
+
+	nodes, err := h.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if !isNodeSchedulable(node) {
+			continue
+		}
+		fits := true
+		for _, pv := range volumes {
+			if !nodeMatchesSelector(node, pv.Spec.NodeAffinity.Required) {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			return "", nil
+		}
+	}
+
+	var names []string
+	for _, pv := range volumes {
+		names = append(names, fmt.Sprintf("%s (%s)", pv.Name, describeNodeSelector(pv.Spec.NodeAffinity.Required)))
+	}
+	return fmt.Sprintf("no schedulable node satisfies node affinity of PersistentVolumes %s",
+		strings.Join(names, ", ")), nil
+}
+
+// isNodeSchedulable - нода Ready и не закордонена
+func isNodeSchedulable(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// nodeMatchesSelector проверяет NodeSelector так же, как планировщик:
+// термы объединяются через ИЛИ, выражения внутри терма - через И
+func nodeMatchesSelector(node *corev1.Node, selector *corev1.NodeSelector) bool {
+	nodeLabels := labels.Set(node.Labels)
+	nodeFields := labels.Set{"metadata.name": node.Name}
+	for _, term := range selector.NodeSelectorTerms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		if requirementsMatch(term.MatchExpressions, nodeLabels) && requirementsMatch(term.MatchFields, nodeFields) {
+			return true
+		}
+	}
+	return false
+}
+
+func requirementsMatch(expressions []corev1.NodeSelectorRequirement, set labels.Set) bool {
+	for _, expression := range expressions {
+		var operator selection.Operator
+		switch expression.Operator {
+		case corev1.NodeSelectorOpIn:
+			operator = selection.In
+		case corev1.NodeSelectorOpNotIn:
+			operator = selection.NotIn
+		case corev1.NodeSelectorOpExists:
+			operator = selection.Exists
+		case corev1.NodeSelectorOpDoesNotExist:
+			operator = selection.DoesNotExist
+		case corev1.NodeSelectorOpGt:
+			operator = selection.GreaterThan
+		case corev1.NodeSelectorOpLt:
+			operator = selection.LessThan
+		default:
+			return false
+		}
+		requirement, err := labels.NewRequirement(expression.Key, operator, expression.Values)
+		if err != nil || !requirement.Matches(set) {
+			return false
+		}
+	}
+	return true
+}
+
+func describeNodeSelector(selector *corev1.NodeSelector) string {
+	var terms []string
+	for _, term := range selector.NodeSelectorTerms {
+		var expressions []string
+		for _, expression := range append(term.MatchExpressions, term.MatchFields...) {
+			expressions = append(expressions, fmt.Sprintf("%s %s %s",
+				expression.Key, expression.Operator, strings.Join(expression.Values, ",")))
+		}
+		terms = append(terms, strings.Join(expressions, " && "))
+	}
+	return strings.Join(terms, " || ")
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// Сколько ждать синхронизации кэша namespace'ов при явном списке namespaces.
+// С namespace-scoped RBAC читать объекты Namespace обычно нельзя, и тогда
+// healer работает без политик namespace'ов вместо того, чтобы зависнуть.
+const namespaceSyncTimeout = 30 * time.Second
+
+// watchNamespaces возвращает namespaces, для которых запускаются informer'ы
+func (h *PodHealer) watchNamespaces() []string {
+	if len(h.config.Namespaces) > 0 {
+		var namespaces []string
+		for _, namespace := range h.config.Namespaces {
+			if h.config.Shard.owns(namespace) {
+				namespaces = append(namespaces, namespace)
+			}
+		}
+		return namespaces
+	}
+	return []string{corev1.NamespaceAll}
+}
+
+// namespaceWatched проверяет, входит ли namespace в зону ответственности healer'а
+func (h *PodHealer) namespaceWatched(namespace string) bool {
+	if !h.config.Shard.owns(namespace) {
+		return false
+	}
+	if h.config.NamespaceOptIn && !h.namespaceOptedIn(namespace) {
+		return false
+	}
+	if len(h.config.Namespaces) > 0 {
+		for _, watched := range h.config.Namespaces {
+			if watched == namespace {
+				return true
+			}
+		}
+		return false
+	}
+	if h.config.NamespaceSelector == nil || h.config.NamespaceSelector.Empty() {
+		return true
+	}
+	// В кэше лежат только namespaces, подходящие под селектор
+	if h.namespaces == nil {
+		return false
+	}
+	_, exists, err := h.namespaces.GetByKey(namespace)
+	return err == nil && exists
+}
+
+func (h *PodHealer) nodeSelectorEnabled() bool {
+	return h.config.NodeSelector != nil && !h.config.NodeSelector.Empty()
+}
+
+// nodeWatched проверяет, стоит ли Pod на ноде, подходящей под --node-selector.
+// Pod без ноды (еще не запланированный или с удаленной нодой) сравнивается
+// по своему spec.nodeSelector, то есть по пулу, в который он должен попасть.
+func (h *PodHealer) nodeWatched(pod *corev1.Pod) bool {
+	if !h.nodeSelectorEnabled() {
+		return true
+	}
+	if pod.Spec.NodeName != "" {
+		if node := h.getNode(pod.Spec.NodeName); node != nil {
+			return h.config.NodeSelector.Matches(labels.Set(node.Labels))
+		}
+	}
+	return h.config.NodeSelector.Matches(labels.Set(pod.Spec.NodeSelector))
+}
+
+// getNode читает ноду из кэша, без него (report, simulate) - из API
+func (h *PodHealer) getNode(name string) *corev1.Node {
+	if h.nodes != nil {
+		obj, exists, err := h.nodes.GetByKey(name)
+		if err != nil || !exists {
+			return nil
+		}
+		return obj.(*corev1.Node)
+	}
+	node, err := h.clientset.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.ErrorS(err, "Failed to get node", "cluster", h.cluster, "node", name)
+		}
+		return nil
+	}
+	return node
+}
+
+// startNamespaceInformers заполняет h.namespaces для явного списка namespaces.
+// Без списка namespaces кэшируются в manager'е (setupControllers).
+func (h *PodHealer) startNamespaceInformers(stop <-chan struct{}) {
+	// По informer'у на каждый namespace, все пишут в общий store
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	handlers := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { _ = store.Add(obj) },
+		UpdateFunc: func(oldObj, newObj interface{}) { _ = store.Update(newObj) },
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			_ = store.Delete(obj)
+		},
+	}
+	var synced []cache.InformerSynced
+	for _, namespace := range h.config.Namespaces {
+		watchlist := cache.NewListWatchFromClient(
+			h.clientset.CoreV1().RESTClient(),
+			"namespaces",
+			corev1.NamespaceAll,
+			fields.OneTermEqualSelector("metadata.name", namespace),
+		)
+		_, controller := cache.NewInformer(watchlist, &corev1.Namespace{}, h.config.ResyncPeriod, handlers)
+		go controller.Run(stop)
+		synced = append(synced, controller.HasSynced)
+	}
+	h.namespaces = store
+
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(namespaceSyncTimeout, func() { close(timeout) })
+	defer timer.Stop()
+	if !cache.WaitForCacheSync(timeout, synced...) {
+		klog.InfoS("Namespace cache not synced, namespace policies are unavailable until it syncs",
+			"cluster", h.cluster, "namespaces", h.config.Namespaces)
+	}
+}
+
+// loadNamespaces однократно загружает namespaces для оценки политик без informer'а
+func (h *PodHealer) loadNamespaces(ctx context.Context) error {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	if len(h.config.Namespaces) > 0 {
+		for _, name := range h.config.Namespaces {
+			ns, err := h.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				klog.InfoS("Failed to get namespace, its policy is unavailable", "cluster", h.cluster,
+					"namespace", name, "err", err)
+				continue
+			}
+			if err := store.Add(ns); err != nil {
+				return err
+			}
+		}
+		h.namespaces = store
+		return nil
+	}
+
+	options := metav1.ListOptions{}
+	if h.config.NamespaceSelector != nil {
+		options.LabelSelector = h.config.NamespaceSelector.String()
+	}
+	namespaces, err := h.clientset.CoreV1().Namespaces().List(ctx, options)
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %v", err)
+	}
+	for i := range namespaces.Items {
+		if err := store.Add(&namespaces.Items[i]); err != nil {
+			return err
+		}
+	}
+	h.namespaces = store
+	return nil
+}
+
+// listWatchedPods возвращает Pod'ы всех namespaces в зоне ответственности
+func (h *PodHealer) listWatchedPods(ctx context.Context) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	for _, namespace := range h.watchNamespaces() {
+		list, err := h.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods: %v", err)
+		}
+		for _, pod := range list.Items {
+			if h.namespaceWatched(pod.Namespace) {
+				pods = append(pods, pod)
+			}
+		}
+	}
+	return pods, nil
+}
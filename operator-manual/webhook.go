@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// Аннотации namespace с этим префиксом задают значения по умолчанию для Pod'ов:
+// pod-defaults.healing.kubernetes.io/max-restarts: "5" превращается в
+// healing.kubernetes.io/max-restarts: "5" на каждом новом Pod'е без этой аннотации
+const podDefaultsPrefix = "pod-defaults.healing.kubernetes.io/"
+
+// WebhookConfig - настройки mutating admission webhook.
+// Пустой BindAddress отключает webhook.
+type WebhookConfig struct {
+	BindAddress string
+	CertFile    string
+	KeyFile     string
+	// SelfSigned заменяет CertFile и KeyFile сертификатом, который выпускает сам healer
+	SelfSigned WebhookCertConfig
+}
+
+// namespaceObject возвращает namespace из кэша informer'а или из API,
+// если informer еще не запущен
+func (h *PodHealer) namespaceObject(ctx context.Context, name string) (*corev1.Namespace, error) {
+	if h.namespaces != nil {
+		if obj, exists, err := h.namespaces.GetByKey(name); err == nil && exists {
+			return obj.(*corev1.Namespace), nil
+		}
+	}
+	return h.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+}
+
+// podDefaults возвращает аннотации healing, которые нужно добавить Pod'у
+func podDefaults(ns *corev1.Namespace, pod *corev1.Pod) map[string]string {
+	defaults := make(map[string]string)
+	for key, value := range ns.Annotations {
+		if !strings.HasPrefix(key, podDefaultsPrefix) {
+			continue
+		}
+		podKey := "healing.kubernetes.io/" + strings.TrimPrefix(key, podDefaultsPrefix)
+		if _, exists := pod.Annotations[podKey]; !exists {
+			defaults[podKey] = value
+		}
+	}
+	return defaults
+}
+
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// defaultsPatch строит JSON patch, добавляющий аннотации Pod'у
+func defaultsPatch(pod *corev1.Pod, defaults map[string]string) ([]byte, error) {
+	if len(pod.Annotations) == 0 {
+		return json.Marshal([]jsonPatchOperation{{Op: "add", Path: "/metadata/annotations", Value: defaults}})
+	}
+
+	keys := make([]string, 0, len(defaults))
+	for key := range defaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	operations := make([]jsonPatchOperation, 0, len(keys))
+	for _, key := range keys {
+		operations = append(operations, jsonPatchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations/" + escaper.Replace(key),
+			Value: defaults[key],
+		})
+	}
+	return json.Marshal(operations)
+}
+
+// mutatePod добавляет Pod'у аннотации по умолчанию из его namespace.
+// Ошибки не блокируют создание Pod'а: healing - не повод ломать деплой.
+func (h *PodHealer) mutatePod(ctx context.Context, request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true}
+
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(request.Object.Raw, pod); err != nil {
+		klog.ErrorS(err, "Failed to decode pod in admission request", "namespace", request.Namespace)
+		return response
+	}
+
+	ns, err := h.namespaceObject(ctx, request.Namespace)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get namespace for admission request", "namespace", request.Namespace)
+		return response
+	}
+
+	defaults := podDefaults(ns, pod)
+	if len(defaults) == 0 {
+		return response
+	}
+	patch, err := defaultsPatch(pod, defaults)
+	if err != nil {
+		klog.ErrorS(err, "Failed to build admission patch", "namespace", request.Namespace)
+		return response
+	}
+
+	patchType := admissionv1.PatchTypeJSONPatch
+	response.Patch, response.PatchType = patch, &patchType
+	klog.V(2).InfoS("Injected healing defaults", "namespace", request.Namespace,
+		"pod", pod.Name+pod.GenerateName, "annotations", defaults)
+	return response
+}
+
+func (h *PodHealer) serveMutate(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = h.mutatePod(r.Context(), review.Request)
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		klog.ErrorS(err, "Failed to write admission response")
+	}
+}
+
+// serveWebhook запускает HTTPS сервер mutating webhook
+func (h *PodHealer) serveWebhook(config WebhookConfig) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mutate-pods", h.serveMutate)
+
+	server := &http.Server{Addr: config.BindAddress, Handler: mux}
+	certFile, keyFile := config.CertFile, config.KeyFile
+	if config.SelfSigned.Enabled {
+		certs := newWebhookCerts(h, config.SelfSigned)
+		certs.run(context.Background())
+		server.TLSConfig = &tls.Config{GetCertificate: certs.getCertificate, MinVersion: tls.VersionTLS12}
+		certFile, keyFile = "", ""
+	}
+
+	klog.InfoS("Serving mutating webhook", "address", config.BindAddress, "cluster", h.cluster)
+	if err := server.ListenAndServeTLS(certFile, keyFile); err != nil {
+		klog.Fatalf("Webhook server failed: %v", err)
+	}
+}
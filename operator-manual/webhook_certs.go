@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// webhookCertCheckInterval - как часто проверяется срок действия самоподписанного сертификата
+const webhookCertCheckInterval = time.Hour
+
+// webhookCertRotationGrace - сколько после перевыпуска caBundle содержит и прежний сертификат.
+// Каждая реплика перечитывает Secret раз в webhookCertCheckInterval, поэтому за два интервала
+// все реплики успевают перейти на новый сертификат.
+const webhookCertRotationGrace = 2 * webhookCertCheckInterval
+
+const (
+	// webhookPreviousCertKey - ключ Secret'а с прежним сертификатом на время webhookCertRotationGrace
+	webhookPreviousCertKey = "previous.crt"
+	// annotationWebhookCertRotated - время последнего перевыпуска сертификата в RFC3339
+	annotationWebhookCertRotated = "healing.kubernetes.io/webhook-cert-rotated"
+)
+
+// WebhookCertConfig - самоподписанный сертификат webhook'а вместо cert-manager.
+// Сертификат хранится в Secret'е, общем для всех реплик: apiserver проверяет любую из них
+// по одному caBundle, поэтому реплики не могут выпускать каждая свой.
+type WebhookCertConfig struct {
+	Enabled bool
+	// Service и Namespace - Service webhook'а, его DNS имена попадают в сертификат
+	Service   string
+	Namespace string
+	// Secret - Secret в Namespace с tls.crt и tls.key
+	Secret string
+	// Configuration - MutatingWebhookConfiguration, caBundle которой обновляет healer
+	Configuration string
+	// Validity - срок действия сертификата, он перевыпускается после двух третей срока
+	Validity time.Duration
+}
+
+// webhookCerts отдает TLS серверу текущий сертификат и перевыпускает его по сроку
+type webhookCerts struct {
+	h      *PodHealer
+	config WebhookCertConfig
+
+	mu      sync.Mutex
+	current *tls.Certificate
+}
+
+func newWebhookCerts(h *PodHealer, config WebhookCertConfig) *webhookCerts {
+	return &webhookCerts{h: h, config: config}
+}
+
+// run выпускает сертификат, повторяя попытки до успеха, и затем следит за его сроком
+func (c *webhookCerts) run(ctx context.Context) {
+	_ = wait.PollImmediateInfinite(10*time.Second, func() (bool, error) {
+		if err := c.ensure(ctx); err != nil {
+			klog.ErrorS(err, "Failed to issue webhook certificate")
+			return false, nil
+		}
+		return true, nil
+	})
+	go wait.Forever(func() {
+		if err := c.ensure(ctx); err != nil {
+			klog.ErrorS(err, "Failed to renew webhook certificate")
+		}
+	}, webhookCertCheckInterval)
+}
+
+func (c *webhookCerts) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current == nil {
+		return nil, fmt.Errorf("webhook certificate is not issued yet")
+	}
+	return c.current, nil
+}
+
+// renewalDue - прошли две трети срока действия сертификата
+func renewalDue(issued, expires, now time.Time) bool {
+	return !now.Before(expires.Add(-expires.Sub(issued) / 3))
+}
+
+// generateWebhookCert выпускает самоподписанный сертификат для DNS имен Service'а.
+// Сертификат одновременно является CA из caBundle.
+func generateWebhookCert(config WebhookCertConfig, now time.Time) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	service := config.Service + "." + config.Namespace + ".svc"
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: service},
+		DNSNames:              []string{config.Service, config.Service + "." + config.Namespace, service, service + ".cluster.local"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(config.Validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// parseWebhookCert читает сертификат из Secret'а, nil - Secret'а нет или данные испорчены
+func parseWebhookCert(secret *corev1.Secret) (*tls.Certificate, *x509.Certificate) {
+	if secret == nil {
+		return nil, nil
+	}
+	pair, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, nil
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil
+	}
+	return &pair, leaf
+}
+
+// webhookCABundle - caBundle для Secret'а: текущий сертификат и, пока не прошел
+// webhookCertRotationGrace после перевыпуска, прежний. Так apiserver доверяет и репликам,
+// которые еще отдают прежний сертификат.
+func webhookCABundle(secret *corev1.Secret, now time.Time) []byte {
+	caBundle := secret.Data[corev1.TLSCertKey]
+	previous := secret.Data[webhookPreviousCertKey]
+	if len(previous) == 0 {
+		return caBundle
+	}
+	rotated, err := time.Parse(time.RFC3339, secret.Annotations[annotationWebhookCertRotated])
+	if err != nil || !now.Before(rotated.Add(webhookCertRotationGrace)) {
+		return caBundle
+	}
+	return append(append([]byte{}, caBundle...), previous...)
+}
+
+// ensure загружает сертификат из Secret'а, при необходимости перевыпускает его
+// и обновляет caBundle. Реплики, проигравшие гонку за Secret, берут сертификат победителя.
+// Новый сертификат отдается только после того, как он попал в caBundle.
+func (c *webhookCerts) ensure(ctx context.Context) error {
+	now := c.h.clock.Now()
+	secrets := c.h.clientset.CoreV1().Secrets(c.config.Namespace)
+	secret, err := secrets.Get(ctx, c.config.Secret, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		secret, err = nil, nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get webhook certificate secret: %w", err)
+	}
+
+	pair, leaf := parseWebhookCert(secret)
+	if pair == nil || renewalDue(leaf.NotBefore, leaf.NotAfter, now) {
+		certPEM, keyPEM, err := generateWebhookCert(c.config, now)
+		if err != nil {
+			return fmt.Errorf("failed to generate webhook certificate: %w", err)
+		}
+		data := map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM}
+		if secret == nil {
+			secret, err = secrets.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: c.config.Secret, Namespace: c.config.Namespace},
+				Type:       corev1.SecretTypeTLS,
+				Data:       data,
+			}, metav1.CreateOptions{})
+		} else {
+			secret = secret.DeepCopy()
+			// Прежний сертификат остается в caBundle, пока остальные реплики его отдают
+			if pair != nil && now.Before(leaf.NotAfter) {
+				data[webhookPreviousCertKey] = secret.Data[corev1.TLSCertKey]
+				if secret.Annotations == nil {
+					secret.Annotations = map[string]string{}
+				}
+				secret.Annotations[annotationWebhookCertRotated] = now.UTC().Format(time.RFC3339)
+			}
+			secret.Data = data
+			secret, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		}
+		if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+			secret, err = secrets.Get(ctx, c.config.Secret, metav1.GetOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to store webhook certificate: %w", err)
+		}
+		if pair, leaf = parseWebhookCert(secret); pair == nil {
+			return fmt.Errorf("webhook certificate secret %s/%s is invalid", c.config.Namespace, c.config.Secret)
+		}
+		klog.InfoS("Issued webhook certificate", "secret", c.config.Namespace+"/"+c.config.Secret, "expires", leaf.NotAfter)
+	}
+
+	if err := c.patchCABundle(ctx, webhookCABundle(secret, now)); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.current = pair
+	c.mu.Unlock()
+	return nil
+}
+
+// patchCABundle выставляет caBundle всем webhook'ам конфигурации. Прежний сертификат
+// убирается из caBundle первой проверкой после webhookCertRotationGrace.
+func (c *webhookCerts) patchCABundle(ctx context.Context, caBundle []byte) error {
+	configurations := c.h.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	configuration, err := configurations.Get(ctx, c.config.Configuration, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get mutating webhook configuration %s: %w", c.config.Configuration, err)
+	}
+	changed := false
+	for i := range configuration.Webhooks {
+		if !bytes.Equal(configuration.Webhooks[i].ClientConfig.CABundle, caBundle) {
+			configuration.Webhooks[i].ClientConfig.CABundle = caBundle
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if _, err := configurations.Update(ctx, configuration, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update caBundle of %s: %w", c.config.Configuration, err)
+	}
+	klog.InfoS("Updated webhook caBundle", "configuration", c.config.Configuration)
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWebhookCerts(t *testing.T) {
+	ctx := context.Background()
+	configuration := &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-healer"},
+		Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "pod-defaults.healing.kubernetes.io"}},
+	}
+	config := WebhookCertConfig{Enabled: true, Service: "pod-healer-webhook", Namespace: "pod-healer-system",
+		Secret: "pod-healer-webhook-cert", Configuration: "pod-healer", Validity: 90 * time.Hour}
+	healer, clientset, clock := newTestHealer(t, Config{}, configuration)
+
+	issued := func() (*corev1.Secret, []byte) {
+		t.Helper()
+		secret, err := clientset.CoreV1().Secrets(config.Namespace).Get(ctx, config.Secret, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get secret: %v", err)
+		}
+		configuration, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, "pod-healer", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get configuration: %v", err)
+		}
+		return secret, configuration.Webhooks[0].ClientConfig.CABundle
+	}
+	serves := func(certs *webhookCerts, certPEM string) bool {
+		t.Helper()
+		served, err := certs.getCertificate(nil)
+		if err != nil {
+			t.Fatalf("certificate must be served, got %v", err)
+		}
+		block, _ := pem.Decode([]byte(certPEM))
+		return bytes.Equal(served.Certificate[0], block.Bytes)
+	}
+
+	// Первая реплика выпускает сертификат и заполняет caBundle
+	certs := newWebhookCerts(healer, config)
+	if _, err := certs.getCertificate(nil); err == nil {
+		t.Fatalf("certificate must not be served before it is issued")
+	}
+	if err := certs.ensure(ctx); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	secret, caBundle := issued()
+	first := string(secret.Data[corev1.TLSCertKey])
+	if string(caBundle) != first {
+		t.Fatalf("caBundle must be the issued certificate")
+	}
+	_, leaf := parseWebhookCert(secret)
+	if err := leaf.VerifyHostname("pod-healer-webhook.pod-healer-system.svc"); err != nil {
+		t.Fatalf("certificate must cover the service name: %v", err)
+	}
+	if !serves(certs, first) {
+		t.Fatalf("issued certificate must be served")
+	}
+
+	// Вторая реплика берет сертификат из того же Secret'а, пока срок не подошел
+	clock.Step(30 * time.Hour)
+	other := newWebhookCerts(healer, config)
+	if err := other.ensure(ctx); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if secret, _ := issued(); string(secret.Data[corev1.TLSCertKey]) != first || !serves(other, first) {
+		t.Fatalf("certificate must be reused before two thirds of its validity")
+	}
+
+	// После двух третей срока сертификат перевыпускается, caBundle содержит оба сертификата,
+	// пока вторая реплика еще отдает прежний
+	clock.Step(31 * time.Hour)
+	if err := certs.ensure(ctx); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	secret, caBundle = issued()
+	renewed := string(secret.Data[corev1.TLSCertKey])
+	if renewed == first || !serves(certs, renewed) {
+		t.Fatalf("certificate must be renewed")
+	}
+	if string(caBundle) != renewed+first || !serves(other, first) {
+		t.Fatalf("caBundle must trust the renewed and the previous certificate during rotation")
+	}
+
+	// Вторая реплика переходит на новый сертификат при следующей проверке
+	clock.Step(webhookCertCheckInterval)
+	if err := other.ensure(ctx); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if _, caBundle := issued(); !serves(other, renewed) || string(caBundle) != renewed+first {
+		t.Fatalf("replica must reload the renewed certificate while caBundle keeps the previous one")
+	}
+
+	// После webhookCertRotationGrace прежний сертификат убирается из caBundle
+	clock.Step(webhookCertRotationGrace - webhookCertCheckInterval)
+	if err := certs.ensure(ctx); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if _, caBundle := issued(); string(caBundle) != renewed {
+		t.Fatalf("previous certificate must be dropped from caBundle after the rotation grace, got %d bytes", len(caBundle))
+	}
+}
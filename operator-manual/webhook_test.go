@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestDefaultsPatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		defaults    map[string]string
+		want        string
+	}{
+		{
+			// Без аннотаций добавлять ключи по одному нельзя: /metadata/annotations еще нет
+			name:     "pod without annotations",
+			defaults: map[string]string{"healing.kubernetes.io/max-restarts": "5", "healing.kubernetes.io/action": "evict"},
+			want: `[{"op":"add","path":"/metadata/annotations","value":` +
+				`{"healing.kubernetes.io/action":"evict","healing.kubernetes.io/max-restarts":"5"}}]`,
+		},
+		{
+			name:        "pod with annotations",
+			annotations: map[string]string{"team": "web"},
+			defaults:    map[string]string{"healing.kubernetes.io/max-restarts": "5", "healing.kubernetes.io/action": "evict"},
+			want: `[{"op":"add","path":"/metadata/annotations/healing.kubernetes.io~1action","value":"evict"},` +
+				`{"op":"add","path":"/metadata/annotations/healing.kubernetes.io~1max-restarts","value":"5"}]`,
+		},
+		{
+			name:        "tilde in key",
+			annotations: map[string]string{"team": "web"},
+			defaults:    map[string]string{"healing.kubernetes.io/a~b": "1"},
+			want:        `[{"op":"add","path":"/metadata/annotations/healing.kubernetes.io~1a~0b","value":"1"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Annotations: tt.annotations}}
+			patch, err := defaultsPatch(pod, tt.defaults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(patch) != tt.want {
+				t.Errorf("patch %s, want %s", patch, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeMutate(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Annotations: map[string]string{
+		podDefaultsPrefix + "max-restarts": "5",
+		podDefaultsPrefix + "action":       "evict",
+		"owner":                            "team-web",
+	}}}
+	plain := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "plain"}}
+	healer, _, _ := newTestHealer(t, Config{}, namespace, plain)
+
+	mutate := func(t *testing.T, namespace string, pod *corev1.Pod) *admissionv1.AdmissionResponse {
+		t.Helper()
+		raw, err := json.Marshal(pod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := json.Marshal(admissionv1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+			Request:  &admissionv1.AdmissionRequest{UID: "request-uid", Namespace: namespace, Object: runtime.RawExtension{Raw: raw}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		healer.serveMutate(recorder, httptest.NewRequest(http.MethodPost, "/mutate-pods", bytes.NewReader(body)))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("mutate answered %d: %s", recorder.Code, recorder.Body)
+		}
+		review := &admissionv1.AdmissionReview{}
+		if err := json.NewDecoder(recorder.Body).Decode(review); err != nil {
+			t.Fatal(err)
+		}
+		if review.Request != nil || review.Response == nil || review.Response.UID != "request-uid" || !review.Response.Allowed {
+			t.Fatalf("unexpected review %+v", review)
+		}
+		return review.Response
+	}
+
+	// Аннотация, заданная на Pod'е, не перезаписывается значением namespace'а
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{GenerateName: "web-",
+		Annotations: map[string]string{"healing.kubernetes.io/action": "delete"}}}
+	response := mutate(t, "default", pod)
+	if response.PatchType == nil || *response.PatchType != admissionv1.PatchTypeJSONPatch {
+		t.Fatalf("expected a JSON patch, got %+v", response)
+	}
+	var operations []jsonPatchOperation
+	if err := json.Unmarshal(response.Patch, &operations); err != nil {
+		t.Fatal(err)
+	}
+	want := jsonPatchOperation{Op: "add", Path: "/metadata/annotations/healing.kubernetes.io~1max-restarts", Value: "5"}
+	if len(operations) != 1 || operations[0] != want {
+		t.Errorf("operations %+v, want %+v", operations, want)
+	}
+
+	if response := mutate(t, "plain", &corev1.Pod{}); response.Patch != nil || response.PatchType != nil {
+		t.Errorf("namespace without defaults must not patch, got %s", response.Patch)
+	}
+	// Ошибки не блокируют создание Pod'а
+	if response := mutate(t, "missing", &corev1.Pod{}); response.Patch != nil {
+		t.Errorf("unknown namespace must not patch, got %s", response.Patch)
+	}
+
+	recorder := httptest.NewRecorder()
+	healer.serveMutate(recorder, httptest.NewRequest(http.MethodPost, "/mutate-pods", bytes.NewReader([]byte(`{}`))))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("review without a request answered %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
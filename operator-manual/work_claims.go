@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// labelWorkClaim отмечает Lease'ы, которыми реплики закрепляют за собой heal'ы
+	labelWorkClaim = "healing.kubernetes.io/claim"
+	// annotationClaimedWork - что закреплено Lease'ом, для kubectl get leases
+	annotationClaimedWork = "healing.kubernetes.io/claimed-work"
+
+	// Как часто удаляются истекшие Lease'ы
+	workClaimSweepInterval = 5 * time.Minute
+)
+
+// ActiveActiveConfig - работа нескольких активных реплик healer'а без лидера.
+// Все реплики следят за Pod'ами и принимают решения, а выполняет heal та, что первой
+// закрепила его Lease'ом в namespace'е --leader-election-namespace. Rate limiter
+// и бюджеты namespaces действуют в каждой реплике отдельно.
+type ActiveActiveConfig struct {
+	Enabled bool
+	// Identity - имя реплики в holderIdentity Lease'ов
+	Identity string
+	// ClaimDuration - сколько Lease закрепляет heal за репликой. Пока он не истек,
+	// другие реплики не лечат тот же Pod, даже если видят его еще зависшим.
+	ClaimDuration time.Duration
+}
+
+// ownerScopedActions - действия над владельцем Pod'а, а не над самим Pod'ом. Их heal'ы
+// закрепляются по UID владельца: иначе две реплики, взявшие разные Pod'ы одного
+// Deployment'а, перезапустили бы или масштабировали его дважды.
+var ownerScopedActions = map[HealingAction]bool{
+	ActionRolloutRestart: true,
+	ActionScale:          true,
+	ActionRollback:       true,
+	ActionSidecarRestart: true,
+	ActionOOMBump:        true,
+}
+
+func workClaimName(uid types.UID) string {
+	return "pod-healer-claim-" + string(uid)
+}
+
+// claimWork закрепляет работу над объектом uid за репликой. Возвращает false и
+// holderIdentity, если работу уже закрепила за собой другая реплика.
+func (h *PodHealer) claimWork(ctx context.Context, uid types.UID, work string) (bool, string, error) {
+	config := h.config.ActiveActive
+	leases := h.clientset.CoordinationV1().Leases(h.config.LeaderElection.Namespace)
+	now := metav1.NewMicroTime(h.clock.Now())
+	duration := int32(config.ClaimDuration / time.Second)
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       &config.Identity,
+		LeaseDurationSeconds: &duration,
+		AcquireTime:          &now,
+		RenewTime:            &now,
+	}
+
+	_, err := leases.Create(ctx, &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        workClaimName(uid),
+			Labels:      map[string]string{labelWorkClaim: "true", "app.kubernetes.io/managed-by": eventComponent},
+			Annotations: map[string]string{annotationClaimedWork: work},
+		},
+		Spec: spec,
+	}, metav1.CreateOptions{})
+	if err == nil {
+		return true, config.Identity, nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return false, "", err
+	}
+
+	lease, err := leases.Get(ctx, workClaimName(uid), metav1.GetOptions{})
+	if err != nil {
+		return false, "", err
+	}
+	holder := ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	if holder != config.Identity && !claimExpired(lease, now.Time) {
+		return false, holder, nil
+	}
+
+	// Истекший Lease перехватывается через resourceVersion: из двух реплик обновит его одна
+	lease.Spec = spec
+	lease.Annotations = map[string]string{annotationClaimedWork: work}
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		if apierrors.IsConflict(err) {
+			return false, holder, nil
+		}
+		return false, "", err
+	}
+	return true, config.Identity, nil
+}
+
+func claimExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return !now.Before(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// claimHeal закрепляет heal Pod'а или, для ownerScopedActions, его владельца за репликой.
+// Вне active-active режима всегда успешно.
+func (h *PodHealer) claimHeal(ctx context.Context, decision *healingDecision) bool {
+	if !h.config.ActiveActive.Enabled {
+		return true
+	}
+	pod := decision.Pod
+	uid, work := pod.UID, fmt.Sprintf("%s of pod %s/%s in cluster %s", decision.Action, pod.Namespace, pod.Name, h.cluster)
+	if owner := decision.Owner; owner != nil && ownerScopedActions[decision.Action] {
+		uid, work = owner.Object.GetUID(), fmt.Sprintf("%s of %s in cluster %s", decision.Action, owner, h.cluster)
+	}
+	claimed, holder, err := h.claimWork(ctx, uid, work)
+	if err != nil {
+		klog.ErrorS(err, "Failed to claim heal", "cluster", h.cluster, "namespace", pod.Namespace, "pod", pod.Name)
+		return false
+	}
+	if !claimed {
+		klog.V(2).InfoS("Heal is claimed by another replica", "cluster", h.cluster,
+			"namespace", pod.Namespace, "pod", pod.Name, "holder", holder)
+	}
+	return claimed
+}
+
+// sweepWorkClaims удаляет истекшие Lease'ы. Precondition по resourceVersion
+// не дает удалить Lease, который другая реплика только что перехватила.
+func (h *PodHealer) sweepWorkClaims(ctx context.Context) {
+	leases := h.clientset.CoordinationV1().Leases(h.config.LeaderElection.Namespace)
+	list, err := leases.List(ctx, metav1.ListOptions{LabelSelector: labelWorkClaim + "=true"})
+	if err != nil {
+		klog.ErrorS(err, "Failed to list work claims", "cluster", h.cluster)
+		return
+	}
+	now := h.clock.Now()
+	for i := range list.Items {
+		lease := &list.Items[i]
+		if !claimExpired(lease, now) {
+			continue
+		}
+		resourceVersion := lease.ResourceVersion
+		err := leases.Delete(ctx, lease.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{ResourceVersion: &resourceVersion},
+		})
+		if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+			klog.ErrorS(err, "Failed to delete expired work claim", "cluster", h.cluster, "lease", lease.Name)
+		}
+	}
+}